@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	defaultCartBackupsDir     = "cart-backups"
+	defaultCartBackupKeep     = 10
+	defaultCartBackupInterval = time.Hour
+	cartBackupPrefix          = "cart-"
+	cartBackupSuffix          = ".json"
+	cartBackupTimeFormat      = "20060102-150405.000"
+	cartBackupReasonScheduled = "scheduled"
+	cartBackupReasonRestore   = "restore_backup"
+)
+
+// cartBackupNamePattern matches the names Create gives backups, so
+// restore_backup cannot be pointed at any other file.
+var cartBackupNamePattern = regexp.MustCompile(`^cart-\d{8}-\d{6}\.\d{3}-[a-z_]+\.json$`)
+
+// cartBackups is nil when backups are disabled, as in most tests.
+var cartBackups *CartBackups
+
+// cartBackupsDir is where backups go: CART_BACKUP_DIR, or a directory next
+// to the cart file. It is kept apart from the cart file and its lock.
+func cartBackupsDir(cartPath string) string {
+	if path := os.Getenv("CART_BACKUP_DIR"); path != "" {
+		return path
+	}
+	if cartPath == "" {
+		cartPath = defaultCartFile
+	}
+	return filepath.Join(filepath.Dir(cartPath), defaultCartBackupsDir)
+}
+
+// CartBackups keeps the newest copies of the carts, snapshots and budgets
+// as cart-<time>-<reason>.json files in one directory.
+type CartBackups struct {
+	dir  string
+	keep int
+	// mutex serializes writing and pruning.
+	mutex sync.Mutex
+	// last is the content of the newest backup, so scheduled backups of
+	// carts that did not change are skipped.
+	last []byte
+	now  func() time.Time
+}
+
+func NewCartBackups(dir string, keep int) *CartBackups {
+	return &CartBackups{dir: dir, keep: keep, now: time.Now}
+}
+
+// CartBackup describes one backup file.
+type CartBackup struct {
+	Name      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+// Create writes the current carts to a new backup named after reason and
+// prunes the oldest backups past the limit. It returns the backup name.
+func (b *CartBackups) Create(reason string) (string, error) {
+	data, err := encodeCartFile()
+	if err != nil {
+		return "", err
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	name := cartBackupPrefix + b.now().Format(cartBackupTimeFormat) + "-" + reason + cartBackupSuffix
+	if err := writeFileAtomic(filepath.Join(b.dir, name), cartCipher.seal(data)); err != nil {
+		return "", err
+	}
+	b.last = data
+	return name, b.pruneLocked()
+}
+
+func (b *CartBackups) pruneLocked() error {
+	backups, err := b.listLocked()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, backup := range backups[min(b.keep, len(backups)):] {
+		if err := os.Remove(filepath.Join(b.dir, backup.Name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to prune backup %s: %w", backup.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// List returns the backups, newest first.
+func (b *CartBackups) List() ([]CartBackup, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.listLocked()
+}
+
+func (b *CartBackups) listLocked() ([]CartBackup, error) {
+	entries, err := os.ReadDir(b.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var backups []CartBackup
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !cartBackupNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		stamp := strings.TrimPrefix(entry.Name(), cartBackupPrefix)[:len(cartBackupTimeFormat)]
+		createdAt, err := time.ParseInLocation(cartBackupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, CartBackup{Name: entry.Name(), Size: info.Size(), CreatedAt: createdAt})
+	}
+	// The names start with the time, so they sort chronologically.
+	slices.SortFunc(backups, func(a, b CartBackup) int { return strings.Compare(b.Name, a.Name) })
+	return backups, nil
+}
+
+// Read decodes a backup by its file name.
+func (b *CartBackups) Read(name string) (cartFile, error) {
+	if !cartBackupNamePattern.MatchString(name) {
+		return cartFile{}, fmt.Errorf("backup %q does not exist, use list_backups to see backups", name)
+	}
+	data, err := os.ReadFile(filepath.Join(b.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return cartFile{}, fmt.Errorf("backup %q does not exist, use list_backups to see backups", name)
+	}
+	if err != nil {
+		return cartFile{}, fmt.Errorf("failed to read backup %s: %w", name, err)
+	}
+	if data, err = cartCipher.open(data); err != nil {
+		return cartFile{}, fmt.Errorf("failed to decrypt backup %s: %w", name, err)
+	}
+	file, err := decodeCartFile(data)
+	if err != nil {
+		return cartFile{}, fmt.Errorf("backup %s is corrupt: %w", name, err)
+	}
+	return file, nil
+}
+
+// StartPeriodic backs the carts up every interval until stop is closed,
+// skipping the backup when nothing changed since the previous one.
+func (b *CartBackups) StartPeriodic(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if data, err := encodeCartFile(); err == nil && b.unchanged(data) {
+					continue
+				}
+				if _, err := b.Create(cartBackupReasonScheduled); err != nil {
+					slog.Error("scheduled cart backup failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+func (b *CartBackups) unchanged(data []byte) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.last != nil && bytes.Equal(b.last, data)
+}
+
+// backupBeforeChange backs the carts up ahead of a destructive tool call. A
+// failed backup is logged but does not block the call. Calls on the carts of
+// a session are not backed up, since backups hold the global carts.
+func backupBeforeChange(ctx context.Context, reason string) {
+	if cartBackups == nil || sessionScoped(ctx) {
+		return
+	}
+	name, err := cartBackups.Create(reason)
+	if err != nil {
+		slog.ErrorContext(ctx, "cart backup failed", "reason", reason, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "cart backed up", "reason", reason, "backup", name)
+}
+
+func handleListBackups(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if sessionScoped(ctx) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: errSessionScopeUnsupported.Error()},
+			},
+		}, nil
+	}
+	if cartBackups == nil {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "💾 Резервные копии корзины отключены (CART_BACKUP_KEEP=0)"},
+			},
+		}, nil
+	}
+	backups, err := cartBackups.List()
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if len(backups) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "💾 Резервных копий корзины пока нет"},
+			},
+		}, nil
+	}
+
+	lines := make([]string, 0, len(backups))
+	for i, backup := range backups {
+		lines = append(lines, fmt.Sprintf("%d. %s — %s, %d байт", i+1, backup.Name, backup.CreatedAt.Format("2006-01-02 15:04:05"), backup.Size))
+	}
+	result := fmt.Sprintf(`💾 Резервные копии корзины (новые сверху, хранится не больше %d):
+
+%s
+
+💡 Используйте restore_backup с именем файла, чтобы вернуть корзины из копии`,
+		cartBackups.keep, strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleRestoreBackup(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if sessionScoped(ctx) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: errSessionScopeUnsupported.Error()},
+			},
+		}, nil
+	}
+	if cartBackups == nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "cart backups are disabled (CART_BACKUP_KEEP=0)"},
+			},
+		}, nil
+	}
+	args, _ := request.Params.Arguments.(map[string]any)
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+
+	file, err := cartBackups.Read(name)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	// The carts being replaced get a backup of their own, so the restore
+	// can itself be reverted with restore_backup.
+	previous, err := cartBackups.Create(cartBackupReasonRestore)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("restore aborted, could not back up the current carts first: %v", err)},
+			},
+		}, nil
+	}
+
+	if err := s.restoreCarts(ctx, &file); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("restore failed, the carts are kept as backed up in %s: %v", previous, err)},
+			},
+		}, nil
+	}
+
+	lines := len(file.Items)
+	for _, items := range file.Carts {
+		lines += len(items)
+	}
+	slog.InfoContext(ctx, "cart backup restored", "backup", name, "carts", len(file.Carts)+1, "lines", lines, "previous", previous)
+
+	result := fmt.Sprintf(`♻️ Корзины восстановлены из резервной копии %s
+
+🛒 Корзин: %d
+📦 Позиций: %d
+📸 Снимков: %d
+
+💡 Прежнее состояние сохранено в копию %s — её можно вернуть тем же restore_backup`,
+		name, len(file.Carts)+1, lines, len(file.Snapshots), previous)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+// restoreCarts replaces the carts and budgets of the store with the ones in
+// file, deleting the carts the backup does not have, and then loads its
+// snapshots and versions.
+func (s *Server) restoreCarts(ctx context.Context, file *cartFile) error {
+	backup := maps.Clone(file.Carts)
+	if backup == nil {
+		backup = make(map[string][]*CartItem)
+	}
+	backup[defaultCartName] = file.Items
+
+	names, err := s.store.Carts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, kept := backup[name]; !kept && name != defaultCartName {
+			if _, err := s.store.DeleteCart(ctx, name, true); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(backup)) {
+		if validateCartName(name) != nil {
+			continue
+		}
+		if !slices.Contains(names, name) {
+			if err := s.store.CreateCart(ctx, name); err != nil {
+				return err
+			}
+		}
+		err := s.update(ctx, name, func(c *Cart) error {
+			c.load(backup[name])
+			c.SetBudget(file.Budgets[name])
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cartSnapshots.load(file.Snapshots)
+	cartVersions.load(file.Versions)
+	persistCart(s.persistence)
+	return nil
+}
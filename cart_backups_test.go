@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// useCartBackups enables backups into a temporary directory with a clock
+// that advances a second per backup.
+func useCartBackups(t *testing.T, keep int) *CartBackups {
+	t.Helper()
+	backups := NewCartBackups(t.TempDir(), keep)
+	clock := time.Date(2025, 3, 1, 10, 0, 0, 0, time.Local)
+	backups.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	prev := cartBackups
+	cartBackups = backups
+	t.Cleanup(func() { cartBackups = prev })
+	return backups
+}
+
+func TestCartBackupsPrune(t *testing.T) {
+	resetCarts(t)
+	t.Cleanup(func() { resetCarts(t) })
+	backups := useCartBackups(t, 3)
+
+	var names []string
+	for range 5 {
+		name, err := backups.Create(cartBackupReasonScheduled)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		names = append(names, name)
+	}
+	os.WriteFile(filepath.Join(backups.dir, "notes.txt"), []byte("not a backup"), 0o644)
+
+	listed, err := backups.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var got []string
+	for _, backup := range listed {
+		got = append(got, backup.Name)
+	}
+	if want := []string{names[4], names[3], names[2]}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("List() = %v, want the three newest backups %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(backups.dir, "notes.txt")); err != nil {
+		t.Errorf("pruning removed a file that is not a backup: %v", err)
+	}
+
+	for _, name := range []string{"../cart.json", "notes.txt", names[0]} {
+		if _, err := backups.Read(name); err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("Read(%q) error = %v, want a missing backup", name, err)
+		}
+	}
+}
+
+func TestRestoreBackupAfterClear(t *testing.T) {
+	resetCarts(t)
+	t.Cleanup(func() { resetCarts(t) })
+	backups := useCartBackups(t, 10)
+	ctx := context.Background()
+
+	cart.load([]*CartItem{{ID: "kettle", Title: "Чайник", Price: "2 990 ₽", Quantity: 2}})
+	call := func(handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) string {
+		t.Helper()
+		var request mcp.CallToolRequest
+		request.Params.Arguments = args
+		result, err := handler(ctx, request)
+		if err != nil || result.IsError {
+			t.Fatalf("tool call error = %v, result = %s", err, toolResultText(result))
+		}
+		return toolResultText(result)
+	}
+
+	srv := NewServer(NewMemoryCartStore(carts), nil)
+	call(srv.handleClearCart, map[string]any{"confirm": true})
+	if len(getCart()) != 0 {
+		t.Fatal("clear_cart left items in the cart")
+	}
+	listed, _ := backups.List()
+	if len(listed) != 1 || !strings.HasSuffix(listed[0].Name, "-clear_cart.json") {
+		t.Fatalf("backups after clear_cart = %v, want one clear_cart backup", listed)
+	}
+	if text := call(handleListBackups, nil); !strings.Contains(text, listed[0].Name) {
+		t.Errorf("list_backups does not show %s:\n%s", listed[0].Name, text)
+	}
+
+	text := call(srv.handleRestoreBackup, map[string]any{"name": listed[0].Name})
+	if items := getCart(); len(items) != 1 || items[0].ID != "kettle" || items[0].Quantity != 2 {
+		t.Errorf("cart after restore_backup = %v, want the kettle × 2 back", items)
+	}
+	listed, _ = backups.List()
+	if len(listed) != 2 || !strings.HasSuffix(listed[0].Name, "-restore_backup.json") || !strings.Contains(text, listed[0].Name) {
+		t.Errorf("backups after restore_backup = %v, want the emptied carts saved first and named in:\n%s", listed, text)
+	}
+}
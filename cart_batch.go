@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxBatchConcurrency caps the entries of a batch_add_to_cart call that are
+// added at once; the store serializes the writes to each cart anyway.
+const maxBatchConcurrency = 4
+
+// batchEntryResult is the outcome of one batch_add_to_cart entry.
+type batchEntryResult struct {
+	ID       string
+	Title    string
+	Count    int
+	Quantity int
+	// Warning flags a price that could not be parsed.
+	Warning string
+	Err     error
+}
+
+// parseBatchItems accepts the items as an array or as a string holding a
+// JSON array, which some clients send instead.
+func parseBatchItems(value any) ([]any, error) {
+	if data, ok := value.(string); ok {
+		var items []any
+		if err := json.Unmarshal([]byte(data), &items); err != nil {
+			return nil, fmt.Errorf("items parameter must be a JSON array: %w", err)
+		}
+		value = items
+	}
+	items, ok := value.([]any)
+	if !ok || len(items) == 0 || len(items) > maxBatchItems {
+		return nil, fmt.Errorf("items parameter is required and must be an array of 1 to %d items", maxBatchItems)
+	}
+	return items, nil
+}
+
+// addBatchEntry adds one entry with the checks add_to_cart makes. lines is
+// the cart before the batch, used to match entries by link.
+func (s *Server) addBatchEntry(ctx context.Context, cartName string, lines []*CartItem, raw any) batchEntryResult {
+	itemArgs, ok := raw.(map[string]any)
+	if !ok {
+		return batchEntryResult{Err: errors.New("entry must be an object")}
+	}
+	input, err := parseCartItemInput(itemArgs)
+	if err != nil {
+		return batchEntryResult{ID: input.ID, Err: err}
+	}
+	itemID := cartLineID(lines, input.ID, input.Link)
+	result := batchEntryResult{ID: itemID, Title: input.Title, Count: input.Quantity, Warning: input.priceWarning()}
+
+	existing, exists, err := s.store.Get(ctx, cartName, itemID)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if !exists && input.Title == "" {
+		result.Err = errors.New("title parameter is required when adding a new item to the cart")
+		return result
+	}
+	if exists {
+		result.Title = existing.Title
+	}
+
+	var image string
+	if found, ok := productRegistry.Get(itemID); ok {
+		image = found.Image()
+	}
+	result.Quantity, result.Err = s.store.Add(ctx, cartName, CartItem{
+		ID:          itemID,
+		Title:       input.Title,
+		Link:        input.Link,
+		Price:       input.Price,
+		Shop:        input.Shop,
+		Description: input.Description,
+		Image:       image,
+	}, input.Quantity)
+	return result
+}
+
+func (s *Server) handleBatchAddToCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	rawItems, err := parseBatchItems(args["items"])
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	lines, err := s.store.List(ctx, cartName)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	results := make([]batchEntryResult, len(rawItems))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxBatchConcurrency)
+	for i, raw := range rawItems {
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				results[i] = batchEntryResult{Err: err}
+				return err
+			}
+			results[i] = s.addBatchEntry(gctx, cartName, lines, raw)
+			return nil
+		})
+	}
+	// Entries fail on their own; only a cancelled call stops the batch.
+	if err := g.Wait(); err != nil {
+		slog.WarnContext(ctx, "batch add interrupted", "cart", cartName, "error", err)
+	}
+
+	var added, failed []string
+	for i, result := range results {
+		if result.Err != nil {
+			failed = append(failed, fmt.Sprintf("• [%d] %s", i, result.Err))
+			continue
+		}
+		added = append(added, fmt.Sprintf("• [%d] %s +%d, в корзине: %d (ID: %s)%s", i, result.Title, result.Count, result.Quantity, result.ID, result.Warning))
+	}
+	slog.InfoContext(ctx, "cart batch added", "cart", cartName, "items", len(results), "added", len(added), "failed", len(failed))
+
+	text := fmt.Sprintf("✅ Добавлено в корзину%s: %d из %d", cartLabel(cartName), len(added), len(results))
+	if len(added) > 0 {
+		text += "\n\n" + strings.Join(added, "\n") + s.budgetWarning(ctx, cartName)
+	}
+	if len(failed) > 0 {
+		text += fmt.Sprintf("\n\n❌ Не добавлено: %d\n%s", len(failed), strings.Join(failed, "\n"))
+	}
+	if len(added) > 0 {
+		text += "\n\n💡 Используйте view_cart для просмотра корзины"
+	}
+
+	return &mcp.CallToolResult{
+		IsError: len(added) == 0,
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: text},
+		},
+	}, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestHandleBatchAddToCart(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		items     any
+		wantError bool
+		wantText  []string
+		wantLines map[string]int
+	}{
+		{
+			name: "partial success",
+			items: []any{
+				map[string]any{"item_id": "kettle-000000001", "title": "Чайник", "price": "2 990 ₽", "quantity": float64(2)},
+				"not an object",
+				map[string]any{"item_id": "mug-000000000001"},
+				map[string]any{"item_id": "kettle-000000001", "title": "Чайник"},
+				map[string]any{"item_id": "spoon-0000000001", "title": "Ложка", "quantity": float64(1000)},
+			},
+			wantText: []string{
+				"Добавлено в корзину «home»: 2 из 5",
+				"[1] entry must be an object",
+				"[2] title parameter is required",
+				"[4] quantity must be between 1 and",
+				"Не добавлено: 3",
+			},
+			wantLines: map[string]int{"kettle-000000001": 3},
+		},
+		{
+			name:      "JSON string",
+			items:     `[{"item_id": "mug-000000000001", "title": "Кружка"}]`,
+			wantText:  []string{"1 из 1", "[0] Кружка +1, в корзине: 1"},
+			wantLines: map[string]int{"mug-000000000001": 1},
+		},
+		{
+			name:      "nothing added",
+			items:     []any{map[string]any{"item_id": "mug-000000000001"}},
+			wantError: true,
+			wantText:  []string{"0 из 1"},
+			wantLines: map[string]int{},
+		},
+		{name: "empty batch", items: []any{}, wantError: true, wantText: []string{"array of 1 to"}},
+		{name: "malformed JSON", items: `[{`, wantError: true, wantText: []string{"must be a JSON array"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := NewMemoryCartStore(newTestCartRegistry("home"))
+			var request mcp.CallToolRequest
+			request.Params.Arguments = map[string]any{"cart": "home", "items": tt.items}
+			result, err := NewServer(store, nil).handleBatchAddToCart(t.Context(), request)
+			if err != nil {
+				t.Fatalf("handleBatchAddToCart() error = %v", err)
+			}
+			text := toolResultText(result)
+			if result.IsError != tt.wantError {
+				t.Errorf("IsError = %t, want %t; text: %s", result.IsError, tt.wantError, text)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(text, want) {
+					t.Errorf("result text does not contain %q:\n%s", want, text)
+				}
+			}
+			if tt.wantLines == nil {
+				return
+			}
+			lines, _ := store.List(t.Context(), "home")
+			got := make(map[string]int)
+			for _, line := range lines {
+				got[line.ID] = line.Quantity
+			}
+			if len(got) != len(tt.wantLines) {
+				t.Errorf("cart = %v, want %v", got, tt.wantLines)
+			}
+			for id, quantity := range tt.wantLines {
+				if got[id] != quantity {
+					t.Errorf("cart = %v, want %v", got, tt.wantLines)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleAddItems(t *testing.T) {
+	t.Parallel()
+
+	const (
+		kettleLink = "https://example.com/add-items/kettle"
+		imageLink  = "https://example.com/add-items/mug"
+	)
+	var found SearchItem
+	if err := json.Unmarshal([]byte(`{"link": "`+imageLink+`", "pagemap": {"cse_image": [{"src": "https://example.com/mug.jpg"}]}}`), &found); err != nil {
+		t.Fatal(err)
+	}
+	productRegistry.Add([]SearchItem{found})
+	mugID := generateItemID(found)
+
+	tests := []struct {
+		name      string
+		items     []any
+		wantText  []string
+		wantLines map[string]int
+		wantImage string
+	}{
+		{
+			name: "another URL of a line in the cart",
+			items: []any{
+				map[string]any{"item_id": "kettle-copy", "title": "Чайник", "link": kettleLink + "/?utm_source=ya"},
+			},
+			wantText:  []string{"Объединено с уже имеющимися: 1", "в корзине: 2 (ID: kettle)"},
+			wantLines: map[string]int{"kettle": 2},
+		},
+		{
+			name: "two URLs of one page in the batch",
+			items: []any{
+				map[string]any{"item_id": "lamp-1", "title": "Лампа", "link": "https://example.com/add-items/lamp"},
+				map[string]any{"item_id": "lamp-2", "title": "Лампа", "link": "http://EXAMPLE.com/add-items/lamp#photos", "quantity": float64(2)},
+			},
+			wantText:  []string{"Новых позиций: 1", "в корзине: 3 (ID: lamp-1)"},
+			wantLines: map[string]int{"kettle": 1, "lamp-1": 3},
+		},
+		{
+			name:      "image from the search results",
+			items:     []any{map[string]any{"item_id": mugID, "title": "Кружка", "link": imageLink}},
+			wantLines: map[string]int{"kettle": 1, mugID: 1},
+			wantImage: "https://example.com/mug.jpg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := NewMemoryCartStore(newTestCartRegistry("home"))
+			if _, err := store.Add(t.Context(), "home", CartItem{ID: "kettle", Title: "Чайник", Link: kettleLink}, 1); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			var request mcp.CallToolRequest
+			request.Params.Arguments = map[string]any{"cart": "home", "items": tt.items}
+			result, err := NewServer(store, nil).handleAddItems(t.Context(), request)
+			if err != nil || result.IsError {
+				t.Fatalf("handleAddItems() = %s, %v", toolResultText(result), err)
+			}
+			text := toolResultText(result)
+			for _, want := range tt.wantText {
+				if !strings.Contains(text, want) {
+					t.Errorf("result text does not contain %q:\n%s", want, text)
+				}
+			}
+
+			lines, _ := store.List(t.Context(), "home")
+			got := make(map[string]int)
+			for _, line := range lines {
+				got[line.ID] = line.Quantity
+			}
+			if !maps.Equal(got, tt.wantLines) {
+				t.Errorf("cart = %v, want %v", got, tt.wantLines)
+			}
+			if tt.wantImage != "" {
+				if item, _, _ := store.Get(t.Context(), "home", mugID); item.Image != tt.wantImage {
+					t.Errorf("image = %q, want %q", item.Image, tt.wantImage)
+				}
+			}
+		})
+	}
+}
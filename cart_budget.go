@@ -0,0 +1,245 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Budget is the spending limit of a cart. A zero Amount means no budget.
+type Budget struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+func (b Budget) set() bool {
+	return b.Amount > 0
+}
+
+func (b Budget) String() string {
+	return Price{Amount: b.Amount, Currency: b.Currency}.Normalized()
+}
+
+// Budget returns the budget of c.
+func (c *Cart) Budget() Budget {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.budget
+}
+
+// SetBudget replaces the budget of c; a zero budget clears it.
+func (c *Cart) SetBudget(budget Budget) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.budget = budget
+}
+
+// Budgets returns the budgets of every cart that has one, keyed by cart name.
+func (r *CartRegistry) Budgets() map[string]Budget {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make(map[string]Budget)
+	for name, c := range r.carts {
+		if budget := c.Budget(); budget.set() {
+			result[name] = budget
+		}
+	}
+	return result
+}
+
+// loadBudgets assigns budgets read from disk to carts that exist.
+func (r *CartRegistry) loadBudgets(budgets map[string]Budget) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for name, c := range r.carts {
+		c.SetBudget(budgets[name])
+	}
+}
+
+// priceTotals sums parsed prices per currency and counts items without one.
+func priceTotals(items []*CartItem) (totals map[string]float64, unpriced int) {
+	totals = make(map[string]float64)
+	for _, item := range items {
+		if item.PriceParsed {
+			totals[item.PriceCurrency] += item.PriceAmount * float64(item.Quantity)
+		} else {
+			unpriced++
+		}
+	}
+	return totals, unpriced
+}
+
+// budgetSpent returns the cart total in the budget currency. Other
+// currencies are converted when DISPLAY_CURRENCY set up a converter and are
+// reported in skipped otherwise.
+func budgetSpent(totals map[string]float64, budget Budget) (spent float64, skipped []string) {
+	for currency, amount := range totals {
+		switch {
+		case currency == budget.Currency:
+			spent += amount
+		case currencyConverter != nil && currency != "":
+			value, err := currencyConverter.Convert(amount, currency, budget.Currency)
+			if err != nil {
+				skipped = append(skipped, currency)
+				continue
+			}
+			spent += value
+		default:
+			skipped = append(skipped, cmp.Or(currency, "без валюты"))
+		}
+	}
+	return spent, skipped
+}
+
+// budgetLine describes how the totals compare with budget, or is empty when
+// the cart has no budget.
+func budgetLine(totals map[string]float64, budget Budget) string {
+	if !budget.set() {
+		return ""
+	}
+	spent, skipped := budgetSpent(totals, budget)
+	spentText := Price{Amount: spent, Currency: budget.Currency}.Normalized()
+
+	var line string
+	if spent > budget.Amount {
+		overshoot := Price{Amount: spent - budget.Amount, Currency: budget.Currency}.Normalized()
+		line = fmt.Sprintf("🚨 Бюджет %s превышен на %s (в корзине %s)", budget, overshoot, spentText)
+	} else {
+		left := Price{Amount: budget.Amount - spent, Currency: budget.Currency}.Normalized()
+		line = fmt.Sprintf("🎯 Бюджет: %s, в корзине %s, осталось %s", budget, spentText, left)
+	}
+	if len(skipped) > 0 {
+		line += fmt.Sprintf(" (без учёта сумм в %s)", strings.Join(skipped, ", "))
+	}
+	return line
+}
+
+// budgetWarning is the add_to_cart notice shown when c is over its budget.
+func budgetWarning(c *Cart) string {
+	budget := c.Budget()
+	if !budget.set() {
+		return ""
+	}
+	totals, _ := priceTotals(c.Snapshot())
+	if spent, _ := budgetSpent(totals, budget); spent <= budget.Amount {
+		return ""
+	}
+	return "\n" + budgetLine(totals, budget)
+}
+
+func (s *Server) handleSetBudget(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	amount, ok := args["amount"].(float64)
+	if !ok || amount < 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "amount parameter is required and must be a non-negative number"},
+			},
+		}, nil
+	}
+
+	currency := "RUB"
+	if value, _ := args["currency"].(string); strings.TrimSpace(value) != "" {
+		value = strings.ToUpper(strings.TrimSpace(value))
+		currency = cmp.Or(currencyAliases[value], value)
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	budget := Budget{Amount: amount, Currency: currency}
+	if amount == 0 {
+		budget = Budget{}
+	}
+	var items []*CartItem
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		c.SetBudget(budget)
+		items = c.Snapshot()
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart budget set", "cart", cartName, "amount", budget.Amount, "currency", budget.Currency)
+
+	if !budget.set() {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🗑️ Бюджет корзины%s снят", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	totals, _ := priceTotals(items)
+	result := fmt.Sprintf("✅ Бюджет корзины%s установлен\n%s", cartLabel(cartName), budgetLine(totals, budget))
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleGetBudget(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	var budget Budget
+	var items []*CartItem
+	err = s.store.View(ctx, cartName, func(c *Cart) error {
+		budget, items = c.Budget(), c.Snapshot()
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	if !budget.set() {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("💼 У корзины%s нет бюджета\n\n💡 Задайте его через set_budget", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	totals, unpriced := priceTotals(items)
+	result := budgetLine(totals, budget)
+	if unpriced > 0 {
+		result += fmt.Sprintf("\n⚠️ %d товаров с нераспознанной ценой не учтены", unpriced)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cartEncryptionHeader starts every encrypted cart file. Plain cart files
+// are JSON and start with { or [, so the two cannot be confused. The header
+// is also authenticated with the ciphertext.
+const cartEncryptionHeader = "megamarket-cart-aes256gcm-v1\n"
+
+var (
+	errCartKeyMissing = errors.New("file is encrypted but no key provided")
+	errCartWrongKey   = errors.New("wrong key, or the file has been modified")
+)
+
+// cartCipher encrypts the cart file and its backups. It is nil when
+// CART_ENCRYPTION_KEY is unset and they are kept as plain JSON.
+var cartCipher *CartCipher
+
+// CartCipher seals the cart file with AES-256-GCM.
+type CartCipher struct {
+	aead cipher.AEAD
+}
+
+// parseCartEncryptionKey reads a base64 32-byte key. An empty value means no
+// encryption and returns a nil cipher.
+func parseCartEncryptionKey(value string) (*CartCipher, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("the key must be 32 bytes encoded as base64, generate one with: openssl rand -base64 32")
+	}
+	return NewCartCipher(key)
+}
+
+func NewCartCipher(key []byte) (*CartCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &CartCipher{aead: aead}, nil
+}
+
+// isEncryptedCart reports whether data starts with the encryption header.
+func isEncryptedCart(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(cartEncryptionHeader))
+}
+
+// seal encrypts data behind the header with a fresh nonce. A nil cipher
+// returns data unchanged.
+func (c *CartCipher) seal(data []byte) []byte {
+	if c == nil {
+		return data
+	}
+	out := make([]byte, len(cartEncryptionHeader), len(cartEncryptionHeader)+c.aead.NonceSize()+len(data)+c.aead.Overhead())
+	copy(out, cartEncryptionHeader)
+	nonce := make([]byte, c.aead.NonceSize())
+	rand.Read(nonce)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, data, []byte(cartEncryptionHeader))
+}
+
+// open returns the plain content of a file written by seal. Plain files are
+// returned as they are, so a key can be set on an existing cart file; it is
+// encrypted on the next save.
+func (c *CartCipher) open(data []byte) ([]byte, error) {
+	if !isEncryptedCart(data) {
+		return data, nil
+	}
+	if c == nil {
+		return nil, errCartKeyMissing
+	}
+	sealed := data[len(cartEncryptionHeader):]
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errCartWrongKey
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, []byte(cartEncryptionHeader))
+	if err != nil {
+		return nil, errCartWrongKey
+	}
+	return plain, nil
+}
+
+// rotateCartEncryption rewrites the cart file and its backups, decrypting
+// them with from and encrypting them with to. Either may be nil for plain
+// files, so this also turns encryption on or off. It returns the number of
+// files rewritten.
+func rotateCartEncryption(cartPath, backupsDir string, from, to *CartCipher) (int, error) {
+	paths := []string{cartPath}
+	entries, err := os.ReadDir(backupsDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && cartBackupNamePattern.MatchString(entry.Name()) {
+			paths = append(paths, filepath.Join(backupsDir, entry.Name()))
+		}
+	}
+
+	// Every file is decrypted before any is rewritten, so a wrong old key
+	// leaves them all as they were.
+	plain := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if plain[path], err = from.open(data); err != nil {
+			return 0, fmt.Errorf("failed to decrypt %s: %w; check CART_ENCRYPTION_OLD_KEY", path, err)
+		}
+	}
+	rotated := 0
+	for _, path := range paths {
+		data, ok := plain[path]
+		if !ok {
+			continue
+		}
+		if err := writeFileAtomic(path, to.seal(data)); err != nil {
+			return rotated, err
+		}
+		rotated++
+	}
+	return rotated, nil
+}
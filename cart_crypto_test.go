@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testCartCipher(t *testing.T, fill byte) *CartCipher {
+	t.Helper()
+	c, err := NewCartCipher(bytes.Repeat([]byte{fill}, 32))
+	if err != nil {
+		t.Fatalf("NewCartCipher() error = %v", err)
+	}
+	return c
+}
+
+// useCartCipher encrypts the cart file with c for the rest of the test.
+func useCartCipher(t *testing.T, c *CartCipher) {
+	t.Helper()
+	prev := cartCipher
+	cartCipher = c
+	t.Cleanup(func() { cartCipher = prev })
+}
+
+func TestParseCartEncryptionKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		value      string
+		wantCipher bool
+		wantErr    bool
+	}{
+		{name: "unset", value: ""},
+		{name: "valid", value: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)), wantCipher: true},
+		{name: "surrounding whitespace", value: " " + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)) + "\n", wantCipher: true},
+		{name: "16 bytes", value: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 16)), wantErr: true},
+		{name: "not base64", value: "not a key!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseCartEncryptionKey(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCartEncryptionKey() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if (got != nil) != tt.wantCipher {
+				t.Errorf("parseCartEncryptionKey() cipher = %v, want one: %t", got, tt.wantCipher)
+			}
+		})
+	}
+}
+
+func TestCartCipherRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	c := testCartCipher(t, 1)
+	plain := []byte(`{"items": [{"id": "kettle", "title": "Чайник"}]}`)
+	sealed := c.seal(plain)
+	if !isEncryptedCart(sealed) || bytes.Contains(sealed, []byte("kettle")) {
+		t.Fatalf("seal() = %q, want the header followed by ciphertext", sealed)
+	}
+	if again := c.seal(plain); bytes.Equal(again, sealed) {
+		t.Error("seal() reused a nonce: two seals of the same data are identical")
+	}
+
+	got, err := c.open(sealed)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("open() = %q, %v, want %q", got, err, plain)
+	}
+	if got, err := c.open(plain); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("open(plain) = %q, %v, want the plain data back", got, err)
+	}
+	if got := (*CartCipher)(nil).seal(plain); !bytes.Equal(got, plain) {
+		t.Errorf("nil seal() = %q, want the plain data", got)
+	}
+}
+
+func TestCartCipherTamper(t *testing.T) {
+	t.Parallel()
+
+	c := testCartCipher(t, 1)
+	sealed := c.seal([]byte(`{"items": []}`))
+
+	tests := []struct {
+		name    string
+		data    func() []byte
+		cipher  *CartCipher
+		wantErr error
+	}{
+		{name: "ciphertext modified", data: func() []byte { return flipByte(sealed, len(sealed)-20) }, cipher: c, wantErr: errCartWrongKey},
+		{name: "tag modified", data: func() []byte { return flipByte(sealed, len(sealed)-1) }, cipher: c, wantErr: errCartWrongKey},
+		{name: "nonce modified", data: func() []byte { return flipByte(sealed, len(cartEncryptionHeader)) }, cipher: c, wantErr: errCartWrongKey},
+		{name: "truncated", data: func() []byte { return sealed[:len(cartEncryptionHeader)+4] }, cipher: c, wantErr: errCartWrongKey},
+		{name: "wrong key", data: func() []byte { return sealed }, cipher: testCartCipher(t, 2), wantErr: errCartWrongKey},
+		{name: "no key", data: func() []byte { return sealed }, wantErr: errCartKeyMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := tt.cipher.open(tt.data()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("open() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func flipByte(data []byte, i int) []byte {
+	out := bytes.Clone(data)
+	out[i] ^= 0x01
+	return out
+}
+
+func TestJSONCartFileEncrypted(t *testing.T) {
+	resetCarts(t)
+	t.Cleanup(func() { resetCarts(t) })
+	useCartCipher(t, testCartCipher(t, 1))
+
+	cart.load([]*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 2}})
+	path := filepath.Join(t.TempDir(), "cart.json")
+	if err := NewJSONCartFile(path).Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !isEncryptedCart(data) || bytes.Contains(data, []byte("kettle")) {
+		t.Fatalf("cart file = %q, want it encrypted", data)
+	}
+
+	resetCarts(t)
+	if err := NewJSONCartFile(path).Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if item, ok := cart.Get("kettle"); !ok || item.Quantity != 2 {
+		t.Errorf("kettle after encrypted restart = %+v, %v, want quantity 2", item, ok)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		cipher  *CartCipher
+		wantErr error
+	}{
+		{name: "no key", wantErr: errCartKeyMissing},
+		{name: "wrong key", cipher: testCartCipher(t, 2), wantErr: errCartWrongKey},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			useCartCipher(t, tt.cipher)
+			err := NewJSONCartFile(path).Load()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Load() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, statErr := os.Stat(path); statErr != nil {
+				t.Errorf("cart file was moved aside after %v", err)
+			}
+		})
+	}
+}
+
+func TestJSONCartFileEncryptsPlainFile(t *testing.T) {
+	resetCarts(t)
+	t.Cleanup(func() { resetCarts(t) })
+
+	path := filepath.Join(t.TempDir(), "cart.json")
+	if err := os.WriteFile(path, []byte(`{"items": [{"id": "mug", "title": "Кружка", "quantity": 1}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	useCartCipher(t, testCartCipher(t, 1))
+	if err := NewJSONCartFile(path).Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, ok := cart.Get("mug"); !ok {
+		t.Error("mug is missing after loading the plain file")
+	}
+	if data, _ := os.ReadFile(path); !isEncryptedCart(data) {
+		t.Errorf("cart file after Load() = %q, want it encrypted", data)
+	}
+}
+
+func TestRotateCartEncryption(t *testing.T) {
+	oldCipher, newCipher := testCartCipher(t, 1), testCartCipher(t, 2)
+	dir := t.TempDir()
+	cartPath := filepath.Join(dir, "cart.json")
+	backupsDir := filepath.Join(dir, defaultCartBackupsDir)
+	backupPath := filepath.Join(backupsDir, "cart-20250301-100000.000-clear_cart.json")
+	if err := os.MkdirAll(backupsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	plain := map[string][]byte{
+		cartPath:   []byte(`{"items": [{"id": "kettle"}]}`),
+		backupPath: []byte(`{"items": [{"id": "mug"}]}`),
+	}
+	for path, data := range plain {
+		if err := os.WriteFile(path, oldCipher.seal(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := rotateCartEncryption(cartPath, backupsDir, testCartCipher(t, 3), newCipher); !errors.Is(err, errCartWrongKey) {
+		t.Fatalf("rotateCartEncryption() with the wrong old key error = %v, want %v", err, errCartWrongKey)
+	}
+	for path, data := range plain {
+		if got, err := oldCipher.open(mustReadFile(t, path)); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s after a failed rotation = %q, %v, want it still under the old key", path, got, err)
+		}
+	}
+
+	rotated, err := rotateCartEncryption(cartPath, backupsDir, oldCipher, newCipher)
+	if err != nil || rotated != 2 {
+		t.Fatalf("rotateCartEncryption() = %d, %v, want 2 files", rotated, err)
+	}
+	for path, data := range plain {
+		sealed := mustReadFile(t, path)
+		if _, err := oldCipher.open(sealed); !errors.Is(err, errCartWrongKey) {
+			t.Errorf("%s still opens with the old key", path)
+		}
+		if got, err := newCipher.open(sealed); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s under the new key = %q, %v, want %q", path, got, err, data)
+		}
+	}
+
+	if _, err := rotateCartEncryption(cartPath, backupsDir, newCipher, nil); err != nil {
+		t.Fatalf("rotateCartEncryption() to plain error = %v", err)
+	}
+	if got := mustReadFile(t, cartPath); !strings.HasPrefix(string(got), "{") {
+		t.Errorf("cart file after decrypting = %q, want plain JSON", got)
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var (
+	errPriceUnparsed    = errors.New("current price could not be parsed")
+	errCurrencyMismatch = errors.New("current price and target price are in different currencies")
+)
+
+// Target returns the target price of the item; ok is false when none is set.
+func (item *CartItem) Target() (target Price, ok bool) {
+	return Price{Amount: item.TargetPrice, Currency: item.TargetCurrency}, item.TargetPrice > 0
+}
+
+// dealReached reports whether the current price of the item is at or below
+// its target. It fails when the comparison cannot be made, so that an item
+// with an unreadable price is reported instead of silently never matching.
+func dealReached(item *CartItem) (bool, error) {
+	target, ok := item.Target()
+	if !ok {
+		return false, nil
+	}
+	price, parsed := item.ParsedPrice()
+	if !parsed {
+		return false, errPriceUnparsed
+	}
+	if price.Currency != "" && target.Currency != "" && price.Currency != target.Currency {
+		return false, errCurrencyMismatch
+	}
+	return price.Amount <= target.Amount, nil
+}
+
+// formatTarget renders the target price lines of view_cart.
+func formatTarget(item *CartItem) string {
+	target, ok := item.Target()
+	if !ok {
+		return ""
+	}
+	line := "\n🎯 Целевая цена: " + target.Normalized()
+	reached, err := dealReached(item)
+	switch {
+	case errors.Is(err, errPriceUnparsed):
+		line += " — ⚠️ текущая цена не распознана, сравнить нельзя"
+	case errors.Is(err, errCurrencyMismatch):
+		line += " — ⚠️ текущая цена в другой валюте, сравнить нельзя"
+	case reached:
+		line += " — 🔥 цена достигнута!"
+	}
+	return line
+}
+
+// SetTargetPrice records the price the user is willing to pay for an item; a
+// zero amount clears it. It returns a copy of the updated item.
+func (c *Cart) SetTargetPrice(ctx context.Context, itemID string, target Price) (*CartItem, bool) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	item, exists := c.Items[itemID]
+	if !exists {
+		return nil, false
+	}
+	c.auditLocked("set_target_price", itemID)
+	item.TargetPrice = target.Amount
+	item.TargetCurrency = target.Currency
+	if target.Amount > 0 && target.Currency == "" {
+		item.TargetCurrency = item.PriceCurrency
+	}
+	if target.Amount <= 0 {
+		item.TargetPrice, item.TargetCurrency = 0, ""
+	}
+	item.UpdatedAt = c.now()
+	return item.clone(), true
+}
+
+func (s *Server) handleSetTargetPrice(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	itemID, _ := args["item_id"].(string)
+	itemID = strings.TrimSpace(itemID)
+	if itemID == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+
+	raw, ok := args["price"].(string)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: `price parameter is required, e.g. "9 990 ₽"; pass "0" to clear the target`},
+			},
+		}, nil
+	}
+	target, err := ParsePrice(raw)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("could not parse target price %q: %v", raw, err)},
+			},
+		}, nil
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var item *CartItem
+	var found bool
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		item, found = c.SetTargetPrice(ctx, itemID, target)
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if !found {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Item %s not found in cart%s", itemID, cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	if _, ok := item.Target(); !ok {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🗑️ Целевая цена снята\n📦 %s\n🆔 ID: %s", item.Title, item.ID)},
+			},
+		}, nil
+	}
+
+	result := fmt.Sprintf("🎯 Целевая цена установлена\n📦 %s\n💰 Текущая цена: %s%s\n🆔 ID: %s",
+		item.Title, item.Price, formatTarget(item), item.ID)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleListDeals(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	items, cartName, err := s.cartFromArgs(ctx, args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var deals, unknown []string
+	watched := 0
+	for _, item := range items {
+		target, ok := item.Target()
+		if !ok {
+			continue
+		}
+		watched++
+		reached, err := dealReached(item)
+		switch {
+		case err != nil:
+			unknown = append(unknown, fmt.Sprintf("• %s — цена %q, цель %s (ID: %s)", item.Title, item.Price, target.Normalized(), item.ID))
+		case reached:
+			deals = append(deals, fmt.Sprintf("• %s — %s при цели %s (ID: %s)", item.Title, item.Price, target.Normalized(), item.ID))
+		}
+	}
+
+	if watched == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🎯 В корзине%s нет товаров с целевой ценой\n\n💡 Задайте её через set_target_price", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	var result strings.Builder
+	if len(deals) > 0 {
+		result.WriteString(fmt.Sprintf("🔥 Цена достигла целевой (%d из %d):\n\n%s", len(deals), watched, strings.Join(deals, "\n")))
+	} else {
+		result.WriteString(fmt.Sprintf("🎯 Ни один из %d товаров пока не подешевел до целевой цены", watched))
+	}
+	if len(unknown) > 0 {
+		result.WriteString(fmt.Sprintf("\n\n⚠️ Не удалось сравнить с целевой ценой (%d): цена не распознана или в другой валюте\n%s", len(unknown), strings.Join(unknown, "\n")))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result.String()},
+		},
+	}, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// trackingParams are query parameters that only identify the ad or campaign a
+// visitor came from. Parameters starting with utm_ are dropped as well.
+var trackingParams = map[string]bool{
+	"yclid": true,
+	"gclid": true,
+}
+
+// canonicalLink reduces the variants under which a product page is reached to
+// one form: https, a lowercase host, no tracking parameters, no fragment and
+// no trailing slash. Links that do not parse as absolute URLs are only
+// trimmed.
+func canonicalLink(link string) string {
+	link = strings.TrimSpace(link)
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return link
+	}
+
+	u.Scheme = "https"
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment, u.RawFragment = "", ""
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+
+	query := u.Query()
+	for key := range query {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// cartLineID picks the cart line an addition goes to: the line with itemID
+// when there is one, otherwise a line for the same product page reached via
+// another URL, otherwise itemID itself.
+func cartLineID(items []*CartItem, itemID, link string) string {
+	for _, item := range items {
+		if item.ID == itemID {
+			return itemID
+		}
+	}
+	canonical := canonicalLink(link)
+	if canonical == "" {
+		return itemID
+	}
+	for _, item := range items {
+		if item.Link != "" && canonicalLink(item.Link) == canonical {
+			return item.ID
+		}
+	}
+	return itemID
+}
+
+// dedupedLine reports one line that absorbed duplicates in Dedupe.
+type dedupedLine struct {
+	Kept      *CartItem
+	MergedIDs []string
+}
+
+// Dedupe merges lines whose links are the same product page. The line added
+// first is kept and the others are folded into it like merge_carts does;
+// quantities are capped at config.MaxCartQuantity. The change can be undone.
+func (c *Cart) Dedupe(ctx context.Context) []dedupedLine {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	groups := make(map[string][]*CartItem)
+	for _, item := range c.Items {
+		if item.Link != "" {
+			link := canonicalLink(item.Link)
+			groups[link] = append(groups[link], item)
+		}
+	}
+
+	var ids []string
+	var duplicates [][]*CartItem
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			if !group[i].AddedAt.Equal(group[j].AddedAt) {
+				return group[i].AddedAt.Before(group[j].AddedAt)
+			}
+			return group[i].ID < group[j].ID
+		})
+		for _, item := range group {
+			ids = append(ids, item.ID)
+		}
+		duplicates = append(duplicates, group)
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	c.recordLocked("dedupe", ids...)
+
+	now := c.now()
+	result := make([]dedupedLine, 0, len(duplicates))
+	for _, group := range duplicates {
+		kept := group[0]
+		line := dedupedLine{}
+		for _, item := range group[1:] {
+			mergeCartLines(kept, item)
+			delete(c.Items, item.ID)
+			line.MergedIDs = append(line.MergedIDs, item.ID)
+		}
+		kept.Quantity = min(kept.Quantity, config.MaxCartQuantity)
+		kept.UpdatedAt = now
+		line.Kept = kept.clone()
+		result = append(result, line)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Kept.ID < result[j].Kept.ID })
+	return result
+}
+
+func (s *Server) handleDedupeCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var lines []dedupedLine
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		lines = c.Dedupe(ctx)
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart deduplicated", "cart", cartName, "lines", len(lines))
+	if len(lines) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("✅ В корзине%s нет повторяющихся товаров", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	var merged int
+	blocks := make([]string, 0, len(lines))
+	for _, line := range lines {
+		merged += len(line.MergedIDs)
+		blocks = append(blocks, fmt.Sprintf("• %s × %d (ID: %s) ← %s",
+			line.Kept.Title, line.Kept.Quantity, line.Kept.ID, strings.Join(line.MergedIDs, ", ")))
+	}
+	result := fmt.Sprintf(`🧹 Объединены повторяющиеся товары корзины%s: удалено строк %d
+
+%s
+
+💡 undo_cart вернёт корзину к прежнему виду`,
+		cartLabel(cartName), merged, strings.Join(blocks, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// lineChange is a line present on both sides of a diff whose quantity,
+// price or note differs.
+type lineChange struct {
+	Before *CartItem
+	After  *CartItem
+}
+
+// cartDiff describes how one list of cart lines turns into another.
+type cartDiff struct {
+	Added   []*CartItem
+	Removed []*CartItem
+	Changed []lineChange
+}
+
+func (d cartDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// diffCartItems compares two sets of lines by item ID. Every group is sorted
+// by title.
+func diffCartItems(before, after []*CartItem) cartDiff {
+	beforeByID := make(map[string]*CartItem, len(before))
+	for _, item := range before {
+		beforeByID[item.ID] = item
+	}
+	afterByID := make(map[string]*CartItem, len(after))
+	for _, item := range after {
+		afterByID[item.ID] = item
+	}
+
+	var diff cartDiff
+	for id, item := range afterByID {
+		previous, exists := beforeByID[id]
+		switch {
+		case !exists:
+			diff.Added = append(diff.Added, item)
+		case previous.Quantity != item.Quantity || previous.Price != item.Price || previous.Note != item.Note:
+			diff.Changed = append(diff.Changed, lineChange{Before: previous, After: item})
+		}
+	}
+	for id, item := range beforeByID {
+		if _, kept := afterByID[id]; !kept {
+			diff.Removed = append(diff.Removed, item)
+		}
+	}
+
+	sortCartItems(diff.Added, "title")
+	sortCartItems(diff.Removed, "title")
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return strings.ToLower(diff.Changed[i].After.Title) < strings.ToLower(diff.Changed[j].After.Title)
+	})
+	return diff
+}
+
+// format renders the diff grouped as added, removed and changed lines, with
+// item IDs so follow-up calls can refer to them.
+func (d cartDiff) format() string {
+	var groups []string
+	if len(d.Added) > 0 {
+		lines := []string{fmt.Sprintf("➕ Добавлены (%d):", len(d.Added))}
+		for _, item := range d.Added {
+			lines = append(lines, fmt.Sprintf("  • %s × %d (ID: %s)", item.Title, item.Quantity, item.ID))
+		}
+		groups = append(groups, strings.Join(lines, "\n"))
+	}
+	if len(d.Removed) > 0 {
+		lines := []string{fmt.Sprintf("➖ Удалены (%d):", len(d.Removed))}
+		for _, item := range d.Removed {
+			lines = append(lines, fmt.Sprintf("  • %s × %d (ID: %s)", item.Title, item.Quantity, item.ID))
+		}
+		groups = append(groups, strings.Join(lines, "\n"))
+	}
+	if len(d.Changed) > 0 {
+		lines := []string{fmt.Sprintf("🔄 Изменены (%d):", len(d.Changed))}
+		for _, change := range d.Changed {
+			var fields []string
+			if change.Before.Quantity != change.After.Quantity {
+				fields = append(fields, fmt.Sprintf("количество %d → %d", change.Before.Quantity, change.After.Quantity))
+			}
+			if change.Before.Price != change.After.Price {
+				fields = append(fields, fmt.Sprintf("цена %s → %s", change.Before.Price, change.After.Price))
+			}
+			if change.Before.Note != change.After.Note {
+				fields = append(fields, fmt.Sprintf("заметка «%s» → «%s»", change.Before.Note, change.After.Note))
+			}
+			lines = append(lines, fmt.Sprintf("  • %s (ID: %s): %s", change.After.Title, change.After.ID, strings.Join(fields, ", ")))
+		}
+		groups = append(groups, strings.Join(lines, "\n"))
+	}
+	return strings.Join(groups, "\n\n")
+}
+
+// resolveCartRef returns the lines behind a diff_carts reference: a cart
+// name or a snapshot name, optionally prefixed with "cart:" or "snapshot:".
+// Without a prefix carts take precedence over snapshots.
+func (s *Server) resolveCartRef(ctx context.Context, ref string) (items []*CartItem, label string, err error) {
+	ref = strings.TrimSpace(ref)
+	kind, name, prefixed := strings.Cut(ref, ":")
+	if !prefixed || (kind != "cart" && kind != "snapshot") {
+		kind, name = "", ref
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", fmt.Errorf("reference %q is empty, pass a cart or snapshot name", ref)
+	}
+
+	if kind != "snapshot" {
+		items, err := s.store.List(ctx, name)
+		var notFound *CartNotFoundError
+		switch {
+		case err == nil:
+			return items, fmt.Sprintf("корзина «%s»", name), nil
+		case !errors.As(err, &notFound):
+			return nil, "", err
+		}
+	}
+	if kind == "snapshot" && sessionScoped(ctx) {
+		return nil, "", errSessionScopeUnsupported
+	}
+	if kind != "cart" && !sessionScoped(ctx) {
+		if snapshot, ok := cartSnapshots.Get(name); ok {
+			return snapshot.Items, fmt.Sprintf("снимок «%s»", name), nil
+		}
+	}
+	switch kind {
+	case "cart":
+		return nil, "", fmt.Errorf("cart %q does not exist, use list_carts to see carts", name)
+	case "snapshot":
+		return nil, "", fmt.Errorf("snapshot %q does not exist, use list_snapshots to see snapshots", name)
+	}
+	return nil, "", fmt.Errorf("no cart or snapshot named %q, use list_carts or list_snapshots", name)
+}
+
+func (s *Server) handleDiffCarts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	refA, _ := args["a"].(string)
+	refB, _ := args["b"].(string)
+
+	before, labelA, err := s.resolveCartRef(ctx, refA)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	after, labelB, err := s.resolveCartRef(ctx, refB)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	diff := diffCartItems(before, after)
+	result := fmt.Sprintf("⚖️ Сравнение: %s → %s\n\n", labelA, labelB)
+	if diff.empty() {
+		result += "✅ Различий нет"
+	} else {
+		result += diff.format()
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
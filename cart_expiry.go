@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// expired reports whether the item was last updated more than
+// config.CartItemTTL ago. Items never expire when the TTL is unset.
+func (item *CartItem) expired(now time.Time) bool {
+	return config.CartItemTTL > 0 && now.Sub(item.UpdatedAt) > config.CartItemTTL
+}
+
+// splitExpired separates expired items from the rest, keeping their order.
+func splitExpired(items []*CartItem, now time.Time) (fresh, expired []*CartItem) {
+	for _, item := range items {
+		if item.expired(now) {
+			expired = append(expired, item)
+		} else {
+			fresh = append(fresh, item)
+		}
+	}
+	return fresh, expired
+}
+
+// formatExpiredItems renders the expired section of view_cart and cart_total.
+func formatExpiredItems(items []*CartItem) string {
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, fmt.Sprintf("• %s × %d — %s, обновлено %s (ID: %s)",
+			item.Title, item.Quantity, item.Price, item.UpdatedAt.Format("2006-01-02"), item.ID))
+	}
+	return fmt.Sprintf("⌛ Устаревшие позиции (не обновлялись дольше %s, цены могли измениться, в итог не входят): %d\n%s\n💡 prune_expired удалит их из корзины",
+		config.CartItemTTL, len(items), strings.Join(lines, "\n"))
+}
+
+// pruneExpired removes the expired lines of c and counts the removals.
+func pruneExpired(ctx context.Context, c *Cart) []*CartItem {
+	removed := c.PruneExpired(ctx)
+	cartRemoveTotal.Add(float64(len(removed)))
+	return removed
+}
+
+// PruneExpired removes the expired lines of c, keeping them in the trash and
+// the undo journal, and returns copies of them sorted by ID.
+func (c *Cart) PruneExpired(ctx context.Context) []*CartItem {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	now := c.now()
+	var removed []*CartItem
+	var ids []string
+	for id, item := range c.Items {
+		if item.expired(now) {
+			removed = append(removed, item.clone())
+			ids = append(ids, id)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	sort.Slice(removed, func(i, j int) bool { return removed[i].ID < removed[j].ID })
+	c.recordLocked("prune_expired", ids...)
+	for _, id := range ids {
+		c.trashLocked(c.Items[id])
+		delete(c.Items, id)
+	}
+	return removed
+}
+
+func (s *Server) handlePruneExpired(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if config.CartItemTTL <= 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "cart items never expire: CART_ITEM_TTL is not set"},
+			},
+		}, nil
+	}
+
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var removed []*CartItem
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		removed = pruneExpired(ctx, c)
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "expired cart items pruned", "cart", cartName, "items", len(removed))
+	if len(removed) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("✅ В корзине%s нет устаревших товаров (срок — %s с последнего обновления)", cartLabel(cartName), config.CartItemTTL)},
+			},
+		}, nil
+	}
+
+	lines := make([]string, 0, len(removed))
+	for _, item := range removed {
+		lines = append(lines, fmt.Sprintf("• %s × %d (ID: %s)", item.Title, item.Quantity, item.ID))
+	}
+	result := fmt.Sprintf(`🧹 Из корзины%s удалены устаревшие товары: %d
+
+%s
+
+💡 Вернуть их можно через restore_item или undo_cart`,
+		cartLabel(cartName), len(removed), strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
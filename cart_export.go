@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// cartExportSchemaVersion is bumped whenever a field of cartExport or
+// CartItem changes meaning or is removed. Adding fields keeps the version.
+const cartExportSchemaVersion = 1
+
+// cartExport is the document returned by export_cart. Items are ordered by
+// the time they were added, timestamps are RFC 3339.
+type cartExport struct {
+	SchemaVersion int                `json:"schema_version"`
+	Cart          string             `json:"cart"`
+	ExportedAt    time.Time          `json:"exported_at"`
+	UniqueItems   int                `json:"unique_items"`
+	TotalQuantity int                `json:"total_quantity"`
+	Totals        map[string]float64 `json:"totals"`
+	UnpricedItems int                `json:"unpriced_items"`
+	Items         []*CartItem        `json:"items"`
+}
+
+func exportCart(c *Cart, name string) cartExport {
+	items := c.Snapshot()
+	export := cartExport{
+		SchemaVersion: cartExportSchemaVersion,
+		Cart:          name,
+		ExportedAt:    c.now().UTC(),
+		UniqueItems:   len(items),
+		Totals:        make(map[string]float64),
+		Items:         items,
+	}
+	for _, item := range items {
+		export.TotalQuantity += item.Quantity
+		if item.PriceParsed {
+			export.Totals[item.PriceCurrency] += item.PriceAmount * float64(item.Quantity)
+		} else {
+			export.UnpricedItems++
+		}
+	}
+	return export
+}
+
+var cartExportFormats = []string{"json", "csv", "markdown"}
+
+// render encodes the export in one of cartExportFormats and returns the
+// document with its MIME type.
+func (e cartExport) render(format string) (string, string, error) {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(e, "", "  ")
+		if err != nil {
+			return "", "", err
+		}
+		return string(data), "application/json", nil
+	case "csv":
+		text, err := e.csv()
+		return text, "text/csv; charset=utf-8", err
+	case "markdown":
+		return e.markdown(), "text/markdown; charset=utf-8", nil
+	}
+	return "", "", fmt.Errorf("unknown export format %q, use one of: %s", format, strings.Join(cartExportFormats, ", "))
+}
+
+// csv renders one row per item. encoding/csv takes care of quoting commas,
+// quotes and line breaks; the output is UTF-8.
+func (e cartExport) csv() (string, error) {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	rows := [][]string{{"id", "title", "shop", "price", "quantity", "link"}}
+	for _, item := range e.Items {
+		rows = append(rows, []string{item.ID, item.Title, item.Shop, item.Price, strconv.Itoa(item.Quantity), item.Link})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// markdown renders a GitHub-style table followed by a totals row.
+func (e cartExport) markdown() string {
+	var b strings.Builder
+	b.WriteString("| ID | Название | Магазин | Цена | Количество | Ссылка |\n")
+	b.WriteString("|---|---|---|---|---:|---|\n")
+	for _, item := range e.Items {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %d | %s |\n",
+			tableCell(item.ID), tableCell(item.Title), tableCell(item.Shop), tableCell(item.Price), item.Quantity, tableCell(item.Link))
+	}
+	total := "—"
+	if len(e.Totals) > 0 {
+		total = formatTotals(e.Totals)
+	}
+	fmt.Fprintf(&b, "| | **Итого** | | **%s** | **%d** | |\n", tableCell(total), e.TotalQuantity)
+	return b.String()
+}
+
+// cartExportURI identifies an export in the embedded resource.
+func cartExportURI(name, format string) string {
+	uri := cartResourceURI + "/export?cart=" + url.QueryEscape(name)
+	if format != "json" {
+		uri += "&format=" + format
+	}
+	return uri
+}
+
+func (s *Server) handleExportCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	format := "json"
+	if value, ok := args["format"].(string); ok && value != "" {
+		format = value
+	}
+
+	var export cartExport
+	err = s.store.View(ctx, cartName, func(c *Cart) error {
+		export = exportCart(c, cartName)
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	text, mimeType, err := export.render(format)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("failed to export cart: %v", err)},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart exported", "cart", cartName, "format", format, "items", export.UniqueItems)
+
+	summary := fmt.Sprintf("📤 Корзина%s выгружена в %s (позиций: %d)", cartLabel(cartName), strings.ToUpper(format), export.UniqueItems)
+	if format == "json" {
+		summary = fmt.Sprintf("📤 Корзина%s выгружена в JSON (позиций: %d, schema_version: %d)", cartLabel(cartName), export.UniqueItems, cartExportSchemaVersion)
+	}
+
+	// The document goes out as a base64 blob so that clients offer it as a
+	// file instead of pasting it into the conversation.
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: summary},
+			mcp.EmbeddedResource{
+				Type: "resource",
+				Resource: mcp.BlobResourceContents{
+					URI:      cartExportURI(cartName, format),
+					MIMEType: mimeType,
+					Blob:     base64.StdEncoding.EncodeToString([]byte(text)),
+				},
+			},
+		},
+	}, nil
+}
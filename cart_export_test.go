@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func TestExportCartRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCart()
+	if _, err := c.Add(t.Context(), "priced", "Чайник", "https://example.com/kettle", "1 299,90 ₽", "example.com", "Электрический", 2); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := c.Add(t.Context(), "unpriced", "Кружка", "https://example.com/mug", "цена по запросу", "example.com", "", 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	c.Items["priced"].Note = "проверить объём"
+	c.Items["priced"].Tags = []string{"кухня", "подарок"}
+	c.Items["priced"].Priority = "high"
+
+	data, err := json.Marshal(exportCart(c, "home"))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var decoded struct {
+		SchemaVersion int                `json:"schema_version"`
+		Cart          string             `json:"cart"`
+		TotalQuantity int                `json:"total_quantity"`
+		Totals        map[string]float64 `json:"totals"`
+		UnpricedItems int                `json:"unpriced_items"`
+		Items         []CartItem         `json:"items"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v\n%s", err, data)
+	}
+
+	if decoded.SchemaVersion != cartExportSchemaVersion || decoded.Cart != "home" {
+		t.Errorf("header = (schema_version %d, cart %q), want (%d, %q)", decoded.SchemaVersion, decoded.Cart, cartExportSchemaVersion, "home")
+	}
+	if decoded.TotalQuantity != 3 || decoded.UnpricedItems != 1 {
+		t.Errorf("total_quantity = %d, unpriced_items = %d, want 3 and 1", decoded.TotalQuantity, decoded.UnpricedItems)
+	}
+	if got := decoded.Totals["RUB"]; got != 2599.8 {
+		t.Errorf("totals[RUB] = %v, want 2599.8", got)
+	}
+
+	want := c.Snapshot()
+	if len(decoded.Items) != len(want) {
+		t.Fatalf("exported %d items, want %d", len(decoded.Items), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(&decoded.Items[i], want[i]) {
+			t.Errorf("item %d after round trip = %+v, want %+v", i, decoded.Items[i], *want[i])
+		}
+	}
+}
+
+func TestExportCartGolden(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCart()
+	items := []struct {
+		id, title, link, price, shop, description string
+		quantity                                  int
+	}{
+		{"a-kettle", `Чайник "Bosch", 1,7 л ☕`, "https://example.com/kettle?color=red,blue", "1 299,90 ₽", "megamarket.ru", "Корпус: сталь\nМощность: 2200 Вт", 2},
+		{"b-cable", "Кабель USB-C | Lightning", "https://example.com/cable", "12.50 USD", "shop | one", "Длина 1 м, | оплётка", 3},
+		{"c-mug", "Кружка\nс котом 🐱", "https://example.com/mug", "по запросу", "", "", 1},
+	}
+	for _, item := range items {
+		if _, err := c.Add(t.Context(), item.id, item.title, item.link, item.price, item.shop, item.description, item.quantity); err != nil {
+			t.Fatalf("Add(%s) error = %v", item.id, err)
+		}
+	}
+	export := exportCart(c, defaultCartName)
+
+	for _, tt := range []struct{ format, golden string }{
+		{format: "csv", golden: "cart_export.csv"},
+		{format: "markdown", golden: "cart_export.md"},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			got, _, err := export.render(tt.format)
+			if err != nil {
+				t.Fatalf("render(%q) error = %v", tt.format, err)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("reading golden file: %v (run go test -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("render(%q) mismatch with %s\ngot:\n%s\nwant:\n%s", tt.format, path, got, want)
+			}
+		})
+	}
+}
+
+func TestImportCart(t *testing.T) {
+	t.Parallel()
+
+	source := newTestCart()
+	if _, err := source.Add(t.Context(), "kettle", "Чайник", "https://example.com/kettle", "1 299 ₽", "example.com", "", 2); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	data, err := json.Marshal(exportCart(source, defaultCartName))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	items, failures, err := parseCartImport(string(data))
+	if err != nil || len(failures) != 0 {
+		t.Fatalf("parseCartImport(export) = %v, %v", failures, err)
+	}
+
+	target := newTestCart()
+	if _, err := target.Add(t.Context(), "kettle", "Чайник", "https://example.com/kettle", "1 299 ₽", "example.com", "", 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := target.Add(t.Context(), "mug", "Кружка", "", "", "", "", 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if added, merged, err := target.Import(t.Context(), items, false); err != nil || added != 0 || merged != 1 {
+		t.Fatalf("Import(merge) = (%d, %d, %v), want (0, 1, nil)", added, merged, err)
+	}
+	if got := target.Items["kettle"].Quantity; got != 3 {
+		t.Errorf("merged quantity = %d, want 3", got)
+	}
+
+	if added, merged, err := target.Import(t.Context(), items, true); err != nil || added != 1 || merged != 0 {
+		t.Fatalf("Import(replace) = (%d, %d, %v), want (1, 0, nil)", added, merged, err)
+	}
+	if _, exists := target.Items["mug"]; exists || target.Items["kettle"].Quantity != 2 {
+		t.Errorf("cart after replace = %v, want only the imported kettle × 2", target.Items)
+	}
+}
+
+func TestParseCartImportValidation(t *testing.T) {
+	t.Parallel()
+
+	_, failures, err := parseCartImport(`[
+		{"id": "ok", "title": "Товар", "link": "https://example.com/ok"},
+		{"id": "", "title": "Без ID"},
+		{"id": "no-title"},
+		{"id": "ftp", "title": "FTP", "link": "ftp://example.com/file"},
+		{"id": "negative", "title": "Минус", "quantity": -1},
+		null
+	]`)
+	if err != nil {
+		t.Fatalf("parseCartImport() error = %v", err)
+	}
+
+	var indexes []int
+	for _, failure := range failures {
+		indexes = append(indexes, failure.Index)
+	}
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(indexes, want) {
+		t.Errorf("failed indexes = %v, want %v", indexes, want)
+	}
+
+	if _, _, err := parseCartImport(`{"schema_version": 99, "items": []}`); err == nil {
+		t.Error("parseCartImport() accepted a newer schema version")
+	}
+}
+
+func TestHandleExportCartEmpty(t *testing.T) {
+	const name = "export-empty-test"
+	if _, err := carts.Create(name); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	t.Cleanup(func() { carts.Delete(name, true) })
+
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]any{"cart": name}
+	result, err := NewServer(NewMemoryCartStore(carts), nil).handleExportCart(t.Context(), request)
+	if err != nil || result.IsError {
+		t.Fatalf("handleExportCart() = %v, %v", toolResultText(result), err)
+	}
+
+	embedded, ok := result.Content[1].(mcp.EmbeddedResource)
+	if !ok {
+		t.Fatalf("content[1] = %T, want mcp.EmbeddedResource", result.Content[1])
+	}
+	blob, ok := embedded.Resource.(mcp.BlobResourceContents)
+	if !ok {
+		t.Fatalf("resource = %T, want mcp.BlobResourceContents", embedded.Resource)
+	}
+	data, err := base64.StdEncoding.DecodeString(blob.Blob)
+	if err != nil {
+		t.Fatalf("decoding blob: %v", err)
+	}
+	var decoded struct {
+		Items json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v\n%s", err, data)
+	}
+	if string(decoded.Items) != "[]" {
+		t.Errorf("items = %s, want []", decoded.Items)
+	}
+}
+
+func TestParseCartImportBase64(t *testing.T) {
+	t.Parallel()
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(`{"schema_version": 1, "items": [{"id": "kettle", "title": "Чайник", "quantity": 2}]}`))
+	items, failures, err := parseCartImport(encoded)
+	if err != nil || len(failures) != 0 {
+		t.Fatalf("parseCartImport(base64) = %v, %v", failures, err)
+	}
+	if len(items) != 1 || items[0].ID != "kettle" || items[0].Quantity != 2 {
+		t.Errorf("items = %v, want kettle × 2", items)
+	}
+
+	if _, _, err := parseCartImport("not json, not base64!"); err == nil {
+		t.Error("parseCartImport() accepted garbage")
+	}
+	oversized := base64.StdEncoding.EncodeToString(make([]byte, maxCartImportSize+1))
+	if _, _, err := parseCartImport(oversized); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("parseCartImport(oversized) error = %v, want a size limit error", err)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultCartFile = "cart.json"
+
+// CartPersistence persists the carts between server restarts.
+type CartPersistence interface {
+	Load() error
+	Save() error
+}
+
+// cartFile is the on-disk layout: the default cart, the other named carts,
+// the cart snapshots, budgets and versions. Saved is only read: it held the
+// wishlist before wishlists moved to their own file. Files written before
+// that hold a bare array of cart items.
+type cartFile struct {
+	Items []*CartItem            `json:"items"`
+	Saved []*CartItem            `json:"saved,omitempty"`
+	Carts map[string][]*CartItem `json:"carts,omitempty"`
+
+	Snapshots []CartSnapshot    `json:"snapshots,omitempty"`
+	Budgets   map[string]Budget `json:"budgets,omitempty"`
+	// Versions are kept only with the memory backend.
+	Versions map[string][]CartVersion `json:"versions,omitempty"`
+}
+
+// JSONCartFile keeps the cart in a JSON file on disk.
+type JSONCartFile struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func NewJSONCartFile(path string) *JSONCartFile {
+	if path == "" {
+		path = defaultCartFile
+	}
+	return &JSONCartFile{path: path}
+}
+
+// Lock keeps a second server instance from writing the same cart file.
+// The wishlist, saved search and price alert files sit next to it and are
+// covered by the same lock.
+func (s *JSONCartFile) Lock(wait bool) (*FileLock, error) {
+	return LockFile(s.path, wait)
+}
+
+func (s *JSONCartFile) Load() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return s.moveAside(fmt.Errorf("failed to read cart file %s: %w", s.path, err))
+	}
+	// A file that cannot be decrypted is not moved aside: the key is wrong,
+	// not the file, and starting with empty carts would hide that.
+	encrypted := isEncryptedCart(data)
+	if data, err = cartCipher.open(data); err != nil {
+		return fmt.Errorf("failed to load cart file %s: %w; check CART_ENCRYPTION_KEY", s.path, err)
+	}
+
+	file, err := decodeCartFile(data)
+	if err != nil {
+		return s.moveAside(fmt.Errorf("failed to decode cart file %s: %w", s.path, err))
+	}
+
+	file.apply()
+	wishlists.loadLegacy(file.Saved)
+	if cartCipher != nil && !encrypted {
+		slog.Info("encrypting plain cart file", "path", s.path)
+		return s.saveLocked()
+	}
+	return nil
+}
+
+func decodeCartFile(data []byte) (cartFile, error) {
+	var file cartFile
+	var err error
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &file.Items)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+	return file, err
+}
+
+// encodeCartFile captures the carts, snapshots and budgets as they are now.
+func encodeCartFile() ([]byte, error) {
+	data, err := json.MarshalIndent(cartFile{
+		Items:     getCart(),
+		Carts:     carts.Named(),
+		Snapshots: cartSnapshots.List(),
+		Budgets:   carts.Budgets(),
+		Versions:  cartVersions.all(),
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cart: %w", err)
+	}
+	return data, nil
+}
+
+// apply replaces the carts, snapshots and budgets with the ones in f.
+func (f *cartFile) apply() {
+	cart.load(f.Items)
+	carts.load(f.Carts)
+	cartSnapshots.load(f.Snapshots)
+	carts.loadBudgets(f.Budgets)
+	cartVersions.load(f.Versions)
+}
+
+// moveAside renames a cart file that could not be loaded to
+// <path>.corrupt-<time>, so the server starts with empty carts instead of
+// overwriting it on the next save. The file is kept for manual recovery; if
+// it cannot be moved, loadErr is returned and the server refuses to start.
+func (s *JSONCartFile) moveAside(loadErr error) error {
+	aside := s.path + ".corrupt-" + time.Now().Format("20060102-150405")
+	if err := os.Rename(s.path, aside); err != nil {
+		return fmt.Errorf("%w; moving it aside failed: %w", loadErr, err)
+	}
+	slog.Error("CART FILE IS CORRUPT OR UNREADABLE, starting with empty carts; the old file was kept for manual recovery",
+		"error", loadErr, "moved_to", aside)
+	return nil
+}
+
+// load replaces the contents of c with items read from disk.
+func (c *Cart) load(items []*CartItem) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.Items = make(map[string]*CartItem, len(items))
+	for _, item := range items {
+		if item == nil || item.ID == "" {
+			continue
+		}
+		item.updateParsedPrice()
+		c.Items[item.ID] = item
+	}
+}
+
+func (s *JSONCartFile) Save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.saveLocked()
+}
+
+func (s *JSONCartFile) saveLocked() error {
+	data, err := encodeCartFile()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, cartCipher.seal(data))
+}
+
+// writeFileAtomic writes to a temporary file in the same directory and
+// renames it over the old one, so a crash mid-write never leaves a truncated
+// file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file for %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temporary file for %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file for %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+func persistCart(persistence CartPersistence) {
+	if persistence == nil {
+		return
+	}
+	if err := persistence.Save(); err != nil {
+		slog.Error("failed to save cart", "error", err)
+	}
+}
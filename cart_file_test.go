@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resetCarts empties the global carts, as a fresh process starts.
+func resetCarts(t *testing.T) {
+	t.Helper()
+	cart.load(nil)
+	carts.load(nil)
+	carts.loadBudgets(nil)
+	cartSnapshots.load(nil)
+}
+
+func TestJSONCartFileRestart(t *testing.T) {
+	resetCarts(t)
+	t.Cleanup(func() { resetCarts(t) })
+
+	added := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	updated := added.Add(90 * time.Minute)
+	cart.load([]*CartItem{{
+		ID:        "kettle",
+		Title:     "Чайник",
+		Link:      "https://example.com/kettle",
+		Price:     "2 990 ₽",
+		Quantity:  3,
+		Note:      "подарок маме",
+		Tags:      []string{"кухня"},
+		AddedAt:   added,
+		UpdatedAt: updated,
+	}})
+	if _, err := carts.Create("office"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	office, _ := carts.Get("office")
+	office.load([]*CartItem{{ID: "mug", Title: "Кружка", Quantity: 12, AddedAt: added, UpdatedAt: added}})
+
+	path := filepath.Join(t.TempDir(), "cart.json")
+	if err := NewJSONCartFile(path).Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	resetCarts(t)
+	if err := NewJSONCartFile(path).Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	item, ok := cart.Get("kettle")
+	if !ok {
+		t.Fatal("kettle is missing after restart")
+	}
+	if item.Quantity != 3 || item.Note != "подарок маме" || len(item.Tags) != 1 || !item.PriceParsed {
+		t.Errorf("kettle after restart = %+v, want quantity 3, the note, the tag and a parsed price", item)
+	}
+	if !item.AddedAt.Equal(added) || !item.UpdatedAt.Equal(updated) {
+		t.Errorf("kettle timestamps after restart = %v, %v, want %v, %v", item.AddedAt, item.UpdatedAt, added, updated)
+	}
+	office, ok = carts.Get("office")
+	if !ok {
+		t.Fatal("office cart is missing after restart")
+	}
+	if mug, ok := office.Get("mug"); !ok || mug.Quantity != 12 {
+		t.Errorf("office mug after restart = %+v, %v, want quantity 12", mug, ok)
+	}
+}
+
+func TestJSONCartFileCorrupt(t *testing.T) {
+	resetCarts(t)
+	t.Cleanup(func() { resetCarts(t) })
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cart.json")
+	if err := os.WriteFile(path, []byte(`{"items": [{"id": "kettle"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewJSONCartFile(path).Load(); err != nil {
+		t.Fatalf("Load() error = %v, want the corrupt file moved aside", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("corrupt cart file is still at %s", path)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), "cart.json.corrupt-") {
+		t.Errorf("directory holds %v, want only the moved-aside cart file", entries)
+	}
+	if uniqueItems, _ := cart.Totals(); uniqueItems != 0 {
+		t.Errorf("cart has %d items after a corrupt load, want none", uniqueItems)
+	}
+}
+
+// TestJSONCartFileLegacySaved checks that the items of the "saved" field of
+// an old cart file end up in the default wishlist and are written out to
+// the wishlists file.
+func TestJSONCartFileLegacySaved(t *testing.T) {
+	resetCarts(t)
+	t.Cleanup(func() { resetCarts(t) })
+	prev := wishlists
+	t.Cleanup(func() { wishlists = prev })
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cart.json")
+	legacy := `{"items": [{"id": "kettle", "title": "Чайник", "quantity": 1}], "saved": [{"id": "mug", "title": "Кружка", "quantity": 2}]}`
+	if err := os.WriteFile(path, []byte(legacy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	wishlists = NewWishlistStore(filepath.Join(dir, defaultWishlistsFile))
+	if err := NewJSONCartFile(path).Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if err := wishlists.Load(); err != nil {
+		t.Fatalf("wishlists Load() error = %v", err)
+	}
+
+	wishlists = NewWishlistStore(filepath.Join(dir, defaultWishlistsFile))
+	if err := wishlists.Load(); err != nil {
+		t.Fatalf("reloading the wishlists: %v", err)
+	}
+	saved, _ := wishlists.Get(defaultWishlistName)
+	if mug, ok := saved.Get("mug"); !ok || mug.Quantity != 2 {
+		t.Errorf("default wishlist mug = %+v, %v, want quantity 2 from the legacy saved field", mug, ok)
+	}
+}
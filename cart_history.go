@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultCartHistorySize  = 500
+	defaultCartHistoryLimit = 20
+	cartHistoryURI          = cartResourceURI + "/history"
+)
+
+// CartHistoryEntry records one cart mutation. ItemIDs lists every line the
+// mutation touched and QuantityDelta is the net change of units in the cart,
+// so clearing a cart is a single entry.
+type CartHistoryEntry struct {
+	At            time.Time `json:"at"`
+	Cart          string    `json:"cart"`
+	Action        string    `json:"action"`
+	Tool          string    `json:"tool,omitempty"`
+	Session       string    `json:"session,omitempty"`
+	ItemIDs       []string  `json:"item_ids"`
+	QuantityDelta int       `json:"quantity_delta"`
+}
+
+// CartHistory is a fixed-size ring buffer of the most recent cart mutations.
+type CartHistory struct {
+	entries []CartHistoryEntry
+	next    int
+	full    bool
+	mutex   sync.Mutex
+}
+
+var cartHistory = NewCartHistory(defaultCartHistorySize)
+
+func NewCartHistory(size int) *CartHistory {
+	if size <= 0 {
+		size = defaultCartHistorySize
+	}
+	return &CartHistory{entries: make([]CartHistoryEntry, size)}
+}
+
+// Add is called by carts while they still hold their own lock, so the order
+// of entries is the order in which the mutations happened.
+func (h *CartHistory) Add(entry CartHistoryEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Recent returns up to limit entries of session touching itemID, newest
+// first. An empty session or itemID matches every entry and a limit of zero
+// returns all of them.
+func (h *CartHistory) Recent(session, itemID string, limit int) []CartHistoryEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.entries)
+	}
+
+	var result []CartHistoryEntry
+	for i := 1; i <= count && (limit <= 0 || len(result) < limit); i++ {
+		entry := h.entries[(h.next-i+len(h.entries))%len(h.entries)]
+		if (session == "" || entry.Session == session) && (itemID == "" || slices.Contains(entry.ItemIDs, itemID)) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// pendingAudit is the mutation in progress on a cart: the quantities of the
+// touched lines before the change.
+type pendingAudit struct {
+	action string
+	before map[string]int
+}
+
+// auditLocked marks the start of a mutation of the given lines. The entry is
+// written by unlock once the mutation is done. The caller must hold c.mutex.
+func (c *Cart) auditLocked(action string, itemIDs ...string) {
+	pending := &pendingAudit{action: action, before: make(map[string]int, len(itemIDs))}
+	for _, id := range itemIDs {
+		if item, exists := c.Items[id]; exists {
+			pending.before[id] = item.Quantity
+		} else {
+			pending.before[id] = 0
+		}
+	}
+	c.pending = pending
+}
+
+// unlock writes the history entry of the mutation started with auditLocked,
+// if any, and then releases c.mutex. Writing the entry before the lock is
+// released keeps the history consistent with the cart.
+func (c *Cart) unlock(ctx context.Context) {
+	if pending := c.pending; pending != nil {
+		c.pending = nil
+		c.lastAction = pending.action
+		entry := CartHistoryEntry{
+			At:      c.now(),
+			Cart:    c.name,
+			Action:  pending.action,
+			Tool:    toolNameFromContext(ctx),
+			Session: sessionIDFromContext(ctx),
+			ItemIDs: make([]string, 0, len(pending.before)),
+		}
+		for id, before := range pending.before {
+			entry.ItemIDs = append(entry.ItemIDs, id)
+			if item, exists := c.Items[id]; exists {
+				entry.QuantityDelta += item.Quantity - before
+			} else {
+				entry.QuantityDelta -= before
+			}
+		}
+		sort.Strings(entry.ItemIDs)
+		cartHistory.Add(entry)
+	}
+	c.mutex.Unlock()
+}
+
+// takeLastAction returns the action of the newest mutation and forgets it,
+// so a later change that records none is not logged under it.
+func (c *Cart) takeLastAction() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	action := c.lastAction
+	c.lastAction = ""
+	return action
+}
+
+func registerCartHistoryResource(s *server.MCPServer) {
+	s.AddResource(mcp.Resource{
+		URI:         cartHistoryURI,
+		Name:        "История корзины",
+		Description: "Журнал изменений всех корзин в формате JSON, сначала новые",
+		MIMEType:    "application/json",
+	}, handleReadCartHistory)
+}
+
+func handleReadCartHistory(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	entries := cartHistory.Recent(historySession(ctx), "", 0)
+	if entries == nil {
+		entries = []CartHistoryEntry{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cart history: %w", err)
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      cartHistoryURI,
+			MIMEType: "application/json",
+			Text:     string(data),
+		},
+	}, nil
+}
+
+func handleCartHistory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	itemID, _ := args["item_id"].(string)
+	itemID = strings.TrimSpace(itemID)
+
+	limit := defaultCartHistoryLimit
+	if value, ok := args["limit"].(float64); ok {
+		if value != float64(int(value)) || value < 1 {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: "limit must be a positive integer"},
+				},
+			}, nil
+		}
+		limit = int(value)
+	}
+
+	entries := cartHistory.Recent(historySession(ctx), itemID, limit)
+	if len(entries) == 0 {
+		text := "📜 История изменений корзины пуста"
+		if itemID != "" {
+			text = fmt.Sprintf("📜 Изменений товара %s в истории нет", itemID)
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: text},
+			},
+		}, nil
+	}
+
+	lines := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		action := cartActionNames[entry.Action]
+		if action == "" {
+			action = entry.Action
+		}
+		line := fmt.Sprintf("• %s — %s, корзина %s, %+d шт.", entry.At.Format(time.DateTime), action, entry.Cart, entry.QuantityDelta)
+		switch {
+		case len(entry.ItemIDs) == 1:
+			line += ", товар " + entry.ItemIDs[0]
+		case len(entry.ItemIDs) > 1:
+			line += fmt.Sprintf(", позиций: %d", len(entry.ItemIDs))
+		}
+		if entry.Tool != "" {
+			line += fmt.Sprintf("\n  🔧 %s", entry.Tool)
+			if entry.Session != "" {
+				line += ", сессия " + entry.Session
+			}
+		}
+		lines = append(lines, line)
+	}
+	result := fmt.Sprintf("📜 История изменений корзины (%d, сначала новые):\n\n%s\n\n💡 Полный журнал в JSON доступен как ресурс %s",
+		len(entries), strings.Join(lines, "\n"), cartHistoryURI)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const maxCartImportSize = 1 << 20
+
+var cartImportModes = []string{"merge", "replace"}
+
+// decodeCartImport returns the JSON of an import given either as plain JSON
+// or base64-encoded, as export_cart hands it out. The size limit applies to
+// the decoded document.
+func decodeCartImport(data string) (string, error) {
+	trimmed := strings.TrimSpace(data)
+	if trimmed == "" || trimmed[0] == '{' || trimmed[0] == '[' {
+		if len(data) > maxCartImportSize {
+			return "", fmt.Errorf("import is %d bytes long, the limit is %d", len(data), maxCartImportSize)
+		}
+		return data, nil
+	}
+	if len(trimmed) > base64.StdEncoding.EncodedLen(maxCartImportSize) {
+		return "", fmt.Errorf("import is %d bytes long, the limit is %d", base64.StdEncoding.DecodedLen(len(trimmed)), maxCartImportSize)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(trimmed)
+	if err != nil {
+		return "", errors.New("data must be JSON or base64-encoded JSON")
+	}
+	if len(decoded) > maxCartImportSize {
+		return "", fmt.Errorf("import is %d bytes long, the limit is %d", len(decoded), maxCartImportSize)
+	}
+	return string(decoded), nil
+}
+
+// parseCartImport decodes an export_cart JSON document, or a bare array of
+// items, plain or base64-encoded, and validates every item. Valid items are
+// returned with duplicates folded together; invalid ones are reported by
+// their index in the document.
+func parseCartImport(data string) ([]*CartItem, []*BatchItemError, error) {
+	data, err := decodeCartImport(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var document struct {
+		SchemaVersion int         `json:"schema_version"`
+		Items         []*CartItem `json:"items"`
+	}
+	if trimmed := bytes.TrimSpace([]byte(data)); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &document.Items)
+	} else {
+		err = json.Unmarshal([]byte(data), &document)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cart JSON: %w", err)
+	}
+	if document.SchemaVersion > cartExportSchemaVersion {
+		return nil, nil, fmt.Errorf("schema_version %d is newer than the supported version %d", document.SchemaVersion, cartExportSchemaVersion)
+	}
+	if len(document.Items) > config.MaxCartItems {
+		return nil, nil, &CartLimitError{Limit: "distinct items", Max: config.MaxCartItems, Current: len(document.Items)}
+	}
+
+	var valid []*CartItem
+	var failures []*BatchItemError
+	byID := make(map[string]*CartItem)
+	for i, item := range document.Items {
+		if err := validateImportedItem(item); err != nil {
+			failures = append(failures, &BatchItemError{Index: i, Err: err})
+			continue
+		}
+		if existing, seen := byID[item.ID]; seen {
+			mergeCartLines(existing, item)
+			continue
+		}
+		byID[item.ID] = item
+		valid = append(valid, item)
+	}
+	return valid, failures, nil
+}
+
+// validateImportedItem checks an imported line and normalizes it in place.
+// A missing quantity counts as one unit.
+func validateImportedItem(item *CartItem) error {
+	if item == nil {
+		return errors.New("item must be an object")
+	}
+	item.ID = strings.TrimSpace(item.ID)
+	item.Title = strings.TrimSpace(item.Title)
+	item.Link = strings.TrimSpace(item.Link)
+	if item.ID == "" {
+		return errors.New("id is required")
+	}
+	if item.Title == "" {
+		return errors.New("title is required")
+	}
+	if item.Quantity == 0 {
+		item.Quantity = 1
+	}
+	input := cartItemInput{ID: item.ID, Title: item.Title, Link: item.Link, Description: item.Description, Quantity: item.Quantity}
+	if err := input.validate(); err != nil {
+		return err
+	}
+	item.Description = input.Description
+	if !slices.Contains(priorities, item.Priority) {
+		item.Priority = priorityNormal
+	}
+	item.updateParsedPrice()
+	return nil
+}
+
+// importCart puts validated items into c and counts the additions.
+func importCart(ctx context.Context, c *Cart, items []*CartItem, replace bool) (added, merged int, err error) {
+	added, merged, err = c.Import(ctx, items, replace)
+	cartAddTotal.Add(float64(added + merged))
+	return added, merged, err
+}
+
+// Import adds items to c, summing quantities of lines that already exist.
+// With replace the current lines go to the trash first. The cart limits are
+// checked before anything changes.
+func (c *Cart) Import(ctx context.Context, items []*CartItem, replace bool) (added, merged int, err error) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	current := c.Items
+	if replace {
+		current = nil
+	}
+	lines, totalQuantity := len(current), 0
+	for _, item := range current {
+		totalQuantity += item.Quantity
+	}
+	for _, item := range items {
+		totalQuantity += item.Quantity
+		existing, exists := current[item.ID]
+		if !exists {
+			lines++
+			continue
+		}
+		if existing.Quantity+item.Quantity > config.MaxCartQuantity {
+			return 0, 0, &CartLimitError{Limit: "quantity per item", Max: config.MaxCartQuantity, Current: existing.Quantity}
+		}
+	}
+	if lines > config.MaxCartItems {
+		return 0, 0, &CartLimitError{Limit: "distinct items", Max: config.MaxCartItems, Current: len(current)}
+	}
+	if totalQuantity > config.MaxCartTotalQuantity {
+		return 0, 0, &CartLimitError{Limit: "total quantity", Max: config.MaxCartTotalQuantity, Current: totalQuantity}
+	}
+
+	ids := make([]string, 0, len(items)+len(c.Items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	if replace {
+		for id := range c.Items {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Strings(ids)
+	c.recordLocked("import", ids...)
+
+	if replace {
+		for _, item := range c.Items {
+			c.trashLocked(item)
+		}
+		c.Items = make(map[string]*CartItem, len(items))
+	}
+	now := c.now()
+	for _, item := range items {
+		if existing, exists := c.Items[item.ID]; exists {
+			mergeCartLines(existing, item)
+			existing.UpdatedAt = now
+			merged++
+			continue
+		}
+		item = item.clone()
+		if item.AddedAt.IsZero() {
+			item.AddedAt = now
+		}
+		item.UpdatedAt = now
+		c.Items[item.ID] = item
+		added++
+	}
+	return added, merged, nil
+}
+
+func (s *Server) handleImportCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	data, ok := args["data"].(string)
+	if !ok || strings.TrimSpace(data) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "data parameter is required and must be a JSON string"},
+			},
+		}, nil
+	}
+	mode := "merge"
+	if value, ok := args["mode"].(string); ok && value != "" {
+		mode = value
+	}
+	if !slices.Contains(cartImportModes, mode) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("mode must be one of: %s", strings.Join(cartImportModes, ", "))},
+			},
+		}, nil
+	}
+	strict, _ := args["strict"].(bool)
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	items, failures, err := parseCartImport(data)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	var failureLines []string
+	for _, failure := range failures {
+		failureLines = append(failureLines, "• "+failure.Error())
+	}
+	if strict && len(failures) > 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("import aborted, %d items are invalid:\n%s", len(failures), strings.Join(failureLines, "\n"))},
+			},
+		}, nil
+	}
+
+	if mode == "replace" {
+		backupBeforeChange(ctx, "import_cart")
+	}
+	var added, merged int
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		added, merged, err = importCart(ctx, c, items, mode == "replace")
+		return err
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart imported", "cart", cartName, "mode", mode, "added", added, "merged", merged, "invalid", len(failures))
+
+	result := fmt.Sprintf(`📥 Товары импортированы в корзину%s (режим: %s)
+
+📦 Новых позиций: %d
+➕ Объединено с существующими: %d`,
+		cartLabel(cartName), mode, added, merged)
+	if len(failures) > 0 {
+		result += fmt.Sprintf("\n\n⚠️ Пропущено некорректных позиций: %d\n%s", len(failures), strings.Join(failureLines, "\n"))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+const defaultUndoJournalSize = 20
+
+// cartMutation remembers how the touched cart lines looked before a change.
+// A nil entry in Before means the line did not exist yet.
+type cartMutation struct {
+	Action string
+	At     time.Time
+	Before map[string]*CartItem
+}
+
+// recordLocked snapshots the given lines before they are changed. The caller
+// must hold c.mutex. Only the last config.UndoJournalSize mutations are kept.
+func (c *Cart) recordLocked(action string, itemIDs ...string) {
+	c.auditLocked(action, itemIDs...)
+	mutation := cartMutation{
+		Action: action,
+		At:     c.now(),
+		Before: make(map[string]*CartItem, len(itemIDs)),
+	}
+	for _, id := range itemIDs {
+		if item, exists := c.Items[id]; exists {
+			mutation.Before[id] = item.clone()
+		} else {
+			mutation.Before[id] = nil
+		}
+	}
+
+	c.journal = append(c.journal, mutation)
+	if extra := len(c.journal) - config.UndoJournalSize; extra > 0 {
+		c.journal = append(c.journal[:0], c.journal[extra:]...)
+	}
+}
+
+// keepJournal saves the undo journal and trash of c. The returned function
+// puts them back, for a change that was recorded but could not be saved.
+func (c *Cart) keepJournal() (restore func()) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	journal, trash := slices.Clone(c.journal), slices.Clone(c.trash)
+	return func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		c.journal, c.trash = journal, trash
+	}
+}
+
+// undoneChange describes one line reverted by Undo: Restored is the line as
+// it is now back in the cart and Discarded the state that was undone. Either
+// is nil when the line is absent on that side.
+type undoneChange struct {
+	ID        string
+	Restored  *CartItem
+	Discarded *CartItem
+}
+
+// Undo reverts the most recent recorded mutation. ok is false when there is
+// nothing to undo.
+func (c *Cart) Undo(ctx context.Context) (action string, changes []undoneChange, ok bool) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	if len(c.journal) == 0 {
+		return "", nil, false
+	}
+	mutation := c.journal[len(c.journal)-1]
+	c.journal = c.journal[:len(c.journal)-1]
+	ids := make([]string, 0, len(mutation.Before))
+	for id := range mutation.Before {
+		ids = append(ids, id)
+	}
+	c.auditLocked("undo", ids...)
+
+	for id, before := range mutation.Before {
+		change := undoneChange{ID: id}
+		if current, exists := c.Items[id]; exists {
+			change.Discarded = current.clone()
+		}
+		if before == nil {
+			if mutation.Action == "restore" && change.Discarded != nil {
+				c.trashLocked(change.Discarded)
+			}
+			delete(c.Items, id)
+		} else {
+			c.Items[id] = before.clone()
+			c.untrashLocked(id)
+			change.Restored = before.clone()
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].ID < changes[j].ID })
+	return mutation.Action, changes, true
+}
@@ -0,0 +1,690 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisURL       = "redis://localhost:6379/0"
+	defaultRedisKeyPrefix = "megamarket:"
+)
+
+// A Redis cart is one hash, <prefix>cart:<name>. Each line has three fields:
+// "q:<id>" holds the quantity, "i:<id>" the rest of the line as JSON and
+// "u:<id>" the UnixNano of its last change. "#lines" and "#total" keep the
+// line count and total quantity so the limits are checked without reading
+// the whole cart, and "#budget" holds the budget as JSON. The names of the
+// carts other than the default one are the members of the set <prefix>carts.
+// The scripts run atomically on the server, and quantities change with
+// HINCRBY there, so replicas never overwrite each other's updates.
+var (
+	redisAddScript = redis.NewScript(`
+local count = tonumber(ARGV[2])
+local total = tonumber(redis.call('HGET', KEYS[1], '#total') or '0')
+if total + count > tonumber(ARGV[4]) then
+	return {-1, total}
+end
+local quantity = tonumber(redis.call('HGET', KEYS[1], 'q:' .. ARGV[1]) or '-1')
+if math.max(quantity, 0) + count > tonumber(ARGV[8]) then
+	return {-3, math.max(quantity, 0)}
+end
+if quantity < 0 then
+	local lines = tonumber(redis.call('HGET', KEYS[1], '#lines') or '0')
+	if lines >= tonumber(ARGV[5]) then
+		return {-2, lines}
+	end
+	redis.call('HSET', KEYS[1], 'i:' .. ARGV[1], ARGV[3])
+	redis.call('HINCRBY', KEYS[1], '#lines', 1)
+end
+redis.call('HSET', KEYS[1], 'u:' .. ARGV[1], ARGV[6])
+redis.call('HINCRBY', KEYS[1], '#total', count)
+quantity = redis.call('HINCRBY', KEYS[1], 'q:' .. ARGV[1], count)
+if tonumber(ARGV[7]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[7])
+end
+return {quantity, 0}
+`)
+	// redisSetScript sets a line to ARGV[2] units, or subtracts ARGV[3]
+	// units when ARGV[2] is empty, deleting the line at zero. It returns the
+	// previous quantity and 1, or {0, 0} when there is no such line.
+	redisSetScript = redis.NewScript(`
+local previous = tonumber(redis.call('HGET', KEYS[1], 'q:' .. ARGV[1]) or '-1')
+if previous < 0 then
+	return {0, 0}
+end
+local quantity = tonumber(ARGV[2])
+if ARGV[2] == '' then
+	quantity = previous - math.min(tonumber(ARGV[3]), previous)
+end
+if quantity <= 0 then
+	redis.call('HDEL', KEYS[1], 'q:' .. ARGV[1], 'i:' .. ARGV[1], 'u:' .. ARGV[1])
+	redis.call('HINCRBY', KEYS[1], '#lines', -1)
+	quantity = 0
+else
+	redis.call('HSET', KEYS[1], 'q:' .. ARGV[1], quantity, 'u:' .. ARGV[1], ARGV[4])
+end
+redis.call('HINCRBY', KEYS[1], '#total', quantity - previous)
+if tonumber(ARGV[5]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+end
+return {previous, 1}
+`)
+	// redisClearScript removes every line but keeps the budget.
+	redisClearScript = redis.NewScript(`
+local lines = tonumber(redis.call('HGET', KEYS[1], '#lines') or '0')
+local total = tonumber(redis.call('HGET', KEYS[1], '#total') or '0')
+local budget = redis.call('HGET', KEYS[1], '#budget')
+redis.call('DEL', KEYS[1])
+if budget then
+	redis.call('HSET', KEYS[1], '#budget', budget)
+	if tonumber(ARGV[1]) > 0 then
+		redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	end
+end
+return {lines, total}
+`)
+)
+
+// CartStorageError is returned when the cart storage cannot be reached.
+type CartStorageError struct {
+	Err error
+}
+
+func (e *CartStorageError) Error() string {
+	return fmt.Sprintf("cart storage unavailable, try again later: %v", e.Err)
+}
+
+func (e *CartStorageError) Unwrap() error { return e.Err }
+
+// errCartConflict is returned when another replica changed a cart while an
+// update was reading it.
+var errCartConflict = errors.New("the cart was changed by another replica at the same time, try again")
+
+// RedisCartStore keeps the carts in Redis, so several server replicas share
+// them: their lines, budgets and which carts exist. Every read and change
+// loads the cart from Redis into its in-memory cart first, which keeps this
+// replica's undo journal and trash.
+type RedisCartStore struct {
+	client *redis.Client
+	prefix string
+	// ttl, when set, expires a cart that was not changed for that long.
+	ttl   time.Duration
+	carts *CartRegistry
+	// mutex serializes the changes, which share the in-memory carts.
+	mutex sync.Mutex
+	now   func() time.Time
+}
+
+// NewRedisCartStore connects to the server at url, e.g. redis://localhost:6379/0.
+func NewRedisCartStore(url, prefix string, ttl time.Duration, registry *CartRegistry) (*RedisCartStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	return &RedisCartStore{
+		client: redis.NewClient(options),
+		prefix: prefix,
+		ttl:    ttl,
+		carts:  registry,
+		now:    time.Now,
+	}, nil
+}
+
+func (s *RedisCartStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisCartStore) key(cartName string) string {
+	return s.prefix + "cart:" + cartName
+}
+
+// cartsKey is the set of the names of the carts other than the default one.
+func (s *RedisCartStore) cartsKey() string {
+	return s.prefix + "carts"
+}
+
+func (s *RedisCartStore) checkCart(ctx context.Context, cartName string) error {
+	if cartName == defaultCartName {
+		return nil
+	}
+	exists, err := s.client.SIsMember(ctx, s.cartsKey(), cartName).Result()
+	if err != nil {
+		return &CartStorageError{Err: err}
+	}
+	if !exists {
+		return &CartNotFoundError{Name: cartName}
+	}
+	return nil
+}
+
+// redisLine is the "i:<id>" field: everything but the quantity and UpdatedAt.
+type redisLine struct {
+	Title          string    `json:"title"`
+	Link           string    `json:"link"`
+	Price          string    `json:"price"`
+	Shop           string    `json:"shop"`
+	Description    string    `json:"description"`
+	Image          string    `json:"image,omitempty"`
+	Note           string    `json:"note,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	Priority       string    `json:"priority"`
+	TargetPrice    float64   `json:"target_price,omitempty"`
+	TargetCurrency string    `json:"target_currency,omitempty"`
+	AddedAt        time.Time `json:"added_at"`
+}
+
+func encodeRedisLine(item *CartItem) (string, error) {
+	line, err := json.Marshal(redisLine{
+		Title:          item.Title,
+		Link:           item.Link,
+		Price:          item.Price,
+		Shop:           item.Shop,
+		Description:    item.Description,
+		Image:          item.Image,
+		Note:           item.Note,
+		Tags:           item.Tags,
+		Priority:       item.Priority,
+		TargetPrice:    item.TargetPrice,
+		TargetCurrency: item.TargetCurrency,
+		AddedAt:        item.AddedAt,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cart item %s: %w", item.ID, err)
+	}
+	return string(line), nil
+}
+
+// apply runs a script that changes a cart and, once it succeeds, replays the
+// change on the in-memory cart. The cart is read before the script runs, so
+// the undo journal records the lines as they were in Redis.
+func (s *RedisCartStore) apply(ctx context.Context, cartName string, script func() error, replay func(c *Cart)) error {
+	if err := s.checkCart(ctx, cartName); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lines, budget, err := s.read(ctx, s.client, cartName)
+	if err != nil {
+		return err
+	}
+	if err := script(); err != nil {
+		return err
+	}
+	c := s.carts.ensure(cartName)
+	c.load(lines)
+	c.SetBudget(budget)
+	replay(c)
+	notifyCartChanged()
+	return nil
+}
+
+func (s *RedisCartStore) Add(ctx context.Context, cartName string, item CartItem, count int) (quantity int, err error) {
+	now := s.now()
+	line, err := encodeRedisLine(&CartItem{
+		ID:          item.ID,
+		Title:       item.Title,
+		Link:        item.Link,
+		Price:       item.Price,
+		Shop:        item.Shop,
+		Description: item.Description,
+		Image:       item.Image,
+		Priority:    priorityNormal,
+		AddedAt:     now,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.apply(ctx, cartName, func() error {
+		result, err := redisAddScript.Run(ctx, s.client, []string{s.key(cartName)},
+			item.ID, count, line, config.MaxCartTotalQuantity, config.MaxCartItems, now.UnixNano(), s.ttl.Milliseconds(), config.MaxCartQuantity).Int64Slice()
+		if err != nil {
+			return &CartStorageError{Err: err}
+		}
+		switch result[0] {
+		case -1:
+			return &CartLimitError{Limit: "total quantity", Max: config.MaxCartTotalQuantity, Current: int(result[1])}
+		case -2:
+			return &CartLimitError{Limit: "distinct items", Max: config.MaxCartItems, Current: int(result[1])}
+		case -3:
+			return &CartLimitError{Limit: "quantity per item", Max: config.MaxCartQuantity, Current: int(result[1])}
+		}
+		quantity = int(result[0])
+		return nil
+	}, func(c *Cart) {
+		if _, err := c.AddItem(ctx, item, count); err != nil {
+			slog.WarnContext(ctx, "in-memory cart out of sync with Redis", "cart", cartName, "error", err)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	cartAddTotal.Inc()
+	return quantity, nil
+}
+
+// set runs redisSetScript: quantity is the new quantity, or "" to subtract n.
+func (s *RedisCartStore) set(ctx context.Context, cartName, itemID, quantity string, n int) (previous int, found bool, err error) {
+	result, err := redisSetScript.Run(ctx, s.client, []string{s.key(cartName)},
+		itemID, quantity, n, s.now().UnixNano(), s.ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, false, &CartStorageError{Err: err}
+	}
+	return int(result[0]), result[1] == 1, nil
+}
+
+func (s *RedisCartStore) Remove(ctx context.Context, cartName, itemID string, n int) (removed int, deleted bool, err error) {
+	if err := s.checkCart(ctx, cartName); err != nil || n <= 0 {
+		return 0, false, err
+	}
+	var previous int
+	var found bool
+	err = s.apply(ctx, cartName, func() error {
+		previous, found, err = s.set(ctx, cartName, itemID, "", n)
+		return err
+	}, func(c *Cart) {
+		c.RemoveN(ctx, itemID, n)
+	})
+	if err != nil || !found {
+		return 0, false, err
+	}
+	cartRemoveTotal.Inc()
+	return min(n, previous), n >= previous, nil
+}
+
+func (s *RedisCartStore) SetQuantity(ctx context.Context, cartName, itemID string, quantity int) (previous int, found bool, err error) {
+	err = s.apply(ctx, cartName, func() error {
+		previous, found, err = s.set(ctx, cartName, itemID, strconv.Itoa(quantity), 0)
+		return err
+	}, func(c *Cart) {
+		c.SetQuantity(ctx, itemID, quantity)
+	})
+	if err != nil || !found {
+		return 0, false, err
+	}
+	switch {
+	case quantity > previous:
+		cartAddTotal.Inc()
+	case quantity < previous:
+		cartRemoveTotal.Inc()
+	}
+	return previous, true, nil
+}
+
+func (s *RedisCartStore) Clear(ctx context.Context, cartName string) (uniqueItems, totalQuantity int, err error) {
+	err = s.apply(ctx, cartName, func() error {
+		result, err := redisClearScript.Run(ctx, s.client, []string{s.key(cartName)}, s.ttl.Milliseconds()).Int64Slice()
+		if err != nil {
+			return &CartStorageError{Err: err}
+		}
+		uniqueItems, totalQuantity = int(result[0]), int(result[1])
+		return nil
+	}, func(c *Cart) {
+		c.Clear(ctx)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	cartRemoveTotal.Add(float64(uniqueItems))
+	return uniqueItems, totalQuantity, nil
+}
+
+// Update runs fn on the carts as read from Redis and writes back the lines
+// it changed in a MULTI block. The carts are WATCHed, so a change another
+// replica makes in between, or deleting one of them, fails the update with
+// errCartConflict instead of being overwritten.
+func (s *RedisCartStore) Update(ctx context.Context, cartNames []string, fn func(carts []*Cart) error) error {
+	keys := make([]string, len(cartNames))
+	for i, name := range cartNames {
+		if err := s.checkCart(ctx, name); err != nil {
+			return err
+		}
+		keys[i] = s.key(name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var fnErr error
+	var restores []func()
+	changed := false
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		targets := make([]*Cart, len(cartNames))
+		states := make([]cartState, len(cartNames))
+		for i, name := range cartNames {
+			lines, budget, err := s.read(ctx, tx, name)
+			if err != nil {
+				return err
+			}
+			targets[i] = s.carts.ensure(name)
+			targets[i].load(lines)
+			targets[i].SetBudget(budget)
+			states[i] = stateOf(targets[i])
+			restores = append(restores, targets[i].keepJournal())
+		}
+		fnErr = fn(targets)
+
+		type write struct {
+			lines   []*CartItem
+			removed []string
+			budget  bool
+		}
+		writes := make([]write, len(targets))
+		for i, c := range targets {
+			writes[i].lines, writes[i].removed = states[i].changes(c)
+			writes[i].budget = c.Budget() != states[i].budget
+			changed = changed || len(writes[i].lines) > 0 || len(writes[i].removed) > 0 || writes[i].budget
+		}
+		if !changed {
+			return nil
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, c := range targets {
+				if len(writes[i].lines) == 0 && len(writes[i].removed) == 0 && !writes[i].budget {
+					continue
+				}
+				for _, item := range writes[i].lines {
+					line, err := encodeRedisLine(item)
+					if err != nil {
+						return err
+					}
+					pipe.HSet(ctx, keys[i], "q:"+item.ID, item.Quantity, "i:"+item.ID, line, "u:"+item.ID, item.UpdatedAt.UnixNano())
+				}
+				for _, id := range writes[i].removed {
+					pipe.HDel(ctx, keys[i], "q:"+id, "i:"+id, "u:"+id)
+				}
+				uniqueItems, totalQuantity := c.Totals()
+				pipe.HSet(ctx, keys[i], "#lines", uniqueItems, "#total", totalQuantity)
+				if budget := c.Budget(); writes[i].budget && budget.set() {
+					encoded, err := json.Marshal(budget)
+					if err != nil {
+						return err
+					}
+					pipe.HSet(ctx, keys[i], "#budget", encoded)
+				} else if writes[i].budget {
+					pipe.HDel(ctx, keys[i], "#budget")
+				}
+				if s.ttl > 0 {
+					pipe.PExpire(ctx, keys[i], s.ttl)
+				}
+			}
+			return nil
+		})
+		return err
+	}, append(keys, s.cartsKey())...)
+	if err != nil {
+		for _, restore := range restores {
+			restore()
+		}
+		if errors.Is(err, redis.TxFailedErr) {
+			return errCartConflict
+		}
+		var storageErr *CartStorageError
+		if errors.As(err, &storageErr) {
+			return err
+		}
+		return &CartStorageError{Err: err}
+	}
+	if changed {
+		notifyCartChanged()
+	}
+	return fnErr
+}
+
+func (s *RedisCartStore) View(ctx context.Context, cartName string, fn func(c *Cart) error) error {
+	if err := s.checkCart(ctx, cartName); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	lines, budget, err := s.read(ctx, s.client, cartName)
+	if err != nil {
+		return err
+	}
+	c := s.carts.ensure(cartName)
+	c.load(lines)
+	c.SetBudget(budget)
+	return fn(c)
+}
+
+func (s *RedisCartStore) Carts(ctx context.Context) ([]string, error) {
+	names, err := s.client.SMembers(ctx, s.cartsKey()).Result()
+	if err != nil {
+		return nil, &CartStorageError{Err: err}
+	}
+	names = slices.DeleteFunc(names, func(name string) bool { return name == defaultCartName })
+	sort.Strings(names)
+	return append([]string{defaultCartName}, names...), nil
+}
+
+func (s *RedisCartStore) CreateCart(ctx context.Context, name string) error {
+	if err := validateCartName(name); err != nil {
+		return err
+	}
+	if name == defaultCartName {
+		return fmt.Errorf("cart %q already exists", name)
+	}
+	added, err := s.client.SAdd(ctx, s.cartsKey(), name).Result()
+	if err != nil {
+		return &CartStorageError{Err: err}
+	}
+	if added == 0 {
+		return fmt.Errorf("cart %q already exists", name)
+	}
+	s.carts.ensure(name)
+	return nil
+}
+
+// DeleteCart removes the cart from the set of carts and its hash together,
+// watching both so that a line another replica adds in between is not lost
+// without force.
+func (s *RedisCartStore) DeleteCart(ctx context.Context, name string, force bool) (int, error) {
+	if name == defaultCartName {
+		return 0, errors.New("the default cart cannot be deleted, use clear_cart to empty it")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var uniqueItems int
+	var deleteErr error
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.SIsMember(ctx, s.cartsKey(), name).Result()
+		if err != nil {
+			return err
+		}
+		if !exists {
+			deleteErr = &CartNotFoundError{Name: name}
+			return nil
+		}
+		lines, err := tx.HGet(ctx, s.key(name), "#lines").Int()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		uniqueItems = lines
+		if uniqueItems > 0 && !force {
+			deleteErr = fmt.Errorf("cart %q contains %d items, pass confirm=true to delete it", name, uniqueItems)
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SRem(ctx, s.cartsKey(), name)
+			pipe.Del(ctx, s.key(name))
+			return nil
+		})
+		return err
+	}, s.cartsKey(), s.key(name))
+	switch {
+	case errors.Is(err, redis.TxFailedErr):
+		return 0, errCartConflict
+	case err != nil:
+		return 0, &CartStorageError{Err: err}
+	case deleteErr != nil:
+		return uniqueItems, deleteErr
+	}
+	s.carts.Delete(name, true)
+	return uniqueItems, nil
+}
+
+// redisItem builds a line from its three hash fields.
+func redisItem(itemID, quantity, line, updatedAt string) (*CartItem, error) {
+	var stored redisLine
+	if err := json.Unmarshal([]byte(line), &stored); err != nil {
+		return nil, fmt.Errorf("failed to decode cart item %s: %w", itemID, err)
+	}
+	count, err := strconv.Atoi(quantity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quantity of cart item %s: %w", itemID, err)
+	}
+	updated, _ := strconv.ParseInt(updatedAt, 10, 64)
+	item := &CartItem{
+		ID:             itemID,
+		Title:          stored.Title,
+		Link:           stored.Link,
+		Price:          stored.Price,
+		Shop:           stored.Shop,
+		Description:    stored.Description,
+		Image:          stored.Image,
+		Quantity:       count,
+		Note:           stored.Note,
+		Tags:           stored.Tags,
+		Priority:       stored.Priority,
+		TargetPrice:    stored.TargetPrice,
+		TargetCurrency: stored.TargetCurrency,
+		AddedAt:        stored.AddedAt,
+		UpdatedAt:      time.Unix(0, updated),
+	}
+	item.updateParsedPrice()
+	return item, nil
+}
+
+func (s *RedisCartStore) Get(ctx context.Context, cartName, itemID string) (CartItem, bool, error) {
+	if err := s.checkCart(ctx, cartName); err != nil {
+		return CartItem{}, false, err
+	}
+	values, err := s.client.HMGet(ctx, s.key(cartName), "q:"+itemID, "i:"+itemID, "u:"+itemID).Result()
+	if err != nil {
+		return CartItem{}, false, &CartStorageError{Err: err}
+	}
+	quantity, ok := values[0].(string)
+	if !ok {
+		return CartItem{}, false, nil
+	}
+	line, _ := values[1].(string)
+	updatedAt, _ := values[2].(string)
+	item, err := redisItem(itemID, quantity, line, updatedAt)
+	if err != nil {
+		return CartItem{}, false, err
+	}
+	return *item, true, nil
+}
+
+func (s *RedisCartStore) List(ctx context.Context, cartName string) ([]*CartItem, error) {
+	if err := s.checkCart(ctx, cartName); err != nil {
+		return nil, err
+	}
+	lines, _, err := s.read(ctx, s.client, cartName)
+	return lines, err
+}
+
+// read reads the lines of a cart, in the order they were added, and its budget.
+func (s *RedisCartStore) read(ctx context.Context, client redis.Cmdable, cartName string) ([]*CartItem, Budget, error) {
+	fields, err := client.HGetAll(ctx, s.key(cartName)).Result()
+	if err != nil {
+		return nil, Budget{}, &CartStorageError{Err: err}
+	}
+
+	var budget Budget
+	if encoded, ok := fields["#budget"]; ok {
+		if err := json.Unmarshal([]byte(encoded), &budget); err != nil {
+			return nil, Budget{}, fmt.Errorf("failed to decode the budget of cart %q: %w", cartName, err)
+		}
+	}
+
+	items := []*CartItem{}
+	for field, quantity := range fields {
+		itemID, ok := strings.CutPrefix(field, "q:")
+		if !ok {
+			continue
+		}
+		item, err := redisItem(itemID, quantity, fields["i:"+itemID], fields["u:"+itemID])
+		if err != nil {
+			return nil, Budget{}, err
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].AddedAt.Equal(items[j].AddedAt) {
+			return items[i].AddedAt.Before(items[j].AddedAt)
+		}
+		return items[i].ID < items[j].ID
+	})
+	return items, budget, nil
+}
+
+// Versions is not supported: the replicas share the carts but each would
+// keep versions of its own.
+func (s *RedisCartStore) Versions(ctx context.Context, cartName string) ([]CartVersion, error) {
+	if err := s.checkCart(ctx, cartName); err != nil {
+		return nil, err
+	}
+	return nil, errCartVersionsUnsupported
+}
+
+func (s *RedisCartStore) Rollback(ctx context.Context, cartName string, versionID int) (CartVersion, cartDiff, error) {
+	if err := s.checkCart(ctx, cartName); err != nil {
+		return CartVersion{}, cartDiff{}, err
+	}
+	return CartVersion{}, cartDiff{}, errCartVersionsUnsupported
+}
+
+// Sync makes the in-memory carts match Redis at startup, since another
+// replica may have changed them while this one was down. When Redis does not
+// list any carts yet, the named carts this replica kept on disk are
+// registered there first, so they survive the upgrade to shared cart names.
+func (s *RedisCartStore) Sync(ctx context.Context) error {
+	listed, err := s.client.Exists(ctx, s.cartsKey()).Result()
+	if err != nil {
+		return &CartStorageError{Err: err}
+	}
+	if local := slices.DeleteFunc(s.carts.Names(), func(name string) bool { return name == defaultCartName }); listed == 0 && len(local) > 0 {
+		if err := s.client.SAdd(ctx, s.cartsKey(), local).Err(); err != nil {
+			return &CartStorageError{Err: err}
+		}
+	}
+
+	names, err := s.Carts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range s.carts.Names() {
+		if !slices.Contains(names, name) {
+			s.carts.Delete(name, true)
+		}
+	}
+	for _, name := range names {
+		lines, budget, err := s.read(ctx, s.client, name)
+		if err != nil {
+			return err
+		}
+		c := s.carts.ensure(name)
+		c.load(lines)
+		c.SetBudget(budget)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newTestRedisCartStore connects a store with carts of its own to the server
+// at url and creates the named carts there unless another store already has.
+func newTestRedisCartStore(t *testing.T, url string, names ...string) *RedisCartStore {
+	t.Helper()
+	store, err := NewRedisCartStore(url, defaultRedisKeyPrefix, 0, newTestCartRegistry())
+	if err != nil {
+		t.Fatalf("NewRedisCartStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	existing, _ := store.Carts(t.Context())
+	for _, name := range names {
+		if slices.Contains(existing, name) {
+			continue
+		}
+		if err := store.CreateCart(t.Context(), name); err != nil {
+			t.Fatalf("CreateCart(%q) error = %v", name, err)
+		}
+	}
+	return store
+}
+
+// TestRedisCartStoreReplicas checks that two stores on the same server, as
+// two replicas would have, see each other's changes.
+func TestRedisCartStoreReplicas(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	url := "redis://" + miniredis.RunT(t).Addr()
+	first := newTestRedisCartStore(t, url, "home")
+	second := newTestRedisCartStore(t, url, "home")
+
+	if _, err := first.Add(ctx, "home", CartItem{ID: "kettle", Title: "Чайник", Price: "2 990 ₽"}, 2); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	quantity, err := second.Add(ctx, "home", CartItem{ID: "kettle", Title: "Чайник"}, 3)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if quantity != 5 {
+		t.Errorf("Add() on the second replica = %d, want 5", quantity)
+	}
+
+	item, found, err := first.Get(ctx, "home", "kettle")
+	if err != nil || !found || item.Quantity != 5 || !item.PriceParsed {
+		t.Errorf("Get() on the first replica = %+v, %v, %v, want kettle × 5 with a parsed price", item, found, err)
+	}
+
+	if err := second.Sync(ctx); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	home, _ := second.carts.Get("home")
+	if lines := home.Snapshot(); len(lines) != 1 || lines[0].Quantity != 5 {
+		t.Errorf("in-memory cart after Sync() = %v, want kettle × 5", lines)
+	}
+}
+
+// TestRedisCartStoreReplicaTools runs cart tools on two replicas in turn:
+// whatever one of them changes, including which carts exist and their
+// budgets, the other one shows on its next call.
+func TestRedisCartStoreReplicaTools(t *testing.T) {
+	t.Parallel()
+
+	url := "redis://" + miniredis.RunT(t).Addr()
+	replicas := []*Server{
+		NewServer(newTestRedisCartStore(t, url), nil),
+		NewServer(newTestRedisCartStore(t, url), nil),
+	}
+
+	steps := []struct {
+		replica   int
+		tool      string
+		args      map[string]any
+		wantError bool
+		want      []string
+	}{
+		{replica: 0, tool: "create_cart", args: map[string]any{"name": "дача"}},
+		{replica: 1, tool: "list_carts", want: []string{"• дача — позиций: 0"}},
+		{replica: 0, tool: "add_to_cart", args: map[string]any{"cart": "дача", "item_id": "kettle", "title": "Чайник", "price": "2 990 ₽", "quantity": float64(2)}},
+		{replica: 0, tool: "set_budget", args: map[string]any{"cart": "дача", "amount": float64(10000)}},
+		{replica: 1, tool: "view_cart", args: map[string]any{"cart": "дача"}, want: []string{"Чайник", "Количество: 2", "Бюджет: 10000.00 RUB"}},
+		{replica: 1, tool: "clear_cart", args: map[string]any{"cart": "дача", "confirm": true}},
+		{replica: 0, tool: "view_cart", args: map[string]any{"cart": "дача"}, want: []string{"пуста"}},
+		{replica: 0, tool: "get_budget", args: map[string]any{"cart": "дача"}, want: []string{"Бюджет: 10000.00 RUB"}},
+		{replica: 1, tool: "delete_cart", args: map[string]any{"name": "дача"}},
+		{replica: 0, tool: "view_cart", args: map[string]any{"cart": "дача"}, wantError: true, want: []string{`cart "дача" does not exist`}},
+	}
+	for i, step := range steps {
+		srv := replicas[step.replica]
+		handler := map[string]func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error){
+			"create_cart": srv.handleCreateCart,
+			"list_carts":  srv.handleListCarts,
+			"add_to_cart": srv.handleAddToCart,
+			"set_budget":  srv.handleSetBudget,
+			"get_budget":  srv.handleGetBudget,
+			"view_cart":   srv.handleViewCart,
+			"clear_cart":  srv.handleClearCart,
+			"delete_cart": srv.handleDeleteCart,
+		}[step.tool]
+		var request mcp.CallToolRequest
+		request.Params.Arguments = step.args
+		result, err := handler(t.Context(), request)
+		if err != nil {
+			t.Fatalf("step %d: %s error = %v", i, step.tool, err)
+		}
+		text := toolResultText(result)
+		if result.IsError != step.wantError {
+			t.Fatalf("step %d: %s on replica %d IsError = %t, want %t; text: %s", i, step.tool, step.replica, result.IsError, step.wantError, text)
+		}
+		for _, want := range step.want {
+			if !strings.Contains(text, want) {
+				t.Errorf("step %d: %s on replica %d does not contain %q:\n%s", i, step.tool, step.replica, want, text)
+			}
+		}
+	}
+}
+
+func TestRedisCartStoreTTL(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	server := miniredis.RunT(t)
+	store, err := NewRedisCartStore("redis://"+server.Addr(), "test:", time.Hour, newTestCartRegistry())
+	if err != nil {
+		t.Fatalf("NewRedisCartStore() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.CreateCart(ctx, "home"); err != nil {
+		t.Fatalf("CreateCart() error = %v", err)
+	}
+
+	if _, err := store.Add(ctx, "home", CartItem{ID: "kettle", Title: "Чайник"}, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if ttl := server.TTL("test:cart:home"); ttl != time.Hour {
+		t.Errorf("TTL of test:cart:home = %v, want %v", ttl, time.Hour)
+	}
+	server.FastForward(2 * time.Hour)
+	if lines, err := store.List(ctx, "home"); err != nil || len(lines) != 0 {
+		t.Errorf("List() after the TTL = %v, %v, want an empty cart", lines, err)
+	}
+}
+
+func TestRedisCartStoreUnavailable(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	server := miniredis.RunT(t)
+	store := newTestRedisCartStore(t, "redis://"+server.Addr(), "home")
+	server.Close()
+
+	_, err := store.Add(ctx, "home", CartItem{ID: "kettle", Title: "Чайник"}, 1)
+	if err == nil || !strings.Contains(err.Error(), "cart storage unavailable") {
+		t.Errorf("Add() with Redis down error = %v, want cart storage unavailable", err)
+	}
+	if _, err := store.List(ctx, "home"); err == nil || !strings.Contains(err.Error(), "cart storage unavailable") {
+		t.Errorf("List() with Redis down error = %v, want cart storage unavailable", err)
+	}
+}
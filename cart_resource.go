@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const cartResourceURI = "shopping://cart"
+
+// cartNotifier is the server whose clients are told about cart changes.
+var cartNotifier *server.MCPServer
+
+type cartSnapshot struct {
+	UniqueItems   int         `json:"unique_items"`
+	TotalQuantity int         `json:"total_quantity"`
+	Items         []*CartItem `json:"items"`
+}
+
+func registerCartResource(s *server.MCPServer, srv *Server) {
+	s.AddResource(mcp.Resource{
+		URI:         cartResourceURI,
+		Name:        "Корзина",
+		Description: "Текущее содержимое корзины в формате JSON",
+		MIMEType:    "application/json",
+	}, srv.handleReadCart)
+	cartNotifier = s
+}
+
+func (s *Server) handleReadCart(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	items, err := s.store.List(ctx, defaultCartName)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := cartSnapshot{UniqueItems: len(items), Items: items}
+	for _, item := range items {
+		snapshot.TotalQuantity += item.Quantity
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cart: %w", err)
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      cartResourceURI,
+			MIMEType: "application/json",
+			Text:     string(data),
+		},
+	}, nil
+}
+
+// cartChanged runs after every cart mutation: it saves the cart through
+// persistence and tells clients that shopping://cart has new content. mcp-go
+// does not track resources/subscribe requests, so the update goes to every
+// initialized session.
+func cartChanged(persistence CartPersistence) {
+	persistCart(persistence)
+	notifyCartChanged()
+}
+
+// notifySessionCartChanged tells only the client of one session that
+// shopping://cart has new content, since the other sessions have carts of
+// their own.
+func notifySessionCartChanged(ctx context.Context, sessionID string) {
+	if cartNotifier == nil {
+		return
+	}
+	err := cartNotifier.SendNotificationToSpecificClient(sessionID, mcp.MethodNotificationResourceUpdated, map[string]any{
+		"uri": cartResourceURI,
+	})
+	if err != nil {
+		slog.DebugContext(ctx, "cart change notification not sent", "session", sessionID, "error", err)
+	}
+}
+
+// notifyCartChanged tells clients that shopping://cart has new content.
+func notifyCartChanged() {
+	if cartNotifier != nil {
+		cartNotifier.SendNotificationToAllClients(mcp.MethodNotificationResourceUpdated, map[string]any{
+			"uri": cartResourceURI,
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	cartScopeGlobal  = "global"
+	cartScopeSession = "session"
+
+	defaultCartScope      = cartScopeGlobal
+	defaultCartSessionTTL = 2 * time.Hour
+)
+
+// sessionCartState is what one MCP session sees with CART_SCOPE=session: its
+// own carts and their versions.
+type sessionCartState struct {
+	registry *CartRegistry
+	versions *CartVersions
+	lastUsed time.Time
+}
+
+// SessionCartStore keeps separate carts for every MCP session. A session's
+// carts are created on its first cart tool call and dropped when the
+// session is unregistered or has been idle for longer than ttl. Session
+// carts live in memory only and are not saved to the cart file.
+type SessionCartStore struct {
+	sessions map[string]*sessionCartState
+	ttl      time.Duration
+	now      func() time.Time
+	mutex    sync.Mutex
+}
+
+// sessionCarts is nil unless CART_SCOPE=session, in which case the carts of
+// every tool call come from the session of the call.
+var sessionCarts *SessionCartStore
+
+// errSessionScopeUnsupported is returned by the snapshot and backup tools
+// in calls with a session of their own: snapshots and backups hold the
+// global carts, so they would show one session the carts of the others.
+var errSessionScopeUnsupported = errors.New("snapshots and backups are shared by all sessions and are not available with CART_SCOPE=session")
+
+// sessionScoped reports whether a call works on the carts of its own session.
+func sessionScoped(ctx context.Context) bool {
+	return sessionCarts != nil && sessionIDFromContext(ctx) != ""
+}
+
+// historySession returns the session whose cart history a call may see, or
+// an empty string for the whole history.
+func historySession(ctx context.Context) string {
+	if !sessionScoped(ctx) {
+		return ""
+	}
+	return sessionIDFromContext(ctx)
+}
+
+func NewSessionCartStore(ttl time.Duration) *SessionCartStore {
+	return &SessionCartStore{
+		sessions: make(map[string]*sessionCartState),
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// state returns the carts of a session, creating them on first use. Calls
+// without a session get nil and fall back to the global carts.
+func (s *SessionCartStore) state(ctx context.Context) *sessionCartState {
+	if s == nil {
+		return nil
+	}
+	sessionID := sessionIDFromContext(ctx)
+	if sessionID == "" {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, ok := s.sessions[sessionID]
+	if !ok {
+		state = &sessionCartState{
+			registry: &CartRegistry{carts: map[string]*Cart{defaultCartName: NewCart(defaultCartName)}},
+			versions: NewCartVersions(),
+		}
+		s.sessions[sessionID] = state
+		slog.DebugContext(ctx, "session carts created", "session", sessionID)
+	}
+	state.lastUsed = s.now()
+	return state
+}
+
+// Close drops the carts of a session that has ended.
+func (s *SessionCartStore) Close(sessionID string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.sessions[sessionID]; ok {
+		delete(s.sessions, sessionID)
+		slog.Debug("session carts dropped", "session", sessionID)
+	}
+}
+
+// Sweep drops the carts of sessions idle for longer than the TTL, which is
+// how sessions that were abandoned without being closed are cleaned up. It
+// returns the number of sessions dropped.
+func (s *SessionCartStore) Sweep() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	dropped := 0
+	for sessionID, state := range s.sessions {
+		if now.Sub(state.lastUsed) > s.ttl {
+			delete(s.sessions, sessionID)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Len returns the number of sessions that have carts.
+func (s *SessionCartStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.sessions)
+}
+
+// StartSweeping drops idle sessions every ttl until stop is closed.
+func (s *SessionCartStore) StartSweeping(stop <-chan struct{}) {
+	if s.ttl <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.ttl)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if dropped := s.Sweep(); dropped > 0 {
+					slog.Info("idle session carts dropped", "sessions", dropped)
+				}
+			}
+		}
+	}()
+}
+
+// sessionCartHooks drops the carts of a session when the MCP server
+// unregisters it. The streamable HTTP transport only does that for its
+// long-lived GET streams, so the idle TTL is still needed.
+func sessionCartHooks() *server.Hooks {
+	hooks := &server.Hooks{}
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		sessionCarts.Close(session.SessionID())
+	})
+	return hooks
+}
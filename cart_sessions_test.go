@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// testSession is a client session as the streamable HTTP server puts it in
+// the context of every call.
+type testSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s testSession) Initialize()                                         {}
+func (s testSession) Initialized() bool                                   { return true }
+func (s testSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+func (s testSession) SessionID() string                                   { return s.id }
+
+func withTestSession(ctx context.Context, sessionID string) context.Context {
+	return server.NewMCPServer("test", "1.0").WithContext(ctx, testSession{id: sessionID})
+}
+
+func TestMemoryCartStoreSessions(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryCartStore(newTestCartRegistry(defaultCartName))
+	store.sessions = NewSessionCartStore(time.Hour)
+	alice := withTestSession(t.Context(), "alice")
+	bob := withTestSession(t.Context(), "bob")
+
+	if _, err := store.Add(alice, defaultCartName, CartItem{ID: "kettle", Title: "Чайник"}, 2); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := store.Add(bob, defaultCartName, CartItem{ID: "mug", Title: "Кружка"}, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		want []string
+	}{
+		{name: "alice", ctx: alice, want: []string{"kettle"}},
+		{name: "bob", ctx: bob, want: []string{"mug"}},
+		{name: "no session", ctx: t.Context(), want: []string{}},
+	} {
+		lines, err := store.List(tt.ctx, defaultCartName)
+		if err != nil {
+			t.Fatalf("%s: List() error = %v", tt.name, err)
+		}
+		if got := lineIDs(lines); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: cart = %v, want %v", tt.name, got, tt.want)
+		}
+		versions, err := store.Versions(tt.ctx, defaultCartName)
+		if err != nil || len(versions) != len(tt.want) {
+			t.Errorf("%s: Versions() = %+v, %v, want %d", tt.name, versions, err, len(tt.want))
+		}
+	}
+	if n := store.sessions.Len(); n != 2 {
+		t.Errorf("sessions = %d, want 2", n)
+	}
+}
+
+func TestSessionCartsCleanup(t *testing.T) {
+	prev := sessionCarts
+	t.Cleanup(func() { sessionCarts = prev })
+	clock := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	sessionCarts = NewSessionCartStore(time.Hour)
+	sessionCarts.now = func() time.Time { return clock }
+	store := NewMemoryCartStore(carts)
+	store.sessions = sessionCarts
+	srv := NewServer(store, nil)
+
+	call := func(ctx context.Context, handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) string {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = args
+		result, err := handler(ctx, request)
+		if err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		if result.IsError {
+			t.Fatalf("unexpected error: %s", toolResultText(result))
+		}
+		return toolResultText(result)
+	}
+
+	active := withTestSession(t.Context(), "active")
+	abandoned := withTestSession(t.Context(), "abandoned")
+	call(abandoned, srv.handleCreateCart, map[string]any{"name": "дача"})
+	if text := call(active, srv.handleListCarts, nil); strings.Contains(text, "дача") {
+		t.Errorf("list_carts of another session = %q, want no «дача»", text)
+	}
+	if _, ok := carts.Get("дача"); ok {
+		t.Error("cart created in a session was added to the global carts")
+	}
+
+	// The abandoned session makes no more calls; the active one keeps going.
+	clock = clock.Add(45 * time.Minute)
+	call(active, srv.handleListCarts, nil)
+	clock = clock.Add(30 * time.Minute)
+	if dropped := sessionCarts.Sweep(); dropped != 1 {
+		t.Errorf("Sweep() = %d, want the abandoned session dropped", dropped)
+	}
+	if n := sessionCarts.Len(); n != 1 {
+		t.Errorf("sessions after Sweep() = %d, want 1", n)
+	}
+	if text := call(abandoned, srv.handleListCarts, nil); strings.Contains(text, "дача") {
+		t.Errorf("list_carts after the session expired = %q, want fresh carts", text)
+	}
+
+	// Unregistering a session drops its carts right away.
+	s := server.NewMCPServer("test", "1.0", server.WithHooks(sessionCartHooks()))
+	if err := s.RegisterSession(t.Context(), testSession{id: "active"}); err != nil {
+		t.Fatalf("RegisterSession() error = %v", err)
+	}
+	s.UnregisterSession(t.Context(), "active")
+	if n := sessionCarts.Len(); n != 1 {
+		t.Errorf("sessions after UnregisterSession() = %d, want only the renewed one", n)
+	}
+}
+
+// TestSessionScopedTools checks that with CART_SCOPE=session a session only
+// sees its own history, undo and change notifications, and that the
+// snapshot and backup tools, which hold the global carts, are refused.
+func TestSessionScopedTools(t *testing.T) {
+	prevSessions, prevNotifier := sessionCarts, cartNotifier
+	t.Cleanup(func() { sessionCarts, cartNotifier = prevSessions, prevNotifier })
+	useCartBackups(t, 10)
+	sessionCarts = NewSessionCartStore(time.Hour)
+	store := NewMemoryCartStore(newTestCartRegistry(defaultCartName))
+	store.sessions = sessionCarts
+	srv := NewServer(store, nil)
+
+	cartNotifier = server.NewMCPServer("test", "1.0")
+	sessions := map[string]testSession{}
+	for _, id := range []string{"scope-alice", "scope-bob"} {
+		sessions[id] = testSession{id: id, notifications: make(chan mcp.JSONRPCNotification, 10)}
+		if err := cartNotifier.RegisterSession(t.Context(), sessions[id]); err != nil {
+			t.Fatalf("RegisterSession() error = %v", err)
+		}
+	}
+	alice := withTestSession(t.Context(), "scope-alice")
+	bob := withTestSession(t.Context(), "scope-bob")
+
+	call := func(ctx context.Context, handler func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		var request mcp.CallToolRequest
+		request.Params.Arguments = args
+		result, err := handler(ctx, request)
+		if err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		return result
+	}
+
+	if result := call(alice, srv.handleAddToCart, map[string]any{"item_id": "kettle", "title": "Чайник", "quantity": float64(2)}); result.IsError {
+		t.Fatalf("add_to_cart error: %s", toolResultText(result))
+	}
+	if n := len(sessions["scope-alice"].notifications); n != 1 {
+		t.Errorf("notifications to the changing session = %d, want 1", n)
+	}
+	if n := len(sessions["scope-bob"].notifications); n != 0 {
+		t.Errorf("notifications to another session = %d, want 0", n)
+	}
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		handler   func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)
+		args      map[string]any
+		wantError bool
+		want      string
+		absent    string
+	}{
+		{name: "own history", ctx: alice, handler: handleCartHistory, want: "kettle"},
+		{name: "history of another session", ctx: bob, handler: handleCartHistory, want: "пуста", absent: "kettle"},
+		{name: "undo in another session", ctx: bob, handler: srv.handleUndoCart, want: "Нечего отменять"},
+		{name: "snapshot_cart", ctx: alice, handler: srv.handleSnapshotCart, args: map[string]any{"name": "before"}, wantError: true, want: "CART_SCOPE=session"},
+		{name: "list_snapshots", ctx: alice, handler: handleListSnapshots, wantError: true, want: "CART_SCOPE=session"},
+		{name: "restore_snapshot", ctx: alice, handler: srv.handleRestoreSnapshot, args: map[string]any{"name": "before"}, wantError: true, want: "CART_SCOPE=session"},
+		{name: "list_backups", ctx: alice, handler: handleListBackups, wantError: true, want: "CART_SCOPE=session"},
+		{name: "restore_backup", ctx: alice, handler: srv.handleRestoreBackup, args: map[string]any{"name": "cart.json"}, wantError: true, want: "CART_SCOPE=session"},
+		{name: "diff against a snapshot", ctx: alice, handler: srv.handleDiffCarts, args: map[string]any{"a": "snapshot:before", "b": "default"}, wantError: true, want: "CART_SCOPE=session"},
+		{name: "own undo", ctx: alice, handler: srv.handleUndoCart, want: "Чайник"},
+	}
+	for _, tt := range tests {
+		result := call(tt.ctx, tt.handler, tt.args)
+		text := toolResultText(result)
+		if result.IsError != tt.wantError {
+			t.Errorf("%s: IsError = %t, want %t; text: %s", tt.name, result.IsError, tt.wantError, text)
+		}
+		if !strings.Contains(text, tt.want) {
+			t.Errorf("%s: result does not contain %q:\n%s", tt.name, tt.want, text)
+		}
+		if tt.absent != "" && strings.Contains(text, tt.absent) {
+			t.Errorf("%s: result contains %q:\n%s", tt.name, tt.absent, text)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	maxCartSnapshots      = 20
+	maxSnapshotNameLength = 64
+	maxSnapshotDescLength = 200
+)
+
+// CartSnapshot is an immutable copy of a cart taken by snapshot_cart.
+type CartSnapshot struct {
+	Name        string      `json:"name"`
+	Cart        string      `json:"cart"`
+	Description string      `json:"description,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Items       []*CartItem `json:"items"`
+}
+
+func (s CartSnapshot) clone() CartSnapshot {
+	items := make([]*CartItem, len(s.Items))
+	for i, item := range s.Items {
+		items[i] = item.clone()
+	}
+	s.Items = items
+	return s
+}
+
+// SnapshotStore keeps up to maxCartSnapshots snapshots, oldest first. They
+// are persisted in the cart file.
+type SnapshotStore struct {
+	snapshots []CartSnapshot
+	mutex     sync.RWMutex
+}
+
+var cartSnapshots = &SnapshotStore{}
+
+// Add stores a snapshot under a new name and evicts the oldest ones once
+// there are more than maxCartSnapshots. It returns the evicted names.
+func (s *SnapshotStore) Add(snapshot CartSnapshot) (evicted []string, err error) {
+	if snapshot.Name == "" || utf8.RuneCountInString(snapshot.Name) > maxSnapshotNameLength {
+		return nil, fmt.Errorf("snapshot name must be 1 to %d characters long", maxSnapshotNameLength)
+	}
+	if utf8.RuneCountInString(snapshot.Description) > maxSnapshotDescLength {
+		return nil, fmt.Errorf("snapshot description is limited to %d characters", maxSnapshotDescLength)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, existing := range s.snapshots {
+		if existing.Name == snapshot.Name {
+			return nil, fmt.Errorf("snapshot %q already exists, snapshots cannot be overwritten", snapshot.Name)
+		}
+	}
+	s.snapshots = append(s.snapshots, snapshot.clone())
+	for len(s.snapshots) > maxCartSnapshots {
+		evicted = append(evicted, s.snapshots[0].Name)
+		s.snapshots = append(s.snapshots[:0], s.snapshots[1:]...)
+	}
+	return evicted, nil
+}
+
+func (s *SnapshotStore) Get(name string) (CartSnapshot, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, snapshot := range s.snapshots {
+		if snapshot.Name == name {
+			return snapshot.clone(), true
+		}
+	}
+	return CartSnapshot{}, false
+}
+
+// List returns copies of all snapshots, oldest first.
+func (s *SnapshotStore) List() []CartSnapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := make([]CartSnapshot, len(s.snapshots))
+	for i, snapshot := range s.snapshots {
+		result[i] = snapshot.clone()
+	}
+	return result
+}
+
+// load replaces all snapshots with the ones read from disk.
+func (s *SnapshotStore) load(snapshots []CartSnapshot) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt) })
+	s.snapshots = nil
+	for _, snapshot := range snapshots {
+		if snapshot.Name == "" {
+			continue
+		}
+		for _, item := range snapshot.Items {
+			if item != nil {
+				item.updateParsedPrice()
+			}
+		}
+		s.snapshots = append(s.snapshots, snapshot)
+	}
+	if extra := len(s.snapshots) - maxCartSnapshots; extra > 0 {
+		s.snapshots = s.snapshots[extra:]
+	}
+}
+
+// RestoreSnapshot replaces the contents of c with copies of items in one
+// step. Lines that disappear go to the trash, and the whole restore can be
+// reverted with undo_cart.
+func (c *Cart) RestoreSnapshot(ctx context.Context, items []*CartItem) cartDiff {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	restored := make(map[string]*CartItem, len(items))
+	after := make([]*CartItem, 0, len(items))
+	for _, item := range items {
+		if item != nil && item.ID != "" {
+			restored[item.ID] = item.clone()
+			after = append(after, item.clone())
+		}
+	}
+	before := make([]*CartItem, 0, len(c.Items))
+	ids := make([]string, 0, len(restored)+len(c.Items))
+	for id, item := range c.Items {
+		before = append(before, item.clone())
+		if _, kept := restored[id]; !kept {
+			ids = append(ids, id)
+		}
+	}
+	for id := range restored {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	diff := diffCartItems(before, after)
+	c.recordLocked("restore_snapshot", ids...)
+
+	for _, item := range diff.Removed {
+		c.trashLocked(c.Items[item.ID])
+	}
+	now := c.now()
+	for _, item := range restored {
+		item.UpdatedAt = now
+	}
+	c.Items = restored
+	return diff
+}
+
+// snapshotCart stores the lines of a cart taken at createdAt and persists them.
+func (s *Server) snapshotCart(items []*CartItem, cartName, name, description string, createdAt time.Time) (CartSnapshot, []string, error) {
+	snapshot := CartSnapshot{
+		Name:        name,
+		Cart:        cartName,
+		Description: description,
+		CreatedAt:   createdAt,
+		Items:       items,
+	}
+	evicted, err := cartSnapshots.Add(snapshot)
+	if err != nil {
+		return CartSnapshot{}, nil, err
+	}
+	cartChanged(s.persistence)
+	return snapshot, evicted, nil
+}
+
+func (s *Server) handleSnapshotCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if sessionScoped(ctx) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: errSessionScopeUnsupported.Error()},
+			},
+		}, nil
+	}
+	args, _ := request.Params.Arguments.(map[string]any)
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+	description, _ := args["description"].(string)
+	description = strings.TrimSpace(description)
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	var items []*CartItem
+	var now time.Time
+	err = s.store.View(ctx, cartName, func(c *Cart) error {
+		items, now = c.Snapshot(), c.now()
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	snapshot, evicted, err := s.snapshotCart(items, cartName, name, description, now)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart snapshot saved", "snapshot", name, "cart", cartName, "items", len(snapshot.Items), "evicted", len(evicted))
+
+	result := fmt.Sprintf(`📸 Снимок «%s» корзины%s сохранён (позиций: %d)
+
+💡 Используйте restore_snapshot с name="%s", чтобы вернуть корзину к этому состоянию`,
+		name, cartLabel(cartName), len(snapshot.Items), name)
+	if len(evicted) > 0 {
+		result += fmt.Sprintf("\n🗑️ Удалены самые старые снимки (храним не больше %d): %s", maxCartSnapshots, strings.Join(evicted, ", "))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func handleListSnapshots(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if sessionScoped(ctx) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: errSessionScopeUnsupported.Error()},
+			},
+		}, nil
+	}
+	snapshots := cartSnapshots.List()
+	if len(snapshots) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "📸 Снимков корзины нет. Используйте snapshot_cart, чтобы сохранить текущее состояние"},
+			},
+		}, nil
+	}
+
+	now := time.Now()
+	var lines []string
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+		quantity := 0
+		for _, item := range snapshot.Items {
+			quantity += item.Quantity
+		}
+		line := fmt.Sprintf("• %s — корзина %s, позиций: %d, товаров: %d, создан %s",
+			snapshot.Name, snapshot.Cart, len(snapshot.Items), quantity, formatRelativeTime(snapshot.CreatedAt, now))
+		if snapshot.Description != "" {
+			line += "\n  📝 " + snapshot.Description
+		}
+		lines = append(lines, line)
+	}
+	result := fmt.Sprintf("📸 Снимки корзины (%d из %d), сначала новые:\n\n%s", len(snapshots), maxCartSnapshots, strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleRestoreSnapshot(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if sessionScoped(ctx) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: errSessionScopeUnsupported.Error()},
+			},
+		}, nil
+	}
+	args, _ := request.Params.Arguments.(map[string]any)
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+
+	snapshot, ok := cartSnapshots.Get(name)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("snapshot %q does not exist, use list_snapshots to see snapshots", name)},
+			},
+		}, nil
+	}
+
+	// The snapshot goes back into the cart it was taken from unless the call
+	// names another one.
+	target := snapshot.Cart
+	if value, ok := args["cart"].(string); ok && strings.TrimSpace(value) != "" {
+		target = value
+	}
+	cartName, err := cartNameFromArgs(map[string]any{"cart": target})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	backupBeforeChange(ctx, "restore_snapshot")
+	var diff cartDiff
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		diff = c.RestoreSnapshot(ctx, snapshot.Items)
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart snapshot restored", "snapshot", name, "cart", cartName,
+		"added", len(diff.Added), "removed", len(diff.Removed), "changed", len(diff.Changed))
+
+	changes := "Содержимое корзины не изменилось"
+	if !diff.empty() {
+		changes = diff.format()
+	}
+
+	result := fmt.Sprintf(`⏪ Корзина%s восстановлена из снимка «%s»
+
+%s
+
+💡 Удалённые позиции можно вернуть через restore_item, а всё восстановление отменить через undo_cart`,
+		cartLabel(cartName), name, changes)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// useCartSnapshots gives a test an empty snapshot store of its own.
+func useCartSnapshots(t *testing.T) {
+	t.Helper()
+	prev := cartSnapshots
+	t.Cleanup(func() { cartSnapshots = prev })
+	cartSnapshots = &SnapshotStore{}
+}
+
+func TestHandleSnapshotTools(t *testing.T) {
+	useCartSnapshots(t)
+
+	srv := NewServer(NewMemoryCartStore(newTestCartRegistry(defaultCartName, "дача")), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{name: "no snapshots yet", handler: handleListSnapshots, want: []string{"Снимков корзины нет"}},
+		{name: "add kettle", handler: srv.handleAddToCart, args: map[string]any{"item_id": "kettle", "title": "Чайник", "quantity": float64(2)}},
+		{name: "add mug", handler: srv.handleAddToCart, args: map[string]any{"item_id": "mug", "title": "Кружка"}},
+		{name: "snapshot", handler: srv.handleSnapshotCart, args: map[string]any{"name": "before", "description": "до распродажи"}, want: []string{"Снимок «before» корзины сохранён (позиций: 2)"}},
+		{name: "same name", handler: srv.handleSnapshotCart, args: map[string]any{"name": "before"}, wantError: true, want: []string{`snapshot "before" already exists`}},
+		{name: "no name", handler: srv.handleSnapshotCart, args: map[string]any{"name": " "}, wantError: true, want: []string{"snapshot name must be 1 to"}},
+		{name: "list", handler: handleListSnapshots, want: []string{"before — корзина default, позиций: 2, товаров: 3", "до распродажи"}},
+
+		{name: "remove mug", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "mug"}},
+		{name: "more kettles", handler: srv.handleSetQuantity, args: map[string]any{"item_id": "kettle", "quantity": float64(5)}},
+		{name: "add lamp", handler: srv.handleAddToCart, args: map[string]any{"item_id": "lamp", "title": "Лампа"}},
+		{
+			name:    "restore",
+			handler: srv.handleRestoreSnapshot,
+			args:    map[string]any{"name": "before"},
+			want:    []string{"Корзина восстановлена из снимка «before»", "➕ Добавлены (1):\n  • Кружка × 1", "➖ Удалены (1):\n  • Лампа × 1", "Чайник (ID: kettle): количество 5 → 2"},
+		},
+		{name: "lines replaced", handler: srv.handleViewCart, want: []string{"Чайник", "Количество: 2", "Кружка"}, wantAbsent: []string{"Лампа"}},
+		{name: "dropped line in the trash", handler: srv.handleViewRemoved, want: []string{"Лампа × 1"}},
+		{name: "undo the restore", handler: srv.handleUndoCart, want: []string{"Отменено: восстановление снимка корзины"}},
+		{name: "state before the restore", handler: srv.handleViewCart, want: []string{"Лампа", "Количество: 5"}, wantAbsent: []string{"Кружка"}},
+
+		{name: "into another cart", handler: srv.handleRestoreSnapshot, args: map[string]any{"name": "before", "cart": "дача"}, want: []string{"Корзина «дача» восстановлена из снимка «before»"}},
+		{name: "other cart filled", handler: srv.handleViewCart, args: map[string]any{"cart": "дача"}, want: []string{"Чайник", "Кружка"}},
+		{name: "unknown snapshot", handler: srv.handleRestoreSnapshot, args: map[string]any{"name": "missing"}, wantError: true, want: []string{`snapshot "missing" does not exist`}},
+		{name: "unknown cart", handler: srv.handleRestoreSnapshot, args: map[string]any{"name": "before", "cart": "офис"}, wantError: true, want: []string{`cart "офис" does not exist`}},
+	})
+}
+
+func TestSnapshotStoreEviction(t *testing.T) {
+	t.Parallel()
+
+	store := &SnapshotStore{}
+	created := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := range maxCartSnapshots + 2 {
+		evicted, err := store.Add(CartSnapshot{Name: fmt.Sprintf("s%02d", i), Cart: defaultCartName, CreatedAt: created.Add(time.Duration(i) * time.Minute)})
+		if err != nil {
+			t.Fatalf("Add(s%02d) error = %v", i, err)
+		}
+		if want := i >= maxCartSnapshots; (len(evicted) == 1) != want {
+			t.Errorf("Add(s%02d) evicted %v", i, evicted)
+		}
+	}
+	snapshots := store.List()
+	if len(snapshots) != maxCartSnapshots || snapshots[0].Name != "s02" {
+		t.Errorf("snapshots = %d starting at %s, want %d starting at s02", len(snapshots), snapshots[0].Name, maxCartSnapshots)
+	}
+	if _, ok := store.Get("s00"); ok {
+		t.Error("the oldest snapshot is still there after the eviction")
+	}
+}
+
+// TestRestoreSnapshotSessionScope checks that with CART_SCOPE=session
+// restore_snapshot is refused with errSessionScopeUnsupported and changes
+// neither the session cart nor the global one.
+func TestRestoreSnapshotSessionScope(t *testing.T) {
+	useCartSnapshots(t)
+	prev := sessionCarts
+	t.Cleanup(func() { sessionCarts = prev })
+	sessionCarts = NewSessionCartStore(time.Hour)
+
+	registry := newTestCartRegistry(defaultCartName)
+	home, _ := registry.Get(defaultCartName)
+	home.load([]*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 1}})
+	store := NewMemoryCartStore(registry)
+	store.sessions = sessionCarts
+	srv := NewServer(store, nil)
+	if _, _, err := srv.snapshotCart([]*CartItem{{ID: "mug", Title: "Кружка", Quantity: 3}}, defaultCartName, "before", "", time.Now()); err != nil {
+		t.Fatalf("snapshotCart() error = %v", err)
+	}
+
+	alice := withTestSession(t.Context(), "alice")
+	if _, err := store.Add(alice, defaultCartName, CartItem{ID: "lamp", Title: "Лампа"}, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]any{"name": "before"}
+	result, err := srv.handleRestoreSnapshot(alice, request)
+	if err != nil {
+		t.Fatalf("handleRestoreSnapshot() error = %v", err)
+	}
+	if text := toolResultText(result); !result.IsError || text != errSessionScopeUnsupported.Error() {
+		t.Errorf("restore_snapshot in a session = %q (IsError %t), want %q", text, result.IsError, errSessionScopeUnsupported)
+	}
+
+	if lines, _ := store.List(alice, defaultCartName); strings.Join(lineIDs(lines), ",") != "lamp" {
+		t.Errorf("session cart after the refused restore = %v, want lamp", lineIDs(lines))
+	}
+	if lines, _ := store.List(t.Context(), defaultCartName); strings.Join(lineIDs(lines), ",") != "kettle" {
+		t.Errorf("global cart after the refused restore = %v, want kettle", lineIDs(lines))
+	}
+}
@@ -0,0 +1,713 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultCartBackend = "memory"
+	defaultCartDBPath  = "cart.db"
+)
+
+// sqliteMigrations are applied in order at startup; PRAGMA user_version
+// records how many have run. Append new migrations, never edit old ones.
+var sqliteMigrations = []string{
+	`CREATE TABLE carts (
+		name            TEXT PRIMARY KEY,
+		budget_amount   REAL NOT NULL DEFAULT 0,
+		budget_currency TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE items (
+		cart            TEXT NOT NULL REFERENCES carts (name) ON DELETE CASCADE,
+		id              TEXT NOT NULL,
+		title           TEXT NOT NULL,
+		link            TEXT NOT NULL,
+		price           TEXT NOT NULL,
+		shop            TEXT NOT NULL,
+		description     TEXT NOT NULL,
+		quantity        INTEGER NOT NULL,
+		note            TEXT NOT NULL DEFAULT '',
+		tags            TEXT NOT NULL DEFAULT '[]',
+		priority        TEXT NOT NULL DEFAULT '',
+		target_price    REAL NOT NULL DEFAULT 0,
+		target_currency TEXT NOT NULL DEFAULT '',
+		added_at        INTEGER NOT NULL,
+		updated_at      INTEGER NOT NULL,
+		PRIMARY KEY (cart, id)
+	);
+	CREATE INDEX items_by_added ON items (cart, added_at, id);
+	CREATE TABLE history (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		cart           TEXT NOT NULL,
+		action         TEXT NOT NULL,
+		item_id        TEXT NOT NULL,
+		quantity_delta INTEGER NOT NULL,
+		tool           TEXT NOT NULL,
+		session        TEXT NOT NULL,
+		at             INTEGER NOT NULL
+	);
+	CREATE INDEX history_by_cart ON history (cart, at);
+	CREATE TABLE snapshots (
+		name        TEXT PRIMARY KEY,
+		cart        TEXT NOT NULL,
+		description TEXT NOT NULL,
+		created_at  INTEGER NOT NULL,
+		items       TEXT NOT NULL
+	);`,
+	`ALTER TABLE items ADD COLUMN image TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE versions (
+		cart        TEXT NOT NULL,
+		id          INTEGER NOT NULL,
+		created_at  INTEGER NOT NULL,
+		reason      TEXT NOT NULL,
+		rollback_of INTEGER NOT NULL DEFAULT 0,
+		items       TEXT NOT NULL,
+		PRIMARY KEY (cart, id)
+	);`,
+}
+
+// SQLiteCartStore keeps the carts in a SQLite database. Every change runs in
+// a transaction on the cart as stored, and each line it changes is logged to
+// the history table. The in-memory carts of the registry only keep what the
+// database does not: the undo journal and the trash. Save only writes the
+// snapshots, which the snapshot tools keep outside the store.
+type SQLiteCartStore struct {
+	db    *sql.DB
+	carts *CartRegistry
+	// mutex serializes the transactions, which share the in-memory carts.
+	mutex sync.Mutex
+	// changes counts the changes to each cart since its newest version.
+	changes map[string]int
+	now     func() time.Time
+}
+
+// NewSQLiteCartStore opens the database at path, creating it and applying
+// pending migrations as needed.
+func NewSQLiteCartStore(path string, registry *CartRegistry) (*SQLiteCartStore, error) {
+	if path == "" {
+		path = defaultCartDBPath
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cart database %s: %w", path, err)
+	}
+	// SQLite allows one writer at a time; a single connection avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteCartStore{db: db, carts: registry, changes: make(map[string]int), now: time.Now}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate cart database %s: %w", path, err)
+	}
+	if _, err := db.Exec("INSERT OR IGNORE INTO carts (name) VALUES (?)", defaultCartName); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create the default cart in %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *SQLiteCartStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteCartStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		slog.Info("cart database migrated", "version", i+1)
+	}
+	return nil
+}
+
+// transact runs fn in a transaction on the current state of existing carts:
+// each is loaded from the database into its in-memory cart, which keeps the
+// undo journal and trash, and the lines fn changed are written back and
+// logged to the history table. after, when set, runs once they are written.
+func (s *SQLiteCartStore) transact(ctx context.Context, cartNames []string, fn func(tx *sql.Tx, carts []*Cart) error, after func(tx *sql.Tx) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin cart transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	targets := make([]*Cart, len(cartNames))
+	states := make([]cartState, len(cartNames))
+	for i, name := range cartNames {
+		if targets[i], states[i], err = s.load(ctx, tx, name); err != nil {
+			return err
+		}
+	}
+	fnErr := fn(tx, targets)
+
+	changed := false
+	for i, c := range targets {
+		written, err := s.write(ctx, tx, cartNames[i], c, states[i])
+		if err != nil {
+			return err
+		}
+		changed = changed || written
+	}
+	if after != nil && fnErr == nil {
+		if err := after(tx); err != nil {
+			return err
+		}
+	}
+	for _, name := range cartNames {
+		if err := s.versionChanged(ctx, tx, name); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit cart transaction: %w", err)
+	}
+	if changed {
+		notifyCartChanged()
+	}
+	return fnErr
+}
+
+// load reads a cart into its in-memory cart and returns the state it was in.
+func (s *SQLiteCartStore) load(ctx context.Context, tx *sql.Tx, cartName string) (*Cart, cartState, error) {
+	var budget Budget
+	err := tx.QueryRowContext(ctx, "SELECT budget_amount, budget_currency FROM carts WHERE name = ?", cartName).Scan(&budget.Amount, &budget.Currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, cartState{}, &CartNotFoundError{Name: cartName}
+	}
+	if err != nil {
+		return nil, cartState{}, fmt.Errorf("failed to look up cart: %w", err)
+	}
+	items, err := listItems(ctx, tx, cartName)
+	if err != nil {
+		return nil, cartState{}, err
+	}
+	c := s.carts.ensure(cartName)
+	c.load(items)
+	c.SetBudget(budget)
+	return c, stateOf(c), nil
+}
+
+// write saves the lines and budget of c that differ from state, logging
+// every line to the history, and reports whether there were any.
+func (s *SQLiteCartStore) write(ctx context.Context, tx *sql.Tx, cartName string, c *Cart, state cartState) (bool, error) {
+	lines, removed := state.changes(c)
+	action := cmp.Or(c.takeLastAction(), "update")
+	for _, item := range lines {
+		values, err := itemValues(item, cartName)
+		if err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, upsertItemSQL, values...); err != nil {
+			return false, fmt.Errorf("failed to save cart item %s: %w", item.ID, err)
+		}
+		delta := item.Quantity
+		if before, ok := state.lines[item.ID]; ok {
+			delta -= before.Quantity
+		}
+		if err := s.logHistory(ctx, tx, cartName, action, item.ID, delta); err != nil {
+			return false, err
+		}
+	}
+	for _, id := range removed {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM items WHERE cart = ? AND id = ?", cartName, id); err != nil {
+			return false, fmt.Errorf("failed to delete cart item %s: %w", id, err)
+		}
+		if err := s.logHistory(ctx, tx, cartName, action, id, -state.lines[id].Quantity); err != nil {
+			return false, err
+		}
+	}
+
+	budget := c.Budget()
+	if budget != state.budget {
+		if _, err := tx.ExecContext(ctx, "UPDATE carts SET budget_amount = ?, budget_currency = ? WHERE name = ?",
+			budget.Amount, budget.Currency, cartName); err != nil {
+			return false, fmt.Errorf("failed to save the budget of cart %s: %w", cartName, err)
+		}
+	}
+	return len(lines) > 0 || len(removed) > 0 || budget != state.budget, nil
+}
+
+func (s *SQLiteCartStore) logHistory(ctx context.Context, tx *sql.Tx, cartName, action, itemID string, delta int) error {
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO history (cart, action, item_id, quantity_delta, tool, session, at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		cartName, action, itemID, delta, toolNameFromContext(ctx), sessionIDFromContext(ctx), s.now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to write cart history: %w", err)
+	}
+	s.changes[cartName]++
+	return nil
+}
+
+func (s *SQLiteCartStore) Update(ctx context.Context, cartNames []string, fn func(carts []*Cart) error) error {
+	return s.transact(ctx, cartNames, func(tx *sql.Tx, carts []*Cart) error {
+		return fn(carts)
+	}, nil)
+}
+
+func (s *SQLiteCartStore) View(ctx context.Context, cartName string, fn func(c *Cart) error) error {
+	return s.transact(ctx, []string{cartName}, func(tx *sql.Tx, carts []*Cart) error {
+		return fn(carts[0])
+	}, nil)
+}
+
+func (s *SQLiteCartStore) Add(ctx context.Context, cartName string, item CartItem, count int) (quantity int, err error) {
+	err = s.Update(ctx, []string{cartName}, func(carts []*Cart) error {
+		quantity, err = addToCart(ctx, carts[0], item, count)
+		return err
+	})
+	return quantity, err
+}
+
+func (s *SQLiteCartStore) Remove(ctx context.Context, cartName, itemID string, n int) (removed int, deleted bool, err error) {
+	err = s.Update(ctx, []string{cartName}, func(carts []*Cart) error {
+		removed, deleted = removeFromCart(ctx, carts[0], itemID, n)
+		return nil
+	})
+	return removed, deleted, err
+}
+
+func (s *SQLiteCartStore) SetQuantity(ctx context.Context, cartName, itemID string, quantity int) (previous int, found bool, err error) {
+	err = s.Update(ctx, []string{cartName}, func(carts []*Cart) error {
+		previous, found = setQuantity(ctx, carts[0], itemID, quantity)
+		return nil
+	})
+	return previous, found, err
+}
+
+func (s *SQLiteCartStore) Clear(ctx context.Context, cartName string) (uniqueItems, totalQuantity int, err error) {
+	err = s.Update(ctx, []string{cartName}, func(carts []*Cart) error {
+		uniqueItems, totalQuantity = clearCart(ctx, carts[0])
+		return nil
+	})
+	return uniqueItems, totalQuantity, err
+}
+
+// Carts returns the names of the cart rows.
+func (s *SQLiteCartStore) Carts(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name FROM carts WHERE name != ? ORDER BY name", defaultCartName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read carts: %w", err)
+	}
+	defer rows.Close()
+
+	names := []string{defaultCartName}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read carts: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *SQLiteCartStore) CreateCart(ctx context.Context, name string) error {
+	if err := validateCartName(name); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO carts (name) VALUES (?)", name)
+	if err != nil {
+		return fmt.Errorf("failed to create cart: %w", err)
+	}
+	if created, _ := result.RowsAffected(); created == 0 {
+		return fmt.Errorf("cart %q already exists", name)
+	}
+	s.carts.ensure(name)
+	return nil
+}
+
+func (s *SQLiteCartStore) DeleteCart(ctx context.Context, name string, force bool) (uniqueItems int, err error) {
+	if name == defaultCartName {
+		return 0, errors.New("the default cart cannot be deleted, use clear_cart to empty it")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin cart transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM carts WHERE name = ?), (SELECT COUNT(*) FROM items WHERE cart = ?)", name, name).Scan(&exists, &uniqueItems); err != nil {
+		return 0, fmt.Errorf("failed to look up cart: %w", err)
+	}
+	if !exists {
+		return 0, fmt.Errorf("cart %q does not exist", name)
+	}
+	if uniqueItems > 0 && !force {
+		return uniqueItems, fmt.Errorf("cart %q contains %d items, pass confirm=true to delete it", name, uniqueItems)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM carts WHERE name = ?", name); err != nil {
+		return 0, fmt.Errorf("failed to delete cart: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM versions WHERE cart = ?", name); err != nil {
+		return 0, fmt.Errorf("failed to delete cart versions: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit cart transaction: %w", err)
+	}
+	s.carts.Delete(name, true)
+	delete(s.changes, name)
+	return uniqueItems, nil
+}
+
+const itemColumns = `id, title, link, price, shop, description, quantity, note, tags, priority, target_price, target_currency, added_at, updated_at, image`
+
+const upsertItemSQL = "INSERT OR REPLACE INTO items (" + itemColumns + ", cart) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// itemValues returns the arguments of upsertItemSQL for item.
+func itemValues(item *CartItem, cartName string) ([]any, error) {
+	tags, err := json.Marshal(item.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tags of cart item %s: %w", item.ID, err)
+	}
+	if item.Tags == nil {
+		tags = []byte("[]")
+	}
+	return []any{item.ID, item.Title, item.Link, item.Price, item.Shop, item.Description, item.Quantity,
+		item.Note, string(tags), item.Priority, item.TargetPrice, item.TargetCurrency, item.AddedAt.UnixNano(), item.UpdatedAt.UnixNano(), item.Image, cartName}, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanItem(row rowScanner) (*CartItem, error) {
+	var item CartItem
+	var tags string
+	var addedAt, updatedAt int64
+	if err := row.Scan(&item.ID, &item.Title, &item.Link, &item.Price, &item.Shop, &item.Description, &item.Quantity,
+		&item.Note, &tags, &item.Priority, &item.TargetPrice, &item.TargetCurrency, &addedAt, &updatedAt, &item.Image); err != nil {
+		return nil, err
+	}
+	if tags != "[]" {
+		if err := json.Unmarshal([]byte(tags), &item.Tags); err != nil {
+			return nil, fmt.Errorf("failed to decode tags of cart item %s: %w", item.ID, err)
+		}
+	}
+	item.AddedAt, item.UpdatedAt = time.Unix(0, addedAt), time.Unix(0, updatedAt)
+	item.updateParsedPrice()
+	return &item, nil
+}
+
+// cartExists reports whether the cart has a row, for reads that found no lines.
+func (s *SQLiteCartStore) cartExists(ctx context.Context, cartName string) error {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM carts WHERE name = ?)", cartName).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up cart: %w", err)
+	}
+	if !exists {
+		return &CartNotFoundError{Name: cartName}
+	}
+	return nil
+}
+
+func (s *SQLiteCartStore) Get(ctx context.Context, cartName, itemID string) (CartItem, bool, error) {
+	item, err := scanItem(s.db.QueryRowContext(ctx, "SELECT "+itemColumns+" FROM items WHERE cart = ? AND id = ?", cartName, itemID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return CartItem{}, false, s.cartExists(ctx, cartName)
+	}
+	if err != nil {
+		return CartItem{}, false, fmt.Errorf("failed to read cart item: %w", err)
+	}
+	return *item, true, nil
+}
+
+func (s *SQLiteCartStore) List(ctx context.Context, cartName string) ([]*CartItem, error) {
+	items, err := listItems(ctx, s.db, cartName)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return items, s.cartExists(ctx, cartName)
+	}
+	return items, nil
+}
+
+// queryer is a *sql.DB or a *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func listItems(ctx context.Context, q queryer, cartName string) ([]*CartItem, error) {
+	rows, err := q.QueryContext(ctx, "SELECT "+itemColumns+" FROM items WHERE cart = ? ORDER BY added_at, id", cartName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cart items: %w", err)
+	}
+	defer rows.Close()
+
+	items := []*CartItem{}
+	for rows.Next() {
+		item, err := scanItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cart item: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list cart items: %w", err)
+	}
+	return items, nil
+}
+
+// Load fills the in-memory registry from the database at startup.
+func (s *SQLiteCartStore) Load() error {
+	ctx := context.Background()
+	named := make(map[string][]*CartItem)
+	budgets := make(map[string]Budget)
+	rows, err := s.db.QueryContext(ctx, "SELECT name, budget_amount, budget_currency FROM carts")
+	if err != nil {
+		return fmt.Errorf("failed to read carts: %w", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		var budget Budget
+		if err := rows.Scan(&name, &budget.Amount, &budget.Currency); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read carts: %w", err)
+		}
+		names = append(names, name)
+		budgets[name] = budget
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read carts: %w", err)
+	}
+	for _, name := range names {
+		items, err := s.List(ctx, name)
+		if err != nil {
+			return err
+		}
+		named[name] = items
+	}
+
+	snapshots, err := s.loadSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+
+	cart.load(named[defaultCartName])
+	delete(named, defaultCartName)
+	s.carts.load(named)
+	cartSnapshots.load(snapshots)
+	s.carts.loadBudgets(budgets)
+	return nil
+}
+
+func (s *SQLiteCartStore) loadSnapshots(ctx context.Context) ([]CartSnapshot, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT name, cart, description, created_at, items FROM snapshots")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cart snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []CartSnapshot
+	for rows.Next() {
+		var snapshot CartSnapshot
+		var createdAt int64
+		var items string
+		if err := rows.Scan(&snapshot.Name, &snapshot.Cart, &snapshot.Description, &createdAt, &items); err != nil {
+			return nil, fmt.Errorf("failed to read cart snapshots: %w", err)
+		}
+		if err := json.Unmarshal([]byte(items), &snapshot.Items); err != nil {
+			return nil, fmt.Errorf("failed to decode cart snapshot %s: %w", snapshot.Name, err)
+		}
+		snapshot.CreatedAt = time.Unix(0, createdAt)
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// Save writes the cart snapshots in one transaction. The carts themselves
+// are only written by the transactions of the store methods.
+func (s *SQLiteCartStore) Save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin cart transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM snapshots"); err != nil {
+		return fmt.Errorf("failed to save cart snapshots: %w", err)
+	}
+	for _, snapshot := range cartSnapshots.List() {
+		items, err := json.Marshal(snapshot.Items)
+		if err != nil {
+			return fmt.Errorf("failed to encode cart snapshot %s: %w", snapshot.Name, err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO snapshots (name, cart, description, created_at, items) VALUES (?, ?, ?, ?, ?)",
+			snapshot.Name, snapshot.Cart, snapshot.Description, snapshot.CreatedAt.UnixNano(), string(items)); err != nil {
+			return fmt.Errorf("failed to save cart snapshot %s: %w", snapshot.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit cart transaction: %w", err)
+	}
+	return nil
+}
+
+// versionChanged records a version after a change when one is due.
+func (s *SQLiteCartStore) versionChanged(ctx context.Context, tx *sql.Tx, cartName string) error {
+	changes := s.changes[cartName]
+	if changes == 0 {
+		return nil
+	}
+	var last int64
+	err := tx.QueryRowContext(ctx, "SELECT created_at FROM versions WHERE cart = ? ORDER BY id DESC LIMIT 1", cartName).Scan(&last)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read cart versions: %w", err)
+	}
+	var lastAt time.Time
+	if err == nil {
+		lastAt = time.Unix(0, last)
+	}
+	if !cartVersionDue(changes, lastAt, s.now()) {
+		return nil
+	}
+	_, err = s.addVersion(ctx, tx, cartName, CartVersion{Reason: cartVersionReasonPeriodic})
+	return err
+}
+
+// addVersion records the lines of the cart as a new version, then drops the
+// versions past the count and age limits. The new version is always kept.
+func (s *SQLiteCartStore) addVersion(ctx context.Context, tx *sql.Tx, cartName string, version CartVersion) (CartVersion, error) {
+	items, err := listItems(ctx, tx, cartName)
+	if err != nil {
+		return CartVersion{}, err
+	}
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return CartVersion{}, fmt.Errorf("failed to encode cart version: %w", err)
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) + 1 FROM versions WHERE cart = ?", cartName).Scan(&version.ID); err != nil {
+		return CartVersion{}, fmt.Errorf("failed to read cart versions: %w", err)
+	}
+	version.CreatedAt, version.Items = s.now(), items
+	if _, err := tx.ExecContext(ctx, "INSERT INTO versions (cart, id, created_at, reason, rollback_of, items) VALUES (?, ?, ?, ?, ?, ?)",
+		cartName, version.ID, version.CreatedAt.UnixNano(), version.Reason, version.RollbackOf, string(encoded)); err != nil {
+		return CartVersion{}, fmt.Errorf("failed to write cart version: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM versions WHERE cart = ? AND id <= ?", cartName, version.ID-max(config.CartVersionKeep, 1)); err != nil {
+		return CartVersion{}, fmt.Errorf("failed to prune cart versions: %w", err)
+	}
+	if config.CartVersionMaxAge > 0 {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM versions WHERE cart = ? AND id < ? AND created_at < ?",
+			cartName, version.ID, version.CreatedAt.Add(-config.CartVersionMaxAge).UnixNano()); err != nil {
+			return CartVersion{}, fmt.Errorf("failed to prune cart versions: %w", err)
+		}
+	}
+	s.changes[cartName] = 0
+	return version, nil
+}
+
+func (s *SQLiteCartStore) Versions(ctx context.Context, cartName string) ([]CartVersion, error) {
+	if err := s.cartExists(ctx, cartName); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT id, created_at, reason, rollback_of, items FROM versions WHERE cart = ? ORDER BY id", cartName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cart versions: %w", err)
+	}
+	defer rows.Close()
+
+	now := s.now()
+	var versions []CartVersion
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !cartVersionExpired(version, now) {
+			versions = append(versions, version)
+		}
+	}
+	return versions, rows.Err()
+}
+
+func scanVersion(row rowScanner) (CartVersion, error) {
+	var version CartVersion
+	var createdAt int64
+	var items string
+	if err := row.Scan(&version.ID, &createdAt, &version.Reason, &version.RollbackOf, &items); err != nil {
+		return CartVersion{}, fmt.Errorf("failed to read cart versions: %w", err)
+	}
+	if err := json.Unmarshal([]byte(items), &version.Items); err != nil {
+		return CartVersion{}, fmt.Errorf("failed to decode cart version %d: %w", version.ID, err)
+	}
+	for _, item := range version.Items {
+		item.updateParsedPrice()
+	}
+	version.CreatedAt = time.Unix(0, createdAt)
+	return version, nil
+}
+
+func (s *SQLiteCartStore) Rollback(ctx context.Context, cartName string, versionID int) (version CartVersion, diff cartDiff, err error) {
+	err = s.transact(ctx, []string{cartName}, func(tx *sql.Tx, carts []*Cart) error {
+		target, err := scanVersion(tx.QueryRowContext(ctx, "SELECT id, created_at, reason, rollback_of, items FROM versions WHERE cart = ? AND id = ?", cartName, versionID))
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && cartVersionExpired(target, s.now())) {
+			return fmt.Errorf("version %d of cart %q does not exist, use list_versions to see versions", versionID, cartName)
+		}
+		if err != nil {
+			return err
+		}
+		// The current state becomes a version first, so the rollback can be
+		// rolled back even when it had not been recorded yet.
+		if s.changes[cartName] > 0 && config.CartVersionKeep > 0 {
+			if _, err := s.addVersion(ctx, tx, cartName, CartVersion{Reason: cartVersionReasonPeriodic}); err != nil {
+				return err
+			}
+		}
+		diff = carts[0].RestoreSnapshot(ctx, target.Items)
+		return nil
+	}, func(tx *sql.Tx) error {
+		version, err = s.addVersion(ctx, tx, cartName, CartVersion{Reason: cartVersionReasonRollback, RollbackOf: versionID})
+		return err
+	})
+	if err != nil {
+		return CartVersion{}, cartDiff{}, err
+	}
+	return version, diff, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestSQLiteCartStore opens a store with carts of its own at path and
+// creates the named carts in it.
+func newTestSQLiteCartStore(tb testing.TB, path string, names ...string) *SQLiteCartStore {
+	tb.Helper()
+	store, err := NewSQLiteCartStore(path, newTestCartRegistry())
+	if err != nil {
+		tb.Fatalf("NewSQLiteCartStore() error = %v", err)
+	}
+	tb.Cleanup(func() { store.Close() })
+	for _, name := range names {
+		if name == defaultCartName {
+			continue
+		}
+		if err := store.CreateCart(tb.Context(), name); err != nil {
+			tb.Fatalf("CreateCart(%q) error = %v", name, err)
+		}
+	}
+	return store
+}
+
+func TestSQLiteCartStoreReopen(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	path := filepath.Join(t.TempDir(), "cart.db")
+	store := newTestSQLiteCartStore(t, path, "home")
+	if _, err := store.Add(ctx, "home", CartItem{ID: "kettle", Title: "Чайник", Price: "2 990 ₽"}, 2); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := store.Add(ctx, "home", CartItem{ID: "mug", Title: "Кружка"}, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, _, err := store.SetQuantity(ctx, "home", "kettle", 4); err != nil {
+		t.Fatalf("SetQuantity() error = %v", err)
+	}
+	store.Close()
+
+	reopened, err := NewSQLiteCartStore(path, newTestCartRegistry())
+	if err != nil {
+		t.Fatalf("reopening the database: %v", err)
+	}
+	t.Cleanup(func() { reopened.Close() })
+
+	var version, history int
+	reopened.db.QueryRow("PRAGMA user_version").Scan(&version)
+	reopened.db.QueryRow("SELECT COUNT(*) FROM history WHERE cart = 'home'").Scan(&history)
+	if version != len(sqliteMigrations) || history != 3 {
+		t.Errorf("reopened database has schema version %d and %d history rows, want %d and 3", version, history, len(sqliteMigrations))
+	}
+
+	lines, err := reopened.List(ctx, "home")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(lines) != 2 || lines[0].ID != "kettle" || lines[0].Quantity != 4 || !lines[0].PriceParsed || lines[1].ID != "mug" {
+		t.Errorf("List() after reopening = %+v, want kettle × 4 with a parsed price, then mug", lines)
+	}
+}
+
+// TestSQLiteCartStoreMirror checks that the in-memory registry, which the
+// other tools read, follows the changes made through the store.
+func TestSQLiteCartStoreMirror(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	store := newTestSQLiteCartStore(t, filepath.Join(t.TempDir(), "cart.db"), "home")
+	store.Add(ctx, "home", CartItem{ID: "kettle", Title: "Чайник"}, 3)
+	store.Add(ctx, "home", CartItem{ID: "mug", Title: "Кружка"}, 1)
+	store.Remove(ctx, "home", "kettle", 1)
+	store.SetQuantity(ctx, "home", "mug", 0)
+
+	lines, err := store.List(ctx, "home")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	home, _ := store.carts.Get("home")
+	mirrored := home.Snapshot()
+	if len(lines) != 1 || len(mirrored) != 1 || mirrored[0].ID != lines[0].ID || mirrored[0].Quantity != lines[0].Quantity {
+		t.Errorf("in-memory cart = %v, database = %v, want the same single line", mirrored, lines)
+	}
+	if len(home.trash) != 1 || home.trash[0].Item.ID != "mug" {
+		t.Errorf("in-memory trash = %v, want the mug removed through the store", home.trash)
+	}
+}
+
+func BenchmarkSQLiteCartStoreList(b *testing.B) {
+	items := make([]*CartItem, 10000)
+	added := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range items {
+		items[i] = &CartItem{ID: fmt.Sprintf("item-%05d", i), Title: "Товар", Price: "100 ₽", Quantity: 1, AddedAt: added.Add(time.Duration(i) * time.Second)}
+	}
+	store := newTestSQLiteCartStore(b, filepath.Join(b.TempDir(), "cart.db"), "home")
+	err := store.Update(b.Context(), []string{"home"}, func(carts []*Cart) error {
+		carts[0].load(items)
+		return nil
+	})
+	if err != nil {
+		b.Fatalf("Update() error = %v", err)
+	}
+
+	b.Run("List", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := store.List(b.Context(), "home"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Get", func(b *testing.B) {
+		for b.Loop() {
+			if _, _, err := store.Get(b.Context(), "home", "item-05000"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
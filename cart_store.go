@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// CartStore holds the named carts. The cart tools reach the carts only
+// through it (see Server), so their handlers can be tested against a store
+// of their own and the storage can change without touching them.
+type CartStore interface {
+	// Add adds count units of item to the cart, creating the line when it is
+	// new, and returns the resulting quantity. It fails with a
+	// *CartLimitError when the cart would grow past its limits.
+	Add(ctx context.Context, cartName string, item CartItem, count int) (quantity int, err error)
+	// Remove removes up to n units of an item. deleted reports whether the
+	// whole line went; removed is zero when the item is not in the cart.
+	Remove(ctx context.Context, cartName, itemID string, n int) (removed int, deleted bool, err error)
+	// SetQuantity sets the quantity of a line, removing it at zero, and
+	// returns the previous quantity.
+	SetQuantity(ctx context.Context, cartName, itemID string, quantity int) (previous int, found bool, err error)
+	// Get returns a copy of one line.
+	Get(ctx context.Context, cartName, itemID string) (item CartItem, found bool, err error)
+	// List returns copies of the lines in the order they were added.
+	List(ctx context.Context, cartName string) ([]*CartItem, error)
+	// Clear removes every line and reports how many lines and units went.
+	Clear(ctx context.Context, cartName string) (uniqueItems, totalQuantity int, err error)
+	// Versions returns the versions of the cart recorded as it changed,
+	// oldest first, or errCartVersionsUnsupported.
+	Versions(ctx context.Context, cartName string) ([]CartVersion, error)
+	// Rollback replaces the lines with those of a version and records the
+	// result as a new version, so the rollback can itself be rolled back.
+	Rollback(ctx context.Context, cartName string, versionID int) (version CartVersion, diff cartDiff, err error)
+	// Update runs fn on the current state of the named carts, in the order
+	// given, and saves what fn changed. fn changes the carts through their
+	// methods, which keep the undo journal, trash and history. Changes made
+	// before fn fails are saved too, so fn must fail before changing
+	// anything, as the Cart methods do.
+	Update(ctx context.Context, cartNames []string, fn func(carts []*Cart) error) error
+	// View runs fn on the current state of a cart, which fn must not change.
+	View(ctx context.Context, cartName string, fn func(c *Cart) error) error
+	// Carts returns the cart names with the default cart first and the rest sorted.
+	Carts(ctx context.Context) ([]string, error)
+	// CreateCart adds an empty cart.
+	CreateCart(ctx context.Context, name string) error
+	// DeleteCart removes a cart and reports how many lines it had. Non-empty
+	// carts are only deleted with force.
+	DeleteCart(ctx context.Context, name string, force bool) (uniqueItems int, err error)
+}
+
+// CartNotFoundError is returned for operations on a cart that does not exist.
+type CartNotFoundError struct {
+	Name string
+}
+
+func (e *CartNotFoundError) Error() string {
+	return fmt.Sprintf("cart %q does not exist, use list_carts to see carts or create_cart to add one", e.Name)
+}
+
+// MemoryCartStore is the CartStore over the in-memory cart registry. Every
+// change goes through the same undo journal, history and persistence as the
+// other cart tools.
+type MemoryCartStore struct {
+	carts    *CartRegistry
+	versions *CartVersions
+	// sessions, when set, gives every MCP session carts of its own; calls
+	// without a session use carts and versions.
+	sessions *SessionCartStore
+	// persistence, when set, saves the carts outside of sessions after
+	// every change.
+	persistence CartPersistence
+}
+
+func NewMemoryCartStore(registry *CartRegistry) *MemoryCartStore {
+	return &MemoryCartStore{carts: registry, versions: NewCartVersions()}
+}
+
+// scope returns the carts and versions seen by a call.
+func (s *MemoryCartStore) scope(ctx context.Context) (*CartRegistry, *CartVersions) {
+	if state := s.sessions.state(ctx); state != nil {
+		return state.registry, state.versions
+	}
+	return s.carts, s.versions
+}
+
+func (s *MemoryCartStore) cart(ctx context.Context, name string) (*Cart, error) {
+	registry, _ := s.scope(ctx)
+	c, ok := registry.Get(name)
+	if !ok {
+		return nil, &CartNotFoundError{Name: name}
+	}
+	return c, nil
+}
+
+func (s *MemoryCartStore) Add(ctx context.Context, cartName string, item CartItem, count int) (quantity int, err error) {
+	err = s.Update(ctx, []string{cartName}, func(carts []*Cart) error {
+		quantity, err = addToCart(ctx, carts[0], item, count)
+		return err
+	})
+	return quantity, err
+}
+
+func (s *MemoryCartStore) Remove(ctx context.Context, cartName, itemID string, n int) (removed int, deleted bool, err error) {
+	err = s.Update(ctx, []string{cartName}, func(carts []*Cart) error {
+		removed, deleted = removeFromCart(ctx, carts[0], itemID, n)
+		return nil
+	})
+	return removed, deleted, err
+}
+
+func (s *MemoryCartStore) SetQuantity(ctx context.Context, cartName, itemID string, quantity int) (previous int, found bool, err error) {
+	err = s.Update(ctx, []string{cartName}, func(carts []*Cart) error {
+		previous, found = setQuantity(ctx, carts[0], itemID, quantity)
+		return nil
+	})
+	return previous, found, err
+}
+
+func (s *MemoryCartStore) Get(ctx context.Context, cartName, itemID string) (CartItem, bool, error) {
+	c, err := s.cart(ctx, cartName)
+	if err != nil {
+		return CartItem{}, false, err
+	}
+	item, found := c.Get(itemID)
+	return item, found, nil
+}
+
+func (s *MemoryCartStore) List(ctx context.Context, cartName string) ([]*CartItem, error) {
+	c, err := s.cart(ctx, cartName)
+	if err != nil {
+		return nil, err
+	}
+	return c.Snapshot(), nil
+}
+
+func (s *MemoryCartStore) Clear(ctx context.Context, cartName string) (uniqueItems, totalQuantity int, err error) {
+	err = s.Update(ctx, []string{cartName}, func(carts []*Cart) error {
+		uniqueItems, totalQuantity = clearCart(ctx, carts[0])
+		return nil
+	})
+	return uniqueItems, totalQuantity, err
+}
+
+// Update runs fn on the carts themselves. Once it returns, every cart whose
+// lines changed counts towards its next version, and the carts are saved if
+// anything changed.
+func (s *MemoryCartStore) Update(ctx context.Context, cartNames []string, fn func(carts []*Cart) error) error {
+	targets := make([]*Cart, len(cartNames))
+	states := make([]cartState, len(cartNames))
+	for i, name := range cartNames {
+		c, err := s.cart(ctx, name)
+		if err != nil {
+			return err
+		}
+		targets[i], states[i] = c, stateOf(c)
+	}
+	err := fn(targets)
+
+	_, versions := s.scope(ctx)
+	changed := false
+	for i, c := range targets {
+		lines, removed := states[i].changes(c)
+		if len(lines) > 0 || len(removed) > 0 {
+			versions.changed(cartNames[i], c)
+			changed = true
+		}
+		changed = changed || c.Budget() != states[i].budget
+	}
+	if changed {
+		s.changed(ctx)
+	}
+	return err
+}
+
+func (s *MemoryCartStore) View(ctx context.Context, cartName string, fn func(c *Cart) error) error {
+	c, err := s.cart(ctx, cartName)
+	if err != nil {
+		return err
+	}
+	return fn(c)
+}
+
+func (s *MemoryCartStore) Carts(ctx context.Context) ([]string, error) {
+	registry, _ := s.scope(ctx)
+	return registry.Names(), nil
+}
+
+func (s *MemoryCartStore) CreateCart(ctx context.Context, name string) error {
+	registry, _ := s.scope(ctx)
+	if _, err := registry.Create(name); err != nil {
+		return err
+	}
+	s.changed(ctx)
+	return nil
+}
+
+func (s *MemoryCartStore) DeleteCart(ctx context.Context, name string, force bool) (int, error) {
+	registry, _ := s.scope(ctx)
+	uniqueItems, err := registry.Delete(name, force)
+	if err != nil {
+		return uniqueItems, err
+	}
+	s.changed(ctx)
+	return uniqueItems, nil
+}
+
+// changed saves the carts and tells clients about a change made by a call.
+// Session carts are not saved, and only their own session is told.
+func (s *MemoryCartStore) changed(ctx context.Context) {
+	if s.sessions.state(ctx) != nil {
+		notifySessionCartChanged(ctx, sessionIDFromContext(ctx))
+		return
+	}
+	cartChanged(s.persistence)
+}
+
+// cartState is what a store remembers of a cart before an update, to tell
+// what the update changed.
+type cartState struct {
+	lines  map[string]*CartItem
+	budget Budget
+}
+
+func stateOf(c *Cart) cartState {
+	items := c.Snapshot()
+	lines := make(map[string]*CartItem, len(items))
+	for _, item := range items {
+		lines[item.ID] = item
+	}
+	return cartState{lines: lines, budget: c.Budget()}
+}
+
+// changes returns copies of the lines of c that are new or differ from the
+// state, in the order they were added, and the sorted IDs of the lines that
+// are gone.
+func (state cartState) changes(c *Cart) (changed []*CartItem, removed []string) {
+	current := make(map[string]bool)
+	for _, item := range c.Snapshot() {
+		current[item.ID] = true
+		if before, ok := state.lines[item.ID]; !ok || !reflect.DeepEqual(before, item) {
+			changed = append(changed, item)
+		}
+	}
+	for id := range state.lines {
+		if !current[id] {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// Server carries the dependencies of the cart tool handlers.
+type Server struct {
+	store CartStore
+	// persistence saves the carts and snapshots after a change the store
+	// does not save by itself; nil keeps them in memory only.
+	persistence CartPersistence
+}
+
+func NewServer(store CartStore, persistence CartPersistence) *Server {
+	return &Server{store: store, persistence: persistence}
+}
+
+// update runs fn on one cart through the store; see CartStore.Update.
+func (s *Server) update(ctx context.Context, cartName string, fn func(c *Cart) error) error {
+	return s.store.Update(ctx, []string{cartName}, func(carts []*Cart) error {
+		return fn(carts[0])
+	})
+}
+
+// budgetWarning reports an overspent budget after a change to the named cart.
+func (s *Server) budgetWarning(ctx context.Context, cartName string) string {
+	var warning string
+	s.store.View(ctx, cartName, func(c *Cart) error {
+		warning = budgetWarning(c)
+		return nil
+	})
+	return warning
+}
+
+// lineIDs returns the sorted IDs of items.
+func lineIDs(items []*CartItem) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
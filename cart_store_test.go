@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestCartRegistry(names ...string) *CartRegistry {
+	registry := &CartRegistry{carts: make(map[string]*Cart)}
+	for _, name := range names {
+		registry.carts[name] = newTestCart()
+	}
+	return registry
+}
+
+// cartStoreBackends builds an empty store holding the named carts for each
+// CartStore implementation; every backend must pass the same tests.
+var cartStoreBackends = []struct {
+	name     string
+	newStore func(t *testing.T, names ...string) CartStore
+}{
+	{name: "memory", newStore: func(t *testing.T, names ...string) CartStore {
+		return NewMemoryCartStore(newTestCartRegistry(names...))
+	}},
+	{name: "sqlite", newStore: func(t *testing.T, names ...string) CartStore {
+		return newTestSQLiteCartStore(t, filepath.Join(t.TempDir(), "cart.db"), names...)
+	}},
+	{name: "redis", newStore: func(t *testing.T, names ...string) CartStore {
+		return newTestRedisCartStore(t, "redis://"+miniredis.RunT(t).Addr(), names...)
+	}},
+}
+
+// TestMemoryCartStorePersistence checks that the memory store saves through
+// its own persistence after a change and only then.
+func TestMemoryCartStorePersistence(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	persistence := &countingCartPersistence{}
+	store := NewMemoryCartStore(newTestCartRegistry("home"))
+	store.persistence = persistence
+
+	if _, err := store.Add(ctx, "home", CartItem{ID: "kettle", Title: "Чайник"}, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := store.List(ctx, "home"); err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if _, err := store.Add(ctx, "home", CartItem{ID: "kettle"}, config.MaxCartQuantity); err == nil {
+		t.Fatal("Add() over the per-item limit succeeded")
+	}
+	if persistence.saves != 1 {
+		t.Errorf("saves after an add, a read and a refused add = %d, want 1", persistence.saves)
+	}
+}
+
+func TestCartStore(t *testing.T) {
+	t.Parallel()
+
+	for _, backend := range cartStoreBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Parallel()
+			testCartStore(t, backend.newStore(t, "home"))
+		})
+	}
+}
+
+func TestCartStoreConcurrent(t *testing.T) {
+	t.Parallel()
+
+	for _, backend := range cartStoreBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Parallel()
+			testCartStoreConcurrent(t, backend.newStore(t, "home", "office"))
+		})
+	}
+}
+
+func testCartStore(t *testing.T, store CartStore) {
+	ctx := t.Context()
+	item := CartItem{ID: "kettle", Title: "Чайник", Link: "https://example.com/kettle", Price: "2 990 ₽", Image: "https://example.com/kettle.jpg"}
+
+	if quantity, err := store.Add(ctx, "home", item, 2); err != nil || quantity != 2 {
+		t.Fatalf("Add() = %d, %v, want 2, nil", quantity, err)
+	}
+	if quantity, err := store.Add(ctx, "home", item, 1); err != nil || quantity != 3 {
+		t.Fatalf("second Add() = %d, %v, want 3, nil", quantity, err)
+	}
+	if got, found, err := store.Get(ctx, "home", "kettle"); err != nil || !found || got.Quantity != 3 || got.Title != "Чайник" || got.Image != item.Image {
+		t.Fatalf("Get() = %+v, %v, %v, want the kettle with its image and quantity 3", got, found, err)
+	}
+	if previous, found, err := store.SetQuantity(ctx, "home", "kettle", 5); err != nil || !found || previous != 3 {
+		t.Fatalf("SetQuantity() = %d, %v, %v, want 3, true, nil", previous, found, err)
+	}
+	if removed, deleted, err := store.Remove(ctx, "home", "kettle", 2); err != nil || removed != 2 || deleted {
+		t.Fatalf("Remove() = %d, %v, %v, want 2, false, nil", removed, deleted, err)
+	}
+	if removed, _, err := store.Remove(ctx, "home", "missing", 1); err != nil || removed != 0 {
+		t.Fatalf("Remove(missing) = %d, %v, want 0, nil", removed, err)
+	}
+	if lines, err := store.List(ctx, "home"); err != nil || len(lines) != 1 || lines[0].Quantity != 3 {
+		t.Fatalf("List() = %v, %v, want one line with quantity 3", lines, err)
+	}
+	if uniqueItems, totalQuantity, err := store.Clear(ctx, "home"); err != nil || uniqueItems != 1 || totalQuantity != 3 {
+		t.Fatalf("Clear() = %d, %d, %v, want 1, 3, nil", uniqueItems, totalQuantity, err)
+	}
+	if lines, _ := store.List(ctx, "home"); len(lines) != 0 {
+		t.Errorf("List() after Clear() = %v, want no lines", lines)
+	}
+
+	var notFound *CartNotFoundError
+	if _, err := store.Add(ctx, "office", item, 1); !errors.As(err, &notFound) || notFound.Name != "office" {
+		t.Errorf("Add() to a missing cart error = %v, want *CartNotFoundError for office", err)
+	}
+	if _, err := store.List(ctx, "office"); !errors.As(err, &notFound) {
+		t.Errorf("List() of a missing cart error = %v, want *CartNotFoundError", err)
+	}
+}
+
+func testCartStoreConcurrent(t *testing.T, store CartStore) {
+	ctx := t.Context()
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(3)
+		cartName := "home"
+		if i%2 == 1 {
+			cartName = "office"
+		}
+		go func() {
+			defer wg.Done()
+			if _, err := store.Add(ctx, cartName, CartItem{ID: "item", Title: "Item"}, 2); err != nil {
+				t.Errorf("Add() error = %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := store.List(ctx, cartName); err != nil {
+				t.Errorf("List() error = %v", err)
+			}
+			store.Get(ctx, cartName, "item")
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := store.Add(ctx, cartName, CartItem{ID: "other", Title: "Other"}, 1); err != nil {
+				t.Errorf("Add() error = %v", err)
+			}
+			store.Remove(ctx, cartName, "other", 1)
+		}()
+	}
+	wg.Wait()
+
+	for _, cartName := range []string{"home", "office"} {
+		item, found, err := store.Get(ctx, cartName, "item")
+		if err != nil || !found || item.Quantity != 20 {
+			t.Errorf("%s: quantity after 10 concurrent adds of 2 = %d (found %v, error %v), want 20", cartName, item.Quantity, found, err)
+		}
+		if lines, _ := store.List(ctx, cartName); len(lines) != 1 {
+			t.Errorf("%s: List() = %d lines, want only item left", cartName, len(lines))
+		}
+	}
+}
+
+// TestCartStoreConcurrentQuantityLimit checks that the store enforces the
+// per-item limit itself: of several concurrent adds that each fit on their
+// own but not together, only one goes through.
+func TestCartStoreConcurrentQuantityLimit(t *testing.T) {
+	t.Parallel()
+
+	for _, backend := range cartStoreBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Parallel()
+			testCartStoreConcurrentQuantityLimit(t, backend.newStore(t, "home"))
+		})
+	}
+}
+
+func testCartStoreConcurrentQuantityLimit(t *testing.T, store CartStore) {
+	ctx := t.Context()
+	count := config.MaxCartQuantity/2 + 1
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	added := 0
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.Add(ctx, "home", CartItem{ID: "kettle", Title: "Чайник"}, count)
+			var limit *CartLimitError
+			switch {
+			case err == nil:
+				mutex.Lock()
+				added++
+				mutex.Unlock()
+			case !errors.As(err, &limit) || limit.Limit != "quantity per item":
+				t.Errorf("Add() error = %v, want *CartLimitError for the quantity per item", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if added != 1 {
+		t.Errorf("%d concurrent adds of %d went through, want 1 with a limit of %d", added, count, config.MaxCartQuantity)
+	}
+	if item, _, err := store.Get(ctx, "home", "kettle"); err != nil || item.Quantity != count {
+		t.Errorf("quantity after the concurrent adds = %d, %v, want %d", item.Quantity, err, count)
+	}
+
+	var limit *CartLimitError
+	if _, err := store.Add(ctx, "home", CartItem{ID: "mug", Title: "Кружка"}, config.MaxCartQuantity+1); !errors.As(err, &limit) || limit.Limit != "quantity per item" {
+		t.Errorf("Add() of a new line over the limit error = %v, want *CartLimitError for the quantity per item", err)
+	}
+	if _, found, _ := store.Get(ctx, "home", "mug"); found {
+		t.Error("a new line over the per-item limit was added")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func (s *Server) handleCartSummary(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartItems, cartName, err := s.cartFromArgs(ctx, args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	if len(cartItems) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🛒 Корзина%s пуста", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	groups := groupCartByShop(cartItems)
+	lines := make([]string, 0, len(groups))
+	for _, group := range groups {
+		name := group.Shop
+		if name == "" {
+			name = "unknown"
+		}
+		subtotal := "—"
+		if len(group.Totals) > 0 {
+			subtotal = formatGroupedTotals(group.Totals)
+		}
+		line := fmt.Sprintf("• %s — позиций: %d, товаров: %d, сумма: %s", name, len(group.Items), group.Quantity, subtotal)
+		if group.Unpriced > 0 {
+			line += fmt.Sprintf(" (без цены: %d)", group.Unpriced)
+		}
+		lines = append(lines, line)
+	}
+
+	totals, unpriced := priceTotals(cartItems)
+	total := "не удалось рассчитать"
+	if len(totals) > 0 {
+		total = formatGroupedTotals(totals)
+	}
+	if unpriced > 0 {
+		total += fmt.Sprintf("\nℹ️ Позиций без распознанной цены: %d, они не учтены в итоге", unpriced)
+	}
+
+	result := fmt.Sprintf(`🏪 Сводка корзины%s по магазинам (%d):
+
+%s
+
+💰 Итого: %s`,
+		cartLabel(cartName), len(groups), strings.Join(lines, "\n"), total)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
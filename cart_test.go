@@ -0,0 +1,997 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func newTestCart() *Cart {
+	return &Cart{
+		Items: make(map[string]*CartItem),
+		now:   func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+}
+
+func TestCartAdd(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		initial      int
+		count        int
+		wantQuantity int
+	}{
+		{name: "new item", count: 1, wantQuantity: 1},
+		{name: "new item with quantity", count: 3, wantQuantity: 3},
+		{name: "increments existing item", initial: 2, count: 1, wantQuantity: 3},
+		{name: "increments existing item by several", initial: 2, count: 5, wantQuantity: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newTestCart()
+			if tt.initial > 0 {
+				if _, err := c.Add(t.Context(), "item", "Item", "https://example.com/item", "100 ₽", "example.com", "", tt.initial); err != nil {
+					t.Fatalf("initial Add() error = %v", err)
+				}
+			}
+
+			got, err := c.Add(t.Context(), "item", "Item", "https://example.com/item", "100 ₽", "example.com", "", tt.count)
+			if err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			if got != tt.wantQuantity {
+				t.Errorf("Add() = %d, want %d", got, tt.wantQuantity)
+			}
+			if item := c.Items["item"]; item == nil || item.Quantity != tt.wantQuantity {
+				t.Errorf("stored item = %+v, want quantity %d", item, tt.wantQuantity)
+			}
+			if len(c.Items) != 1 {
+				t.Errorf("cart has %d lines, want 1", len(c.Items))
+			}
+		})
+	}
+}
+
+func TestCartAddConcurrent(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCart()
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Add(t.Context(), "item", "Item", "", "", "", "", 1); err != nil {
+				t.Errorf("Add() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := c.Items["item"].Quantity; got != 10 {
+		t.Errorf("quantity after 10 concurrent adds = %d, want 10", got)
+	}
+}
+
+func TestCartRemoveN(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		initial      int
+		itemID       string
+		n            int
+		wantRemoved  int
+		wantDeleted  bool
+		wantQuantity int
+	}{
+		{name: "decrements quantity", initial: 3, itemID: "item", n: 1, wantRemoved: 1, wantQuantity: 2},
+		{name: "decrement to one keeps the line", initial: 2, itemID: "item", n: 1, wantRemoved: 1, wantQuantity: 1},
+		{name: "decrement to exactly zero removes item", initial: 2, itemID: "item", n: 2, wantRemoved: 2, wantDeleted: true},
+		{name: "removing more than present clamps", initial: 2, itemID: "item", n: 5, wantRemoved: 2, wantDeleted: true},
+		{name: "non-existent item", initial: 1, itemID: "missing", n: 1, wantQuantity: 1},
+		{name: "non-positive count", initial: 1, itemID: "item", n: 0, wantQuantity: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newTestCart()
+			if _, err := c.Add(t.Context(), "item", "Item", "", "", "", "", tt.initial); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			removed, deleted := c.RemoveN(t.Context(), tt.itemID, tt.n)
+			if removed != tt.wantRemoved || deleted != tt.wantDeleted {
+				t.Errorf("RemoveN() = (%d, %t), want (%d, %t)", removed, deleted, tt.wantRemoved, tt.wantDeleted)
+			}
+
+			item, exists := c.Items["item"]
+			if tt.wantDeleted {
+				if exists {
+					t.Errorf("item still in cart with quantity %d", item.Quantity)
+				}
+				return
+			}
+			if !exists || item.Quantity != tt.wantQuantity {
+				t.Errorf("stored item = %+v, want quantity %d", item, tt.wantQuantity)
+			}
+		})
+	}
+}
+
+func TestCartSetQuantity(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		itemID       string
+		quantity     int
+		wantPrevious int
+		wantFound    bool
+		wantExists   bool
+	}{
+		{name: "sets quantity", itemID: "item", quantity: 5, wantPrevious: 2, wantFound: true, wantExists: true},
+		{name: "zero removes item", itemID: "item", quantity: 0, wantPrevious: 2, wantFound: true},
+		{name: "non-existent item", itemID: "missing", quantity: 3, wantExists: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newTestCart()
+			if _, err := c.Add(t.Context(), "item", "Item", "", "", "", "", 2); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			previous, found := c.SetQuantity(t.Context(), tt.itemID, tt.quantity)
+			if previous != tt.wantPrevious || found != tt.wantFound {
+				t.Errorf("SetQuantity() = (%d, %t), want (%d, %t)", previous, found, tt.wantPrevious, tt.wantFound)
+			}
+			if _, exists := c.Items["item"]; exists != tt.wantExists {
+				t.Errorf("item exists = %t, want %t", exists, tt.wantExists)
+			}
+			if _, exists := c.Items["missing"]; exists {
+				t.Error("SetQuantity created a missing item")
+			}
+		})
+	}
+}
+
+func TestCartClear(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		items      map[string]int
+		wantUnique int
+		wantTotal  int
+	}{
+		{name: "empty cart is a no-op", items: nil},
+		{name: "removes every item", items: map[string]int{"a": 1, "b": 3}, wantUnique: 2, wantTotal: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := newTestCart()
+			for id, quantity := range tt.items {
+				if _, err := c.Add(t.Context(), id, id, "", "", "", "", quantity); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+
+			unique, total := c.Clear(t.Context())
+			if unique != tt.wantUnique || total != tt.wantTotal {
+				t.Errorf("Clear() = (%d, %d), want (%d, %d)", unique, total, tt.wantUnique, tt.wantTotal)
+			}
+			if len(c.Items) != 0 {
+				t.Errorf("cart has %d lines after Clear(), want 0", len(c.Items))
+			}
+			if len(tt.items) == 0 && len(c.journal) != 0 {
+				t.Errorf("clearing an empty cart recorded %d undo entries, want 0", len(c.journal))
+			}
+		})
+	}
+}
+
+func TestDiffCartItems(t *testing.T) {
+	t.Parallel()
+
+	before := []*CartItem{
+		{ID: "a", Title: "Чайник", Quantity: 1, Price: "1000 RUB"},
+		{ID: "b", Title: "Блендер", Quantity: 2},
+		{ID: "c", Title: "Тостер", Quantity: 1, Note: "подарок"},
+	}
+	after := []*CartItem{
+		{ID: "a", Title: "Чайник", Quantity: 3, Price: "900 RUB"},
+		{ID: "c", Title: "Тостер", Quantity: 1, Note: "подарок"},
+		{ID: "d", Title: "Миксер", Quantity: 1},
+	}
+
+	diff := diffCartItems(before, after)
+	if len(diff.Added) != 1 || diff.Added[0].ID != "d" {
+		t.Errorf("Added = %v, want [d]", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ID != "b" {
+		t.Errorf("Removed = %v, want [b]", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].After.ID != "a" {
+		t.Fatalf("Changed = %v, want [a]", diff.Changed)
+	}
+	if got := diff.format(); !strings.Contains(got, "количество 1 → 3, цена 1000 RUB → 900 RUB") {
+		t.Errorf("format() = %q", got)
+	}
+
+	if !diffCartItems(before, before).empty() {
+		t.Error("diff of a list with itself is not empty")
+	}
+}
+
+func TestCartHistory(t *testing.T) {
+	t.Parallel()
+
+	h := NewCartHistory(3)
+	for i, id := range []string{"a", "b", "a", "c"} {
+		h.Add(CartHistoryEntry{Action: "add", ItemIDs: []string{id}, QuantityDelta: i + 1})
+	}
+	if got := h.Recent("", "", 0); len(got) != 3 || got[0].QuantityDelta != 4 || got[2].QuantityDelta != 2 {
+		t.Errorf("Recent() = %v, want the last three entries newest first", got)
+	}
+	if got := h.Recent("", "a", 0); len(got) != 1 || got[0].QuantityDelta != 3 {
+		t.Errorf("Recent(a) = %v, want only the entry that is still buffered", got)
+	}
+	if got := h.Recent("", "", 2); len(got) != 2 {
+		t.Errorf("Recent(limit 2) returned %d entries", len(got))
+	}
+}
+
+func TestCartClearHistory(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCart()
+	c.name = "history-test"
+	for _, id := range []string{"history-a", "history-b"} {
+		if _, err := c.Add(t.Context(), id, id, "", "", "", "", 2); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	c.Clear(t.Context())
+
+	entries := cartHistory.Recent("", "history-a", 0)
+	if len(entries) != 2 {
+		t.Fatalf("history of history-a has %d entries, want 2", len(entries))
+	}
+	entry := entries[0]
+	if entry.Action != "clear" || entry.QuantityDelta != -4 || len(entry.ItemIDs) != 2 {
+		t.Errorf("clear entry = %+v, want one entry for both lines with delta -4", entry)
+	}
+}
+
+func TestBudgetLine(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		totals map[string]float64
+		budget Budget
+		want   string
+	}{
+		{name: "no budget", totals: map[string]float64{"RUB": 100}, want: ""},
+		{name: "within budget", totals: map[string]float64{"RUB": 12000}, budget: Budget{Amount: 15000, Currency: "RUB"}, want: "осталось 3000.00 RUB"},
+		{name: "over budget", totals: map[string]float64{"RUB": 16500}, budget: Budget{Amount: 15000, Currency: "RUB"}, want: "превышен на 1500.00 RUB"},
+		{name: "other currency", totals: map[string]float64{"RUB": 100, "USD": 5}, budget: Budget{Amount: 1000, Currency: "RUB"}, want: "без учёта сумм в USD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := budgetLine(tt.totals, tt.budget)
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("budgetLine() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDealReached(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		item    CartItem
+		want    bool
+		wantErr error
+	}{
+		{name: "no target", item: CartItem{Price: "1000 ₽"}},
+		{name: "below target", item: CartItem{Price: "899 ₽", TargetPrice: 900, TargetCurrency: "RUB"}, want: true},
+		{name: "at target", item: CartItem{Price: "900 ₽", TargetPrice: 900, TargetCurrency: "RUB"}, want: true},
+		{name: "above target", item: CartItem{Price: "1 000 ₽", TargetPrice: 900, TargetCurrency: "RUB"}},
+		{name: "unparsed price", item: CartItem{Price: "по запросу", TargetPrice: 900}, wantErr: errPriceUnparsed},
+		{name: "other currency", item: CartItem{Price: "10 USD", TargetPrice: 900, TargetCurrency: "RUB"}, wantErr: errCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			item := tt.item
+			item.updateParsedPrice()
+			got, err := dealReached(&item)
+			if got != tt.want || !errors.Is(err, tt.wantErr) {
+				t.Errorf("dealReached() = (%t, %v), want (%t, %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGroupCartByShop(t *testing.T) {
+	t.Parallel()
+
+	items := []*CartItem{
+		{ID: "a", Shop: "cheap.ru", Price: "100 ₽", Quantity: 1},
+		{ID: "b", Shop: "", Price: "5000 ₽", Quantity: 1},
+		{ID: "c", Shop: "dear.ru", Price: "700 ₽", Quantity: 2},
+		{ID: "d", Shop: "dear.ru", Price: "по запросу", Quantity: 1},
+		{ID: "e", Shop: "abroad.com", Price: "5000 USD", Quantity: 1},
+	}
+	for _, item := range items {
+		item.updateParsedPrice()
+	}
+
+	groups := groupCartByShop(items)
+	var shops []string
+	for _, group := range groups {
+		shops = append(shops, group.Shop)
+	}
+	// 5000 USD is not added to or compared with roubles, so abroad.com
+	// ranks after every shop with a RUB subtotal.
+	if want := []string{"dear.ru", "cheap.ru", "abroad.com", ""}; !slices.Equal(shops, want) {
+		t.Fatalf("shops = %q, want %q", shops, want)
+	}
+	if dear := groups[0]; len(dear.Items) != 2 || dear.Quantity != 3 || dear.Totals["RUB"] != 1400 || dear.Unpriced != 1 {
+		t.Errorf("dear.ru group = %d lines, %d units, %v, %d unpriced, want 2 lines, 3 units, 1400 RUB, 1 unpriced", len(dear.Items), dear.Quantity, dear.Totals, dear.Unpriced)
+	}
+	if abroad := groups[2]; len(abroad.Totals) != 1 || abroad.Totals["USD"] != 5000 {
+		t.Errorf("abroad.com totals = %v, want 5000 USD only", abroad.Totals)
+	}
+}
+
+// TestViewCartGroupByShopPages checks that group_by_shop groups the whole
+// cart before paging: a shop's header shows its full subtotal on every page
+// its items appear on.
+func TestViewCartGroupByShopPages(t *testing.T) {
+	t.Parallel()
+
+	registry := newTestCartRegistry(defaultCartName)
+	home, _ := registry.Get(defaultCartName)
+	var lines []*CartItem
+	for i, line := range []struct{ shop, price string }{
+		{"cheap.ru", "100 ₽"},
+		{"dear.ru", "1 000 ₽"},
+		{"dear.ru", "2 000 ₽"},
+		{"cheap.ru", "200 ₽"},
+		{"dear.ru", "3 000 ₽"},
+	} {
+		lines = append(lines, &CartItem{ID: fmt.Sprintf("item-%d", i), Title: fmt.Sprintf("Товар %d", i), Shop: line.shop, Price: line.price, Quantity: 1})
+	}
+	home.load(lines)
+	srv := NewServer(NewMemoryCartStore(registry), nil)
+
+	tests := []struct {
+		page   int
+		want   []string
+		absent []string
+	}{
+		{
+			page:   1,
+			want:   []string{"🏪 dear.ru — товаров: 3 (позиций: 3, на этой странице: 2), сумма: 6 000.00 RUB", "Товар 1", "Товар 2"},
+			absent: []string{"cheap.ru", "Товар 4"},
+		},
+		{
+			page: 2,
+			want: []string{
+				"🏪 dear.ru — товаров: 3 (позиций: 3, на этой странице: 1), сумма: 6 000.00 RUB",
+				"🏪 cheap.ru — товаров: 2 (позиций: 2, на этой странице: 1), сумма: 300.00 RUB",
+			},
+		},
+		{
+			page: 3,
+			want: []string{"🏪 cheap.ru — товаров: 2 (позиций: 2, на этой странице: 1), сумма: 300.00 RUB"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("page %d", tt.page), func(t *testing.T) {
+			t.Parallel()
+
+			var request mcp.CallToolRequest
+			request.Params.Arguments = map[string]any{"group_by_shop": true, "page": float64(tt.page), "page_size": float64(2)}
+			result, err := srv.handleViewCart(t.Context(), request)
+			if err != nil || result.IsError {
+				t.Fatalf("view_cart error = %v, result = %s", err, toolResultText(result))
+			}
+			text := toolResultText(result)
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("view_cart page %d does not contain %q:\n%s", tt.page, want, text)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(text, absent) {
+					t.Errorf("view_cart page %d contains %q:\n%s", tt.page, absent, text)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateItemIDCanonicalLinks(t *testing.T) {
+	t.Parallel()
+
+	want := generateItemID(SearchItem{Link: "https://megamarket.ru/catalog/details/chaynik-100?color=red"})
+	variants := []string{
+		"https://megamarket.ru/catalog/details/chaynik-100?color=red",
+		"http://megamarket.ru/catalog/details/chaynik-100?color=red",
+		"https://MegaMarket.RU/catalog/details/chaynik-100?color=red",
+		"https://megamarket.ru/catalog/details/chaynik-100/?color=red",
+		"https://megamarket.ru/catalog/details/chaynik-100?color=red#reviews",
+		"https://megamarket.ru/catalog/details/chaynik-100?utm_source=google&color=red&utm_medium=cpc",
+		"https://megamarket.ru/catalog/details/chaynik-100?color=red&yclid=123&gclid=abc",
+		"  https://megamarket.ru/catalog/details/chaynik-100?color=red  ",
+	}
+	for _, link := range variants {
+		if got := generateItemID(SearchItem{Link: link}); got != want {
+			t.Errorf("generateItemID(%q) = %s, want %s", link, got, want)
+		}
+	}
+
+	different := []string{
+		"https://megamarket.ru/catalog/details/chaynik-100?color=blue",
+		"https://megamarket.ru/catalog/details/chaynik-101?color=red",
+		"https://megamarket.ru/Catalog/details/chaynik-100?color=red",
+	}
+	for _, link := range different {
+		if got := generateItemID(SearchItem{Link: link}); got == want {
+			t.Errorf("generateItemID(%q) collapsed with a different product", link)
+		}
+	}
+}
+
+func TestCartDedupe(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCart()
+	for _, line := range []struct {
+		id, link string
+		quantity int
+	}{
+		{"first", "https://example.com/kettle", 1},
+		{"second", "http://example.com/kettle/?utm_source=ya", 2},
+		{"other", "https://example.com/mug", 1},
+	} {
+		if _, err := c.Add(t.Context(), line.id, line.id, line.link, "", "", "", line.quantity); err != nil {
+			t.Fatalf("Add(%s) error = %v", line.id, err)
+		}
+	}
+	c.Items["second"].AddedAt = c.Items["first"].AddedAt.Add(time.Minute)
+
+	if got := cartLineID(c.Snapshot(), "new-id", "https://EXAMPLE.com/mug#photos"); got != "other" {
+		t.Errorf("cartLineID() = %s, want the existing line other", got)
+	}
+
+	lines := c.Dedupe(t.Context())
+	if len(lines) != 1 || lines[0].Kept.ID != "first" || !slices.Equal(lines[0].MergedIDs, []string{"second"}) {
+		t.Fatalf("Dedupe() = %+v, want second merged into first", lines)
+	}
+	if len(c.Items) != 2 || c.Items["first"].Quantity != 3 {
+		t.Errorf("cart after Dedupe() = %v, want first × 3 and other", c.Items)
+	}
+	if c.Dedupe(t.Context()) != nil {
+		t.Error("second Dedupe() found duplicates again")
+	}
+}
+
+func TestParseCartItemInputValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		args      map[string]any
+		wantField string
+	}{
+		{name: "valid", args: map[string]any{"item_id": "kettle", "title": "Чайник", "link": "https://example.com/kettle", "price": "1 299 ₽"}},
+		{name: "unparsed price is kept", args: map[string]any{"item_id": "kettle", "title": "Чайник", "price": "уточняйте у продавца"}},
+		{name: "empty id", args: map[string]any{"item_id": " ", "title": "Чайник"}, wantField: "item_id"},
+		{name: "placeholder link", args: map[string]any{"item_id": "kettle", "title": "Чайник", "link": "N/A"}, wantField: "link"},
+		{name: "relative link", args: map[string]any{"item_id": "kettle", "title": "Чайник", "link": "/catalog/kettle"}, wantField: "link"},
+		{name: "too many", args: map[string]any{"item_id": "kettle", "title": "Чайник", "quantity": float64(defaultMaxCartQuantity + 1)}, wantField: "quantity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseCartItemInput(tt.args)
+			var fieldErr *ItemFieldError
+			switch {
+			case tt.wantField == "" && err != nil:
+				t.Errorf("parseCartItemInput() error = %v, want nil", err)
+			case tt.wantField != "" && (!errors.As(err, &fieldErr) || fieldErr.Field != tt.wantField):
+				t.Errorf("parseCartItemInput() error = %v, want an error for field %s", err, tt.wantField)
+			}
+		})
+	}
+
+	input, err := parseCartItemInput(map[string]any{"item_id": "kettle", "description": strings.Repeat("я", defaultMaxDescriptionLength+10)})
+	if err != nil {
+		t.Fatalf("parseCartItemInput() error = %v", err)
+	}
+	if got := len([]rune(input.Description)); got != defaultMaxDescriptionLength {
+		t.Errorf("description is %d runes long, want it cut to %d", got, defaultMaxDescriptionLength)
+	}
+}
+
+// TestViewCartExpiredFirstPage checks that view_cart lists the expired
+// lines on the first page only, however many pages the cart has.
+func TestViewCartExpiredFirstPage(t *testing.T) {
+	prevTTL := config.CartItemTTL
+	t.Cleanup(func() { config.CartItemTTL = prevTTL })
+	config.CartItemTTL = 168 * time.Hour
+
+	registry := newTestCartRegistry(defaultCartName)
+	home, _ := registry.Get(defaultCartName)
+	now := home.now()
+	home.load([]*CartItem{
+		{ID: "kettle", Title: "Чайник", Quantity: 1, AddedAt: now, UpdatedAt: now},
+		{ID: "mug", Title: "Кружка", Quantity: 1, AddedAt: now.Add(time.Minute), UpdatedAt: now},
+		{ID: "lamp", Title: "Лампа", Quantity: 1, AddedAt: now.Add(-300 * time.Hour), UpdatedAt: now.Add(-300 * time.Hour)},
+	})
+	srv := NewServer(NewMemoryCartStore(registry), nil)
+
+	for _, tt := range []struct {
+		page        float64
+		wantExpired bool
+	}{
+		{page: 1, wantExpired: true},
+		{page: 2, wantExpired: false},
+		{page: 3, wantExpired: false},
+	} {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = map[string]any{"page": tt.page, "page_size": float64(1)}
+		result, err := srv.handleViewCart(t.Context(), request)
+		if err != nil || result.IsError {
+			t.Fatalf("page %g: handleViewCart() = %v, %v", tt.page, result, err)
+		}
+		text := toolResultText(result)
+		want := 0
+		if tt.wantExpired {
+			want = 1
+		}
+		if got := strings.Count(text, "Устаревшие позиции"); got != want {
+			t.Errorf("page %g lists the expired lines %d times, want them only on the first page:\n%s", tt.page, got, text)
+		}
+	}
+}
+
+func TestCartPruneExpired(t *testing.T) {
+	prevTTL := config.CartItemTTL
+	t.Cleanup(func() { config.CartItemTTL = prevTTL })
+
+	c := newTestCart()
+	for _, id := range []string{"old", "fresh"} {
+		if _, err := c.Add(t.Context(), id, "Товар "+id, "", "100 ₽", "", "", 1); err != nil {
+			t.Fatalf("Add(%s) error = %v", id, err)
+		}
+	}
+	c.Items["old"].UpdatedAt = c.now().Add(-200 * time.Hour)
+
+	config.CartItemTTL = 0
+	if removed := c.PruneExpired(t.Context()); removed != nil {
+		t.Fatalf("PruneExpired() without a TTL removed %v", removed)
+	}
+
+	config.CartItemTTL = 168 * time.Hour
+	fresh, expired := splitExpired(c.Snapshot(), c.now())
+	if len(fresh) != 1 || len(expired) != 1 || expired[0].ID != "old" {
+		t.Fatalf("splitExpired() = %v, %v, want only old expired", fresh, expired)
+	}
+	removed := c.PruneExpired(t.Context())
+	if len(removed) != 1 || removed[0].ID != "old" {
+		t.Fatalf("PruneExpired() = %v, want old", removed)
+	}
+	if _, exists := c.Items["old"]; exists || len(c.Items) != 1 {
+		t.Errorf("cart after prune = %v, want only fresh", c.Items)
+	}
+	if len(c.trash) != 1 || c.trash[0].Item.ID != "old" {
+		t.Errorf("trash = %v, want the pruned item", c.trash)
+	}
+}
+
+// cartToolStep is one tool call of a handler test and what its result must say.
+type cartToolStep struct {
+	name      string
+	handler   func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	args      map[string]any
+	wantError bool
+	want      []string
+	// wantAbsent are texts the result must not contain.
+	wantAbsent []string
+}
+
+// runCartToolSteps calls the handlers of steps in order on the same carts.
+func runCartToolSteps(t *testing.T, steps []cartToolStep) {
+	t.Helper()
+	for _, step := range steps {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = step.args
+		result, err := step.handler(t.Context(), request)
+		if err != nil {
+			t.Fatalf("%s: handler error = %v", step.name, err)
+		}
+		text := toolResultText(result)
+		if result.IsError != step.wantError {
+			t.Errorf("%s: IsError = %t, want %t; text: %s", step.name, result.IsError, step.wantError, text)
+		}
+		for _, want := range step.want {
+			if !strings.Contains(text, want) {
+				t.Errorf("%s: result does not contain %q:\n%s", step.name, want, text)
+			}
+		}
+		for _, absent := range step.wantAbsent {
+			if strings.Contains(text, absent) {
+				t.Errorf("%s: result contains %q:\n%s", step.name, absent, text)
+			}
+		}
+	}
+}
+
+func TestHandleAddToCart(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(NewMemoryCartStore(newTestCartRegistry(defaultCartName)), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{name: "missing item_id", handler: srv.handleAddToCart, args: map[string]any{"title": "Чайник"}, wantError: true, want: []string{"item_id"}},
+		{name: "item_id of the wrong type", handler: srv.handleAddToCart, args: map[string]any{"item_id": float64(7), "title": "Чайник"}, wantError: true, want: []string{"item_id parameter must be a string"}},
+		{name: "new item without a title", handler: srv.handleAddToCart, args: map[string]any{"item_id": "kettle"}, wantError: true, want: []string{"title parameter is required"}},
+		{name: "unknown cart", handler: srv.handleAddToCart, args: map[string]any{"item_id": "kettle", "title": "Чайник", "cart": "дача"}, wantError: true, want: []string{`cart "дача" does not exist`}},
+		{
+			name:    "new item",
+			handler: srv.handleAddToCart,
+			args:    map[string]any{"item_id": "kettle", "title": "Чайник", "link": "https://example.com/kettle", "price": "2 990 ₽", "shop": "example.com"},
+			want:    []string{"✅ Товар добавлен в корзину", "Количество в корзине: 1", "ID: kettle"},
+		},
+		{
+			name:    "same item again",
+			handler: srv.handleAddToCart,
+			args:    map[string]any{"item_id": "kettle", "title": "Чайник"},
+			want:    []string{"🔁 Товар уже был в корзине, количество увеличено", "Количество в корзине: 2 (было 1)"},
+		},
+	})
+}
+
+func TestHandleRemoveFromCart(t *testing.T) {
+	t.Parallel()
+
+	registry := newTestCartRegistry(defaultCartName)
+	home, _ := registry.Get(defaultCartName)
+	home.load([]*CartItem{
+		{ID: "kettle", Title: "Чайник", Quantity: 3},
+		{ID: "mug", Title: "Кружка", Quantity: 1},
+	})
+	srv := NewServer(NewMemoryCartStore(registry), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{name: "decrement", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "kettle"}, want: []string{"Удалено 1 из 3, осталось 2", "Чайник"}},
+		{name: "decrement by quantity", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "kettle", "quantity": float64(1)}, want: []string{"Удалено 1 из 2, осталось 1"}},
+		{name: "missing id lists the cart", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "spoon"}, wantError: true, want: []string{"Item spoon not found in cart", "Available item IDs:\nkettle\nmug"}},
+		{name: "last unit removes the line", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "kettle"}, want: []string{"🗑️ Товар удалён из корзины (удалено 1 шт.)", "ID: kettle"}},
+		{name: "all", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "mug", "all": true}, want: []string{"🗑️ Товар удалён из корзины (удалено 1 шт.)", "Кружка"}},
+		{name: "missing id in an empty cart", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "kettle"}, wantError: true, want: []string{"The cart is empty"}},
+		{name: "empty item_id", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": " "}, wantError: true, want: []string{"item_id parameter is required"}},
+		{name: "fractional quantity", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "kettle", "quantity": 1.5}, wantError: true, want: []string{"quantity parameter must be a positive integer"}},
+	})
+}
+
+func TestHandleAddToCartQuantity(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(NewMemoryCartStore(newTestCartRegistry(defaultCartName)), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{name: "new item × 3", handler: srv.handleAddToCart, args: map[string]any{"item_id": "socks", "title": "Носки", "quantity": float64(3)}, want: []string{"✅ Товар добавлен", "Количество в корзине: 3"}},
+		{name: "top up", handler: srv.handleAddToCart, args: map[string]any{"item_id": "socks", "quantity": float64(2)}, want: []string{"количество увеличено", "Количество в корзине: 5 (было 3)"}},
+		{name: "default of one", handler: srv.handleAddToCart, args: map[string]any{"item_id": "socks"}, want: []string{"Количество в корзине: 6 (было 5)"}},
+		{
+			name:      "top up past the maximum",
+			handler:   srv.handleAddToCart,
+			args:      map[string]any{"item_id": "socks", "quantity": float64(config.MaxCartQuantity)},
+			wantError: true,
+			want:      []string{fmt.Sprintf("quantity per item is limited to %d (currently 6)", config.MaxCartQuantity)},
+		},
+		{name: "zero", handler: srv.handleAddToCart, args: map[string]any{"item_id": "socks", "quantity": float64(0)}, wantError: true, want: []string{"quantity"}},
+		{name: "fraction", handler: srv.handleAddToCart, args: map[string]any{"item_id": "socks", "quantity": 1.5}, wantError: true, want: []string{"quantity"}},
+		{name: "unchanged after the errors", handler: srv.handleViewCart, want: []string{"Количество: 6"}},
+	})
+}
+
+// TestCartItemToolsNamedCart checks that the tools changing one cart line
+// work on the cart passed in the cart parameter and leave the others alone.
+func TestCartItemToolsNamedCart(t *testing.T) {
+	prev := wishlists
+	t.Cleanup(func() { wishlists = prev })
+	wishlists = NewWishlistStore("")
+
+	registry := newTestCartRegistry(defaultCartName, "дача")
+	dacha, _ := registry.Get("дача")
+	dacha.load([]*CartItem{{ID: "kettle", Title: "Чайник", Shop: "citilink.ru", Quantity: 1}})
+	srv := NewServer(NewMemoryCartStore(registry), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{name: "search the named cart", handler: srv.handleSearchCart, args: map[string]any{"query": "чайник", "cart": "дача"}, want: []string{"Найдено в корзине «дача»", "Чайник × 1"}},
+		{name: "search the default cart", handler: srv.handleSearchCart, args: map[string]any{"query": "чайник"}, want: []string{"В корзине нет товаров"}},
+		{name: "note", handler: srv.handleSetItemNote, args: map[string]any{"item_id": "kettle", "note": "на кухню", "cart": "дача"}, want: []string{"Заметка сохранена"}},
+		{name: "tag", handler: srv.handleTagItem, args: map[string]any{"item_id": "kettle", "tag": "подарок", "cart": "дача"}, want: []string{"Все теги в корзине «дача»: подарок (1)"}},
+		{name: "priority", handler: srv.handleSetPriority, args: map[string]any{"item_id": "kettle", "priority": "high", "cart": "дача"}, want: []string{"normal → high"}},
+		{name: "not in the default cart", handler: srv.handleSetPriority, args: map[string]any{"item_id": "kettle", "priority": "low"}, wantError: true, want: []string{"Item kettle not found in cart"}},
+		{name: "unknown cart", handler: srv.handleTagItem, args: map[string]any{"item_id": "kettle", "tag": "подарок", "cart": "офис"}, wantError: true, want: []string{`cart "офис" does not exist`}},
+		{name: "named cart after the changes", handler: srv.handleViewCart, args: map[string]any{"cart": "дача"}, want: []string{"❗ Чайник", "Заметка: на кухню", "Теги: подарок"}},
+		{name: "wishlist from the default cart", handler: srv.handleAddToWishlist, args: map[string]any{"item_id": "kettle"}, wantError: true, want: []string{"title parameter is required"}},
+		{name: "wishlist from the named cart", handler: srv.handleAddToWishlist, args: map[string]any{"item_id": "kettle", "cart": "дача"}, want: []string{"Товар отложен", "Чайник"}},
+	})
+}
+
+func TestHandleUndoCart(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(NewMemoryCartStore(newTestCartRegistry(defaultCartName)), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{name: "empty journal", handler: srv.handleUndoCart, want: []string{"Нечего отменять"}},
+		{name: "unknown cart", handler: srv.handleUndoCart, args: map[string]any{"cart": "дача"}, wantError: true, want: []string{`cart "дача" does not exist`}},
+		{name: "add kettle", handler: srv.handleAddToCart, args: map[string]any{"item_id": "kettle", "title": "Чайник", "quantity": float64(2)}},
+		{name: "add mug", handler: srv.handleAddToCart, args: map[string]any{"item_id": "mug", "title": "Кружка"}},
+		{name: "undo add", handler: srv.handleUndoCart, want: []string{"Отменено: добавление товара", "убран Кружка (ID: mug)"}},
+		{name: "mug is gone", handler: srv.handleViewCart, want: []string{"Чайник"}, wantAbsent: []string{"Кружка"}},
+
+		{name: "remove one kettle", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "kettle", "quantity": float64(1)}},
+		{name: "undo remove", handler: srv.handleUndoCart, want: []string{"Отменено: удаление товара", "Чайник: количество 1 → 2"}},
+
+		{name: "set quantity", handler: srv.handleSetQuantity, args: map[string]any{"item_id": "kettle", "quantity": float64(5)}},
+		{name: "undo set_quantity", handler: srv.handleUndoCart, want: []string{"Отменено: изменение количества", "Чайник: количество 5 → 2"}},
+
+		{name: "clear", handler: srv.handleClearCart, args: map[string]any{"confirm": true}},
+		{name: "undo clear", handler: srv.handleUndoCart, want: []string{"Отменено: очистка корзины", "возвращён Чайник × 2 (ID: kettle)"}},
+		{name: "kettle is back", handler: srv.handleViewCart, want: []string{"Чайник", "Количество: 2"}},
+
+		{name: "undo the first add", handler: srv.handleUndoCart, want: []string{"Отменено: добавление товара", "убран Чайник (ID: kettle)"}},
+		{name: "journal used up", handler: srv.handleUndoCart, want: []string{"Нечего отменять"}},
+		{name: "cart is empty again", handler: srv.handleViewCart, want: []string{"пуста"}},
+	})
+}
+
+// TestHandleUndoCartJournalSize checks that undo_cart goes back only as many
+// changes as the journal keeps.
+func TestHandleUndoCartJournalSize(t *testing.T) {
+	prev := config.UndoJournalSize
+	t.Cleanup(func() { config.UndoJournalSize = prev })
+	config.UndoJournalSize = 2
+
+	srv := NewServer(NewMemoryCartStore(newTestCartRegistry(defaultCartName)), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{name: "add kettle", handler: srv.handleAddToCart, args: map[string]any{"item_id": "kettle", "title": "Чайник"}},
+		{name: "add mug", handler: srv.handleAddToCart, args: map[string]any{"item_id": "mug", "title": "Кружка"}},
+		{name: "add lamp", handler: srv.handleAddToCart, args: map[string]any{"item_id": "lamp", "title": "Лампа"}},
+		{name: "undo lamp", handler: srv.handleUndoCart, want: []string{"убран Лампа"}},
+		{name: "undo mug", handler: srv.handleUndoCart, want: []string{"убран Кружка"}},
+		{name: "kettle fell out of the journal", handler: srv.handleUndoCart, want: []string{"Нечего отменять"}},
+		{name: "kettle stays", handler: srv.handleViewCart, want: []string{"Чайник"}},
+	})
+}
+
+func TestHandleCartTotal(t *testing.T) {
+	t.Parallel()
+
+	registry := newTestCartRegistry(defaultCartName)
+	home, _ := registry.Get(defaultCartName)
+	home.load([]*CartItem{
+		{ID: "kettle", Title: "Чайник", Price: "от 1 299 ₽", Quantity: 2},
+		{ID: "mug", Title: "Кружка", Price: "490,50 руб.", Quantity: 1},
+		{ID: "lamp", Title: "Лампа", Price: "$19.99", Quantity: 1},
+		{ID: "sofa", Title: "Диван", Price: "по запросу", Quantity: 1},
+	})
+	srv := NewServer(NewMemoryCartStore(registry), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{
+			name:    "priced and unpriced lines",
+			handler: srv.handleCartTotal,
+			want: []string{
+				"• Чайник: 1299.00 × 2 = 2598.00 RUB",
+				"• Кружка: 490.50 × 1 = 490.50 RUB",
+				"💰 Итого: 3088.50 RUB + 19.99 USD",
+				"⚠️ Без цены (1, не учтены в итоге):\n• Диван × 1 — цена: \"по запросу\" (ID: sofa)",
+			},
+		},
+	})
+
+	registry = newTestCartRegistry(defaultCartName)
+	home, _ = registry.Get(defaultCartName)
+	home.load([]*CartItem{{ID: "sofa", Title: "Диван", Price: "по запросу", Quantity: 1}})
+	unpriced := NewServer(NewMemoryCartStore(registry), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{name: "only unpriced lines", handler: unpriced.handleCartTotal, want: []string{"💰 Итого: не удалось рассчитать", "Без цены (1"}},
+		{name: "unknown cart", handler: unpriced.handleCartTotal, args: map[string]any{"cart": "дача"}, wantError: true, want: []string{`cart "дача" does not exist`}},
+	})
+}
+
+func TestSortCartItems(t *testing.T) {
+	t.Parallel()
+
+	added := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newItems := func() []*CartItem {
+		items := []*CartItem{
+			{ID: "c", Title: "вилка", Price: "300 ₽", Quantity: 1, AddedAt: added.Add(2 * time.Hour)},
+			{ID: "a", Title: "Ложка", Price: "по запросу", Quantity: 5, AddedAt: added},
+			{ID: "d", Title: "Блюдце", Price: "100 ₽", Quantity: 2, AddedAt: added.Add(time.Hour)},
+			{ID: "b", Title: "блюдце", Price: "100 ₽", Quantity: 2, AddedAt: added.Add(time.Hour)},
+		}
+		for _, item := range items {
+			item.updateParsedPrice()
+		}
+		return items
+	}
+
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{by: "added", want: []string{"a", "b", "d", "c"}},
+		{by: "title", want: []string{"b", "d", "c", "a"}},
+		{by: "price", want: []string{"b", "d", "c", "a"}},
+		{by: "quantity", want: []string{"a", "b", "d", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			t.Parallel()
+
+			items := newItems()
+			sortCartItems(items, tt.by)
+			var got []string
+			for _, item := range items {
+				got = append(got, item.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sortCartItems(%s) = %v, want %v", tt.by, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestViewCartStableOrder checks that view_cart prints the cart in the same
+// order on every call, whatever order the cart map iterates in.
+func TestViewCartStableOrder(t *testing.T) {
+	t.Parallel()
+
+	registry := newTestCartRegistry(defaultCartName)
+	home, _ := registry.Get(defaultCartName)
+	var lines []*CartItem
+	for i := range 20 {
+		lines = append(lines, &CartItem{ID: fmt.Sprintf("item-%02d", i), Title: fmt.Sprintf("Товар %02d", 20-i), Price: fmt.Sprintf("%d ₽", 100+i%3), Quantity: 1 + i%4})
+	}
+	home.load(lines)
+	srv := NewServer(NewMemoryCartStore(registry), nil)
+
+	for _, sortBy := range []string{"", "added", "title", "price", "quantity", "priority"} {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = map[string]any{"sort": sortBy, "page_size": float64(50)}
+		var first string
+		for i := range 10 {
+			result, err := srv.handleViewCart(t.Context(), request)
+			if err != nil || result.IsError {
+				t.Fatalf("view_cart sort=%q error = %v, result = %s", sortBy, err, toolResultText(result))
+			}
+			if text := toolResultText(result); i == 0 {
+				first = text
+			} else if text != first {
+				t.Fatalf("view_cart sort=%q call %d differs from the first call:\n%s\n---\n%s", sortBy, i, first, text)
+			}
+		}
+	}
+
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]any{"sort": "cheapest"}
+	if result, _ := srv.handleViewCart(t.Context(), request); !result.IsError || !strings.Contains(toolResultText(result), "sort must be one of") {
+		t.Errorf("view_cart with an unknown sort = %s, want an error listing the sort orders", toolResultText(result))
+	}
+}
+
+func TestFormatRelativeTime(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{ago: 30 * time.Second, want: "только что"},
+		{ago: time.Minute, want: "1 минуту назад"},
+		{ago: 3 * time.Minute, want: "3 минуты назад"},
+		{ago: 11 * time.Minute, want: "11 минут назад"},
+		{ago: 21 * time.Hour, want: "21 час назад"},
+		{ago: 2 * time.Hour, want: "2 часа назад"},
+		{ago: 3 * 24 * time.Hour, want: "3 дня назад"},
+		{ago: 5 * 24 * time.Hour, want: "5 дней назад"},
+		{ago: 40 * 24 * time.Hour, want: "29.01.2025"},
+	}
+	for _, tt := range tests {
+		if got := formatRelativeTime(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("formatRelativeTime(now - %v) = %q, want %q", tt.ago, got, tt.want)
+		}
+	}
+}
+
+// TestCartItemTimes drives the cart clock by hand: AddedAt is set once,
+// UpdatedAt follows every change, and view_cart renders both relative to
+// the cart's clock and sorts by AddedAt with sort=added.
+func TestCartItemTimes(t *testing.T) {
+	t.Parallel()
+
+	clock := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	registry := newTestCartRegistry(defaultCartName)
+	home, _ := registry.Get(defaultCartName)
+	home.now = func() time.Time { return clock }
+	store := NewMemoryCartStore(registry)
+	ctx := t.Context()
+
+	added := clock
+	if _, err := store.Add(ctx, defaultCartName, CartItem{ID: "kettle", Title: "Чайник"}, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	clock = clock.Add(24 * time.Hour)
+	if _, err := store.Add(ctx, defaultCartName, CartItem{ID: "mug", Title: "Кружка"}, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	clock = clock.Add(24 * time.Hour)
+	updated := clock
+	if _, _, err := store.SetQuantity(ctx, defaultCartName, "kettle", 3); err != nil {
+		t.Fatalf("SetQuantity() error = %v", err)
+	}
+
+	kettle, _, _ := store.Get(ctx, defaultCartName, "kettle")
+	if !kettle.AddedAt.Equal(added) || !kettle.UpdatedAt.Equal(updated) {
+		t.Errorf("kettle times = %v, %v, want added %v and updated %v", kettle.AddedAt, kettle.UpdatedAt, added, updated)
+	}
+	lines, _ := store.List(ctx, defaultCartName)
+	lines[0].AddedAt = time.Time{}
+	if again, _, _ := store.Get(ctx, defaultCartName, lines[0].ID); again.AddedAt.IsZero() {
+		t.Error("List() returned lines sharing their times with the cart")
+	}
+
+	clock = clock.Add(24*time.Hour + 2*time.Hour)
+	srv := NewServer(store, nil)
+	var request mcp.CallToolRequest
+	request.Params.Arguments = map[string]any{"sort": "added"}
+	result, err := srv.handleViewCart(ctx, request)
+	if err != nil || result.IsError {
+		t.Fatalf("view_cart error = %v, result = %s", err, toolResultText(result))
+	}
+	text := toolResultText(result)
+	for _, want := range []string{"🕒 Добавлено 3 дня назад, изменено 1 день назад", "🕒 Добавлено 2 дня назад"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("view_cart does not contain %q:\n%s", want, text)
+		}
+	}
+	if kettleAt, mugAt := strings.Index(text, "Чайник"), strings.Index(text, "Кружка"); kettleAt < 0 || mugAt < kettleAt {
+		t.Errorf("view_cart sort=added shows the mug before the kettle:\n%s", text)
+	}
+}
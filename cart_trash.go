@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	maxTrashItems   = 50
+	defaultTrashTTL = 24 * time.Hour
+)
+
+// removedItem is a cart line that was deleted completely and can still be restored.
+type removedItem struct {
+	Item      *CartItem
+	RemovedAt time.Time
+}
+
+// trashLocked moves deleted lines to the trash, keeping only the newest
+// maxTrashItems entries younger than config.TrashTTL. The caller must hold c.mutex.
+func (c *Cart) trashLocked(items ...*CartItem) {
+	now := c.now()
+	for _, item := range items {
+		c.untrashLocked(item.ID)
+		c.trash = append(c.trash, removedItem{Item: item.clone(), RemovedAt: now})
+	}
+	c.pruneTrashLocked(now)
+}
+
+func (c *Cart) pruneTrashLocked(now time.Time) {
+	kept := c.trash[:0]
+	for _, entry := range c.trash {
+		if now.Sub(entry.RemovedAt) <= config.TrashTTL {
+			kept = append(kept, entry)
+		}
+	}
+	if extra := len(kept) - maxTrashItems; extra > 0 {
+		kept = append(kept[:0], kept[extra:]...)
+	}
+	clear(c.trash[len(kept):])
+	c.trash = kept
+}
+
+// untrashLocked forgets the trash entry of an item that is back in the cart.
+func (c *Cart) untrashLocked(itemID string) {
+	for i, entry := range c.trash {
+		if entry.Item.ID == itemID {
+			c.trash = append(c.trash[:i], c.trash[i+1:]...)
+			return
+		}
+	}
+}
+
+// Removed returns copies of the trash entries, most recently removed first.
+func (c *Cart) Removed() []removedItem {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.pruneTrashLocked(c.now())
+	result := make([]removedItem, 0, len(c.trash))
+	for i := len(c.trash) - 1; i >= 0; i-- {
+		result = append(result, removedItem{Item: c.trash[i].Item.clone(), RemovedAt: c.trash[i].RemovedAt})
+	}
+	return result
+}
+
+// Restore moves an item from the trash back into the cart with the quantity
+// it had when it was removed.
+func (c *Cart) Restore(ctx context.Context, itemID string) (*CartItem, error) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	c.pruneTrashLocked(c.now())
+	var restored *CartItem
+	for _, entry := range c.trash {
+		if entry.Item.ID == itemID {
+			restored = entry.Item.clone()
+			break
+		}
+	}
+	if restored == nil {
+		return nil, fmt.Errorf("item %s is not among recently removed items", itemID)
+	}
+	if _, exists := c.Items[itemID]; exists {
+		return nil, fmt.Errorf("item %s is already in the cart", itemID)
+	}
+
+	totalQuantity := 0
+	for _, item := range c.Items {
+		totalQuantity += item.Quantity
+	}
+	if totalQuantity+restored.Quantity > config.MaxCartTotalQuantity {
+		return nil, &CartLimitError{Limit: "total quantity", Max: config.MaxCartTotalQuantity, Current: totalQuantity}
+	}
+	if len(c.Items) >= config.MaxCartItems {
+		return nil, &CartLimitError{Limit: "distinct items", Max: config.MaxCartItems, Current: len(c.Items)}
+	}
+
+	c.recordLocked("restore", itemID)
+	restored.UpdatedAt = c.now()
+	c.Items[itemID] = restored
+	c.untrashLocked(itemID)
+	return restored.clone(), nil
+}
+
+func restoreItem(ctx context.Context, c *Cart, itemID string) (*CartItem, error) {
+	item, err := c.Restore(ctx, itemID)
+	if err == nil {
+		cartAddTotal.Inc()
+	}
+	return item, err
+}
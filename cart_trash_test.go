@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleRemovedItems(t *testing.T) {
+	t.Parallel()
+
+	srv := NewServer(NewMemoryCartStore(newTestCartRegistry(defaultCartName)), nil)
+	runCartToolSteps(t, []cartToolStep{
+		{name: "add kettle", handler: srv.handleAddToCart, args: map[string]any{"item_id": "kettle", "title": "Чайник", "quantity": float64(2)}},
+		{name: "add mug", handler: srv.handleAddToCart, args: map[string]any{"item_id": "mug", "title": "Кружка"}},
+		{name: "add lamp", handler: srv.handleAddToCart, args: map[string]any{"item_id": "lamp", "title": "Лампа"}},
+		{name: "partial remove", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "kettle", "quantity": float64(1)}},
+		{name: "a partial remove keeps the trash empty", handler: srv.handleViewRemoved, want: []string{"Недавно удалённых товаров нет"}},
+
+		{name: "remove the kettle", handler: srv.handleRemoveFromCart, args: map[string]any{"item_id": "kettle"}},
+		{name: "set the mug to zero", handler: srv.handleSetQuantity, args: map[string]any{"item_id": "mug", "quantity": float64(0)}},
+		{name: "both in the trash", handler: srv.handleViewRemoved, want: []string{"Недавно удалённые товары (2)", "Кружка × 1", "Чайник × 1 — удалён"}},
+
+		{name: "restore the kettle", handler: srv.handleRestoreItem, args: map[string]any{"item_id": "kettle"}, want: []string{"Товар возвращён в корзину", "Количество в корзине: 1"}},
+		{name: "kettle left the trash", handler: srv.handleViewRemoved, want: []string{"Недавно удалённые товары (1)", "Кружка"}, wantAbsent: []string{"Чайник"}},
+		{name: "restore the kettle twice", handler: srv.handleRestoreItem, args: map[string]any{"item_id": "kettle"}, wantError: true, want: []string{"item kettle is not among recently removed items"}},
+		{name: "restore an unknown item", handler: srv.handleRestoreItem, args: map[string]any{"item_id": "sofa"}, wantError: true, want: []string{"item sofa is not among recently removed items"}},
+		{name: "restore without item_id", handler: srv.handleRestoreItem, args: map[string]any{}, wantError: true, want: []string{"item_id parameter is required"}},
+
+		{name: "clear", handler: srv.handleClearCart, args: map[string]any{"confirm": true}},
+		{name: "clear trashes every line", handler: srv.handleViewRemoved, want: []string{"Недавно удалённые товары (3)", "Чайник", "Кружка", "Лампа"}},
+		{name: "restore after clear", handler: srv.handleRestoreItem, args: map[string]any{"item_id": "lamp"}, want: []string{"Лампа"}},
+		{name: "lamp is back", handler: srv.handleViewCart, want: []string{"Лампа"}, wantAbsent: []string{"Чайник", "Кружка"}},
+	})
+}
+
+// TestCartRestoreLimits checks that a line restored from the trash is
+// subject to the cart limits like any other line added to the cart.
+func TestCartRestoreLimits(t *testing.T) {
+	prevConfig := config
+	t.Cleanup(func() { config = prevConfig })
+	cfg := *prevConfig
+	cfg.MaxCartItems = 2
+	cfg.MaxCartTotalQuantity = 10
+	config = &cfg
+
+	tests := []struct {
+		name      string
+		cart      []*CartItem
+		wantError string
+	}{
+		{name: "fits", cart: []*CartItem{{ID: "mug", Title: "Кружка", Quantity: 1}}},
+		{name: "already in the cart", cart: []*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 1}}, wantError: "item kettle is already in the cart"},
+		{name: "distinct items", cart: []*CartItem{{ID: "mug", Title: "Кружка", Quantity: 1}, {ID: "lamp", Title: "Лампа", Quantity: 1}}, wantError: "distinct items is limited to 2"},
+		{name: "total quantity", cart: []*CartItem{{ID: "mug", Title: "Кружка", Quantity: 8}}, wantError: "total quantity is limited to 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCart()
+			c.Items["kettle"] = &CartItem{ID: "kettle", Title: "Чайник", Quantity: 3}
+			c.SetQuantity(t.Context(), "kettle", 0)
+			c.load(tt.cart)
+
+			restored, err := c.Restore(t.Context(), "kettle")
+			if tt.wantError == "" {
+				if err != nil || restored.Quantity != 3 {
+					t.Fatalf("Restore() = %v, %v, want the kettle × 3", restored, err)
+				}
+				if len(c.Removed()) != 0 {
+					t.Errorf("trash after the restore = %v, want it empty", c.Removed())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("Restore() error = %v, want %q", err, tt.wantError)
+			}
+			if removed := c.Removed(); len(removed) != 1 || removed[0].Item.ID != "kettle" {
+				t.Errorf("trash after a refused restore = %v, want the kettle kept", removed)
+			}
+		})
+	}
+}
+
+// TestCartTrashCap checks that the trash keeps only the newest maxTrashItems
+// lines and forgets the ones older than config.TrashTTL.
+func TestCartTrashCap(t *testing.T) {
+	prevTTL := config.TrashTTL
+	t.Cleanup(func() { config.TrashTTL = prevTTL })
+	config.TrashTTL = time.Hour
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := newTestCart()
+	c.now = func() time.Time { return now }
+	for i := range maxTrashItems + 5 {
+		id := fmt.Sprintf("item-%02d", i)
+		c.Items[id] = &CartItem{ID: id, Title: "Товар", Quantity: 1}
+		c.SetQuantity(t.Context(), id, 0)
+		now = now.Add(time.Second)
+	}
+
+	removed := c.Removed()
+	if len(removed) != maxTrashItems {
+		t.Fatalf("trash holds %d lines, want %d", len(removed), maxTrashItems)
+	}
+	if first, last := removed[0].Item.ID, removed[len(removed)-1].Item.ID; first != fmt.Sprintf("item-%02d", maxTrashItems+4) || last != "item-05" {
+		t.Errorf("trash runs from %s to %s, want the newest first down to item-05", first, last)
+	}
+
+	now = now.Add(time.Hour)
+	if removed := c.Removed(); len(removed) != 0 {
+		t.Errorf("trash after the TTL = %d lines, want none", len(removed))
+	}
+	if _, err := c.Restore(t.Context(), fmt.Sprintf("item-%02d", maxTrashItems+4)); err == nil {
+		t.Error("Restore() of an expired trash entry succeeded")
+	}
+}
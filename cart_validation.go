@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+)
+
+const defaultMaxDescriptionLength = 1000
+
+// ItemFieldError reports an item field that broke a validation rule.
+type ItemFieldError struct {
+	Field string
+	Rule  string
+}
+
+func (e *ItemFieldError) Error() string {
+	return fmt.Sprintf("%s %s", e.Field, e.Rule)
+}
+
+// validate checks an item being added to a cart or wishlist and normalizes it
+// in place: the description is cut to config.MaxDescriptionLength runes. It is
+// shared by add_to_cart, add_items, add_to_wishlist and import_cart. Titles are
+// checked by the callers, since adding to an existing line needs none.
+func (input *cartItemInput) validate() error {
+	if input.ID == "" {
+		return &ItemFieldError{Field: "item_id", Rule: "is required and must be a non-empty string"}
+	}
+	if input.Link != "" && !isAbsoluteHTTPURL(input.Link) {
+		return &ItemFieldError{Field: "link", Rule: fmt.Sprintf("must be an absolute http or https URL, got %q", input.Link)}
+	}
+	if input.Quantity < 1 || input.Quantity > config.MaxCartQuantity {
+		return &ItemFieldError{Field: "quantity", Rule: fmt.Sprintf("must be between 1 and %d, got %d", config.MaxCartQuantity, input.Quantity)}
+	}
+	input.Description = truncateRunes(input.Description, config.MaxDescriptionLength)
+	return nil
+}
+
+// priceWarning flags a price that was given but could not be parsed; such
+// items are still added and left out of the cart totals.
+func (input *cartItemInput) priceWarning() string {
+	if input.Price == "" {
+		return ""
+	}
+	if _, err := ParsePrice(input.Price); err != nil {
+		return fmt.Sprintf("\n⚠️ Цена «%s» не распознана, товар не войдёт в итог корзины", input.Price)
+	}
+	return ""
+}
+
+func isAbsoluteHTTPURL(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// truncateRunes shortens s to at most limit runes, marking the cut with an
+// ellipsis.
+func truncateRunes(s string, limit int) string {
+	if limit <= 0 || utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	defaultCartVersionEvery    = 10
+	defaultCartVersionInterval = 15 * time.Minute
+	defaultCartVersionKeep     = 50
+	defaultCartVersionMaxAge   = 7 * 24 * time.Hour
+	cartVersionReasonPeriodic  = "periodic"
+	cartVersionReasonRollback  = "rollback"
+)
+
+// errCartVersionsUnsupported is returned by stores that keep no versions.
+var errCartVersionsUnsupported = errors.New("cart versions are not supported by this cart backend, use snapshot_cart and restore_snapshot instead")
+
+// CartVersion is a copy of a cart recorded by the store as it changes.
+type CartVersion struct {
+	// ID grows with each version of the cart.
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Reason    string    `json:"reason"`
+	// RollbackOf is the version a rollback returned to.
+	RollbackOf int         `json:"rollback_of,omitempty"`
+	Items      []*CartItem `json:"items"`
+}
+
+// cartVersionDue reports whether a change should record a version, given the
+// changes since the newest version and when that version was recorded.
+func cartVersionDue(changes int, last, now time.Time) bool {
+	if config.CartVersionKeep <= 0 {
+		return false
+	}
+	if last.IsZero() {
+		return true
+	}
+	return (config.CartVersionEvery > 0 && changes >= config.CartVersionEvery) ||
+		(config.CartVersionInterval > 0 && now.Sub(last) >= config.CartVersionInterval)
+}
+
+// cartVersionExpired reports whether a version is past CartVersionMaxAge.
+func cartVersionExpired(version CartVersion, now time.Time) bool {
+	return config.CartVersionMaxAge > 0 && now.Sub(version.CreatedAt) > config.CartVersionMaxAge
+}
+
+// CartVersions keeps the versions of each cart, oldest first, for the
+// in-memory store. They are persisted in the cart file.
+type CartVersions struct {
+	mutex    sync.Mutex
+	versions map[string][]CartVersion
+	// changes counts the changes since the newest version of each cart.
+	changes map[string]int
+	now     func() time.Time
+}
+
+// cartVersions is the version store persisted in the cart file; it is nil
+// unless the memory backend is in use.
+var cartVersions *CartVersions
+
+func NewCartVersions() *CartVersions {
+	return &CartVersions{
+		versions: make(map[string][]CartVersion),
+		changes:  make(map[string]int),
+		now:      time.Now,
+	}
+}
+
+// changed counts a change to c and records a version when one is due. It
+// reports whether it did.
+func (v *CartVersions) changed(cartName string, c *Cart) bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.changes[cartName]++
+	var last time.Time
+	if versions := v.versions[cartName]; len(versions) > 0 {
+		last = versions[len(versions)-1].CreatedAt
+	}
+	if !cartVersionDue(v.changes[cartName], last, v.now()) {
+		return false
+	}
+	v.addLocked(cartName, CartVersion{Reason: cartVersionReasonPeriodic, Items: c.Snapshot()})
+	return true
+}
+
+// flush records a version of c if it changed since the newest version.
+func (v *CartVersions) flush(cartName string, c *Cart) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.changes[cartName] > 0 && config.CartVersionKeep > 0 {
+		v.addLocked(cartName, CartVersion{Reason: cartVersionReasonPeriodic, Items: c.Snapshot()})
+	}
+}
+
+func (v *CartVersions) add(cartName string, version CartVersion) CartVersion {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.addLocked(cartName, version)
+}
+
+// addLocked numbers and stores a version, then drops the versions past the
+// count and age limits. The new version is always kept.
+func (v *CartVersions) addLocked(cartName string, version CartVersion) CartVersion {
+	now := v.now()
+	versions := v.versions[cartName]
+	version.ID = 1
+	if len(versions) > 0 {
+		version.ID = versions[len(versions)-1].ID + 1
+	}
+	version.CreatedAt = now
+	versions = append(versions, version)
+
+	kept := versions[:0]
+	for i, existing := range versions {
+		if i == len(versions)-1 || (len(versions)-i <= config.CartVersionKeep && !cartVersionExpired(existing, now)) {
+			kept = append(kept, existing)
+		}
+	}
+	v.versions[cartName] = kept
+	v.changes[cartName] = 0
+	return version
+}
+
+// List returns the versions of a cart that are not past the age limit.
+func (v *CartVersions) List(cartName string) []CartVersion {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	now := v.now()
+	var versions []CartVersion
+	for _, version := range v.versions[cartName] {
+		if !cartVersionExpired(version, now) {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+func (v *CartVersions) all() map[string][]CartVersion {
+	if v == nil {
+		return nil
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	all := make(map[string][]CartVersion, len(v.versions))
+	for name, versions := range v.versions {
+		if len(versions) > 0 {
+			all[name] = slices.Clone(versions)
+		}
+	}
+	return all
+}
+
+func (v *CartVersions) load(all map[string][]CartVersion) {
+	if v == nil {
+		return
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.versions = make(map[string][]CartVersion, len(all))
+	v.changes = make(map[string]int)
+	for name, versions := range all {
+		v.versions[name] = versions
+	}
+}
+
+func (s *MemoryCartStore) Versions(ctx context.Context, cartName string) ([]CartVersion, error) {
+	if _, err := s.cart(ctx, cartName); err != nil {
+		return nil, err
+	}
+	_, versions := s.scope(ctx)
+	return versions.List(cartName), nil
+}
+
+func (s *MemoryCartStore) Rollback(ctx context.Context, cartName string, versionID int) (CartVersion, cartDiff, error) {
+	c, err := s.cart(ctx, cartName)
+	if err != nil {
+		return CartVersion{}, cartDiff{}, err
+	}
+	_, versions := s.scope(ctx)
+	var target CartVersion
+	for _, version := range versions.List(cartName) {
+		if version.ID == versionID {
+			target = version
+		}
+	}
+	if target.ID == 0 {
+		return CartVersion{}, cartDiff{}, fmt.Errorf("version %d of cart %q does not exist, use list_versions to see versions", versionID, cartName)
+	}
+
+	// The current state becomes a version first, so the rollback can be
+	// rolled back even when it had not been recorded yet.
+	versions.flush(cartName, c)
+	diff := c.RestoreSnapshot(ctx, target.Items)
+	version := versions.add(cartName, CartVersion{Reason: cartVersionReasonRollback, RollbackOf: versionID, Items: c.Snapshot()})
+	s.changed(ctx)
+	return version, diff, nil
+}
+
+// cartVersionSummary describes the lines of a version in one line.
+func cartVersionSummary(version CartVersion) string {
+	quantity := 0
+	for _, item := range version.Items {
+		quantity += item.Quantity
+	}
+	return fmt.Sprintf("позиций: %d, товаров: %d", len(version.Items), quantity)
+}
+
+func (s *Server) handleListVersions(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if config.CartVersionKeep <= 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "🕰️ Версии корзины отключены (CART_VERSION_KEEP=0)"},
+			},
+		}, nil
+	}
+
+	versions, err := s.store.Versions(ctx, cartName)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if len(versions) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🕰️ У корзины%s пока нет версий: они появляются по мере её изменения", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	now := time.Now()
+	lines := make([]string, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		version := versions[i]
+		line := fmt.Sprintf("• #%d — %s, %s (%s)", version.ID, formatRelativeTime(version.CreatedAt, now),
+			cartVersionSummary(version), version.CreatedAt.Format("2006-01-02 15:04"))
+		if version.Reason == cartVersionReasonRollback {
+			line += fmt.Sprintf("\n  ⏪ откат к версии #%d", version.RollbackOf)
+		}
+		lines = append(lines, line)
+	}
+	result := fmt.Sprintf(`🕰️ Версии корзины%s, сначала новые:
+
+%s
+
+💡 Используйте rollback_to_version с номером версии или с ago (например 1h), чтобы вернуть корзину к прежнему состоянию`,
+		cartLabel(cartName), strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+// cartVersionAt returns the newest version recorded at or before at.
+func cartVersionAt(versions []CartVersion, at time.Time) (CartVersion, bool) {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if !versions[i].CreatedAt.After(at) {
+			return versions[i], true
+		}
+	}
+	return CartVersion{}, false
+}
+
+func (s *Server) handleRollbackToVersion(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	versionID, hasVersion := args["version"].(float64)
+	ago, _ := args["ago"].(string)
+	ago = strings.TrimSpace(ago)
+	if hasVersion == (ago != "") {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "pass either version or ago, use list_versions to see versions"},
+			},
+		}, nil
+	}
+	if !hasVersion {
+		age, err := time.ParseDuration(ago)
+		if err != nil || age <= 0 {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: fmt.Sprintf("ago must be a positive duration such as 30m or 2h, got %q", ago)},
+				},
+			}, nil
+		}
+		versions, err := s.store.Versions(ctx, cartName)
+		if err != nil {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: err.Error()},
+				},
+			}, nil
+		}
+		version, ok := cartVersionAt(versions, time.Now().Add(-age))
+		if !ok {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: fmt.Sprintf("no version of the cart is %s old, use list_versions to see versions", ago)},
+				},
+			}, nil
+		}
+		versionID = float64(version.ID)
+	}
+
+	backupBeforeChange(ctx, "rollback_to_version")
+	version, diff, err := s.store.Rollback(ctx, cartName, int(versionID))
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart rolled back", "cart", cartName, "version", int(versionID), "new_version", version.ID,
+		"added", len(diff.Added), "removed", len(diff.Removed), "changed", len(diff.Changed))
+
+	changes := "Содержимое корзины не изменилось"
+	if !diff.empty() {
+		changes = diff.format()
+	}
+	result := fmt.Sprintf(`⏪ Корзина%s возвращена к версии #%d
+
+%s
+
+💡 Состояние после отката сохранено как версия #%d; прежнее состояние можно вернуть через rollback_to_version или undo_cart`,
+		cartLabel(cartName), int(versionID), changes, version.ID)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
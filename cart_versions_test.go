@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCartStoreVersions(t *testing.T) {
+	t.Parallel()
+
+	for _, backend := range cartStoreBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := backend.newStore(t, "home")
+			if backend.name == "redis" {
+				if _, err := store.Versions(t.Context(), "home"); !errors.Is(err, errCartVersionsUnsupported) {
+					t.Errorf("Versions() error = %v, want %v", err, errCartVersionsUnsupported)
+				}
+				if _, _, err := store.Rollback(t.Context(), "home", 1); !errors.Is(err, errCartVersionsUnsupported) {
+					t.Errorf("Rollback() error = %v, want %v", err, errCartVersionsUnsupported)
+				}
+				return
+			}
+			testCartStoreVersions(t, store)
+		})
+	}
+}
+
+func testCartStoreVersions(t *testing.T, store CartStore) {
+	ctx := t.Context()
+	kettle := CartItem{ID: "kettle", Title: "Чайник", Price: "2 990 ₽"}
+	mug := CartItem{ID: "mug", Title: "Кружка", Price: "490 ₽"}
+
+	// The first change of a cart always records a version; the next ones
+	// wait for CartVersionEvery changes or CartVersionInterval.
+	if _, err := store.Add(ctx, "home", kettle, 2); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := store.Add(ctx, "home", mug, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	versions, err := store.Versions(ctx, "home")
+	if err != nil || len(versions) != 1 || versions[0].ID != 1 || len(versions[0].Items) != 1 {
+		t.Fatalf("Versions() = %+v, %v, want version 1 with the kettle only", versions, err)
+	}
+
+	version, diff, err := store.Rollback(ctx, "home", 1)
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if version.ID != 3 || version.RollbackOf != 1 || version.Reason != cartVersionReasonRollback {
+		t.Errorf("Rollback() version = %+v, want version 3 rolling back to 1", version)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ID != "mug" || len(diff.Added) != 0 {
+		t.Errorf("Rollback() diff = %+v, want the mug removed", diff)
+	}
+	lines, _ := store.List(ctx, "home")
+	if got := lineIDs(lines); len(got) != 1 || got[0] != "kettle" || lines[0].Quantity != 2 {
+		t.Errorf("cart after rollback = %v, want 2 kettles", got)
+	}
+
+	// The state before the rollback became version 2, so it can be undone.
+	versions, _ = store.Versions(ctx, "home")
+	if len(versions) != 3 || len(versions[1].Items) != 2 {
+		t.Fatalf("Versions() after rollback = %+v, want 3 versions, the second holding both lines", versions)
+	}
+	if _, _, err := store.Rollback(ctx, "home", 2); err != nil {
+		t.Fatalf("Rollback(2) error = %v", err)
+	}
+	lines, _ = store.List(ctx, "home")
+	if got := lineIDs(lines); len(got) != 2 {
+		t.Errorf("cart after rolling the rollback back = %v, want kettle and mug", got)
+	}
+
+	if _, _, err := store.Rollback(ctx, "home", 99); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Rollback(99) error = %v, want a missing version", err)
+	}
+	var notFound *CartNotFoundError
+	if _, err := store.Versions(ctx, "missing"); !errors.As(err, &notFound) {
+		t.Errorf("Versions(missing) error = %v, want a *CartNotFoundError", err)
+	}
+}
+
+func TestCartVersionsRetention(t *testing.T) {
+	prevConfig := config
+	t.Cleanup(func() { config = prevConfig })
+	cfg := *prevConfig
+	cfg.CartVersionEvery, cfg.CartVersionKeep, cfg.CartVersionMaxAge = 1, 3, time.Hour
+	config = &cfg
+
+	clock := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	now := func() time.Time { return clock }
+	backends := []struct {
+		name  string
+		store func(t *testing.T) CartStore
+	}{
+		{name: "memory", store: func(t *testing.T) CartStore {
+			store := NewMemoryCartStore(newTestCartRegistry("home"))
+			store.versions.now = now
+			return store
+		}},
+		{name: "sqlite", store: func(t *testing.T) CartStore {
+			store := newTestSQLiteCartStore(t, filepath.Join(t.TempDir(), "cart.db"), "home")
+			store.now = now
+			return store
+		}},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			clock = time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+			store := backend.store(t)
+			for range 5 {
+				clock = clock.Add(time.Minute)
+				if _, err := store.Add(t.Context(), "home", CartItem{ID: "kettle", Title: "Чайник"}, 1); err != nil {
+					t.Fatalf("Add() error = %v", err)
+				}
+			}
+			versions, err := store.Versions(t.Context(), "home")
+			if err != nil || len(versions) != 3 || versions[0].ID != 3 || versions[2].ID != 5 {
+				t.Fatalf("Versions() = %+v, %v, want versions 3 to 5", versions, err)
+			}
+
+			clock = clock.Add(2 * time.Hour)
+			if versions, _ := store.Versions(t.Context(), "home"); len(versions) != 0 {
+				t.Errorf("Versions() after CartVersionMaxAge = %+v, want none", versions)
+			}
+			if _, _, err := store.Rollback(t.Context(), "home", 5); err == nil {
+				t.Error("Rollback() to an expired version succeeded")
+			}
+		})
+	}
+}
+
+func TestHandleRollbackToVersion(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryCartStore(newTestCartRegistry("home"))
+	clock := time.Now().Add(-3 * time.Hour)
+	store.versions.now = func() time.Time { return clock }
+	srv := NewServer(store, nil)
+	call := func(handler func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) (*mcp.CallToolResult, string) {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = args
+		result, err := handler(t.Context(), request)
+		if err != nil {
+			t.Fatalf("handler error = %v", err)
+		}
+		return result, toolResultText(result)
+	}
+
+	if _, err := store.Add(t.Context(), "home", CartItem{ID: "kettle", Title: "Чайник"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	clock = clock.Add(2 * time.Hour)
+	if _, err := store.Add(t.Context(), "home", CartItem{ID: "mug", Title: "Кружка"}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	result, text := call(srv.handleListVersions, map[string]any{"cart": "home"})
+	if result.IsError || !strings.Contains(text, "#2") || !strings.Contains(text, "#1") {
+		t.Fatalf("list_versions = %q, want versions 1 and 2", text)
+	}
+
+	for _, args := range []map[string]any{
+		{"cart": "home"},
+		{"cart": "home", "version": float64(1), "ago": "1h"},
+		{"cart": "home", "ago": "soon"},
+		{"cart": "home", "ago": "24h"},
+	} {
+		if result, text := call(srv.handleRollbackToVersion, args); !result.IsError {
+			t.Errorf("rollback_to_version(%v) = %q, want an error", args, text)
+		}
+	}
+
+	// An hour and a half ago the cart held only the kettle.
+	result, text = call(srv.handleRollbackToVersion, map[string]any{"cart": "home", "ago": "90m"})
+	if result.IsError || !strings.Contains(text, "версии #1") || !strings.Contains(text, "Кружка") {
+		t.Fatalf("rollback_to_version(ago=90m) = %q, want version 1 restored with the mug removed", text)
+	}
+	if _, found, _ := store.Get(t.Context(), "home", "mug"); found {
+		t.Error("mug is still in the cart after the rollback")
+	}
+}
+
+func TestJSONCartFileVersions(t *testing.T) {
+	resetCarts(t)
+	t.Cleanup(func() { resetCarts(t) })
+	prev := cartVersions
+	t.Cleanup(func() { cartVersions = prev })
+
+	store := NewMemoryCartStore(carts)
+	cartVersions = store.versions
+	if _, err := store.Add(t.Context(), defaultCartName, CartItem{ID: "kettle", Title: "Чайник"}, 1); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "cart.json")
+	if err := NewJSONCartFile(path).Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	cartVersions = NewCartVersions()
+	if err := NewJSONCartFile(path).Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	versions := cartVersions.List(defaultCartName)
+	if len(versions) != 1 || len(versions[0].Items) != 1 || versions[0].Items[0].ID != "kettle" {
+		t.Errorf("versions after restart = %+v, want version 1 with the kettle", versions)
+	}
+}
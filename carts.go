@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultCartName   = "default"
+	maxCartNameLength = 32
+)
+
+// CartRegistry holds the named carts. The default cart always exists and is
+// the same *Cart as the global cart.
+type CartRegistry struct {
+	carts map[string]*Cart
+	mutex sync.RWMutex
+}
+
+var carts = &CartRegistry{
+	carts: map[string]*Cart{defaultCartName: cart},
+}
+
+func NewCart(name string) *Cart {
+	return &Cart{
+		Items: make(map[string]*CartItem),
+		name:  name,
+		now:   time.Now,
+	}
+}
+
+func validateCartName(name string) error {
+	return validateListName("cart", name)
+}
+
+// validateListName accepts 1 to maxCartNameLength letters, digits, spaces,
+// '-' and '_' as the name of a cart or wishlist; kind is used in errors.
+func validateListName(kind, name string) error {
+	if name == "" || utf8.RuneCountInString(name) > maxCartNameLength {
+		return fmt.Errorf("%s name must be 1 to %d characters long", kind, maxCartNameLength)
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != ' ' && r != '-' && r != '_' {
+			return fmt.Errorf("%s name %q may only contain letters, digits, spaces, '-' and '_'", kind, name)
+		}
+	}
+	return nil
+}
+
+func (r *CartRegistry) Get(name string) (*Cart, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	c, ok := r.carts[name]
+	return c, ok
+}
+
+func (r *CartRegistry) Create(name string) (*Cart, error) {
+	if err := validateCartName(name); err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.carts[name]; exists {
+		return nil, fmt.Errorf("cart %q already exists", name)
+	}
+	c := NewCart(name)
+	r.carts[name] = c
+	return c, nil
+}
+
+// Delete removes a named cart. Non-empty carts are only deleted with force.
+func (r *CartRegistry) Delete(name string, force bool) (uniqueItems int, err error) {
+	if name == defaultCartName {
+		return 0, errors.New("the default cart cannot be deleted, use clear_cart to empty it")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	c, exists := r.carts[name]
+	if !exists {
+		return 0, fmt.Errorf("cart %q does not exist", name)
+	}
+	uniqueItems, _ = c.Totals()
+	if uniqueItems > 0 && !force {
+		return uniqueItems, fmt.Errorf("cart %q contains %d items, pass confirm=true to delete it", name, uniqueItems)
+	}
+	delete(r.carts, name)
+	return uniqueItems, nil
+}
+
+// Names returns the cart names with the default cart first and the rest sorted.
+func (r *CartRegistry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.carts))
+	for name := range r.carts {
+		if name != defaultCartName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{defaultCartName}, names...)
+}
+
+// Named returns snapshots of all carts except the default one, for persistence.
+func (r *CartRegistry) Named() map[string][]*CartItem {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make(map[string][]*CartItem, len(r.carts))
+	for name, c := range r.carts {
+		if name != defaultCartName {
+			result[name] = c.Snapshot()
+		}
+	}
+	return result
+}
+
+// ensure returns the cart called name, adding an empty one when the
+// registry does not hold it yet. The database-backed stores load their carts
+// into it, since the undo journal and trash are only kept in memory.
+func (r *CartRegistry) ensure(name string) *Cart {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	c, ok := r.carts[name]
+	if !ok {
+		c = NewCart(name)
+		r.carts[name] = c
+	}
+	return c
+}
+
+// load replaces all named carts with the ones read from disk.
+func (r *CartRegistry) load(named map[string][]*CartItem) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.carts = map[string]*Cart{defaultCartName: cart}
+	for name, items := range named {
+		if name == defaultCartName || validateCartName(name) != nil {
+			continue
+		}
+		c := NewCart(name)
+		c.load(items)
+		r.carts[name] = c
+	}
+}
+
+// withProperty returns a copy of a tool's properties with one more parameter.
+func withProperty(properties map[string]any, name string, param any) map[string]any {
+	result := maps.Clone(properties)
+	result[name] = param
+	return result
+}
+
+// cartFromArgs resolves the optional cart argument of a tool call and
+// returns the lines of that cart.
+func (s *Server) cartFromArgs(ctx context.Context, args map[string]any) ([]*CartItem, string, error) {
+	name, err := cartNameFromArgs(args)
+	if err != nil {
+		return nil, "", err
+	}
+	items, err := s.store.List(ctx, name)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, name, nil
+}
+
+// cartNameFromArgs returns the cart named by the optional cart argument,
+// without checking that it exists.
+func cartNameFromArgs(args map[string]any) (string, error) {
+	name := defaultCartName
+	if value, present := args["cart"]; present && value != nil {
+		str, ok := value.(string)
+		if !ok {
+			return "", errors.New("cart parameter must be a string")
+		}
+		if str = strings.TrimSpace(str); str != "" {
+			name = str
+		}
+	}
+	return name, nil
+}
+
+// cartLabel is appended to tool output for carts other than the default one.
+func cartLabel(name string) string {
+	if name == defaultCartName {
+		return ""
+	}
+	return fmt.Sprintf(" «%s»", name)
+}
+
+// copyCart deep-copies every line of src into dst, replacing the lines dst
+// had. The copies get fresh AddedAt timestamps. Replacing a cart that
+// existed before is recorded in its undo journal.
+func copyCart(ctx context.Context, src, dst *Cart, replaced bool) (lines int) {
+	unlock := lockCarts(ctx, src, dst)
+	defer unlock()
+
+	ids := make([]string, 0, len(dst.Items)+len(src.Items))
+	for id := range dst.Items {
+		ids = append(ids, id)
+	}
+	for id := range src.Items {
+		if _, inTarget := dst.Items[id]; !inTarget {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if replaced {
+		dst.recordLocked("copy", ids...)
+	} else {
+		dst.auditLocked("copy", ids...)
+	}
+
+	now := dst.now()
+	items := make(map[string]*CartItem, len(src.Items))
+	for id, item := range src.Items {
+		item = item.clone()
+		item.AddedAt = now
+		item.UpdatedAt = now
+		items[id] = item
+	}
+	dst.Items = items
+	return len(items)
+}
+
+// copyCart copies the source cart into the cart called name through the
+// store. An existing target is only replaced with overwrite; it keeps its
+// identity, so the replacement can be undone there.
+func (s *Server) copyCart(ctx context.Context, source, name string, overwrite bool) (lines int, replaced bool, err error) {
+	if err := validateCartName(name); err != nil {
+		return 0, false, err
+	}
+	if source == name {
+		return 0, false, fmt.Errorf("cannot copy cart %q onto itself", source)
+	}
+
+	names, err := s.store.Carts(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	if !slices.Contains(names, source) {
+		return 0, false, &CartNotFoundError{Name: source}
+	}
+	replaced = slices.Contains(names, name)
+	if replaced && !overwrite {
+		return 0, false, fmt.Errorf("cart %q already exists, pass overwrite=true to replace it", name)
+	}
+	if !replaced {
+		if err := s.store.CreateCart(ctx, name); err != nil {
+			return 0, false, err
+		}
+	}
+
+	err = s.store.Update(ctx, []string{source, name}, func(carts []*Cart) error {
+		lines = copyCart(ctx, carts[0], carts[1], replaced)
+		return nil
+	})
+	return lines, replaced, err
+}
+
+// mergeCarts moves every line of src into dst. Lines present in both are
+// combined: quantities are summed, the more recently updated price wins and
+// notes are concatenated. src is emptied unless keepSource is set. The
+// limits of dst are checked before anything changes, so the merge either
+// happens completely or not at all.
+func mergeCarts(ctx context.Context, src, dst *Cart, keepSource bool) (moved, merged int, err error) {
+	unlock := lockCarts(ctx, src, dst)
+	defer unlock()
+
+	if len(src.Items) == 0 {
+		return 0, 0, nil
+	}
+
+	totalQuantity := 0
+	for _, item := range dst.Items {
+		totalQuantity += item.Quantity
+	}
+	lines := len(dst.Items)
+	ids := make([]string, 0, len(src.Items))
+	for id, item := range src.Items {
+		ids = append(ids, id)
+		totalQuantity += item.Quantity
+		existing, exists := dst.Items[id]
+		if !exists {
+			lines++
+			continue
+		}
+		if existing.Quantity+item.Quantity > config.MaxCartQuantity {
+			return 0, 0, &CartLimitError{Limit: "quantity per item", Max: config.MaxCartQuantity, Current: existing.Quantity}
+		}
+	}
+	if lines > config.MaxCartItems {
+		return 0, 0, &CartLimitError{Limit: "distinct items", Max: config.MaxCartItems, Current: len(dst.Items)}
+	}
+	if totalQuantity > config.MaxCartTotalQuantity {
+		return 0, 0, &CartLimitError{Limit: "total quantity", Max: config.MaxCartTotalQuantity, Current: totalQuantity}
+	}
+	sort.Strings(ids)
+
+	dst.recordLocked("merge", ids...)
+	if !keepSource {
+		src.recordLocked("merge", ids...)
+	}
+	now := dst.now()
+	for _, id := range ids {
+		item := src.Items[id]
+		existing, exists := dst.Items[id]
+		if !exists {
+			item = item.clone()
+			item.UpdatedAt = now
+			dst.Items[id] = item
+			moved++
+		} else {
+			mergeCartLines(existing, item)
+			existing.UpdatedAt = now
+			merged++
+		}
+		if !keepSource {
+			delete(src.Items, id)
+		}
+	}
+	return moved, merged, nil
+}
+
+// lockCarts locks two different carts in name order, so that concurrent
+// calls in opposite directions cannot deadlock. The returned function
+// writes their history entries and unlocks them.
+func lockCarts(ctx context.Context, a, b *Cart) (unlock func()) {
+	first, second := a, b
+	if b.name < a.name {
+		first, second = b, a
+	}
+	first.mutex.Lock()
+	second.mutex.Lock()
+	return func() {
+		second.unlock(ctx)
+		first.unlock(ctx)
+	}
+}
+
+// mergeCartLines folds incoming into existing, which describes the same product.
+func mergeCartLines(existing, incoming *CartItem) {
+	existing.Quantity += incoming.Quantity
+	if incoming.UpdatedAt.After(existing.UpdatedAt) && incoming.Price != "" {
+		existing.Price = incoming.Price
+		existing.updateParsedPrice()
+	}
+	switch {
+	case existing.Note == "":
+		existing.Note = incoming.Note
+	case incoming.Note != "" && incoming.Note != existing.Note:
+		existing.Note += "; " + incoming.Note
+	}
+	for _, tag := range incoming.Tags {
+		if !slices.Contains(existing.Tags, tag) {
+			existing.Tags = append(existing.Tags, tag)
+		}
+	}
+	slices.Sort(existing.Tags)
+}
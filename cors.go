@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	defaultCORSAllowedOrigins = "*"
+	corsAllowedMethods        = "GET, POST, DELETE, OPTIONS"
+	corsAllowedHeaders        = "Content-Type, Accept, Authorization, Last-Event-ID, Mcp-Session-Id, Mcp-Protocol-Version"
+)
+
+// parseCORSAllowedOrigins splits CORS_ALLOWED_ORIGINS; unset means any origin.
+func parseCORSAllowedOrigins(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		value = defaultCORSAllowedOrigins
+	}
+	var origins []string
+	for origin := range strings.SplitSeq(value, ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// corsMiddleware lets browser-based MCP clients call the server from the
+// allowed origins. Preflight requests are answered with 204 without reaching
+// next. Requests from other origins get no CORS headers, so browsers block them.
+func corsMiddleware(allowedOrigins []string, next http.Handler) http.Handler {
+	anyOrigin := slices.Contains(allowedOrigins, "*")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		origin := r.Header.Get("Origin")
+		switch {
+		case anyOrigin:
+			header.Set("Access-Control-Allow-Origin", "*")
+		case origin != "" && slices.Contains(allowedOrigins, origin):
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+		}
+		header.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		header.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		// Clients read the session ID from the initialize response.
+		header.Set("Access-Control-Expose-Headers", "Mcp-Session-Id")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseCORSAllowedOrigins(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "", want: []string{"*"}},
+		{value: "http://localhost:3000, chrome-extension://abc/ ,", want: []string{"http://localhost:3000", "chrome-extension://abc"}},
+	}
+	for _, tt := range tests {
+		if got := parseCORSAllowedOrigins(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("parseCORSAllowedOrigins(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	t.Parallel()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	tests := []struct {
+		name       string
+		allowed    []string
+		method     string
+		origin     string
+		wantCode   int
+		wantOrigin string
+		wantVary   bool
+	}{
+		{name: "any origin", allowed: []string{"*"}, method: http.MethodPost, origin: "https://evil.example", wantCode: http.StatusTeapot, wantOrigin: "*"},
+		{name: "preflight", allowed: []string{"*"}, method: http.MethodOptions, origin: "http://localhost:3000", wantCode: http.StatusNoContent, wantOrigin: "*"},
+		{name: "listed origin", allowed: []string{"http://localhost:3000"}, method: http.MethodPost, origin: "http://localhost:3000", wantCode: http.StatusTeapot, wantOrigin: "http://localhost:3000", wantVary: true},
+		{name: "other origin", allowed: []string{"http://localhost:3000"}, method: http.MethodPost, origin: "https://evil.example", wantCode: http.StatusTeapot},
+		{name: "other origin preflight", allowed: []string{"http://localhost:3000"}, method: http.MethodOptions, origin: "https://evil.example", wantCode: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tt.method, "/mcp", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+			corsMiddleware(tt.allowed, next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Vary") == "Origin"; got != tt.wantVary {
+				t.Errorf("Vary: Origin set = %v, want %v", got, tt.wantVary)
+			}
+			if rec.Header().Get("Access-Control-Allow-Methods") == "" || rec.Header().Get("Access-Control-Allow-Headers") == "" {
+				t.Errorf("response headers %v lack the allowed methods or headers", rec.Header())
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	cbrfDailyURL = "https://www.cbr.ru/scripts/XML_daily.asp"
+	cbrfRatesTTL = 6 * time.Hour
+)
+
+// CurrencyConverter converts amounts between ISO currency codes.
+type CurrencyConverter interface {
+	Convert(amount float64, from, to string) (float64, error)
+}
+
+// currencyConverter is set in main when DISPLAY_CURRENCY is configured.
+var currencyConverter CurrencyConverter
+
+// FixedRateConverter converts using a static table of rates, each being the
+// price of one unit of the currency in RUB.
+type FixedRateConverter struct {
+	Rates map[string]float64
+}
+
+func (c FixedRateConverter) Convert(amount float64, from, to string) (float64, error) {
+	return convertWithRates(c.Rates, amount, from, to)
+}
+
+// convertWithRates converts through RUB; RUB itself does not need a rate.
+func convertWithRates(rates map[string]float64, amount float64, from, to string) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+	rate := func(currency string) (float64, error) {
+		if currency == "RUB" {
+			return 1, nil
+		}
+		if value, ok := rates[currency]; ok && value > 0 {
+			return value, nil
+		}
+		return 0, fmt.Errorf("no exchange rate for currency %q", currency)
+	}
+	fromRate, err := rate(from)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := rate(to)
+	if err != nil {
+		return 0, err
+	}
+	return amount * fromRate / toRate, nil
+}
+
+// CBRFConverter uses the daily official rates of the Central Bank of Russia.
+// Rates are fetched on first use and refreshed after cbrfRatesTTL.
+type CBRFConverter struct {
+	HTTPClient *http.Client
+	URL        string
+
+	mutex     sync.Mutex
+	rates     map[string]float64
+	fetchedAt time.Time
+}
+
+func NewCBRFConverter(httpClient *http.Client) *CBRFConverter {
+	return &CBRFConverter{HTTPClient: httpClient, URL: cbrfDailyURL}
+}
+
+func (c *CBRFConverter) Convert(amount float64, from, to string) (float64, error) {
+	rates, err := c.currentRates()
+	if err != nil {
+		return 0, err
+	}
+	return convertWithRates(rates, amount, from, to)
+}
+
+// currentRates returns cached rates, fetching them when they are missing or
+// stale. Stale rates are still used if the refresh fails.
+func (c *CBRFConverter) currentRates() (map[string]float64, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.rates != nil && time.Since(c.fetchedAt) < cbrfRatesTTL {
+		return c.rates, nil
+	}
+	rates, err := c.fetch()
+	if err != nil {
+		if c.rates != nil {
+			return c.rates, nil
+		}
+		return nil, err
+	}
+	c.rates, c.fetchedAt = rates, time.Now()
+	return rates, nil
+}
+
+type cbrfValCurs struct {
+	Valutes []struct {
+		CharCode string `xml:"CharCode"`
+		Nominal  string `xml:"Nominal"`
+		Value    string `xml:"Value"`
+	} `xml:"Valute"`
+}
+
+func (c *CBRFConverter) fetch() (map[string]float64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSearchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exchange rates request: %w", err)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rates request returned status %d", resp.StatusCode)
+	}
+	return parseCBRFRates(resp.Body)
+}
+
+// parseCBRFRates reads the XML_daily feed. Values use a decimal comma and are
+// given per Nominal units, e.g. 100 JPY.
+func parseCBRFRates(r io.Reader) (map[string]float64, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charsetReader
+
+	var doc cbrfValCurs
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+
+	rates := make(map[string]float64, len(doc.Valutes))
+	for _, valute := range doc.Valutes {
+		nominal, err := strconv.Atoi(strings.TrimSpace(valute.Nominal))
+		if err != nil || nominal <= 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(valute.Value), ",", ".", 1), 64)
+		if err != nil || value <= 0 {
+			continue
+		}
+		rates[strings.ToUpper(strings.TrimSpace(valute.CharCode))] = value / float64(nominal)
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("exchange rates feed contains no rates")
+	}
+	return rates, nil
+}
+
+// charsetReader decodes windows-1251, the encoding the CBRF feed is served in.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8":
+		return input, nil
+	case "windows-1251", "cp1251":
+		return &cp1251Reader{src: bufio.NewReader(input)}, nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+type cp1251Reader struct {
+	src     *bufio.Reader
+	pending []byte
+}
+
+func (r *cp1251Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.pending) > 0 {
+			copied := copy(p[n:], r.pending)
+			r.pending = r.pending[copied:]
+			n += copied
+			continue
+		}
+		b, err := r.src.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		r.pending = utf8.AppendRune(r.pending[:0], cp1251Rune(b))
+	}
+	return n, nil
+}
+
+// cp1251Rune maps ASCII and the Cyrillic letters; other symbols of the code
+// page are not needed for the feed and become U+FFFD.
+func cp1251Rune(b byte) rune {
+	switch {
+	case b < 0x80:
+		return rune(b)
+	case b >= 0xC0:
+		return 'А' + rune(b-0xC0)
+	case b == 0xA8:
+		return 'Ё'
+	case b == 0xB8:
+		return 'ё'
+	}
+	return utf8.RuneError
+}
+
+// convertTotals sums per-currency totals in the target currency. Currencies
+// that cannot be converted are returned in skipped.
+func convertTotals(converter CurrencyConverter, totals map[string]float64, to string) (sum float64, skipped []string, err error) {
+	converted := 0
+	for currency, amount := range totals {
+		if currency == "" {
+			skipped = append(skipped, currency)
+			continue
+		}
+		value, convErr := converter.Convert(amount, currency, to)
+		if convErr != nil {
+			skipped = append(skipped, currency)
+			err = convErr
+			continue
+		}
+		sum += value
+		converted++
+	}
+	if converted > 0 {
+		err = nil
+	}
+	return sum, skipped, err
+}
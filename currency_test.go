@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFixedRateConverter(t *testing.T) {
+	t.Parallel()
+
+	converter := FixedRateConverter{Rates: map[string]float64{"USD": 90, "EUR": 100}}
+	tests := []struct {
+		name     string
+		amount   float64
+		from, to string
+		want     float64
+		wantErr  bool
+	}{
+		{name: "same currency", amount: 10, from: "USD", to: "USD", want: 10},
+		{name: "to RUB", amount: 2, from: "USD", to: "RUB", want: 180},
+		{name: "from RUB", amount: 900, from: "RUB", to: "USD", want: 10},
+		{name: "cross rate", amount: 9, from: "EUR", to: "USD", want: 10},
+		{name: "unknown currency", amount: 1, from: "GBP", to: "RUB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := converter.Convert(tt.amount, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Convert() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Convert() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertTotals(t *testing.T) {
+	t.Parallel()
+
+	converter := FixedRateConverter{Rates: map[string]float64{"USD": 90}}
+	sum, skipped, err := convertTotals(converter, map[string]float64{"RUB": 900, "USD": 10, "": 5}, "USD")
+	if err != nil {
+		t.Fatalf("convertTotals() error = %v", err)
+	}
+	if math.Abs(sum-20) > 1e-9 {
+		t.Errorf("convertTotals() sum = %v, want 20", sum)
+	}
+	if len(skipped) != 1 || skipped[0] != "" {
+		t.Errorf("convertTotals() skipped = %q, want the unrecognized currency only", skipped)
+	}
+
+	if _, _, err := convertTotals(converter, map[string]float64{"GBP": 1}, "RUB"); err == nil {
+		t.Error("convertTotals() with no convertible totals returned no error")
+	}
+}
+
+func TestCBRFConverter(t *testing.T) {
+	t.Parallel()
+
+	// "Доллар США" and "Японских иен" in windows-1251, as served by the feed.
+	feed := append([]byte(`<?xml version="1.0" encoding="windows-1251"?>
+<ValCurs Date="14.10.2026" name="Foreign Currency Market">
+<Valute ID="R01235"><NumCode>840</NumCode><CharCode>USD</CharCode><Nominal>1</Nominal><Name>`),
+		0xC4, 0xEE, 0xEB, 0xEB, 0xE0, 0xF0, 0x20, 0xD1, 0xD8, 0xC0)
+	feed = append(feed, []byte(`</Name><Value>92,5000</Value></Valute>
+<Valute ID="R01820"><NumCode>392</NumCode><CharCode>JPY</CharCode><Nominal>100</Nominal><Name>`)...)
+	feed = append(feed, 0xDF, 0xEF, 0xEE, 0xED, 0xF1, 0xEA, 0xE8, 0xF5, 0x20, 0xE8, 0xE5, 0xED)
+	feed = append(feed, []byte(`</Name><Value>61,0000</Value></Valute>
+</ValCurs>`)...)
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/xml; charset=windows-1251")
+		w.Write(feed)
+	}))
+	defer srv.Close()
+
+	converter := NewCBRFConverter(srv.Client())
+	converter.URL = srv.URL
+
+	got, err := converter.Convert(2, "USD", "RUB")
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if math.Abs(got-185) > 1e-9 {
+		t.Errorf("Convert(2 USD) = %v RUB, want 185", got)
+	}
+
+	got, err = converter.Convert(1000, "JPY", "RUB")
+	if err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+	if math.Abs(got-610) > 1e-9 {
+		t.Errorf("Convert(1000 JPY) = %v RUB, want 610 (rate is per 100 units)", got)
+	}
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("feed fetched %d times, want 1 (rates are cached)", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errLockHeld is returned by tryLockFile when another process holds the lock.
+var errLockHeld = errors.New("lock held by another process")
+
+// FileLockedError is returned when another server instance already holds
+// the lock on a data file.
+type FileLockedError struct {
+	Path string
+	// PID is the process that holds the lock, or 0 when it is unknown.
+	PID int
+}
+
+func (e *FileLockedError) Error() string {
+	holder := "another process"
+	if e.PID > 0 {
+		holder = fmt.Sprintf("process %d", e.PID)
+	}
+	return fmt.Sprintf("%s is locked by %s; stop the other server instance, point CART_FILE elsewhere or start with -wait-for-lock", e.Path, holder)
+}
+
+// FileLock is an advisory lock on path+".lock", which holds the PID of the
+// process that owns it. The operating system releases the lock when the
+// process exits, so a crash never leaves it stale.
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile locks path for this process. When the lock is held elsewhere it
+// fails with a *FileLockedError, or waits for it to be released if wait is set.
+func LockFile(path string, wait bool) (*FileLock, error) {
+	lockPath := path + ".lock"
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	err = tryLockFile(file)
+	if errors.Is(err, errLockHeld) {
+		pid := lockHolder(file)
+		if !wait {
+			file.Close()
+			return nil, &FileLockedError{Path: path, PID: pid}
+		}
+		slog.Info("waiting for another server instance to release the lock", "path", lockPath, "pid", pid)
+		err = lockFile(file)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", lockPath, err)
+	}
+
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &FileLock{file: file}, nil
+}
+
+// lockHolder reads the PID the lock holder wrote into the lock file.
+func lockHolder(file *os.File) int {
+	data := make([]byte, 32)
+	n, _ := file.ReadAt(data, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data[:n])))
+	return pid
+}
+
+// Unlock releases the lock. The lock file itself is left in place: removing
+// it could let two processes lock two different files of the same name.
+func (l *FileLock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.file.Truncate(0)
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
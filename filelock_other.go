@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// Platforms without advisory locks (Plan 9, WebAssembly) run unlocked.
+
+func tryLockFile(file *os.File) error { return nil }
+
+func lockFile(file *os.File) error { return nil }
+
+func unlockFile(file *os.File) error { return nil }
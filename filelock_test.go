@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJSONCartFileLock(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cart.json")
+	first, err := NewJSONCartFile(path).Lock(false)
+	if err != nil {
+		t.Fatalf("first Lock() error = %v", err)
+	}
+
+	_, err = NewJSONCartFile(path).Lock(false)
+	var lockedErr *FileLockedError
+	if !errors.As(err, &lockedErr) || lockedErr.PID != os.Getpid() {
+		t.Fatalf("second Lock() error = %v, want a *FileLockedError naming PID %d", err, os.Getpid())
+	}
+
+	acquired := make(chan *FileLock)
+	go func() {
+		lock, err := NewJSONCartFile(path).Lock(true)
+		if err != nil {
+			t.Errorf("waiting Lock() error = %v", err)
+		}
+		acquired <- lock
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("waiting Lock() returned while the first lock was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := first.Unlock(); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	select {
+	case lock := <-acquired:
+		if err := lock.Unlock(); err != nil {
+			t.Errorf("Unlock() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting Lock() did not return after the lock was released")
+	}
+}
@@ -0,0 +1,36 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// The lock covers one byte far past the PID, because Windows locks are
+// mandatory and would otherwise keep the second instance from reading it.
+const lockOffset = ^uint32(0)
+
+func lockFileEx(file *os.File, flags uint32) error {
+	overlapped := windows.Overlapped{Offset: lockOffset, OffsetHigh: lockOffset}
+	return windows.LockFileEx(windows.Handle(file.Fd()), flags, 0, 1, 0, &overlapped)
+}
+
+func tryLockFile(file *os.File) error {
+	err := lockFileEx(file, windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLockHeld
+	}
+	return err
+}
+
+func lockFile(file *os.File) error {
+	return lockFileEx(file, windows.LOCKFILE_EXCLUSIVE_LOCK)
+}
+
+func unlockFile(file *os.File) error {
+	overlapped := windows.Overlapped{Offset: lockOffset, OffsetHigh: lockOffset}
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &overlapped)
+}
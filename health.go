@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// startedAt is when the process started, for the uptime in /health.
+var startedAt = time.Now()
+
+// newHTTPHandler serves the MCP endpoint together with the operational
+// endpoints on one mux, behind the CORS middleware. /metrics is left out when
+// METRICS_PORT gives it a port of its own.
+func newHTTPHandler(mcpServer *server.StreamableHTTPServer, srv *Server) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", mcpServer)
+	mux.HandleFunc("GET /health", srv.handleHealth)
+	if config.MetricsPort == "" {
+		mux.Handle("GET /metrics", promhttp.Handler())
+	}
+	return corsMiddleware(config.CORSAllowedOrigins, mux)
+}
+
+// handleHealth is the liveness probe. It answers 503 when the Google Custom
+// Search credentials are missing, since no search can succeed then.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	var status int
+	var body any
+	if err := config.Validate(); err != nil {
+		status = http.StatusServiceUnavailable
+		body = struct {
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		}{Status: "degraded", Reason: "missing credentials"}
+	} else {
+		// The cart storage being unreachable does not make the process dead,
+		// so a failed read only leaves the count at zero.
+		items, _ := s.store.List(r.Context(), defaultCartName)
+		status = http.StatusOK
+		body = struct {
+			Status    string `json:"status"`
+			CartItems int    `json:"cart_items"`
+			UptimeS   int64  `json:"uptime_s"`
+		}{Status: "ok", CartItems: len(items), UptimeS: int64(time.Since(startedAt).Seconds())}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.WarnContext(r.Context(), "failed to write health response", "error", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestHealth(t *testing.T) {
+	prevConfig := config
+	t.Cleanup(func() { config = prevConfig })
+
+	s := server.NewMCPServer(serverName, serverVersion)
+	srv := httptest.NewServer(newHTTPHandler(server.NewStreamableHTTPServer(s), NewServer(NewMemoryCartStore(carts), nil)))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name             string
+		apiKey, engineID string
+		wantCode         int
+		wantStatus       string
+	}{
+		{name: "configured", apiKey: "key", engineID: "engine", wantCode: http.StatusOK, wantStatus: "ok"},
+		{name: "missing credentials", apiKey: "key", wantCode: http.StatusServiceUnavailable, wantStatus: "degraded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := *prevConfig
+			cfg.GoogleAPIKey, cfg.SearchEngineID = tt.apiKey, tt.engineID
+			config = &cfg
+
+			resp, err := http.Get(srv.URL + "/health")
+			if err != nil {
+				t.Fatalf("GET /health error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			var body map[string]any
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding /health response: %v", err)
+			}
+			if resp.StatusCode != tt.wantCode || body["status"] != tt.wantStatus {
+				t.Errorf("GET /health = %d %v, want %d with status %q", resp.StatusCode, body, tt.wantCode, tt.wantStatus)
+			}
+			if _, ok := body["cart_items"]; tt.wantStatus == "ok" && !ok {
+				t.Errorf("healthy response %v has no cart_items", body)
+			}
+		})
+	}
+
+	resp, err := http.Post(srv.URL+"/health", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST /health error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /health = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
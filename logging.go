@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type requestIDKey struct{}
+
+type toolNameKey struct{}
+
+// newLogger builds the process logger; LOG_FORMAT=json switches from the
+// default human-readable text output to JSON lines.
+func newLogger(w io.Writer, format string) *slog.Logger {
+	if strings.EqualFold(format, "json") {
+		return slog.New(requestIDHandler{slog.NewJSONHandler(w, nil)})
+	}
+	return slog.New(requestIDHandler{slog.NewTextHandler(w, nil)})
+}
+
+// requestIDHandler adds the request_id of the current tool call to every
+// record logged with a context.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// toolNameFromContext returns the name of the tool being called, if any.
+func toolNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(toolNameKey{}).(string)
+	return name
+}
+
+// traceToolCalls assigns a request_id to every tool invocation and returns it
+// in the result metadata, so it can be quoted in error reports. The tool name
+// is kept in the context for the cart history.
+func traceToolCalls(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id := uuid.NewString()
+		ctx = context.WithValue(ctx, requestIDKey{}, id)
+		ctx = context.WithValue(ctx, toolNameKey{}, request.Params.Name)
+		result, err := next(ctx, request)
+		if result != nil {
+			if result.Meta == nil {
+				result.Meta = make(map[string]any)
+			}
+			result.Meta["request_id"] = id
+		}
+		return result, err
+	}
+}
+
+// callerFromContext identifies the MCP client behind a request.
+func callerFromContext(ctx context.Context) string {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return "unknown"
+	}
+	if withInfo, ok := session.(server.SessionWithClientInfo); ok {
+		if info := withInfo.GetClientInfo(); info.Name != "" {
+			return info.Name + "/" + session.SessionID()
+		}
+	}
+	return session.SessionID()
+}
+
+// logToolCalls emits one log line per tool invocation.
+func logToolCalls(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		started := time.Now()
+		result, err := next(ctx, request)
+
+		attrs := []any{
+			slog.String("tool", request.Params.Name),
+			slog.Int64("latency_ms", time.Since(started).Milliseconds()),
+			slog.String("caller", callerFromContext(ctx)),
+		}
+		switch {
+		case err != nil:
+			slog.ErrorContext(ctx, "tool call", append(attrs, slog.String("error", err.Error()))...)
+		case result != nil && result.IsError:
+			slog.WarnContext(ctx, "tool call", append(attrs, slog.String("error", toolResultText(result)))...)
+		default:
+			slog.InfoContext(ctx, "tool call", attrs...)
+		}
+		return result, err
+	}
+}
+
+func toolResultText(result *mcp.CallToolResult) string {
+	var parts []string
+	for _, content := range result.Content {
+		if text, ok := content.(mcp.TextContent); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
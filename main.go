@@ -1,17 +1,29 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -41,222 +53,4309 @@ type SearchItem struct {
 			LowPrice      string `json:"lowprice"`
 			HighPrice     string `json:"highprice"`
 		} `json:"aggregateoffer"`
+		CSEImage []struct {
+			Src string `json:"src"`
+		} `json:"cse_image"`
 	} `json:"pagemap"`
 }
 
+// Image returns the first product photo Google found on the page, if any.
+func (item SearchItem) Image() string {
+	for _, image := range item.PageMap.CSEImage {
+		if isAbsoluteHTTPURL(image.Src) {
+			return image.Src
+		}
+	}
+	return ""
+}
+
 type CartItem struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Link        string `json:"link"`
-	Price       string `json:"price"`
-	Shop        string `json:"shop"`
-	Description string `json:"description"`
-	Quantity    int    `json:"quantity"`
+	ID             string    `json:"id"`
+	Title          string    `json:"title"`
+	Link           string    `json:"link"`
+	Price          string    `json:"price"`
+	PriceAmount    float64   `json:"price_amount,omitempty"`
+	PriceCurrency  string    `json:"price_currency,omitempty"`
+	PriceParsed    bool      `json:"price_parsed"`
+	Shop           string    `json:"shop"`
+	Description    string    `json:"description"`
+	Image          string    `json:"image,omitempty"`
+	Quantity       int       `json:"quantity"`
+	Note           string    `json:"note,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	Priority       string    `json:"priority,omitempty"`
+	TargetPrice    float64   `json:"target_price,omitempty"`
+	TargetCurrency string    `json:"target_currency,omitempty"`
+	AddedAt        time.Time `json:"added_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// updateParsedPrice refreshes the numeric price stored next to the raw price string.
+func (item *CartItem) updateParsedPrice() {
+	price, err := ParsePrice(item.Price)
+	item.PriceAmount = price.Amount
+	item.PriceCurrency = price.Currency
+	item.PriceParsed = err == nil
+}
+
+// ParsedPrice returns the item's price; ok is false when the price string
+// could not be parsed.
+func (item *CartItem) ParsedPrice() (price Price, ok bool) {
+	return Price{Amount: item.PriceAmount, Currency: item.PriceCurrency, Display: item.Price}, item.PriceParsed
+}
+
+// clone returns a deep copy of the item.
+func (item *CartItem) clone() *CartItem {
+	c := *item
+	c.Tags = slices.Clone(item.Tags)
+	return &c
 }
 
 type Cart struct {
 	Items map[string]*CartItem
 	mutex sync.RWMutex
+	// name identifies the cart in the cart history.
+	name string
+	// now is the cart's time source, replaceable in tests.
+	now func() time.Time
+	// journal holds recent mutations for undo, oldest first.
+	journal []cartMutation
+	// trash holds recently deleted lines, oldest first.
+	trash []removedItem
+	// pending is the mutation being recorded in the cart history.
+	pending *pendingAudit
+	// lastAction is the action of the newest mutation recorded in the
+	// history, which the database-backed stores log with the lines it changed.
+	lastAction string
+	// budget is the spending limit shown by view_cart and cart_total.
+	budget Budget
+}
+
+var cart = &Cart{
+	Items: make(map[string]*CartItem),
+	name:  defaultCartName,
+	now:   time.Now,
+}
+
+const (
+	serverName    = "shopping-server"
+	serverVersion = "1.0.0"
+)
+
+const (
+	lastSearchTTL               = 30 * time.Minute
+	defaultMaxCartQuantity      = 99
+	defaultMaxCartItems         = 200
+	defaultMaxCartTotalQuantity = 999
+	defaultSearchTimeout        = 10 * time.Second
+	defaultListenAddr           = ":8080"
+	maxNoteLength               = 500
+	defaultShutdownTimeout      = 5 * time.Second
+	defaultCartPageSize         = 20
+	maxCompareItems             = 10
+	maxBatchItems               = 50
+	itemIDLength                = 16
+	maxCartPageSize             = 100
+	// The Custom Search API returns at most 10 results per call and none
+	// past the 100th.
+	searchPageSize          = 10
+	maxSearchResultIndex    = 100
+	defaultMaxSearchResults = 30
+	maxSearchConcurrency    = 3
+	// The free tier of the Custom Search API allows about one call a second.
+	defaultGoogleAPIRPS = 1.0
+	defaultSafeSearch   = safeSearchActive
+)
+
+type lastSearch struct {
+	Items     []SearchItem
+	ExpiresAt time.Time
+}
+
+// LastSearchStore keeps only the most recent search results of every session,
+// so that items can be added to the cart by their result number.
+type LastSearchStore struct {
+	searches map[string]*lastSearch
+	mutex    sync.Mutex
+}
+
+var lastSearches = &LastSearchStore{
+	searches: make(map[string]*lastSearch),
+}
+
+func sessionIDFromContext(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+func (s *LastSearchStore) Save(sessionID string, items []SearchItem) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for id, search := range s.searches {
+		if now.After(search.ExpiresAt) {
+			delete(s.searches, id)
+		}
+	}
+
+	stored := make([]SearchItem, len(items))
+	copy(stored, items)
+	s.searches[sessionID] = &lastSearch{
+		Items:     stored,
+		ExpiresAt: now.Add(lastSearchTTL),
+	}
+}
+
+// Get returns the result with the given 1-based index from the last search of the session.
+func (s *LastSearchStore) Get(sessionID string, index int) (SearchItem, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	search, exists := s.searches[sessionID]
+	if !exists || time.Now().After(search.ExpiresAt) {
+		delete(s.searches, sessionID)
+		return SearchItem{}, fmt.Errorf("no recent search results, run search_products again")
+	}
+	if index < 1 || index > len(search.Items) {
+		return SearchItem{}, fmt.Errorf("result_index %d is out of range, the last search returned %d results; run search_products again if needed", index, len(search.Items))
+	}
+	return search.Items[index-1], nil
+}
+
+type Config struct {
+	GoogleAPIKey         string
+	SearchEngineID       string
+	MaxCartQuantity      int
+	SearchTimeout        time.Duration
+	CacheTTL             time.Duration
+	ListenAddr           string
+	SearchHistorySize    int
+	MaxCartItems         int
+	MaxCartTotalQuantity int
+	UndoJournalSize      int
+	TrashTTL             time.Duration
+	// DisplayCurrency, when set, adds a converted grand total to view_cart.
+	DisplayCurrency string
+	// MaxSearchResults caps num_results; larger searches are split into pages.
+	MaxSearchResults int
+	// PriceAlertInterval is how often price alerts are re-checked.
+	PriceAlertInterval time.Duration
+	// CartHistorySize is how many cart mutations cart_history keeps.
+	CartHistorySize int
+	// CartBackupKeep is how many cart backups are kept; 0 disables them.
+	CartBackupKeep int
+	// CartBackupInterval is how often the carts are backed up besides
+	// before destructive tools; 0 leaves only those backups.
+	CartBackupInterval time.Duration
+	// CartVersionEvery and CartVersionInterval set how often a cart change
+	// records a version for rollback_to_version: after that many changes or
+	// that much time since the previous version; 0 turns either trigger off.
+	CartVersionEvery    int
+	CartVersionInterval time.Duration
+	// CartVersionKeep and CartVersionMaxAge cap the versions kept per cart;
+	// a CartVersionKeep of 0 disables versions.
+	CartVersionKeep   int
+	CartVersionMaxAge time.Duration
+	// GoogleAPIRPS caps the rate of Custom Search API calls.
+	GoogleAPIRPS float64
+	// SafeSearch is the Google SafeSearch level of searches that do not
+	// set adult_content: "active" filters explicit results, "off" does not.
+	SafeSearch string
+	// SearchEngines maps search_products categories to their CX IDs.
+	SearchEngines map[string]string
+	// ProductRegistrySize is how many products found by searches are kept.
+	ProductRegistrySize int
+	// MaxDescriptionLength is the length item descriptions are cut to.
+	MaxDescriptionLength int
+	// VisualSearchProvider and VisualSearchAPIKey configure search_by_image_url.
+	VisualSearchProvider string
+	VisualSearchAPIKey   string
+	// CartItemTTL, when set, marks items not updated for that long as expired.
+	CartItemTTL time.Duration
+	// MetricsPort, when set, moves /metrics off ListenAddr to a port of its own.
+	MetricsPort string
+	// CORSAllowedOrigins lists the origins browsers may call the server from.
+	CORSAllowedOrigins []string
+	// CartBackend selects where carts are kept: "memory" (with the JSON
+	// cart file), "sqlite" (the database at CartDBPath) or "redis" (the
+	// server at RedisURL, shared by several replicas).
+	CartBackend string
+	CartDBPath  string
+	RedisURL    string
+	// RedisKeyPrefix namespaces the cart keys, e.g. per environment.
+	RedisKeyPrefix string
+	// RedisCartTTL, when set, expires Redis carts left unchanged that long.
+	RedisCartTTL time.Duration
+	// CartScope is "global" for one set of carts shared by every client or
+	// "session" for separate in-memory carts per MCP session, dropped after
+	// CartSessionTTL without a call.
+	CartScope      string
+	CartSessionTTL time.Duration
+	// TLS switches the server to HTTPS when a certificate is configured.
+	TLS TLSConfig
+	// ShutdownTimeout bounds how long in-flight requests may run after
+	// SIGINT or SIGTERM before the cart is flushed anyway.
+	ShutdownTimeout time.Duration
+}
+
+func loadConfig() *Config {
+	maxCartQuantity := defaultMaxCartQuantity
+	if value, err := strconv.Atoi(os.Getenv("MAX_CART_QUANTITY")); err == nil && value > 0 {
+		maxCartQuantity = value
+	}
+
+	searchTimeout := defaultSearchTimeout
+	if value, err := strconv.Atoi(os.Getenv("SEARCH_TIMEOUT_SECONDS")); err == nil && value > 0 {
+		searchTimeout = time.Duration(value) * time.Second
+	}
+
+	cacheTTL := defaultCacheTTL
+	if value, err := strconv.Atoi(os.Getenv("CACHE_TTL_SECONDS")); err == nil && value >= 0 {
+		cacheTTL = time.Duration(value) * time.Second
+	}
+
+	listenAddr := os.Getenv("MCP_LISTEN_ADDR")
+	if listenAddr == "" {
+		listenAddr = defaultListenAddr
+		if port := os.Getenv("MCP_PORT"); port != "" {
+			listenAddr = ":" + port
+		}
+	}
+
+	searchHistorySize := defaultSearchHistorySize
+	if value, err := strconv.Atoi(os.Getenv("SEARCH_HISTORY_SIZE")); err == nil && value > 0 {
+		searchHistorySize = value
+	}
+
+	maxCartItems := defaultMaxCartItems
+	if value, err := strconv.Atoi(os.Getenv("MAX_CART_ITEMS")); err == nil && value > 0 {
+		maxCartItems = value
+	}
+
+	maxCartTotalQuantity := defaultMaxCartTotalQuantity
+	if value, err := strconv.Atoi(os.Getenv("MAX_CART_TOTAL_QUANTITY")); err == nil && value > 0 {
+		maxCartTotalQuantity = value
+	}
+
+	undoJournalSize := defaultUndoJournalSize
+	if value, err := strconv.Atoi(os.Getenv("UNDO_JOURNAL_SIZE")); err == nil && value > 0 {
+		undoJournalSize = value
+	}
+
+	trashTTL := defaultTrashTTL
+	if value, err := strconv.Atoi(os.Getenv("TRASH_TTL_HOURS")); err == nil && value > 0 {
+		trashTTL = time.Duration(value) * time.Hour
+	}
+
+	maxSearchResults := defaultMaxSearchResults
+	if value, err := strconv.Atoi(os.Getenv("MAX_SEARCH_RESULTS")); err == nil && value > 0 {
+		maxSearchResults = min(value, maxSearchResultIndex)
+	}
+
+	priceAlertInterval := defaultPriceAlertInterval
+	if value, err := strconv.Atoi(os.Getenv("PRICE_ALERT_INTERVAL_MINUTES")); err == nil && value > 0 {
+		priceAlertInterval = time.Duration(value) * time.Minute
+	}
+
+	cartHistorySize := defaultCartHistorySize
+	if value, err := strconv.Atoi(os.Getenv("CART_HISTORY_SIZE")); err == nil && value > 0 {
+		cartHistorySize = value
+	}
+
+	cartBackupKeep := defaultCartBackupKeep
+	if value, err := strconv.Atoi(os.Getenv("CART_BACKUP_KEEP")); err == nil && value >= 0 {
+		cartBackupKeep = value
+	}
+
+	cartBackupInterval := defaultCartBackupInterval
+	if value, err := time.ParseDuration(os.Getenv("CART_BACKUP_INTERVAL")); err == nil && value >= 0 {
+		cartBackupInterval = value
+	}
+
+	cartVersionEvery := defaultCartVersionEvery
+	if value, err := strconv.Atoi(os.Getenv("CART_VERSION_EVERY")); err == nil && value >= 0 {
+		cartVersionEvery = value
+	}
+
+	cartVersionInterval := defaultCartVersionInterval
+	if value, err := time.ParseDuration(os.Getenv("CART_VERSION_INTERVAL")); err == nil && value >= 0 {
+		cartVersionInterval = value
+	}
+
+	cartVersionKeep := defaultCartVersionKeep
+	if value, err := strconv.Atoi(os.Getenv("CART_VERSION_KEEP")); err == nil && value >= 0 {
+		cartVersionKeep = value
+	}
+
+	cartVersionMaxAge := defaultCartVersionMaxAge
+	if value, err := time.ParseDuration(os.Getenv("CART_VERSION_MAX_AGE")); err == nil && value >= 0 {
+		cartVersionMaxAge = value
+	}
+
+	googleAPIRPS := defaultGoogleAPIRPS
+	if value, err := strconv.ParseFloat(os.Getenv("GOOGLE_API_RPS"), 64); err == nil && value > 0 {
+		googleAPIRPS = value
+	}
+
+	productRegistrySize := defaultProductRegistrySize
+	if value, err := strconv.Atoi(os.Getenv("PRODUCT_REGISTRY_SIZE")); err == nil && value > 0 {
+		productRegistrySize = value
+	}
+
+	maxDescriptionLength := defaultMaxDescriptionLength
+	if value, err := strconv.Atoi(os.Getenv("MAX_DESCRIPTION_LENGTH")); err == nil && value > 0 {
+		maxDescriptionLength = value
+	}
+
+	var cartItemTTL time.Duration
+	if value, err := time.ParseDuration(os.Getenv("CART_ITEM_TTL")); err == nil && value > 0 {
+		cartItemTTL = value
+	}
+
+	shutdownTimeout := defaultShutdownTimeout
+	if value, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && value > 0 {
+		shutdownTimeout = value
+	}
+
+	var redisCartTTL time.Duration
+	if value, err := time.ParseDuration(os.Getenv("REDIS_CART_TTL")); err == nil && value > 0 {
+		redisCartTTL = value
+	}
+
+	cartSessionTTL := defaultCartSessionTTL
+	if value, err := time.ParseDuration(os.Getenv("CART_SESSION_TTL")); err == nil && value > 0 {
+		cartSessionTTL = value
+	}
+
+	return &Config{
+		GoogleAPIKey:         os.Getenv("GOOGLE_API_KEY"),
+		SearchEngineID:       os.Getenv("GOOGLE_SEARCH_ENGINE_ID"),
+		MaxCartQuantity:      maxCartQuantity,
+		SearchTimeout:        searchTimeout,
+		CacheTTL:             cacheTTL,
+		ListenAddr:           listenAddr,
+		SearchHistorySize:    searchHistorySize,
+		MaxCartItems:         maxCartItems,
+		MaxCartTotalQuantity: maxCartTotalQuantity,
+		UndoJournalSize:      undoJournalSize,
+		TrashTTL:             trashTTL,
+		DisplayCurrency:      strings.ToUpper(strings.TrimSpace(os.Getenv("DISPLAY_CURRENCY"))),
+		MaxSearchResults:     maxSearchResults,
+		PriceAlertInterval:   priceAlertInterval,
+		CartHistorySize:      cartHistorySize,
+		CartBackupKeep:       cartBackupKeep,
+		CartBackupInterval:   cartBackupInterval,
+		CartVersionEvery:     cartVersionEvery,
+		CartVersionInterval:  cartVersionInterval,
+		CartVersionKeep:      cartVersionKeep,
+		CartVersionMaxAge:    cartVersionMaxAge,
+		GoogleAPIRPS:         googleAPIRPS,
+		SafeSearch:           parseSafeSearch(os.Getenv("GOOGLE_SAFE_SEARCH")),
+		SearchEngines:        parseSearchEngineMap(os.Getenv("SEARCH_ENGINE_MAP")),
+		ProductRegistrySize:  productRegistrySize,
+		MaxDescriptionLength: maxDescriptionLength,
+		VisualSearchProvider: cmp.Or(strings.ToLower(strings.TrimSpace(os.Getenv("VISUAL_SEARCH_PROVIDER"))), defaultVisualSearchProvider),
+		VisualSearchAPIKey:   os.Getenv("VISUAL_SEARCH_API_KEY"),
+		CartItemTTL:          cartItemTTL,
+		MetricsPort:          strings.TrimSpace(os.Getenv("METRICS_PORT")),
+		CORSAllowedOrigins:   parseCORSAllowedOrigins(os.Getenv("CORS_ALLOWED_ORIGINS")),
+		CartBackend:          cmp.Or(strings.ToLower(strings.TrimSpace(os.Getenv("CART_BACKEND"))), defaultCartBackend),
+		CartDBPath:           cmp.Or(os.Getenv("CART_DB_PATH"), defaultCartDBPath),
+		RedisURL:             cmp.Or(os.Getenv("REDIS_URL"), defaultRedisURL),
+		RedisKeyPrefix:       cmp.Or(os.Getenv("REDIS_KEY_PREFIX"), defaultRedisKeyPrefix),
+		RedisCartTTL:         redisCartTTL,
+		CartScope:            cmp.Or(strings.ToLower(strings.TrimSpace(os.Getenv("CART_SCOPE"))), defaultCartScope),
+		CartSessionTTL:       cartSessionTTL,
+		TLS:                  loadTLSConfig(),
+		ShutdownTimeout:      shutdownTimeout,
+	}
+}
+
+// Validate reports missing Google Custom Search credentials.
+func (c *Config) Validate() error {
+	var missing []string
+	if c.GoogleAPIKey == "" {
+		missing = append(missing, "GOOGLE_API_KEY")
+	}
+	if c.SearchEngineID == "" {
+		missing = append(missing, "GOOGLE_SEARCH_ENGINE_ID")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Google Custom Search is not configured: %s not set", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// config is loaded once in main; the defaults here keep handlers usable
+// before that, e.g. in tests.
+var config = &Config{
+	MaxCartQuantity:      defaultMaxCartQuantity,
+	SearchTimeout:        defaultSearchTimeout,
+	CacheTTL:             defaultCacheTTL,
+	ListenAddr:           defaultListenAddr,
+	SearchHistorySize:    defaultSearchHistorySize,
+	MaxCartItems:         defaultMaxCartItems,
+	MaxCartTotalQuantity: defaultMaxCartTotalQuantity,
+	UndoJournalSize:      defaultUndoJournalSize,
+	TrashTTL:             defaultTrashTTL,
+	MaxSearchResults:     defaultMaxSearchResults,
+	PriceAlertInterval:   defaultPriceAlertInterval,
+	CartHistorySize:      defaultCartHistorySize,
+	CartBackupKeep:       defaultCartBackupKeep,
+	CartBackupInterval:   defaultCartBackupInterval,
+	CartVersionEvery:     defaultCartVersionEvery,
+	CartVersionInterval:  defaultCartVersionInterval,
+	CartVersionKeep:      defaultCartVersionKeep,
+	CartVersionMaxAge:    defaultCartVersionMaxAge,
+	GoogleAPIRPS:         defaultGoogleAPIRPS,
+	SafeSearch:           defaultSafeSearch,
+	ProductRegistrySize:  defaultProductRegistrySize,
+	MaxDescriptionLength: defaultMaxDescriptionLength,
+	VisualSearchProvider: defaultVisualSearchProvider,
+	CORSAllowedOrigins:   []string{defaultCORSAllowedOrigins},
+	CartBackend:          defaultCartBackend,
+	CartDBPath:           defaultCartDBPath,
+	RedisURL:             defaultRedisURL,
+	RedisKeyPrefix:       defaultRedisKeyPrefix,
+	CartScope:            defaultCartScope,
+	CartSessionTTL:       defaultCartSessionTTL,
+	ShutdownTimeout:      defaultShutdownTimeout,
+}
+
+var httpClient = newHTTPClient(defaultSearchTimeout)
+
+// searchProducts returns up to params.NumResults results starting at
+// params.Start. The API serves searchPageSize results per call, so larger
+// requests are split into pages fetched at most maxSearchConcurrency at a
+// time and joined in order.
+func searchProducts(ctx context.Context, query string, params SearchParams) (response *SearchResponse, err error) {
+	began := time.Now()
+	defer func() { observeSearch(time.Since(began), err) }()
+
+	numResults := min(params.NumResults, maxSearchResultIndex-params.Start+1)
+	if numResults <= searchPageSize {
+		params.NumResults = max(numResults, 1)
+		return searchPage(ctx, query, params)
+	}
+
+	pages := make([]*SearchResponse, (numResults+searchPageSize-1)/searchPageSize)
+	errs := make([]error, len(pages))
+	semaphore := make(chan struct{}, maxSearchConcurrency)
+	var wg sync.WaitGroup
+	for i := range pages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			offset := i * searchPageSize
+			page := params
+			page.NumResults = min(searchPageSize, numResults-offset)
+			page.Start = params.Start + offset
+			pages[i], errs[i] = searchPage(ctx, query, page)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	merged := *pages[0]
+	merged.Items = nil
+	for _, page := range pages {
+		merged.Items = append(merged.Items, page.Items...)
+		// A short page means the results ran out.
+		if len(page.Items) < searchPageSize {
+			break
+		}
+	}
+	return &merged, nil
+}
+
+// searchPage performs a single, cached API call.
+func searchPage(ctx context.Context, query string, params SearchParams) (*SearchResponse, error) {
+	cacheKey := searchCacheKey(query, params)
+	if cached, ok := searchCache.Get(cacheKey); ok {
+		slog.InfoContext(ctx, "search cache hit", "query", query, "num", params.NumResults, "start", params.Start)
+		return cached, nil
+	}
+
+	slog.InfoContext(ctx, "search request", "query", query, "num", params.NumResults, "start", params.Start)
+	searchResponse, err := searchClient.Search(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+
+	searchCache.Set(cacheKey, searchResponse)
+
+	return searchResponse, nil
+}
+
+// CartLimitError reports that an addition would exceed one of the cart size limits.
+type CartLimitError struct {
+	Limit   string
+	Max     int
+	Current int
+}
+
+func (e *CartLimitError) Error() string {
+	return fmt.Sprintf("cart limit reached: %s is limited to %d (currently %d)", e.Limit, e.Max, e.Current)
+}
+
+// addToCart adds count units of an item and returns the resulting quantity.
+// It fails with a *CartLimitError when the line would grow past
+// config.MaxCartQuantity units or the cart past config.MaxCartItems lines
+// or config.MaxCartTotalQuantity units.
+func addToCart(ctx context.Context, c *Cart, item CartItem, count int) (int, error) {
+	quantity, err := c.AddItem(ctx, item, count)
+	if err == nil {
+		cartAddTotal.Inc()
+	}
+	return quantity, err
+}
+
+// Snapshot returns deep copies of all items sorted by the time they were added.
+func (c *Cart) Snapshot() []*CartItem {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	result := make([]*CartItem, 0, len(c.Items))
+	for _, item := range c.Items {
+		result = append(result, item.clone())
+	}
+	sortCartItems(result, "added")
+	return result
+}
+
+// mergeItemLocked puts item into c, adding its quantity to an existing line
+// with the same ID. Notes and tags of the existing line are kept and
+// completed with the incoming ones, and a priority or target price the
+// existing line lacks is taken over. The caller must hold c.mutex.
+func (c *Cart) mergeItemLocked(item *CartItem) *CartItem {
+	now := c.now()
+	existing, exists := c.Items[item.ID]
+	if !exists {
+		item = item.clone()
+		item.UpdatedAt = now
+		c.Items[item.ID] = item
+		return item
+	}
+
+	existing.Quantity += item.Quantity
+	switch {
+	case existing.Note == "":
+		existing.Note = item.Note
+	case item.Note != "" && item.Note != existing.Note:
+		existing.Note += "; " + item.Note
+	}
+	for _, tag := range item.Tags {
+		if !slices.Contains(existing.Tags, tag) {
+			existing.Tags = append(existing.Tags, tag)
+		}
+	}
+	slices.Sort(existing.Tags)
+	existing.Priority = cmp.Or(existing.Priority, item.Priority)
+	if existing.TargetPrice == 0 {
+		existing.TargetPrice, existing.TargetCurrency = item.TargetPrice, item.TargetCurrency
+	}
+	existing.UpdatedAt = now
+	return existing
+}
+
+// Add adds count units of an item to c; see addToCart.
+func (c *Cart) Add(ctx context.Context, itemID, title, link, price, shop, description string, count int) (int, error) {
+	return c.AddItem(ctx, CartItem{ID: itemID, Title: title, Link: link, Price: price, Shop: shop, Description: description}, count)
+}
+
+// AddItem adds count units of item, taking the line's details from item
+// when it is new. An existing line only picks up an image it lacked.
+func (c *Cart) AddItem(ctx context.Context, line CartItem, count int) (int, error) {
+	itemID := line.ID
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	totalQuantity := 0
+	for _, item := range c.Items {
+		totalQuantity += item.Quantity
+	}
+	if totalQuantity+count > config.MaxCartTotalQuantity {
+		return 0, &CartLimitError{Limit: "total quantity", Max: config.MaxCartTotalQuantity, Current: totalQuantity}
+	}
+
+	if existingItem, exists := c.Items[itemID]; exists {
+		if existingItem.Quantity+count > config.MaxCartQuantity {
+			return 0, &CartLimitError{Limit: "quantity per item", Max: config.MaxCartQuantity, Current: existingItem.Quantity}
+		}
+		c.recordLocked("add", itemID)
+		existingItem.Image = cmp.Or(existingItem.Image, line.Image)
+		c.setQuantityLocked(itemID, existingItem.Quantity+count)
+		return existingItem.Quantity, nil
+	}
+
+	if count > config.MaxCartQuantity {
+		return 0, &CartLimitError{Limit: "quantity per item", Max: config.MaxCartQuantity, Current: 0}
+	}
+	if len(c.Items) >= config.MaxCartItems {
+		return 0, &CartLimitError{Limit: "distinct items", Max: config.MaxCartItems, Current: len(c.Items)}
+	}
+	c.recordLocked("add", itemID)
+
+	now := c.now()
+	item := &CartItem{
+		ID:          itemID,
+		Title:       line.Title,
+		Link:        line.Link,
+		Price:       line.Price,
+		Shop:        line.Shop,
+		Description: line.Description,
+		Image:       line.Image,
+		Quantity:    count,
+		Priority:    priorityNormal,
+		AddedAt:     now,
+		UpdatedAt:   now,
+	}
+	item.updateParsedPrice()
+	c.Items[itemID] = item
+	return count, nil
+}
+
+// BatchItemError points at the entry of a batch that made it fail.
+type BatchItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchItemError) Error() string {
+	return fmt.Sprintf("items[%d]: %v", e.Index, e.Err)
+}
+
+func (e *BatchItemError) Unwrap() error { return e.Err }
+
+func addItems(ctx context.Context, c *Cart, lines []CartItem) (added, merged int, err error) {
+	added, merged, err = c.AddItems(ctx, lines)
+	cartAddTotal.Add(float64(added + merged))
+	return added, merged, err
+}
+
+// AddItems adds all lines atomically, each with its Quantity as the count to
+// add: every entry is checked against the cart limits first, and the cart is
+// left untouched if any of them fails. Existing lines pick up an image they
+// lacked, as with AddItem. added counts new cart lines, merged counts entries
+// that increased an existing line (including lines created earlier in the
+// same batch).
+func (c *Cart) AddItems(ctx context.Context, inputs []CartItem) (added, merged int, err error) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	totalQuantity := 0
+	for _, item := range c.Items {
+		totalQuantity += item.Quantity
+	}
+	lines := len(c.Items)
+	quantities := make(map[string]int)
+	for i, input := range inputs {
+		current, seen := quantities[input.ID]
+		if !seen {
+			if item, exists := c.Items[input.ID]; exists {
+				current, seen = item.Quantity, true
+			} else if input.Title == "" {
+				return 0, 0, &BatchItemError{Index: i, Err: errors.New("title is required when adding a new item to the cart")}
+			}
+		}
+		if current+input.Quantity > config.MaxCartQuantity {
+			return 0, 0, &BatchItemError{Index: i, Err: fmt.Errorf("quantity %d exceeds the maximum of %d per item", current+input.Quantity, config.MaxCartQuantity)}
+		}
+		if totalQuantity+input.Quantity > config.MaxCartTotalQuantity {
+			return 0, 0, &BatchItemError{Index: i, Err: &CartLimitError{Limit: "total quantity", Max: config.MaxCartTotalQuantity, Current: totalQuantity}}
+		}
+		if !seen {
+			if lines >= config.MaxCartItems {
+				return 0, 0, &BatchItemError{Index: i, Err: &CartLimitError{Limit: "distinct items", Max: config.MaxCartItems, Current: lines}}
+			}
+			lines++
+		}
+		quantities[input.ID] = current + input.Quantity
+		totalQuantity += input.Quantity
+	}
+
+	ids := make([]string, 0, len(quantities))
+	for id := range quantities {
+		ids = append(ids, id)
+	}
+	c.recordLocked("add_items", ids...)
+
+	now := c.now()
+	for _, input := range inputs {
+		if item, exists := c.Items[input.ID]; exists {
+			item.Quantity += input.Quantity
+			item.Image = cmp.Or(item.Image, input.Image)
+			item.UpdatedAt = now
+			merged++
+			continue
+		}
+		item := &CartItem{
+			ID:          input.ID,
+			Title:       input.Title,
+			Link:        input.Link,
+			Price:       input.Price,
+			Shop:        input.Shop,
+			Description: input.Description,
+			Image:       input.Image,
+			Quantity:    input.Quantity,
+			Priority:    priorityNormal,
+			AddedAt:     now,
+			UpdatedAt:   now,
+		}
+		item.updateParsedPrice()
+		c.Items[input.ID] = item
+		added++
+	}
+	return added, merged, nil
+}
+
+// removeFromCart removes up to n units of an item from c and counts the removal.
+func removeFromCart(ctx context.Context, c *Cart, itemID string, n int) (removed int, deleted bool) {
+	removed, deleted = c.RemoveN(ctx, itemID, n)
+	if removed > 0 {
+		cartRemoveTotal.Inc()
+	}
+	return removed, deleted
+}
+
+// RemoveN removes up to n units of an item, clamping n to the quantity in the
+// cart. deleted reports whether the whole line was removed; removed is zero
+// when the item is not in the cart.
+func (c *Cart) RemoveN(ctx context.Context, itemID string, n int) (removed int, deleted bool) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	item, exists := c.Items[itemID]
+	if !exists || n <= 0 {
+		return 0, false
+	}
+	c.recordLocked("remove", itemID)
+
+	quantity := item.Quantity
+	removed = min(n, quantity)
+	c.setQuantityLocked(itemID, quantity-removed)
+	return removed, removed == quantity
+}
+
+// setQuantity sets the quantity of an item in c and counts the change.
+func setQuantity(ctx context.Context, c *Cart, itemID string, quantity int) (previous int, found bool) {
+	previous, found = c.SetQuantity(ctx, itemID, quantity)
+	switch {
+	case !found || quantity == previous:
+	case quantity > previous:
+		cartAddTotal.Inc()
+	default:
+		cartRemoveTotal.Inc()
+	}
+	return previous, found
+}
+
+// SetQuantity sets the quantity of an item already in the cart, removing it
+// when quantity drops to zero. It returns the previous quantity.
+func (c *Cart) SetQuantity(ctx context.Context, itemID string, quantity int) (previous int, found bool) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	if _, exists := c.Items[itemID]; exists {
+		c.recordLocked("set_quantity", itemID)
+	}
+	return c.setQuantityLocked(itemID, quantity)
+}
+
+// SetNote attaches a free-text note to an item; an empty note clears it.
+func (c *Cart) SetNote(ctx context.Context, itemID, note string) (found bool) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	item, exists := c.Items[itemID]
+	if !exists {
+		return false
+	}
+	c.auditLocked("set_note", itemID)
+	item.Note = note
+	item.UpdatedAt = c.now()
+	return true
+}
+
+// normalizeTag trims and lowercases a tag so "Дача " and "дача" are the same.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// Tag adds a normalized tag to an item, or removes it when remove is set.
+// It returns the item's tags after the change.
+func (c *Cart) Tag(ctx context.Context, itemID, tag string, remove bool) (tags []string, found bool) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	item, exists := c.Items[itemID]
+	if !exists {
+		return nil, false
+	}
+
+	c.auditLocked("tag", itemID)
+	tag = normalizeTag(tag)
+	index := slices.Index(item.Tags, tag)
+	switch {
+	case remove && index >= 0:
+		item.Tags = slices.Delete(item.Tags, index, index+1)
+	case !remove && index < 0:
+		item.Tags = append(item.Tags, tag)
+		sort.Strings(item.Tags)
+	}
+	item.UpdatedAt = c.now()
+	return slices.Clone(item.Tags), true
+}
+
+// Tags returns every tag in use in c with the number of items carrying it.
+func (c *Cart) Tags() map[string]int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	tags := make(map[string]int)
+	for _, item := range c.Items {
+		for _, tag := range item.Tags {
+			tags[tag]++
+		}
+	}
+	return tags
+}
+
+// SetPriority changes an item's priority and returns the previous one.
+func (c *Cart) SetPriority(ctx context.Context, itemID, priority string) (previous string, found bool) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	item, exists := c.Items[itemID]
+	if !exists {
+		return "", false
+	}
+	c.auditLocked("set_priority", itemID)
+	previous = item.Priority
+	if previous == "" {
+		previous = priorityNormal
+	}
+	item.Priority = priority
+	item.UpdatedAt = c.now()
+	return previous, true
+}
+
+// setQuantityLocked must be called with c.mutex held.
+func (c *Cart) setQuantityLocked(itemID string, quantity int) (previous int, found bool) {
+	item, exists := c.Items[itemID]
+	if !exists {
+		return 0, false
+	}
+
+	previous = item.Quantity
+	if quantity <= 0 {
+		c.trashLocked(item)
+		delete(c.Items, itemID)
+	} else {
+		item.Quantity = quantity
+		item.UpdatedAt = c.now()
+	}
+	return previous, true
+}
+
+// Get returns a copy of one item.
+func (c *Cart) Get(itemID string) (CartItem, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	item, exists := c.Items[itemID]
+	if !exists {
+		return CartItem{}, false
+	}
+	return *item.clone(), true
+}
+
+// getCart returns a copy of the cart items in the order they were added.
+func getCart() []*CartItem {
+	return cart.Snapshot()
+}
+
+var cartSortOrders = []string{"added", "title", "price", "quantity", "priority"}
+
+const (
+	priorityHigh   = "high"
+	priorityNormal = "normal"
+	priorityLow    = "low"
+)
+
+var priorities = []string{priorityHigh, priorityNormal, priorityLow}
+
+// priorityRank orders priorities from must-have to nice-to-have; items saved
+// before priorities existed count as normal.
+func priorityRank(priority string) int {
+	switch priority {
+	case priorityHigh:
+		return 0
+	case priorityLow:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func priorityMarker(priority string) string {
+	switch priority {
+	case priorityHigh:
+		return "❗ "
+	case priorityLow:
+		return "· "
+	default:
+		return ""
+	}
+}
+
+// sortCartItems orders items in place. Items with unparseable prices go last
+// when sorting by price; ties are broken by ID so the order is always stable.
+func sortCartItems(items []*CartItem, by string) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		switch by {
+		case "title":
+			if ta, tb := strings.ToLower(a.Title), strings.ToLower(b.Title); ta != tb {
+				return ta < tb
+			}
+		case "price":
+			if a.PriceParsed != b.PriceParsed {
+				return a.PriceParsed
+			}
+			if a.PriceAmount != b.PriceAmount {
+				return a.PriceAmount < b.PriceAmount
+			}
+		case "quantity":
+			if a.Quantity != b.Quantity {
+				return a.Quantity > b.Quantity
+			}
+		case "priority":
+			if ra, rb := priorityRank(a.Priority), priorityRank(b.Priority); ra != rb {
+				return ra < rb
+			}
+			if !a.AddedAt.Equal(b.AddedAt) {
+				return a.AddedAt.Before(b.AddedAt)
+			}
+		default:
+			if !a.AddedAt.Equal(b.AddedAt) {
+				return a.AddedAt.Before(b.AddedAt)
+			}
+		}
+		return a.ID < b.ID
+	})
 }
 
-var cart = &Cart{
-	Items: make(map[string]*CartItem),
-}
+// searchCart returns the items whose title, description, shop or tags
+// contain query, ignoring case.
+func searchCart(items []*CartItem, query string) []*CartItem {
+	query = strings.ToLower(query)
+	var matches []*CartItem
+	for _, item := range items {
+		fields := append([]string{item.Title, item.Description, item.Shop}, item.Tags...)
+		for _, field := range fields {
+			if strings.Contains(strings.ToLower(field), query) {
+				matches = append(matches, item)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// findSimilarCartItems returns other items from the same shop whose title
+// matches title once case, punctuation and spacing are ignored, or contains
+// it entirely.
+func findSimilarCartItems(items []*CartItem, itemID, title, shop string) []*CartItem {
+	normalized := normalizeTitle(title)
+	if normalized == "" || shop == "" {
+		return nil
+	}
+	var similar []*CartItem
+	for _, item := range items {
+		if item.ID == itemID || !strings.EqualFold(item.Shop, shop) {
+			continue
+		}
+		other := normalizeTitle(item.Title)
+		if other == "" {
+			continue
+		}
+		if other == normalized || strings.Contains(other, normalized) || strings.Contains(normalized, other) {
+			similar = append(similar, item)
+		}
+	}
+	return similar
+}
+
+func normalizeTitle(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// IDs returns the sorted IDs of all items in c.
+func (c *Cart) IDs() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	ids := make([]string, 0, len(c.Items))
+	for id := range c.Items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (c *Cart) Totals() (uniqueItems, totalQuantity int) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, item := range c.Items {
+		totalQuantity += item.Quantity
+	}
+	return len(c.Items), totalQuantity
+}
+
+func clearCart(ctx context.Context, c *Cart) (uniqueItems, totalQuantity int) {
+	uniqueItems, totalQuantity = c.Clear(ctx)
+	cartRemoveTotal.Add(float64(uniqueItems))
+	return uniqueItems, totalQuantity
+}
+
+// Clear removes every item from c, keeping them in the trash and the undo
+// journal, and reports how many lines and units were removed.
+func (c *Cart) Clear(ctx context.Context) (uniqueItems, totalQuantity int) {
+	c.mutex.Lock()
+	defer c.unlock(ctx)
+
+	uniqueItems = len(c.Items)
+	ids := make([]string, 0, uniqueItems)
+	for id, item := range c.Items {
+		totalQuantity += item.Quantity
+		ids = append(ids, id)
+	}
+	if uniqueItems > 0 {
+		c.recordLocked("clear", ids...)
+	}
+	for _, item := range c.Items {
+		c.trashLocked(item)
+	}
+	c.Items = make(map[string]*CartItem)
+	return uniqueItems, totalQuantity
+}
+
+type queryParams struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+type stringParams struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+type booleanParams struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+}
+
+type integerParams struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Default     int    `json:"default,omitempty"`
+	Minimum     int    `json:"minimum,omitempty"`
+	Maximum     int    `json:"maximum,omitempty"`
+}
+
+type numberParams struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+type enumParams struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Enum        []string `json:"enum"`
+	Default     string   `json:"default,omitempty"`
+}
+
+type arrayParams struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Items       any    `json:"items"`
+	MinItems    int    `json:"minItems,omitempty"`
+	MaxItems    int    `json:"maxItems,omitempty"`
+}
+
+type objectParams struct {
+	Type       string         `json:"type"`
+	Properties map[string]any `json:"properties"`
+	Required   []string       `json:"required,omitempty"`
+}
+
+type numResultsParams struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Default     int    `json:"default"`
+}
+
+func main() {
+	waitForLock := flag.Bool("wait-for-lock", false, "wait for another instance to release the cart file instead of exiting")
+	rotateCartKey := flag.Bool("rotate-cart-key", false, "re-encrypt the cart file and its backups from CART_ENCRYPTION_OLD_KEY to CART_ENCRYPTION_KEY and exit")
+	flag.Parse()
+	slog.SetDefault(newLogger(os.Stderr, os.Getenv("LOG_FORMAT")))
+
+	config = loadConfig()
+	if err := config.Validate(); err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	if err := setUpServices(config); err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	stopEviction := make(chan struct{})
+	stopBackground := sync.OnceFunc(func() { close(stopEviction) })
+	defer stopBackground()
+	searchCache.StartEviction(stopEviction)
+
+	store, persistence, closeStore, err := openCartStore(config, stopEviction)
+	if err != nil {
+		slog.Error("failed to open cart storage", "error", err)
+		os.Exit(1)
+	}
+	var cartLock *FileLock
+	if file, ok := persistence.(*JSONCartFile); ok {
+		if cartLock, err = file.Lock(*waitForLock); err != nil {
+			slog.Error("cart file is in use", "error", err)
+			os.Exit(1)
+		}
+	}
+	if *rotateCartKey {
+		err := rotateCartKeys(persistence)
+		if unlockErr := cartLock.Unlock(); unlockErr != nil {
+			slog.Error("failed to release cart file lock", "error", unlockErr)
+		}
+		if err != nil {
+			slog.Error("failed to rotate cart encryption key", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := loadState(config, persistence, store, stopEviction); err != nil {
+		slog.Error("failed to load server state", "error", err)
+		os.Exit(1)
+	}
+
+	srv := NewServer(store, persistence)
+	s := newMCPServer(config, srv)
+	serverHTTP, httpServer, err := newHTTPServer(config, s, srv)
+	if err != nil {
+		slog.Error("failed to configure TLS", "error", err)
+		os.Exit(1)
+	}
+	var metricsServer *http.Server
+	if config.MetricsPort != "" {
+		metricsServer = startMetricsServer(config.MetricsPort)
+	}
+
+	err = serve(serverHTTP, httpServer, shutdownPlan{
+		timeout:        config.ShutdownTimeout,
+		server:         httpServer,
+		metrics:        metricsServer,
+		stopBackground: stopBackground,
+		persistence:    persistence,
+		closeStore:     closeStore,
+		cartLock:       cartLock,
+	})
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// serve runs the MCP server until it fails or the process gets SIGINT or
+// SIGTERM, and then stops what plan lists.
+func serve(serverHTTP *http.Server, httpServer *server.StreamableHTTPServer, plan shutdownPlan) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if serverHTTP.TLSConfig != nil {
+			slog.Info("MCP server listening with TLS", "addr", serverHTTP.Addr, "client_certs", serverHTTP.TLSConfig.ClientAuth.String())
+			serveErr <- serverHTTP.ListenAndServeTLS("", "")
+			return
+		}
+		slog.Info("MCP server listening", "addr", serverHTTP.Addr)
+		serveErr <- httpServer.Start(serverHTTP.Addr)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("MCP server failed", "error", err)
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	// A second signal kills the process if the shutdown gets stuck.
+	stop()
+	slog.Info("shutdown started", "reason", context.Cause(ctx))
+	return plan.run()
+}
+
+// setUpServices creates the clients and in-memory stores the tools share.
+func setUpServices(cfg *Config) error {
+	cipher, err := parseCartEncryptionKey(os.Getenv("CART_ENCRYPTION_KEY"))
+	if err != nil {
+		return fmt.Errorf("invalid CART_ENCRYPTION_KEY: %w", err)
+	}
+	cartCipher = cipher
+	httpClient = newHTTPClient(cfg.SearchTimeout)
+	searchClient = NewGoogleSearchClient(httpClient, cfg.GoogleAPIKey, cfg.SearchEngineID, cfg.GoogleAPIRPS)
+	if visualSearchClient, err = newVisualSearchClient(cfg.VisualSearchProvider, cfg.VisualSearchAPIKey, httpClient); err != nil {
+		return err
+	}
+	if cfg.DisplayCurrency != "" {
+		currencyConverter = NewCBRFConverter(httpClient)
+	}
+	searchCache = NewSearchCache(cfg.CacheTTL)
+	searchHistory = NewSearchHistory(cfg.SearchHistorySize)
+	cartHistory = NewCartHistory(cfg.CartHistorySize)
+	productRegistry = NewProductRegistry(cfg.ProductRegistrySize)
+	return nil
+}
+
+// openCartStore opens the cart backend of cfg. persistence is where the
+// carts are loaded from and saved to, and closeStore, when set, releases
+// the backend on shutdown. Session carts are swept until stop is closed.
+func openCartStore(cfg *Config, stop <-chan struct{}) (store CartStore, persistence CartPersistence, closeStore func() error, err error) {
+	switch {
+	case cfg.CartScope != cartScopeGlobal && cfg.CartScope != cartScopeSession:
+		return nil, nil, nil, fmt.Errorf("unknown CART_SCOPE %q, supported scopes: global, session", cfg.CartScope)
+	case cfg.CartScope == cartScopeSession && cfg.CartBackend != "memory":
+		return nil, nil, nil, fmt.Errorf("CART_SCOPE=session keeps carts in memory and requires CART_BACKEND=memory, got %q", cfg.CartBackend)
+	}
+
+	switch cfg.CartBackend {
+	case "memory":
+		file := NewJSONCartFile(os.Getenv("CART_FILE"))
+		memoryStore := NewMemoryCartStore(carts)
+		memoryStore.persistence = file
+		cartVersions = memoryStore.versions
+		if cfg.CartScope == cartScopeSession {
+			sessionCarts = NewSessionCartStore(cfg.CartSessionTTL)
+			sessionCarts.StartSweeping(stop)
+			memoryStore.sessions = sessionCarts
+		}
+		return memoryStore, file, nil, nil
+	case "sqlite":
+		sqliteStore, err := NewSQLiteCartStore(cfg.CartDBPath, carts)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to open cart database: %w", err)
+		}
+		return sqliteStore, sqliteStore, sqliteStore.Close, nil
+	case "redis":
+		redisStore, err := NewRedisCartStore(cfg.RedisURL, cfg.RedisKeyPrefix, cfg.RedisCartTTL, carts)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return redisStore, NewJSONCartFile(os.Getenv("CART_FILE")), redisStore.Close, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown CART_BACKEND %q, supported backends: memory, sqlite, redis", cfg.CartBackend)
+	}
+}
+
+// rotateCartKeys re-encrypts the cart file and its backups from
+// CART_ENCRYPTION_OLD_KEY to the current key.
+func rotateCartKeys(persistence CartPersistence) error {
+	file, ok := persistence.(*JSONCartFile)
+	if !ok {
+		return fmt.Errorf("-rotate-cart-key only applies to the cart file, the %s backend is not encrypted", config.CartBackend)
+	}
+	oldCipher, err := parseCartEncryptionKey(os.Getenv("CART_ENCRYPTION_OLD_KEY"))
+	if err != nil {
+		return fmt.Errorf("invalid CART_ENCRYPTION_OLD_KEY: %w", err)
+	}
+	rotated, err := rotateCartEncryption(file.path, cartBackupsDir(os.Getenv("CART_FILE")), oldCipher, cartCipher)
+	if err != nil {
+		return fmt.Errorf("rotated %d files: %w", rotated, err)
+	}
+	slog.Info("cart encryption key rotated", "files", rotated, "encrypted", cartCipher != nil)
+	return nil
+}
+
+// loadState reads the carts, wishlists, saved searches and price alerts
+// saved by the previous run and starts the price alert and backup tasks,
+// which run until stop is closed.
+func loadState(cfg *Config, persistence CartPersistence, store CartStore, stop <-chan struct{}) error {
+	// The wishlists exist before the cart file is read, since cart files
+	// written before wishlists.json keep the default wishlist in "saved".
+	wishlists = NewWishlistStore(wishlistsPath(os.Getenv("CART_FILE")))
+	if err := persistence.Load(); err != nil {
+		return fmt.Errorf("failed to load cart: %w", err)
+	}
+	if redisStore, ok := store.(*RedisCartStore); ok {
+		if err := redisStore.Sync(context.Background()); err != nil {
+			slog.Warn("cart storage not reachable at startup, cart tools will fail until it is", "error", err)
+		}
+	}
+	if err := wishlists.Load(); err != nil {
+		return fmt.Errorf("failed to load wishlists: %w", err)
+	}
+	savedSearches = NewSavedSearchStore(savedSearchesPath(os.Getenv("CART_FILE")))
+	if err := savedSearches.Load(); err != nil {
+		return fmt.Errorf("failed to load saved searches: %w", err)
+	}
+	priceAlerts = NewPriceAlertStore(priceAlertsPath(os.Getenv("CART_FILE")))
+	if err := priceAlerts.Load(); err != nil {
+		return fmt.Errorf("failed to load price alerts: %w", err)
+	}
+	priceAlerts.StartChecking(cfg.PriceAlertInterval, stop)
+	if cfg.CartBackupKeep > 0 {
+		cartBackups = NewCartBackups(cartBackupsDir(os.Getenv("CART_FILE")), cfg.CartBackupKeep)
+		if cfg.CartBackupInterval > 0 {
+			cartBackups.StartPeriodic(cfg.CartBackupInterval, stop)
+		}
+	}
+	return nil
+}
+
+// newMCPServer creates the MCP server with every tool, resource and prompt,
+// all working on the carts of srv.
+func newMCPServer(cfg *Config, srv *Server) *server.MCPServer {
+	s := server.NewMCPServer(
+		serverName,
+		serverVersion,
+		server.WithLogging(),
+		server.WithToolCapabilities(true),
+		server.WithToolHandlerMiddleware(traceToolCalls),
+		server.WithToolHandlerMiddleware(logToolCalls),
+		server.WithResourceCapabilities(true, true),
+		server.WithPromptCapabilities(true),
+		server.WithHooks(sessionCartHooks()),
+	)
+	registerCartResource(s, srv)
+	registerCartHistoryResource(s)
+	registerPrompts(s)
+	RegisterAllTools(s, cfg, srv)
+	return s
+}
+
+// newHTTPServer serves s over streamable HTTP on cfg.ListenAddr, with TLS
+// when cfg enables it, next to the health endpoint of srv.
+func newHTTPServer(cfg *Config, s *server.MCPServer, srv *Server) (*http.Server, *server.StreamableHTTPServer, error) {
+	serverHTTP := &http.Server{Addr: cfg.ListenAddr}
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := cfg.TLS.ServerConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+		serverHTTP.TLSConfig = tlsConfig
+	}
+	httpServer := server.NewStreamableHTTPServer(s, server.WithStreamableHTTPServer(serverHTTP))
+	serverHTTP.Handler = newHTTPHandler(httpServer, srv)
+	return serverHTTP, httpServer, nil
+}
+
+func handleSearchProducts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	query, ok := args["query"].(string)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "query parameter is required and must be a string"},
+			},
+		}, nil
+	}
+
+	numResults := searchPageSize
+	if num, ok := args["num_results"].(float64); ok {
+		numResults = min(max(int(num), 1), config.MaxSearchResults)
+	}
+
+	start := 1
+	if num, ok := args["start"].(float64); ok {
+		start = int(num)
+		if start < 1 {
+			start = 1
+		}
+	}
+
+	minPrice, hasMinPrice := args["min_price"].(float64)
+	maxPrice, hasMaxPrice := args["max_price"].(float64)
+	if hasMinPrice && hasMaxPrice && minPrice > maxPrice {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "min_price must not be greater than max_price"},
+			},
+		}, nil
+	}
+
+	sortBy := "relevance"
+	if value, ok := args["sort_by"].(string); ok && value != "" {
+		if !slices.Contains(searchSortOrders, value) {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: fmt.Sprintf("sort_by must be one of: %s", strings.Join(searchSortOrders, ", "))},
+				},
+			}, nil
+		}
+		sortBy = value
+	}
+
+	searchQuery := query
+	siteFilter := ""
+	if value, present := args["site"]; present && value != nil {
+		site, ok := value.(string)
+		site = strings.ToLower(strings.TrimSpace(site))
+		if !ok || !isHostname(site) {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: "site parameter must be a domain name such as megamarket.ru"},
+				},
+			}, nil
+		}
+		searchQuery = fmt.Sprintf("%s site:%s", query, site)
+		siteFilter = fmt.Sprintf("\n🌐 Только сайт: %s", site)
+	}
+
+	includeImages, _ := args["include_images"].(bool)
+
+	category, _ := args["category"].(string)
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category != "" {
+		siteFilter += fmt.Sprintf("\n🗂️ Категория: %s", category)
+	}
+
+	engineID, err := config.searchEngineFor(category)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	safe := config.SafeSearch
+	if adultContent, ok := args["adult_content"].(bool); ok {
+		safe = safeSearchActive
+		if adultContent {
+			safe = safeSearchOff
+		}
+	}
+	if safe == safeSearchOff {
+		siteFilter += "\n🔞 Безопасный поиск выключен"
+	}
+
+	language, country, err := searchLocaleFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if language != "" {
+		siteFilter += fmt.Sprintf("\n🗣️ Язык: %s", language)
+	}
+	if country != "" {
+		siteFilter += fmt.Sprintf("\n📍 Страна: %s", country)
+	}
+
+	searchResponse, err := searchProducts(ctx, searchQuery, SearchParams{
+		NumResults: numResults,
+		Start:      start,
+		EngineID:   engineID,
+		Safe:       safe,
+		Language:   language,
+		Country:    country,
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Search failed: %v", err)},
+			},
+		}, nil
+	}
+
+	fetched := len(searchResponse.Items)
+	priceFilter := ""
+	if hasMinPrice || hasMaxPrice {
+		searchResponse.Items = filterByPrice(searchResponse.Items, minPrice, hasMinPrice, maxPrice, hasMaxPrice)
+		priceFilter = fmt.Sprintf("\n💰 Фильтр по цене: осталось %d из %d результатов", len(searchResponse.Items), fetched)
+	}
+	sortNote := ""
+	if sortBy != "relevance" {
+		if unpriced := sortByPrice(searchResponse.Items, sortBy == "price_desc"); unpriced > 0 {
+			sortNote = fmt.Sprintf("\n⚠️ У %d результатов не удалось определить цену, они показаны в конце", unpriced)
+		}
+	}
+
+	lastSearches.Save(sessionIDFromContext(ctx), searchResponse.Items)
+	productRegistry.Add(searchResponse.Items)
+	searchHistory.Add(SearchHistoryEntry{
+		Query:        searchQuery,
+		Results:      len(searchResponse.Items),
+		TotalResults: searchResponse.SearchInformation.TotalResults,
+		SearchedAt:   time.Now(),
+	})
+
+	totalResults := searchResponse.SearchInformation.TotalResults
+	searchTime := searchResponse.SearchInformation.SearchTime
+
+	finalResult := fmt.Sprintf(`🔍 Результаты поиска для "%s"
+📊 Найдено: %s результатов за %.2f секунд%s%s%s
+📋 Показаны результаты %s:
+
+%s
+
+💡 Используйте add_result_to_cart с номером товара или add_to_cart с ID товара для добавления в корзину`,
+		query, totalResults, searchTime, siteFilter, priceFilter, sortNote, resultsRange(start, fetched), formatSearchItems(searchResponse.Items, includeImages))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: finalResult},
+		},
+	}, nil
+}
+
+func (s *Server) handleAddToCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	lines, err := s.store.List(ctx, cartName)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	input, err := parseCartItemInput(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	line := input.line(lines)
+	itemID, count := line.ID, input.Quantity
+
+	existing, exists, err := s.store.Get(ctx, cartName, itemID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if !exists && input.Title == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "title parameter is required when adding a new item to the cart"},
+			},
+		}, nil
+	}
+
+	var similar []*CartItem
+	if !exists {
+		similar = findSimilarCartItems(lines, itemID, input.Title, input.Shop)
+	}
+
+	quantity, err := s.store.Add(ctx, cartName, line, count)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart item added", "cart", cartName, "item_id", itemID, "count", count, "quantity", quantity)
+
+	var result string
+	if exists {
+		result = fmt.Sprintf(`🔁 Товар уже был в корзине%s, количество увеличено
+📦 %s
+🔢 Количество в корзине: %d (было %d)
+🆔 ID: %s%s
+
+💡 Используйте view_cart для просмотра корзины`,
+			cartLabel(cartName), existing.Title, quantity, existing.Quantity, itemID, input.priceWarning()+s.budgetWarning(ctx, cartName))
+	} else {
+		warnings := ""
+		for _, item := range similar {
+			warnings += fmt.Sprintf("\n⚠️ В корзине уже есть похожий товар из %s: %s × %d (ID: %s)", item.Shop, item.Title, item.Quantity, item.ID)
+		}
+		result = fmt.Sprintf(`✅ Товар добавлен в корзину%s
+📦 %s
+🔢 Количество в корзине: %d
+🆔 ID: %s%s
+
+💡 Используйте view_cart для просмотра корзины`,
+			cartLabel(cartName), input.Title, quantity, itemID, input.priceWarning()+warnings+s.budgetWarning(ctx, cartName))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+// cartItemInput is one item as described by the add_to_cart arguments.
+type cartItemInput struct {
+	ID          string
+	Title       string
+	Link        string
+	Price       string
+	Shop        string
+	Description string
+	Quantity    int
+}
+
+func parseCartItemInput(args map[string]any) (cartItemInput, error) {
+	fields := make(map[string]string)
+	for _, name := range []string{"item_id", "title", "link", "price", "shop", "description"} {
+		value, present := args[name]
+		if !present || value == nil {
+			continue
+		}
+		str, ok := value.(string)
+		if !ok {
+			return cartItemInput{}, fmt.Errorf("%s parameter must be a string", name)
+		}
+		fields[name] = strings.TrimSpace(str)
+	}
+
+	input := cartItemInput{
+		ID:          fields["item_id"],
+		Title:       fields["title"],
+		Link:        fields["link"],
+		Price:       fields["price"],
+		Shop:        fields["shop"],
+		Description: fields["description"],
+		Quantity:    1,
+	}
+	if value, present := args["quantity"]; present && value != nil {
+		num, ok := value.(float64)
+		if !ok || num != float64(int(num)) || num < 1 {
+			return cartItemInput{}, errors.New("quantity parameter must be a positive integer")
+		}
+		input.Quantity = int(num)
+	}
+	if err := input.validate(); err != nil {
+		return cartItemInput{}, err
+	}
+	return input, nil
+}
+
+// line returns the cart line that adding input makes, given the lines already
+// in the cart: a product page that is in the cart under another URL goes to
+// that line, and the image comes from the search results.
+func (input *cartItemInput) line(items []*CartItem) CartItem {
+	itemID := cartLineID(items, input.ID, input.Link)
+	var image string
+	if found, ok := productRegistry.Get(itemID); ok {
+		image = found.Image()
+	}
+	return CartItem{
+		ID:          itemID,
+		Title:       input.Title,
+		Link:        input.Link,
+		Price:       input.Price,
+		Shop:        input.Shop,
+		Description: input.Description,
+		Image:       image,
+	}
+}
+
+func (s *Server) handleAddItems(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	rawItems, ok := args["items"].([]any)
+	if !ok || len(rawItems) == 0 || len(rawItems) > maxBatchItems {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("items parameter is required and must be an array of 1 to %d items", maxBatchItems)},
+			},
+		}, nil
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	inputs := make([]cartItemInput, 0, len(rawItems))
+	for i, raw := range rawItems {
+		itemArgs, ok := raw.(map[string]any)
+		if !ok {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: fmt.Sprintf("items[%d] must be an object", i)},
+				},
+			}, nil
+		}
+		input, err := parseCartItemInput(itemArgs)
+		if err != nil {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: fmt.Sprintf("items[%d]: %v", i, err)},
+				},
+			}, nil
+		}
+		inputs = append(inputs, input)
+	}
+
+	var added, merged int
+	var lines []string
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		// Each entry is resolved against the cart and the entries before it,
+		// so two URLs of one product page in a batch share a line.
+		current := c.Snapshot()
+		batch := make([]CartItem, len(inputs))
+		for i, input := range inputs {
+			batch[i] = input.line(current)
+			batch[i].Quantity = input.Quantity
+			current = append(current, &batch[i])
+		}
+		if added, merged, err = addItems(ctx, c, batch); err != nil {
+			return err
+		}
+		for i, input := range inputs {
+			item, _ := c.Get(batch[i].ID)
+			lines = append(lines, fmt.Sprintf("• %s +%d, в корзине: %d (ID: %s)%s", item.Title, input.Quantity, item.Quantity, item.ID, input.priceWarning()))
+		}
+		return nil
+	})
+	var notFound *CartNotFoundError
+	if errors.As(err, &notFound) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("No items were added: %v", err)},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart items added", "cart", cartName, "items", len(inputs), "added", added, "merged", merged)
+
+	result := fmt.Sprintf(`✅ Добавлено в корзину%s: %d
+🆕 Новых позиций: %d
+🔁 Объединено с уже имеющимися: %d
+
+%s
+
+💡 Используйте view_cart для просмотра корзины`,
+		cartLabel(cartName), len(inputs), added, merged, strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleSearchCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	query, ok := args["query"].(string)
+	query = strings.TrimSpace(query)
+	if !ok || query == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "query parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	items, err := s.store.List(ctx, cartName)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	matches := searchCart(items, query)
+	if len(matches) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🔍 В корзине%s нет товаров по запросу \"%s\"", cartLabel(cartName), query)},
+			},
+		}, nil
+	}
+
+	var lines []string
+	for _, item := range matches {
+		lines = append(lines, fmt.Sprintf("• %s%s × %d — %s (ID: %s)", priorityMarker(item.Priority), item.Title, item.Quantity, item.Shop, item.ID))
+	}
+	result := fmt.Sprintf("🔍 Найдено в корзине%s по запросу \"%s\": %d\n\n%s", cartLabel(cartName), query, len(matches), strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleViewCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+
+	sortBy := "added"
+	if value, ok := args["sort"].(string); ok && value != "" {
+		if !slices.Contains(cartSortOrders, value) {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: fmt.Sprintf("sort must be one of: %s", strings.Join(cartSortOrders, ", "))},
+				},
+			}, nil
+		}
+		sortBy = value
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	var cartItems []*CartItem
+	var budget Budget
+	var now time.Time
+	err = s.store.View(ctx, cartName, func(c *Cart) error {
+		cartItems, budget, now = c.Snapshot(), c.Budget(), c.now()
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	sortCartItems(cartItems, sortBy)
+
+	if len(cartItems) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🛒 Корзина%s пуста", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	filters, err := cartFiltersFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	filterLine := ""
+	if filters.active() {
+		unfiltered := len(cartItems)
+		cartItems = filters.apply(cartItems)
+		filterLine = fmt.Sprintf("\n🔎 Фильтры: %s — найдено %d из %d позиций", filters, len(cartItems), unfiltered)
+	}
+
+	cartItems, expiredItems := splitExpired(cartItems, now)
+
+	totalItems := 0
+	for _, item := range cartItems {
+		totalItems += item.Quantity
+	}
+	totals, unpriced := priceTotals(cartItems)
+
+	page, pageSize := 1, defaultCartPageSize
+	if num, ok := args["page"].(float64); ok && num >= 1 {
+		page = int(num)
+	}
+	if num, ok := args["page_size"].(float64); ok && num >= 1 {
+		pageSize = min(int(num), maxCartPageSize)
+	}
+	// Grouping happens before paging, so a page continues the shop groups
+	// of the previous one instead of regrouping only its own items.
+	groupByShop, _ := args["group_by_shop"].(bool)
+	var groups []*shopGroup
+	if groupByShop {
+		groups = groupCartByShop(cartItems)
+		cartItems = cartItems[:0:0]
+		for _, group := range groups {
+			cartItems = append(cartItems, group.Items...)
+		}
+	}
+
+	first := min((page-1)*pageSize, len(cartItems))
+	last := min(first+pageSize, len(cartItems))
+	pageItems := cartItems[first:last]
+
+	var body string
+	switch {
+	case len(pageItems) == 0:
+		body = fmt.Sprintf("📭 На странице %d товаров нет", page)
+	case groupByShop:
+		body = formatCartByShop(groups, pageItems, now)
+	default:
+		var items []string
+		for _, item := range pageItems {
+			items = append(items, formatCartItem(item, now))
+		}
+		body = strings.Join(items, "\n")
+	}
+	// Expired lines are not paged, so they are listed once, on the first page.
+	if len(expiredItems) > 0 && page == 1 {
+		body += "\n\n" + formatExpiredItems(expiredItems)
+	}
+
+	shown := fmt.Sprintf("%d–%d из %d", first+1, last, len(cartItems))
+	if len(pageItems) == 0 {
+		shown = fmt.Sprintf("0 из %d", len(cartItems))
+	}
+
+	footer := "💡 Используйте remove_from_cart с ID для удаления товара"
+	if last < len(cartItems) {
+		nextArgs := fmt.Sprintf("page=%d, page_size=%d", page+1, pageSize)
+		if sortBy != "added" {
+			nextArgs += fmt.Sprintf(", sort=%s", sortBy)
+		}
+		if groupByShop {
+			nextArgs += ", group_by_shop=true"
+		}
+		nextArgs += filters.args()
+		if cartName != defaultCartName {
+			nextArgs += fmt.Sprintf(", cart=%q", cartName)
+		}
+		footer = fmt.Sprintf("📄 Следующая страница: view_cart с %s\n%s", nextArgs, footer)
+	}
+
+	total := "не удалось рассчитать"
+	if len(totals) > 0 {
+		total = formatGroupedTotals(totals)
+	}
+	if unpriced > 0 {
+		total += fmt.Sprintf("\nℹ️ Позиций без распознанной цены: %d, они не учтены в итоге", unpriced)
+	}
+	if line := convertedTotalLine(ctx, totals); line != "" {
+		total += "\n" + line
+	}
+	if line := budgetLine(totals, budget); line != "" {
+		total += "\n" + line
+	}
+
+	result := fmt.Sprintf(`🛒 Ваша корзина%s%s
+📊 Всего товаров: %d (уникальных: %d)
+📋 Показаны позиции %s
+
+%s
+
+💰 Итого: %s
+
+%s`,
+		cartLabel(cartName), filterLine, totalItems, len(cartItems), shown, body, total, footer)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+// convertedTotalLine renders the cart total in config.DisplayCurrency, or an
+// empty string when no display currency is configured or the totals are
+// already in it.
+func convertedTotalLine(ctx context.Context, totals map[string]float64) string {
+	to := config.DisplayCurrency
+	if to == "" || currencyConverter == nil || len(totals) == 0 {
+		return ""
+	}
+	if _, only := totals[to]; only && len(totals) == 1 {
+		return ""
+	}
+
+	sum, skipped, err := convertTotals(currencyConverter, totals, to)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to convert cart total", "currency", to, "error", err)
+		return fmt.Sprintf("💱 Пересчёт в %s недоступен", to)
+	}
+	line := fmt.Sprintf("💱 В пересчёте: ≈ %.2f %s", sum, to)
+	if len(skipped) > 0 {
+		line += fmt.Sprintf(" (без учёта сумм в валютах: %s)", strings.Join(currencyLabels(skipped), ", "))
+	}
+	return line
+}
+
+// currencyLabels names currencies for output, including sums whose currency
+// could not be recognized.
+func currencyLabels(currencies []string) []string {
+	labels := make([]string, len(currencies))
+	for i, currency := range currencies {
+		labels[i] = cmp.Or(currency, "не указана")
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+type cartFilters struct {
+	Shop          string
+	TitleContains string
+	Tag           string
+}
+
+func cartFiltersFromArgs(args map[string]any) (cartFilters, error) {
+	var filters cartFilters
+	for name, target := range map[string]*string{"shop": &filters.Shop, "title_contains": &filters.TitleContains, "tag": &filters.Tag} {
+		value, present := args[name]
+		if !present || value == nil {
+			continue
+		}
+		str, ok := value.(string)
+		if !ok {
+			return cartFilters{}, fmt.Errorf("%s parameter must be a string", name)
+		}
+		*target = strings.TrimSpace(str)
+	}
+	filters.Tag = normalizeTag(filters.Tag)
+	return filters, nil
+}
+
+func (f cartFilters) active() bool {
+	return f.Shop != "" || f.TitleContains != "" || f.Tag != ""
+}
+
+func (f cartFilters) matches(item *CartItem) bool {
+	if f.Shop != "" && !strings.Contains(strings.ToLower(item.Shop), strings.ToLower(f.Shop)) {
+		return false
+	}
+	if f.TitleContains != "" && !strings.Contains(strings.ToLower(item.Title), strings.ToLower(f.TitleContains)) {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(item.Tags, f.Tag) {
+		return false
+	}
+	return true
+}
+
+func (f cartFilters) apply(items []*CartItem) []*CartItem {
+	var filtered []*CartItem
+	for _, item := range items {
+		if f.matches(item) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+func (f cartFilters) String() string {
+	var parts []string
+	if f.Shop != "" {
+		parts = append(parts, fmt.Sprintf("магазин «%s»", f.Shop))
+	}
+	if f.TitleContains != "" {
+		parts = append(parts, fmt.Sprintf("название содержит «%s»", f.TitleContains))
+	}
+	if f.Tag != "" {
+		parts = append(parts, fmt.Sprintf("тег «%s»", f.Tag))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// args renders the filters as view_cart arguments for the next-page hint.
+func (f cartFilters) args() string {
+	var result string
+	if f.Shop != "" {
+		result += fmt.Sprintf(", shop=%q", f.Shop)
+	}
+	if f.TitleContains != "" {
+		result += fmt.Sprintf(", title_contains=%q", f.TitleContains)
+	}
+	if f.Tag != "" {
+		result += fmt.Sprintf(", tag=%q", f.Tag)
+	}
+	return result
+}
+
+// formatCartItem renders one cart line; times are shown relative to now.
+func formatCartItem(item *CartItem, now time.Time) string {
+	note := ""
+	if item.Note != "" {
+		note = fmt.Sprintf("\n🗒️ Заметка: %s", item.Note)
+	}
+	if len(item.Tags) > 0 {
+		note += fmt.Sprintf("\n🏷️ Теги: %s", strings.Join(item.Tags, ", "))
+	}
+
+	return fmt.Sprintf(`📦 %s%s
+🏪 Магазин: %s
+💰 Цена: %s%s
+🔢 Количество: %d
+🧮 Сумма: %s
+🔗 Ссылка: %s
+🆔 ID: %s%s%s
+---`,
+		priorityMarker(item.Priority),
+		item.Title,
+		item.Shop,
+		item.Price,
+		formatTarget(item),
+		item.Quantity,
+		formatSubtotal(item),
+		item.Link,
+		item.ID,
+		note,
+		formatItemTimes(item, now))
+}
+
+// formatSubtotal renders price × quantity of a cart line, or "—" when its
+// price could not be parsed.
+func formatSubtotal(item *CartItem) string {
+	price, ok := item.ParsedPrice()
+	if !ok {
+		return "—"
+	}
+	price.Amount *= float64(item.Quantity)
+	return price.Grouped()
+}
+
+// formatItemTimes renders when an item was added and last changed relative to now.
+func formatItemTimes(item *CartItem, now time.Time) string {
+	if item.AddedAt.IsZero() {
+		return ""
+	}
+	result := fmt.Sprintf("\n🕒 Добавлено %s", formatRelativeTime(item.AddedAt, now))
+	if item.UpdatedAt.Sub(item.AddedAt) >= time.Minute {
+		result += fmt.Sprintf(", изменено %s", formatRelativeTime(item.UpdatedAt, now))
+	}
+	return result
+}
+
+// formatRelativeTime renders a past moment in Russian, e.g. "3 дня назад".
+func formatRelativeTime(t, now time.Time) string {
+	elapsed := now.Sub(t)
+	switch {
+	case elapsed < time.Minute:
+		return "только что"
+	case elapsed < time.Hour:
+		return pluralize(int(elapsed/time.Minute), "минуту", "минуты", "минут") + " назад"
+	case elapsed < 24*time.Hour:
+		return pluralize(int(elapsed/time.Hour), "час", "часа", "часов") + " назад"
+	case elapsed < 30*24*time.Hour:
+		return pluralize(int(elapsed/(24*time.Hour)), "день", "дня", "дней") + " назад"
+	default:
+		return t.Format("02.01.2006")
+	}
+}
+
+// pluralize picks the Russian plural form for n: 1 день, 2 дня, 5 дней.
+func pluralize(n int, one, few, many string) string {
+	form := many
+	switch mod10, mod100 := n%10, n%100; {
+	case mod10 == 1 && mod100 != 11:
+		form = one
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		form = few
+	}
+	return fmt.Sprintf("%d %s", n, form)
+}
+
+type shopGroup struct {
+	Shop     string
+	Items    []*CartItem
+	Quantity int
+	// Totals holds the sums per currency; currencies are never added together.
+	Totals   map[string]float64
+	Unpriced int
+}
+
+// groupCartByShop groups items by shop, shops with the largest subtotal
+// first and items without a shop at the very end. Subtotals are compared
+// currency by currency in alphabetical order of the currencies.
+func groupCartByShop(cartItems []*CartItem) []*shopGroup {
+	groups := make(map[string]*shopGroup)
+	for _, item := range cartItems {
+		group, exists := groups[item.Shop]
+		if !exists {
+			group = &shopGroup{Shop: item.Shop}
+			groups[item.Shop] = group
+		}
+		group.Items = append(group.Items, item)
+		group.Quantity += item.Quantity
+	}
+
+	sorted := make([]*shopGroup, 0, len(groups))
+	for _, group := range groups {
+		group.Totals, group.Unpriced = priceTotals(group.Items)
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if (a.Shop == "") != (b.Shop == "") {
+			return b.Shop == ""
+		}
+		if c := compareTotals(a.Totals, b.Totals); c != 0 {
+			return c > 0
+		}
+		return a.Shop < b.Shop
+	})
+	return sorted
+}
+
+// compareTotals orders per-currency sums by the first currency, in
+// alphabetical order, in which they differ.
+func compareTotals(a, b map[string]float64) int {
+	var currencies []string
+	for currency := range a {
+		currencies = append(currencies, currency)
+	}
+	for currency := range b {
+		if _, ok := a[currency]; !ok {
+			currencies = append(currencies, currency)
+		}
+	}
+	slices.Sort(currencies)
+	for _, currency := range currencies {
+		if c := cmp.Compare(a[currency], b[currency]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// formatCartByShop renders the items of one page under the headers of their
+// shop groups. The groups are those of the whole cart, so a header shows
+// the shop's full quantity and subtotal even when its items span pages.
+func formatCartByShop(groups []*shopGroup, pageItems []*CartItem, now time.Time) string {
+	onPage := make(map[*CartItem]bool, len(pageItems))
+	for _, item := range pageItems {
+		onPage[item] = true
+	}
+
+	var sections []string
+	for _, group := range groups {
+		var items []string
+		for _, item := range group.Items {
+			if onPage[item] {
+				items = append(items, formatCartItem(item, now))
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+
+		name := group.Shop
+		if name == "" {
+			name = "Unknown shop"
+		}
+		subtotal := "не удалось рассчитать"
+		if len(group.Totals) > 0 {
+			subtotal = formatGroupedTotals(group.Totals)
+		}
+		if group.Unpriced > 0 {
+			subtotal += fmt.Sprintf(" (без цены: %d)", group.Unpriced)
+		}
+		shown := ""
+		if len(items) < len(group.Items) {
+			shown = fmt.Sprintf(", на этой странице: %d", len(items))
+		}
+		sections = append(sections, fmt.Sprintf(`🏪 %s — товаров: %d (позиций: %d%s), сумма: %s
+
+%s`,
+			name, group.Quantity, len(group.Items), shown, subtotal, strings.Join(items, "\n")))
+	}
+	return strings.Join(sections, "\n\n")
+}
+
+func (s *Server) handleGetCartItem(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	itemID, ok := args["item_id"].(string)
+	if !ok || strings.TrimSpace(itemID) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	itemID = strings.TrimSpace(itemID)
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	item, found, err := s.store.Get(ctx, cartName, itemID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if !found {
+		text := fmt.Sprintf("Item %s not found in cart%s", itemID, cartLabel(cartName))
+		lines, _ := s.store.List(ctx, cartName)
+		if matches := closeCartMatches(lines, itemID); len(matches) > 0 {
+			text += ". Did you mean:\n" + strings.Join(matches, "\n")
+		}
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: text},
+			},
+		}, nil
+	}
+
+	record, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cart item: %w", err)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: formatCartItemDetails(&item)},
+			mcp.EmbeddedResource{
+				Type: "resource",
+				Resource: mcp.TextResourceContents{
+					URI:      "cart://items/" + url.PathEscape(item.ID),
+					MIMEType: "application/json",
+					Text:     string(record),
+				},
+			},
+		},
+	}, nil
+}
+
+// formatCartItemDetails renders every stored field of an item, unlike the
+// compact formatCartItem used in cart listings.
+func formatCartItemDetails(item *CartItem) string {
+	parsed := "не распознана"
+	if price, ok := item.ParsedPrice(); ok {
+		parsed = price.Normalized()
+	}
+	note, tags, image := "—", "—", "—"
+	if item.Note != "" {
+		note = item.Note
+	}
+	if item.Image != "" {
+		image = item.Image
+	}
+	if len(item.Tags) > 0 {
+		tags = strings.Join(item.Tags, ", ")
+	}
+	added, updated := "—", "—"
+	if !item.AddedAt.IsZero() {
+		added = item.AddedAt.Format(time.RFC3339)
+		updated = item.UpdatedAt.Format(time.RFC3339)
+	}
+
+	return fmt.Sprintf(`📦 %s
+🆔 ID: %s
+🔗 Ссылка: %s
+🖼️ Изображение: %s
+🏪 Магазин: %s
+💰 Цена: %s (распознано: %s)
+🔢 Количество: %d
+⭐ Приоритет: %s
+📝 Описание: %s
+🗒️ Заметка: %s
+🏷️ Теги: %s
+🕒 Добавлено: %s
+✏️ Изменено: %s`,
+		item.Title, item.ID, item.Link, image, item.Shop, item.Price, parsed, item.Quantity,
+		item.Priority, item.Description, note, tags, added, updated)
+}
+
+// closeCartMatches suggests cart IDs for an unknown one: IDs it is a prefix
+// of (a truncated ID), IDs that are a prefix of it (extra characters), and
+// items whose shop matches the beginning of the ID, as older IDs started
+// with the shop's DisplayLink.
+func closeCartMatches(items []*CartItem, itemID string) []string {
+	var matches []string
+	for _, item := range items {
+		if strings.HasPrefix(item.ID, itemID) || strings.HasPrefix(itemID, item.ID) ||
+			(item.Shop != "" && strings.HasPrefix(itemID, item.Shop)) {
+			matches = append(matches, fmt.Sprintf("%s — %s", item.ID, item.Title))
+		}
+	}
+	return matches
+}
+
+var cartActionNames = map[string]string{
+	"add":              "добавление товара",
+	"add_items":        "добавление нескольких товаров",
+	"remove":           "удаление товара",
+	"set_quantity":     "изменение количества",
+	"clear":            "очистка корзины",
+	"restore":          "восстановление товара",
+	"merge":            "объединение корзин",
+	"copy":             "копирование корзины",
+	"import":           "импорт корзины",
+	"restore_snapshot": "восстановление снимка корзины",
+	"undo":             "отмена изменения",
+	"move_to_saved":    "перенос в отложенные",
+	"move_to_cart":     "перенос из отложенных",
+	"set_note":         "изменение заметки",
+	"tag":              "изменение тегов",
+	"set_priority":     "изменение приоритета",
+	"set_target_price": "изменение целевой цены",
+	"dedupe":           "объединение повторяющихся товаров",
+	"prune_expired":    "удаление устаревших товаров",
+}
+
+func (s *Server) handleUndoCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var action string
+	var changes []undoneChange
+	var ok bool
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		action, changes, ok = c.Undo(ctx)
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if !ok {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("↩️ Нечего отменять: изменений корзины%s пока не было", cartLabel(cartName))},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart mutation undone", "cart", cartName, "action", action, "items", len(changes))
+
+	var lines []string
+	for _, change := range changes {
+		switch {
+		case change.Restored == nil:
+			lines = append(lines, fmt.Sprintf("• убран %s (ID: %s)", change.Discarded.Title, change.ID))
+		case change.Discarded == nil:
+			lines = append(lines, fmt.Sprintf("• возвращён %s × %d (ID: %s)", change.Restored.Title, change.Restored.Quantity, change.ID))
+		default:
+			lines = append(lines, fmt.Sprintf("• %s: количество %d → %d (ID: %s)", change.Restored.Title, change.Discarded.Quantity, change.Restored.Quantity, change.ID))
+		}
+	}
+
+	name := cartActionNames[action]
+	if name == "" {
+		name = action
+	}
+	result := fmt.Sprintf("↩️ Отменено: %s\n\n%s", name, strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleCreateCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+
+	if err := s.store.CreateCart(ctx, name); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart created", "cart", name)
+
+	result := fmt.Sprintf(`🆕 Корзина «%s» создана
+
+💡 Передавайте cart="%s" в add_to_cart, view_cart и другие инструменты корзины`,
+		name, name)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleListCarts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	names, err := s.store.Carts(ctx)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	var lines []string
+	for _, name := range names {
+		items, err := s.store.List(ctx, name)
+		if err != nil {
+			// Deleted since Carts was read.
+			continue
+		}
+		totalQuantity := 0
+		for _, item := range items {
+			totalQuantity += item.Quantity
+		}
+		lines = append(lines, fmt.Sprintf("• %s — позиций: %d, товаров: %d", name, len(items), totalQuantity))
+	}
+	result := fmt.Sprintf("🛒 Корзины (%d):\n\n%s\n\n💡 copy_cart создаёт копию корзины, например из шаблона для регулярного заказа", len(lines), strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleDeleteCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+	confirm, _ := args["confirm"].(bool)
+
+	uniqueItems, err := s.store.DeleteCart(ctx, name, confirm)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart deleted", "cart", name, "items", uniqueItems)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: fmt.Sprintf("🗑️ Корзина «%s» удалена (позиций: %d)", name, uniqueItems)},
+		},
+	}, nil
+}
+
+func (s *Server) handleMergeCarts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	source, _ := args["source"].(string)
+	source = strings.TrimSpace(source)
+	target, _ := args["target"].(string)
+	target = strings.TrimSpace(target)
+	keepSource, _ := args["keep_source"].(bool)
+
+	if source == target {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("cannot merge cart %q into itself", source)},
+			},
+		}, nil
+	}
+	var moved, merged int
+	err := s.store.Update(ctx, []string{source, target}, func(carts []*Cart) (err error) {
+		moved, merged, err = mergeCarts(ctx, carts[0], carts[1], keepSource)
+		return err
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "carts merged", "source", source, "target", target, "moved", moved, "merged", merged, "keep_source", keepSource)
+
+	if moved+merged == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("ℹ️ Корзина «%s» пуста, переносить нечего", source)},
+			},
+		}, nil
+	}
+
+	verb := "перенесены"
+	if keepSource {
+		verb = "скопированы"
+	}
+	result := fmt.Sprintf(`🔀 Товары из корзины «%s» %s в корзину «%s»
+
+📦 Новых позиций: %d
+➕ Объединено с существующими: %d`,
+		source, verb, target, moved, merged)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleCopyCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	source, _ := args["source"].(string)
+	source = strings.TrimSpace(source)
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+	overwrite, _ := args["overwrite"].(bool)
+
+	lines, replaced, err := s.copyCart(ctx, source, name, overwrite)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart copied", "source", source, "cart", name, "items", lines, "replaced", replaced)
+
+	action := "создана"
+	if replaced {
+		action = "заменена"
+	}
+	result := fmt.Sprintf(`📋 Корзина «%s» %s копией корзины «%s»
+
+📦 Скопировано позиций: %d
+
+💡 Передавайте cart="%s" в view_cart и другие инструменты корзины`,
+		name, action, source, lines, name)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleAddToWishlist(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	input, err := parseCartItemInput(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	w, wishlistName, err := wishlistFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	cartItem, inCart, err := s.store.Get(ctx, cartName, input.ID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	var item *CartItem
+	if inCart && input.Title == "" {
+		item = cartItem.clone()
+		item.Quantity = input.Quantity
+	} else {
+		if _, saved := w.Get(input.ID); !saved && input.Title == "" {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: "title parameter is required unless item_id refers to an item in the cart"},
+				},
+			}, nil
+		}
+		now := time.Now()
+		item = &CartItem{
+			ID:          input.ID,
+			Title:       input.Title,
+			Link:        input.Link,
+			Price:       input.Price,
+			Shop:        input.Shop,
+			Description: input.Description,
+			Quantity:    input.Quantity,
+			Priority:    priorityNormal,
+			AddedAt:     now,
+			UpdatedAt:   now,
+		}
+		item.updateParsedPrice()
+	}
+
+	saved := saveForLater(w, item)
+	slog.InfoContext(ctx, "item saved for later", "item_id", saved.ID, "quantity", saved.Quantity, "wishlist", wishlistName)
+
+	result := fmt.Sprintf(`📌 Товар отложен%s
+📦 %s
+🔢 Количество в отложенных: %d
+🆔 ID: %s
+
+💡 Используйте move_to_cart, чтобы перенести его в корзину`,
+		cartLabel(wishlistName), saved.Title, saved.Quantity, saved.ID)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func handleViewWishlist(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	w, wishlistName, err := wishlistFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	items := w.Snapshot()
+	if len(items) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("📌 Отложенных товаров%s нет", cartLabel(wishlistName))},
+			},
+		}, nil
+	}
+
+	now := w.now()
+	var blocks []string
+	for _, item := range items {
+		blocks = append(blocks, formatCartItem(item, now))
+	}
+	result := fmt.Sprintf(`📌 Отложенные товары%s (%d)
+
+%s
+
+💡 Отложенные товары не входят в стоимость корзины. Используйте move_to_cart, чтобы перенести товар в корзину`,
+		cartLabel(wishlistName), len(items), strings.Join(blocks, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleMoveToCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return s.handleMoveItem(ctx, request, moveToCart, "🛒 Товар перенесён в корзину", "🔢 Количество в корзине")
+}
+
+func (s *Server) handleMoveToSaved(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return s.handleMoveItem(ctx, request, moveToSaved, "📌 Товар перенесён в отложенные", "🔢 Количество в отложенных")
+}
+
+func (s *Server) handleMoveItem(ctx context.Context, request mcp.CallToolRequest, move func(context.Context, *Cart, *Wishlist, string) (*CartItem, error), header, quantityLabel string) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	itemID, ok := args["item_id"].(string)
+	if !ok || strings.TrimSpace(itemID) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	itemID = strings.TrimSpace(itemID)
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	w, wishlistName, err := wishlistFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var item *CartItem
+	err = s.update(ctx, cartName, func(c *Cart) (err error) {
+		item, err = move(ctx, c, w, itemID)
+		return err
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "item moved", "tool", request.Params.Name, "item_id", itemID, "quantity", item.Quantity, "cart", cartName, "wishlist", wishlistName)
+
+	result := fmt.Sprintf(`%s
+📦 %s
+%s: %d
+🆔 ID: %s`,
+		header, item.Title, quantityLabel, item.Quantity, item.ID)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func handleCreateWishlist(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+
+	if _, err := wishlists.Create(name); err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	wishlistsChanged()
+	slog.InfoContext(ctx, "wishlist created", "wishlist", name)
+
+	result := fmt.Sprintf(`🆕 Список отложенных «%s» создан
+
+💡 Передавайте wishlist="%s" в add_to_wishlist, view_wishlist и move_to_cart`,
+		name, name)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func handleListWishlists(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var lines []string
+	for _, name := range wishlists.Names() {
+		w, ok := wishlists.Get(name)
+		if !ok {
+			continue
+		}
+		uniqueItems, totalQuantity := w.Totals()
+		lines = append(lines, fmt.Sprintf("• %s — позиций: %d, товаров: %d", name, uniqueItems, totalQuantity))
+	}
+	result := fmt.Sprintf("📌 Списки отложенных (%d):\n\n%s", len(lines), strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func handleRemoveFromWishlist(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	itemID, ok := args["item_id"].(string)
+	if !ok || strings.TrimSpace(itemID) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	itemID = strings.TrimSpace(itemID)
+
+	w, wishlistName, err := wishlistFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	item, found := removeFromWishlist(w, itemID)
+	if !found {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("item %s not found in saved items", itemID)},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "item removed from wishlist", "item_id", itemID, "wishlist", wishlistName)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: fmt.Sprintf("🗑️ Товар удалён из отложенных%s\n📦 %s\n🆔 ID: %s", cartLabel(wishlistName), item.Title, item.ID)},
+		},
+	}, nil
+}
+
+func (s *Server) handleViewRemoved(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	var removed []removedItem
+	err = s.store.View(ctx, cartName, func(c *Cart) error {
+		removed = c.Removed()
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	if len(removed) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "🗑️ Недавно удалённых товаров нет"},
+			},
+		}, nil
+	}
+
+	now := time.Now()
+	var lines []string
+	for _, entry := range removed {
+		lines = append(lines, fmt.Sprintf("• %s × %d — удалён %s (ID: %s)",
+			entry.Item.Title, entry.Item.Quantity, formatRelativeTime(entry.RemovedAt, now), entry.Item.ID))
+	}
+	result := fmt.Sprintf(`🗑️ Недавно удалённые товары (%d):
+
+%s
+
+💡 Используйте restore_item с ID товара, чтобы вернуть его в корзину`,
+		len(removed), strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleRestoreItem(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	itemID, ok := args["item_id"].(string)
+	if !ok || strings.TrimSpace(itemID) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	itemID = strings.TrimSpace(itemID)
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var item *CartItem
+	err = s.update(ctx, cartName, func(c *Cart) (err error) {
+		item, err = restoreItem(ctx, c, itemID)
+		return err
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart item restored", "cart", cartName, "item_id", itemID, "quantity", item.Quantity)
+
+	result := fmt.Sprintf(`♻️ Товар возвращён в корзину%s
+📦 %s
+🔢 Количество в корзине: %d
+🆔 ID: %s`,
+		cartLabel(cartName), item.Title, item.Quantity, item.ID)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleCartTotal(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	var cartItems []*CartItem
+	var budget Budget
+	err = s.store.View(ctx, cartName, func(c *Cart) error {
+		cartItems, budget = c.Snapshot(), c.Budget()
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	if len(cartItems) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🛒 Корзина%s пуста", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	var expiredItems []*CartItem
+	if includeExpired, _ := args["include_expired"].(bool); !includeExpired {
+		cartItems, expiredItems = splitExpired(cartItems, time.Now())
+	}
+
+	var lines, unpriced []string
+	totals := make(map[string]float64)
+	highTotals := make(map[string]float64)
+	for _, item := range cartItems {
+		title := priorityMarker(item.Priority) + item.Title
+		if !item.PriceParsed {
+			unpriced = append(unpriced, fmt.Sprintf("• %s × %d — цена: %q (ID: %s)", title, item.Quantity, item.Price, item.ID))
+			continue
+		}
+		subtotal := item.PriceAmount * float64(item.Quantity)
+		totals[item.PriceCurrency] += subtotal
+		if item.Priority == priorityHigh {
+			highTotals[item.PriceCurrency] += subtotal
+		}
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("• %s: %.2f × %d = %.2f %s", title, item.PriceAmount, item.Quantity, subtotal, item.PriceCurrency)))
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("🧾 Стоимость корзины%s\n\n", cartLabel(cartName)))
+	if len(lines) > 0 {
+		result.WriteString(strings.Join(lines, "\n"))
+		result.WriteString("\n\n💰 Итого: " + formatTotals(totals))
+		if len(highTotals) > 0 {
+			result.WriteString("\n❗ Обязательные покупки (high): " + formatTotals(highTotals))
+		}
+	} else {
+		result.WriteString("💰 Итого: не удалось рассчитать")
+	}
+	if line := budgetLine(totals, budget); line != "" {
+		result.WriteString("\n" + line)
+	}
+	if len(unpriced) > 0 {
+		result.WriteString(fmt.Sprintf("\n\n⚠️ Без цены (%d, не учтены в итоге):\n", len(unpriced)))
+		result.WriteString(strings.Join(unpriced, "\n"))
+	}
+	if len(expiredItems) > 0 {
+		result.WriteString("\n\n" + formatExpiredItems(expiredItems))
+		result.WriteString("\nЧтобы учесть их в итоге, вызовите cart_total с include_expired=true")
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result.String()},
+		},
+	}, nil
+}
+
+func (s *Server) handleRemoveFromCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	itemID, ok := args["item_id"].(string)
+	if !ok || strings.TrimSpace(itemID) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	itemID = strings.TrimSpace(itemID)
+
+	n := 1
+	if value, present := args["quantity"]; present && value != nil {
+		num, ok := value.(float64)
+		if !ok || num != float64(int(num)) || num < 1 {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: "quantity parameter must be a positive integer"},
+				},
+			}, nil
+		}
+		n = int(num)
+	}
+	if all, _ := args["all"].(bool); all {
+		n = math.MaxInt
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	item, _, err := s.store.Get(ctx, cartName, itemID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	removed, deleted, err := s.store.Remove(ctx, cartName, itemID, n)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart item removed", "cart", cartName, "item_id", itemID, "removed", removed, "deleted", deleted)
+	if removed == 0 {
+		text := fmt.Sprintf("Item %s not found in cart. The cart is empty", itemID)
+		lines, _ := s.store.List(ctx, cartName)
+		if ids := lineIDs(lines); len(ids) > 0 {
+			text = fmt.Sprintf("Item %s not found in cart. Available item IDs:\n%s", itemID, strings.Join(ids, "\n"))
+		}
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: text},
+			},
+		}, nil
+	}
+
+	var result string
+	if deleted {
+		result = fmt.Sprintf(`🗑️ Товар удалён из корзины%s (удалено %d шт.)
+📦 %s
+🆔 ID: %s`,
+			cartLabel(cartName), removed, item.Title, itemID)
+	} else {
+		result = fmt.Sprintf(`➖ Удалено %d из %d, осталось %d
+📦 %s
+🆔 ID: %s`,
+			removed, item.Quantity, item.Quantity-removed, item.Title, itemID)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleClearCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	lines, err := s.store.List(ctx, cartName)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	if len(lines) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🛒 Корзина%s уже пуста, очищать нечего", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	if confirm, _ := args["confirm"].(bool); !confirm {
+		totalQuantity := 0
+		for _, item := range lines {
+			totalQuantity += item.Quantity
+		}
+		result := fmt.Sprintf(`⚠️ Будет удалено товаров: %d (уникальных: %d)
+
+💡 Чтобы очистить корзину, вызовите clear_cart ещё раз с confirm=true`,
+			totalQuantity, len(lines))
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: result},
+			},
+		}, nil
+	}
+
+	backupBeforeChange(ctx, "clear_cart")
+	uniqueItems, totalQuantity, err := s.store.Clear(ctx, cartName)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart cleared", "cart", cartName, "items", uniqueItems, "quantity", totalQuantity)
+	if uniqueItems == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🛒 Корзина%s уже пуста, очищать нечего", cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	result := fmt.Sprintf(`🧹 Корзина%s очищена
+📊 Удалено позиций: %d (всего товаров: %d)
+
+💡 Удалённые товары можно вернуть через view_removed и restore_item или отменить очистку через undo_cart`,
+		cartLabel(cartName), uniqueItems, totalQuantity)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleAddResultToCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	index, ok := args["result_index"].(float64)
+	if !ok || index != float64(int(index)) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "result_index parameter is required and must be an integer"},
+			},
+		}, nil
+	}
+
+	quantity := 1
+	if num, ok := args["quantity"].(float64); ok {
+		quantity = int(num)
+		if maxQuantity := config.MaxCartQuantity; quantity < 1 || quantity > maxQuantity {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: fmt.Sprintf("quantity must be between 1 and %d", maxQuantity)},
+				},
+			}, nil
+		}
+	}
+
+	item, err := lastSearches.Get(sessionIDFromContext(ctx), int(index))
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var itemID string
+	var total int
+	err = s.update(ctx, cartName, func(c *Cart) (err error) {
+		itemID = cartLineID(c.Snapshot(), generateItemID(item), item.Link)
+		total, err = addToCart(ctx, c, CartItem{
+			ID:          itemID,
+			Title:       item.Title,
+			Link:        item.Link,
+			Price:       searchItemPrice(item).String(),
+			Shop:        item.DisplayLink,
+			Description: item.Snippet,
+			Image:       item.Image(),
+		}, quantity)
+		return err
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart item added", "cart", cartName, "item_id", itemID, "count", quantity, "quantity", total)
+
+	result := fmt.Sprintf(`✅ Товар #%d добавлен в корзину%s
+📦 %s
+💰 Цена: %s
+🔢 Количество в корзине: %d
+🆔 ID: %s
+
+💡 Используйте view_cart для просмотра корзины`,
+		int(index), cartLabel(cartName), item.Title, searchItemPrice(item), total, itemID)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleSetQuantity(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	itemID, ok := args["item_id"].(string)
+	if !ok || strings.TrimSpace(itemID) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	itemID = strings.TrimSpace(itemID)
+
+	num, ok := args["quantity"].(float64)
+	if !ok || num != float64(int(num)) || num < 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "quantity parameter is required and must be a non-negative integer"},
+			},
+		}, nil
+	}
+	quantity := int(num)
+
+	if maxQuantity := config.MaxCartQuantity; quantity > maxQuantity {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("quantity %d exceeds the maximum of %d", quantity, maxQuantity)},
+			},
+		}, nil
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	item, _, err := s.store.Get(ctx, cartName, itemID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	previous, found, err := s.store.SetQuantity(ctx, cartName, itemID, quantity)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "cart quantity set", "cart", cartName, "item_id", itemID, "previous", previous, "quantity", quantity, "found", found)
+	if !found {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Item %s not found in cart%s", itemID, cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	var result string
+	if quantity == 0 {
+		result = fmt.Sprintf(`🗑️ Товар удалён из корзины%s
+📦 %s
+🔢 Количество: %d → 0
+🆔 ID: %s`,
+			cartLabel(cartName), item.Title, previous, itemID)
+	} else {
+		result = fmt.Sprintf(`✏️ Количество товара изменено%s
+📦 %s
+🔢 Количество: %d → %d
+🆔 ID: %s`,
+			cartLabel(cartName), item.Title, previous, quantity, itemID)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+// isHostname reports whether s looks like a bare domain name. It keeps the
+// site filter from smuggling extra search operators into the query.
+func isHostname(s string) bool {
+	if len(s) > 253 || !strings.Contains(s, ".") || strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".") {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, r := range label {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// filterByPrice keeps items whose parsed LowPrice lies within the given bounds.
+// Items without a parseable price are dropped.
+func filterByPrice(items []SearchItem, minPrice float64, hasMin bool, maxPrice float64, hasMax bool) []SearchItem {
+	var filtered []SearchItem
+	for _, item := range items {
+		low, ok := item.LowPrice()
+		if !ok {
+			continue
+		}
+		if amount := low.Amount; (hasMin && amount < minPrice) || (hasMax && amount > maxPrice) {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
+
+var searchSortOrders = []string{"relevance", "price_asc", "price_desc"}
+
+// sortByPrice orders items by their lowest offer price, keeping the search
+// order among equal prices. Items without a parseable price go last; their
+// number is returned.
+func sortByPrice(items []SearchItem, descending bool) (unpriced int) {
+	prices := make(map[string]float64, len(items))
+	for _, item := range items {
+		if low, ok := item.LowPrice(); ok {
+			prices[item.Link] = low.Amount
+		} else {
+			unpriced++
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, aOK := prices[items[i].Link]
+		b, bOK := prices[items[j].Link]
+		if aOK != bOK {
+			return aOK
+		}
+		if descending {
+			return a > b
+		}
+		return a < b
+	})
+	return unpriced
+}
+
+// formatSearchItems renders numbered search results with their cart IDs and,
+// with includeImages, the product photo of each result that has one.
+func formatSearchItems(items []SearchItem, includeImages bool) string {
+	var results []string
+	for i, item := range items {
+		price := searchItemPrice(item)
+		image := ""
+		if url := item.Image(); includeImages && url != "" {
+			image = "\n🖼️ Изображение: " + url
+		}
+
+		result := fmt.Sprintf(`📦 Товар #%d
+🏷️ Название: %s
+🏪 Магазин: %s
+💰 Цена: %s
+🔗 Ссылка: %s
+📝 Описание: %s%s
+🆔 ID для корзины: %s
+---`,
+			i+1,
+			item.Title,
+			item.DisplayLink,
+			price,
+			item.Link,
+			item.Snippet,
+			image,
+			generateItemID(item),
+		)
+		results = append(results, result)
+	}
+	return strings.Join(results, "\n")
+}
+
+func resultsRange(start, fetched int) string {
+	if fetched == 0 {
+		return fmt.Sprintf("начиная с %d (больше результатов нет)", start)
+	}
+	return fmt.Sprintf("%d–%d (следующая страница: start=%d)", start, start+fetched-1, start+fetched)
+}
+
+func (s *Server) handleSetItemNote(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	itemID, ok := args["item_id"].(string)
+	if !ok || strings.TrimSpace(itemID) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	itemID = strings.TrimSpace(itemID)
+
+	note, ok := args["note"].(string)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "note parameter is required and must be a string"},
+			},
+		}, nil
+	}
+	note = strings.TrimSpace(note)
+	if length := utf8.RuneCountInString(note); length > maxNoteLength {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("note is %d characters long, the limit is %d", length, maxNoteLength)},
+			},
+		}, nil
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var found bool
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		found = c.SetNote(ctx, itemID, note)
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if !found {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Item %s not found in cart%s", itemID, cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	result := fmt.Sprintf("🗒️ Заметка сохранена\n🆔 ID: %s\n📝 %s", itemID, note)
+	if note == "" {
+		result = fmt.Sprintf("🗒️ Заметка удалена\n🆔 ID: %s", itemID)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleTagItem(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	itemID, ok := args["item_id"].(string)
+	if !ok || strings.TrimSpace(itemID) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	itemID = strings.TrimSpace(itemID)
+
+	tag, _ := args["tag"].(string)
+	if normalizeTag(tag) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "tag parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	remove, _ := args["remove"].(bool)
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var tags []string
+	var found bool
+	var inUse map[string]int
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		tags, found = c.Tag(ctx, itemID, tag, remove)
+		inUse = c.Tags()
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if !found {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Item %s not found in cart%s", itemID, cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	action := "добавлен"
+	if remove {
+		action = "снят"
+	}
+	itemTags := "нет"
+	if len(tags) > 0 {
+		itemTags = strings.Join(tags, ", ")
+	}
+
+	names := make([]string, 0, len(inUse))
+	for name := range inUse {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	allTags := make([]string, 0, len(names))
+	for _, name := range names {
+		allTags = append(allTags, fmt.Sprintf("%s (%d)", name, inUse[name]))
+	}
+	allTagsText := "нет"
+	if len(allTags) > 0 {
+		allTagsText = strings.Join(allTags, ", ")
+	}
+
+	result := fmt.Sprintf(`🏷️ Тег «%s» %s
+🆔 ID: %s
+🏷️ Теги товара: %s
+
+📚 Все теги в корзине%s: %s
+
+💡 Используйте view_cart с tag для просмотра товаров с тегом`,
+		normalizeTag(tag), action, itemID, itemTags, cartLabel(cartName), allTagsText)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func (s *Server) handleSetPriority(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
+
+	itemID, ok := args["item_id"].(string)
+	if !ok || strings.TrimSpace(itemID) == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+	itemID = strings.TrimSpace(itemID)
+
+	priority, _ := args["priority"].(string)
+	if !slices.Contains(priorities, priority) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("priority must be one of: %s", strings.Join(priorities, ", "))},
+			},
+		}, nil
+	}
+
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	var previous string
+	var found bool
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		previous, found = c.SetPriority(ctx, itemID, priority)
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	if !found {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Item %s not found in cart%s", itemID, cartLabel(cartName))},
+			},
+		}, nil
+	}
+
+	result := fmt.Sprintf(`🚩 Приоритет изменён: %s → %s
+🆔 ID: %s`,
+		previous, priority, itemID)
 
-type Config struct {
-	GoogleAPIKey   string
-	SearchEngineID string
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
 }
 
-func loadConfig() *Config {
-	return &Config{
-		GoogleAPIKey:   os.Getenv("GOOGLE_API_KEY"),
-		SearchEngineID: os.Getenv("GOOGLE_SEARCH_ENGINE_ID"),
+func handleSearchHistory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entries := searchHistory.Recent()
+	if len(entries) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "🕘 История поиска пуста"},
+			},
+		}, nil
 	}
-}
 
-func searchProducts(query string, numResults int) (*SearchResponse, error) {
-	config := loadConfig()
-	if config.GoogleAPIKey == "" || config.SearchEngineID == "" {
-		return nil, fmt.Errorf("Google API key or Search Engine ID not configured")
+	lines := make([]string, 0, len(entries))
+	for i, entry := range entries {
+		lines = append(lines, fmt.Sprintf("%d. «%s» — %s, показано %d (найдено %s)",
+			i+1, entry.Query, entry.SearchedAt.Format("2006-01-02 15:04:05"), entry.Results, entry.TotalResults))
 	}
 
-	baseURL := "https://www.googleapis.com/customsearch/v1"
-	params := url.Values{}
-	params.Add("key", config.GoogleAPIKey)
-	params.Add("cx", config.SearchEngineID)
-	params.Add("q", query)
-	params.Add("num", strconv.Itoa(numResults))
+	result := fmt.Sprintf(`🕘 Последние поисковые запросы (%d):
 
-	resp, err := http.Get(baseURL + "?" + params.Encode())
-	if err != nil {
-		return nil, fmt.Errorf("failed to make search request: %w", err)
-	}
-	defer resp.Body.Close()
+%s`,
+		len(entries), strings.Join(lines, "\n"))
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("search API returned status %d: %s", resp.StatusCode, string(body))
-	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
 
-	var searchResponse SearchResponse
-	if err := json.NewDecoder(resp.Body).Decode(&searchResponse); err != nil {
-		return nil, fmt.Errorf("failed to decode search response: %w", err)
-	}
+func handleClearSearchHistory(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	removed := searchHistory.Clear()
 
-	return &searchResponse, nil
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: fmt.Sprintf("🧹 История поиска очищена (удалено запросов: %d)", removed)},
+		},
+	}, nil
 }
 
-func addToCart(itemID, title, link, price, shop, description string) {
-	cart.mutex.Lock()
-	defer cart.mutex.Unlock()
-
-	if existingItem, exists := cart.Items[itemID]; exists {
-		existingItem.Quantity++
-	} else {
-		cart.Items[itemID] = &CartItem{
+// lookupProduct finds an item in the cart first and then among recent search results.
+func (s *Server) lookupProduct(ctx context.Context, itemID string) (CartItem, string, bool) {
+	if item, ok, _ := s.store.Get(ctx, defaultCartName, itemID); ok {
+		return item, "корзина", true
+	}
+	if found, ok := productRegistry.Get(itemID); ok {
+		item := CartItem{
 			ID:          itemID,
-			Title:       title,
-			Link:        link,
-			Price:       price,
-			Shop:        shop,
-			Description: description,
-			Quantity:    1,
+			Title:       found.Title,
+			Link:        found.Link,
+			Price:       searchItemPrice(found).String(),
+			Shop:        found.DisplayLink,
+			Description: found.Snippet,
+			Image:       found.Image(),
 		}
+		item.updateParsedPrice()
+		return item, "поиск", true
 	}
+	return CartItem{}, "", false
 }
 
-func removeFromCart(itemID string) bool {
-	cart.mutex.Lock()
-	defer cart.mutex.Unlock()
-
-	if item, exists := cart.Items[itemID]; exists {
-		if item.Quantity > 1 {
-			item.Quantity--
-		} else {
-			delete(cart.Items, itemID)
-		}
-		return true
+func handleProductDetails(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	link, _ := args["link"].(string)
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "link parameter is required"},
+			},
+		}, nil
 	}
-	return false
-}
 
-func getCart() map[string]*CartItem {
-	cart.mutex.RLock()
-	defer cart.mutex.RUnlock()
+	details, err := fetchProductDetails(ctx, link)
+	if err != nil {
+		slog.WarnContext(ctx, "product details failed", "link", link, "error", err)
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
 
-	result := make(map[string]*CartItem)
-	for k, v := range cart.Items {
-		result[k] = &CartItem{
-			ID:          v.ID,
-			Title:       v.Title,
-			Link:        v.Link,
-			Price:       v.Price,
-			Shop:        v.Shop,
-			Description: v.Description,
-			Quantity:    v.Quantity,
+	price := strings.TrimSpace(details.Price + " " + details.Currency)
+	fields := []struct{ label, value string }{
+		{"📦 Название", details.Name},
+		{"🏷️ Бренд", details.Brand},
+		{"💰 Цена", price},
+		{"✅ Наличие", details.Availability},
+		{"🖼️ Изображение", details.Image},
+		{"📝 Описание", details.Description},
+	}
+	var lines []string
+	for _, field := range fields {
+		if field.value != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", field.label, field.value))
 		}
 	}
-	return result
-}
-
-func clearCart() {
-	cart.mutex.Lock()
-	defer cart.mutex.Unlock()
-	cart.Items = make(map[string]*CartItem)
-}
+	result := fmt.Sprintf("🔍 Данные со страницы товара\n🔗 %s\n\n%s", link, strings.Join(lines, "\n"))
 
-type queryParams struct {
-	Type        string `json:"type"`
-	Description string `json:"description"`
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
 }
 
-type numResultsParams struct {
-	Type        string `json:"type"`
-	Description string `json:"description"`
-	Default     int    `json:"default"`
-}
+func (s *Server) handleCompareProducts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "Invalid arguments format"},
+			},
+		}, nil
+	}
 
-func main() {
-	s := server.NewMCPServer(
-		"shopping-server",
-		"1.0.0",
-		server.WithLogging(),
-		server.WithToolCapabilities(true),
-		server.WithResourceCapabilities(true, true),
-	)
+	rawIDs, ok := args["item_ids"].([]any)
+	if !ok || len(rawIDs) < 2 || len(rawIDs) > maxCompareItems {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("item_ids parameter is required and must be an array of 2 to %d item IDs", maxCompareItems)},
+			},
+		}, nil
+	}
 
-	s.AddTool(mcp.Tool{
-		Name:        "search_products",
-		Description: "Поиск товаров по запросу с использованием Google Custom Search API",
-		InputSchema: mcp.ToolInputSchema{
-			Type: "object",
-			Properties: map[string]any{
-				"query": queryParams{
-					Type:        "string",
-					Description: "Поисковый запрос для поиска товаров",
-				},
-				"num_results": numResultsParams{
-					Type:        "integer",
-					Description: "Количество результатов поиска (по умолчанию 10, максимум 10)",
-					Default:     10,
+	var items []CartItem
+	var sources, missing []string
+	seen := make(map[string]bool)
+	for i, raw := range rawIDs {
+		itemID, ok := raw.(string)
+		if !ok || itemID == "" {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: fmt.Sprintf("item_ids[%d] must be a non-empty string", i)},
 				},
-			},
-			Required: []string{"query"},
-		},
-	}, handleSearchProducts)
+			}, nil
+		}
+		if seen[itemID] {
+			continue
+		}
+		seen[itemID] = true
 
-	s.AddTool(mcp.Tool{
-		Name:        "view_cart",
-		Description: "Посмотреть содержимое корзины",
-		InputSchema: mcp.ToolInputSchema{
-			Type: "object",
-		},
-	}, handleViewCart)
+		item, source, found := s.lookupProduct(ctx, itemID)
+		if !found {
+			missing = append(missing, itemID)
+			continue
+		}
+		items = append(items, item)
+		sources = append(sources, source)
+	}
 
-	// fmt.Println("GOOGLE_API_KEY =", os.Getenv("GOOGLE_API_KEY"))
-	// fmt.Println("SEARCHENGINEID =", os.Getenv("GOOGLE_SEARCH_ENGINE_ID"))
+	if len(missing) > 0 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Items not found in the cart or recent search results: %s", strings.Join(missing, ", "))},
+			},
+		}, nil
+	}
+	if len(items) < 2 {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "at least 2 distinct item IDs are required for comparison"},
+			},
+		}, nil
+	}
 
-	// serverCert, err := tls.LoadX509KeyPair("server.crt", "server.key")
-	// if err != nil {
-	// 	log.Fatalf("failed to load server key pair: %v", err)
-	// }
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("⚖️ Сравнение товаров (%d)\n\n", len(items)))
+	result.WriteString("| # | Название | Магазин | Цена | Описание | Источник | ID |\n")
+	result.WriteString("|---|---|---|---|---|---|---|\n")
+	for i, item := range items {
+		result.WriteString(fmt.Sprintf("| %d | %s | %s | %s | %s | %s | %s |\n",
+			i+1, tableCell(item.Title), tableCell(item.Shop), tableCell(item.Price),
+			tableCell(item.Description), sources[i], tableCell(item.ID)))
+	}
+	result.WriteString("\n" + comparePrices(items))
 
-	// clientCACert, err := ioutil.ReadFile("ca.crt")
-	// if err != nil {
-	// 	log.Fatalf("failed to read client CA cert: %v", err)
-	// }
-	// clientCertPool := x509.NewCertPool()
-	// clientCertPool.AppendCertsFromPEM(clientCACert)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: strings.TrimSpace(result.String())},
+		},
+	}, nil
+}
 
-	// tlsConfig := &tls.Config{
-	// 	Certificates: []tls.Certificate{serverCert},
-	// 	ClientAuth:   tls.RequireAndVerifyClientCert,
-	// 	ClientCAs:    clientCertPool,
-	// 	MinVersion:   tls.VersionTLS12,
-	// }
+// tableCell makes s safe to place inside a markdown table cell.
+func tableCell(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.ReplaceAll(s, "|", "\\|")
+}
 
-	// serverHTTP := &http.Server{
-	// 	Addr:      ":8443",
-	// 	TLSConfig: tlsConfig,
-	// 	Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	// 		if len(r.TLS.PeerCertificates) > 0 {
-	// 			clientCert := r.TLS.PeerCertificates[0]
-	// 			fmt.Fprintf(w, "Hello, %s!\n", clientCert.Subject.CommonName)
-	// 		} else {
-	// 			http.Error(w, "No client certificate provided", http.StatusUnauthorized)
-	// 		}
-	// 	}),
-	// }
+// comparePrices summarises price differences against the cheapest item of
+// each currency; prices in different currencies are never compared.
+func comparePrices(items []CartItem) string {
+	cheapest := make(map[string]int)
+	var currencies []string
+	for i, item := range items {
+		if !item.PriceParsed {
+			continue
+		}
+		best, ok := cheapest[item.PriceCurrency]
+		if !ok {
+			currencies = append(currencies, item.PriceCurrency)
+		}
+		if !ok || item.PriceAmount < items[best].PriceAmount {
+			cheapest[item.PriceCurrency] = i
+		}
+	}
+	if len(currencies) == 0 {
+		return "📊 Цены: ни у одного товара цена не распознана, сравнение невозможно"
+	}
 
-	// httpServer := server.NewStreamableHTTPServer(s, server.WithStreamableHTTPServer(serverHTTP))
-	httpServer := server.NewStreamableHTTPServer(s)
-	if err := httpServer.Start("localhost:8080"); err != nil {
-		log.Fatal(err)
+	var lines []string
+	for _, currency := range currencies {
+		best := items[cheapest[currency]]
+		lines = append(lines, fmt.Sprintf("🏆 Дешевле всего: #%d %s — %.2f %s", cheapest[currency]+1, best.Title, best.PriceAmount, currency))
+		for i, item := range items {
+			if !item.PriceParsed || item.PriceCurrency != currency || i == cheapest[currency] {
+				continue
+			}
+			diff := item.PriceAmount - best.PriceAmount
+			line := fmt.Sprintf("• #%d дороже на %.2f %s", i+1, diff, currency)
+			if best.PriceAmount > 0 {
+				line += fmt.Sprintf(" (+%.1f%%)", diff/best.PriceAmount*100)
+			}
+			lines = append(lines, line)
+		}
 	}
+	for i, item := range items {
+		if !item.PriceParsed {
+			lines = append(lines, fmt.Sprintf("• #%d: цена не распознана (%q)", i+1, item.Price))
+		}
+	}
+	if len(currencies) > 1 {
+		lines = append(lines, "⚠️ Цены указаны в разных валютах и сравниваются только внутри одной валюты")
+	}
+
+	return "📊 Сравнение цен:\n" + strings.Join(lines, "\n")
 }
 
-func handleSearchProducts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func handleSaveSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args, ok := request.Params.Arguments.(map[string]any)
 	if !ok {
 		return &mcp.CallToolResult{
@@ -267,120 +4366,210 @@ func handleSearchProducts(ctx context.Context, request mcp.CallToolRequest) (*mc
 		}, nil
 	}
 
-	query, ok := args["query"].(string)
-	if !ok {
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxSavedSearchNameLength {
 		return &mcp.CallToolResult{
 			IsError: true,
 			Content: []mcp.Content{
-				mcp.TextContent{Type: "text", Text: "query parameter is required and must be a string"},
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("name parameter is required and must be 1 to %d characters long", maxSavedSearchNameLength)},
+			},
+		}, nil
+	}
+
+	query, _ := args["query"].(string)
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "query parameter is required and must be a non-empty string"},
 			},
 		}, nil
 	}
 
-	numResults := 10
+	search := SavedSearch{Name: name, Query: query, NumResults: searchPageSize, SavedAt: time.Now()}
 	if num, ok := args["num_results"].(float64); ok {
-		numResults = int(num)
-		if numResults > 10 {
-			numResults = 10
+		if num != float64(int(num)) || num < 1 || int(num) > config.MaxSearchResults {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: fmt.Sprintf("num_results must be an integer between 1 and %d", config.MaxSearchResults)},
+				},
+			}, nil
 		}
+		search.NumResults = int(num)
+	}
+	if value, present := args["site"]; present && value != nil {
+		site, ok := value.(string)
+		site = strings.ToLower(strings.TrimSpace(site))
+		if !ok || !isHostname(site) {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: "site parameter must be a domain name such as megamarket.ru"},
+				},
+			}, nil
+		}
+		search.Site = site
+	}
+	if minPrice, ok := args["min_price"].(float64); ok {
+		search.MinPrice = &minPrice
+	}
+	if maxPrice, ok := args["max_price"].(float64); ok {
+		search.MaxPrice = &maxPrice
+	}
+	if search.MinPrice != nil && search.MaxPrice != nil && *search.MinPrice > *search.MaxPrice {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "min_price must not be greater than max_price"},
+			},
+		}, nil
 	}
 
-	searchResponse, err := searchProducts(query, numResults)
+	replaced, err := savedSearches.Put(search)
 	if err != nil {
 		return &mcp.CallToolResult{
 			IsError: true,
 			Content: []mcp.Content{
-				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Search failed: %v", err)},
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Failed to save search: %v", err)},
 			},
 		}, nil
 	}
+	slog.InfoContext(ctx, "search saved", "name", name, "query", query, "replaced", replaced)
 
-	var results []string
-	for i, item := range searchResponse.Items {
-		price := "Цена не указана"
-		if len(item.PageMap.AggregateOffer) > 0 {
-			offer := item.PageMap.AggregateOffer[0]
-			if offer.LowPrice != "" {
-				price = fmt.Sprintf("от %s %s", offer.LowPrice, offer.PriceCurrency)
-			}
-		}
-
-		result := fmt.Sprintf(`📦 Товар #%d
-🏷️ Название: %s
-🏪 Магазин: %s
-💰 Цена: %s
-🔗 Ссылка: %s
-📝 Описание: %s
-🆔 ID для корзины: %s
----`,
-			i+1,
-			item.Title,
-			item.DisplayLink,
-			price,
-			item.Link,
-			item.Snippet,
-			generateItemID(item),
-		)
-		results = append(results, result)
+	status := "сохранён"
+	if replaced {
+		status = "обновлён"
 	}
+	result := fmt.Sprintf(`💾 Поиск «%s» %s
+🔍 %s
 
-	totalResults := searchResponse.SearchInformation.TotalResults
-	searchTime := searchResponse.SearchInformation.SearchTime
+💡 Используйте run_saved_search с name="%s", чтобы повторить его`,
+		name, status, formatSavedSearch(search), name)
 
-	finalResult := fmt.Sprintf(`🔍 Результаты поиска для "%s"
-📊 Найдено: %s результатов за %.2f секунд
-📋 Показаны первые %d результатов:
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
 
-%s
+func handleListSavedSearches(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	searches := savedSearches.List()
+	if len(searches) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "💾 Сохранённых поисков нет. Используйте save_search, чтобы сохранить запрос"},
+			},
+		}, nil
+	}
 
-💡 Используйте add_to_cart с ID товара для добавления в корзину`,
-		query, totalResults, searchTime, len(results), strings.Join(results, "\n"))
+	var lines []string
+	for _, search := range searches {
+		lines = append(lines, fmt.Sprintf("• %s — %s", search.Name, formatSavedSearch(search)))
+	}
+	result := fmt.Sprintf("💾 Сохранённые поиски (%d):\n\n%s", len(searches), strings.Join(lines, "\n"))
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{
-			mcp.TextContent{Type: "text", Text: finalResult},
+			mcp.TextContent{Type: "text", Text: result},
 		},
 	}, nil
 }
 
-func handleViewCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	cartItems := getCart()
+func handleRunSavedSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
 
-	if len(cartItems) == 0 {
+	search, ok := savedSearches.Get(name)
+	if !ok {
 		return &mcp.CallToolResult{
+			IsError: true,
 			Content: []mcp.Content{
-				mcp.TextContent{Type: "text", Text: "🛒 Корзина пуста"},
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Saved search %q not found. Use list_saved_searches to see saved names", name)},
 			},
 		}, nil
 	}
 
-	var items []string
-	totalItems := 0
-	for _, item := range cartItems {
-		totalItems += item.Quantity
-		itemText := fmt.Sprintf(`📦 %s
-🏪 Магазин: %s
-💰 Цена: %s
-🔢 Количество: %d
-🔗 Ссылка: %s
-🆔 ID: %s
----`,
-			item.Title,
-			item.Shop,
-			item.Price,
-			item.Quantity,
-			item.Link,
-			item.ID)
-		items = append(items, itemText)
+	searchRequest := request
+	searchRequest.Params.Name = "search_products"
+	searchRequest.Params.Arguments = search.args()
+	return handleSearchProducts(ctx, searchRequest)
+}
+
+func handleDeleteSavedSearch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	name, _ := args["name"].(string)
+	name = strings.TrimSpace(name)
+
+	found, err := savedSearches.Delete(name)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Failed to delete saved search: %v", err)},
+			},
+		}, nil
+	}
+	if !found {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Saved search %q not found", name)},
+			},
+		}, nil
 	}
+	slog.InfoContext(ctx, "saved search deleted", "name", name)
 
-	result := fmt.Sprintf(`🛒 Ваша корзина
-📊 Всего товаров: %d (уникальных: %d)
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: fmt.Sprintf("🗑️ Сохранённый поиск «%s» удалён", name)},
+		},
+	}, nil
+}
 
-%s
+func formatSavedSearch(search SavedSearch) string {
+	parts := []string{fmt.Sprintf("\"%s\", результатов: %d", search.Query, search.NumResults)}
+	if search.Site != "" {
+		parts = append(parts, "сайт: "+search.Site)
+	}
+	if search.MinPrice != nil {
+		parts = append(parts, fmt.Sprintf("от %g", *search.MinPrice))
+	}
+	if search.MaxPrice != nil {
+		parts = append(parts, fmt.Sprintf("до %g", *search.MaxPrice))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *Server) handleServerInfo(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	items, err := s.store.List(ctx, defaultCartName)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	uniqueItems, totalQuantity := len(items), 0
+	for _, item := range items {
+		totalQuantity += item.Quantity
+	}
 
-💡 Используйте remove_from_cart с ID для удаления товара`,
-		totalItems, len(cartItems), strings.Join(items, "\n"))
+	result := fmt.Sprintf(`ℹ️ %s %s
+
+🛒 Корзина:
+• позиций: %d из %d
+• товаров всего: %d из %d
+• максимум единиц одного товара: %d`,
+		serverName, serverVersion,
+		uniqueItems, config.MaxCartItems,
+		totalQuantity, config.MaxCartTotalQuantity,
+		config.MaxCartQuantity)
 
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{
@@ -389,6 +4578,51 @@ func handleViewCart(ctx context.Context, request mcp.CallToolRequest) (*mcp.Call
 	}, nil
 }
 
+// LowPrice parses the lowest price of the item's first AggregateOffer.
+func (item SearchItem) LowPrice() (Price, bool) {
+	return item.offerPrice(func(lowPrice, _ string) string { return lowPrice })
+}
+
+// HighPrice parses the highest price of the item's first AggregateOffer.
+func (item SearchItem) HighPrice() (Price, bool) {
+	return item.offerPrice(func(_, highPrice string) string { return highPrice })
+}
+
+func (item SearchItem) offerPrice(pick func(lowPrice, highPrice string) string) (Price, bool) {
+	if len(item.PageMap.AggregateOffer) == 0 {
+		return Price{}, false
+	}
+	offer := item.PageMap.AggregateOffer[0]
+	price, err := ParsePrice(pick(offer.LowPrice, offer.HighPrice))
+	if err != nil {
+		return Price{}, false
+	}
+	if price.Currency == "" {
+		price.Currency = cmp.Or(currencyAliases[strings.ToUpper(strings.TrimSpace(offer.PriceCurrency))], strings.TrimSpace(offer.PriceCurrency))
+	}
+	return price, true
+}
+
+// searchItemPrice describes the offer price range of a search result, e.g.
+// "от 1299 RUB" or "от 1299 до 1599 RUB". The display string keeps the
+// currency so it can be stored in the cart and parsed again.
+func searchItemPrice(item SearchItem) Price {
+	low, ok := item.LowPrice()
+	if !ok {
+		return Price{Display: "Цена не указана"}
+	}
+	amount := strconv.FormatFloat(low.Amount, 'f', -1, 64)
+	low.Display = strings.TrimSpace(fmt.Sprintf("от %s %s", amount, low.Currency))
+	if high, ok := item.HighPrice(); ok && high.Amount > low.Amount && high.Currency == low.Currency {
+		low.Display = strings.TrimSpace(fmt.Sprintf("от %s до %s %s", amount, strconv.FormatFloat(high.Amount, 'f', -1, 64), low.Currency))
+	}
+	return low
+}
+
+// generateItemID derives a short cart ID from the product link: the first
+// itemIDLength characters of the URL-safe base64 SHA-256 of its canonical
+// form, so every variant of the same link maps to the same ID.
 func generateItemID(item SearchItem) string {
-	return fmt.Sprintf("%s-%s", item.DisplayLink, strings.ReplaceAll(item.Link, "/", "-"))
+	sum := sha256.Sum256([]byte(canonicalLink(item.Link)))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:itemIDLength]
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	searchRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "search_requests_total",
+		Help: "Product searches by outcome.",
+	}, []string{"status"})
+	searchLatencySeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "search_latency_seconds",
+		Help:    "Time taken by product searches, including retries and pagination.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+	cartAddTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cart_add_total",
+		Help: "Cart lines added or increased.",
+	})
+	cartRemoveTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cart_remove_total",
+		Help: "Cart lines removed or decreased.",
+	})
+	googleAPIQuotaErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "google_api_quota_errors_total",
+		Help: "Searches that failed because the Google API quota was exhausted.",
+	})
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cart_size",
+		Help: "Lines in all carts.",
+	}, func() float64 {
+		lines := 0
+		for _, items := range carts.Named() {
+			lines += len(items)
+		}
+		return float64(lines)
+	})
+)
+
+// observeSearch records the outcome and latency of one searchProducts call.
+func observeSearch(elapsed time.Duration, err error) {
+	searchLatencySeconds.Observe(elapsed.Seconds())
+	if err == nil {
+		searchRequestsTotal.WithLabelValues("ok").Inc()
+		return
+	}
+	searchRequestsTotal.WithLabelValues("error").Inc()
+	var apiErr *SearchAPIError
+	if errors.As(err, &apiErr) && apiErr.quotaExceeded() {
+		googleAPIQuotaErrorsTotal.Inc()
+	}
+}
+
+// quotaExceeded reports whether the API refused the request for lack of
+// quota: Custom Search answers 429, older keys 403 with a *LimitExceeded reason.
+func (e *SearchAPIError) quotaExceeded() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		(e.StatusCode == http.StatusForbidden && strings.Contains(e.Body, "LimitExceeded"))
+}
+
+// startMetricsServer serves /metrics on its own port when METRICS_PORT is
+// set; otherwise newHTTPHandler serves it next to the MCP endpoint.
+func startMetricsServer(port string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	metricsServer := &http.Server{Addr: ":" + port, Handler: mux}
+	go func() {
+		slog.Info("metrics server listening", "addr", metricsServer.Addr)
+		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server failed", "error", err)
+		}
+	}()
+	return metricsServer
+}
+
+// stopMetricsServer shuts down the server started by startMetricsServer, if any.
+func stopMetricsServer(ctx context.Context, metricsServer *http.Server) {
+	if metricsServer == nil {
+		return
+	}
+	if err := metricsServer.Shutdown(ctx); err != nil {
+		slog.Error("metrics server shutdown", "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveSearch(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantLabel string
+		wantQuota float64
+	}{
+		{name: "success", wantLabel: "ok"},
+		{name: "quota exhausted", err: fmt.Errorf("page 2: %w", &SearchAPIError{StatusCode: http.StatusTooManyRequests}), wantLabel: "error", wantQuota: 1},
+		{name: "daily limit", err: &SearchAPIError{StatusCode: http.StatusForbidden, Body: `{"reason": "dailyLimitExceeded"}`}, wantLabel: "error", wantQuota: 1},
+		{name: "invalid key", err: &SearchAPIError{StatusCode: http.StatusForbidden, Body: "API key not valid"}, wantLabel: "error"},
+		{name: "network failure", err: errors.New("connection refused"), wantLabel: "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := testutil.ToFloat64(searchRequestsTotal.WithLabelValues(tt.wantLabel))
+			quota := testutil.ToFloat64(googleAPIQuotaErrorsTotal)
+
+			observeSearch(time.Second, tt.err)
+
+			if got := testutil.ToFloat64(searchRequestsTotal.WithLabelValues(tt.wantLabel)) - requests; got != 1 {
+				t.Errorf("search_requests_total{status=%q} grew by %v, want 1", tt.wantLabel, got)
+			}
+			if got := testutil.ToFloat64(googleAPIQuotaErrorsTotal) - quota; got != tt.wantQuota {
+				t.Errorf("google_api_quota_errors_total grew by %v, want %v", got, tt.wantQuota)
+			}
+		})
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	c := newTestCart()
+	removed := testutil.ToFloat64(cartRemoveTotal)
+	if _, err := addToCart(t.Context(), c, CartItem{ID: "item", Title: "Item"}, 2); err != nil {
+		t.Fatalf("addToCart() error = %v", err)
+	}
+	removeFromCart(t.Context(), c, "item", 1)
+	if got := testutil.ToFloat64(cartRemoveTotal) - removed; got != 1 {
+		t.Errorf("cart_remove_total grew by %v, want 1", got)
+	}
+
+	s := server.NewMCPServer(serverName, serverVersion)
+	srv := httptest.NewServer(newHTTPHandler(server.NewStreamableHTTPServer(s), NewServer(NewMemoryCartStore(carts), nil)))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	for _, name := range []string{"search_latency_seconds", "cart_add_total", "cart_remove_total", "cart_size", "google_api_quota_errors_total"} {
+		if !strings.Contains(string(body), "\n"+name) {
+			t.Errorf("GET /metrics has no %s", name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var currencyAliases = map[string]string{
+	"RUB": "RUB",
+	"RUR": "RUB",
+	"РУБ": "RUB",
+	"Р":   "RUB",
+	"₽":   "RUB",
+	"USD": "USD",
+	"$":   "USD",
+	"EUR": "EUR",
+	"€":   "EUR",
+}
+
+// Price is a price string together with the amount and currency parsed from it.
+type Price struct {
+	Amount   float64
+	Currency string
+	// Display is the price as shown to the user, usually the raw string.
+	Display string
+}
+
+// ParsePrice parses price strings such as "от 1 234 RUB", "1 299,90 ₽",
+// "1234.56" or "от 1234 USD". Only the first number is used, so ranges like
+// "от 100 до 200" yield the lower bound. On error the returned Price still
+// carries the display string.
+func ParsePrice(raw string) (Price, error) {
+	price := Price{Display: strings.TrimSpace(raw), Currency: priceCurrency(raw)}
+	amount, err := parseAmount(raw)
+	if err != nil {
+		return price, err
+	}
+	price.Amount = amount
+	return price, nil
+}
+
+// String returns the display form, or the normalized one when the price was
+// built from numbers.
+func (p Price) String() string {
+	if p.Display != "" {
+		return p.Display
+	}
+	return p.Normalized()
+}
+
+// Normalized renders the amount with two decimals and the ISO currency code,
+// e.g. "1234.56 RUB".
+func (p Price) Normalized() string {
+	return strings.TrimSpace(fmt.Sprintf("%.2f %s", p.Amount, p.Currency))
+}
+
+// Grouped renders the amount with thousands separated by spaces, two decimals
+// and the ISO currency code, e.g. "1 234 567.89 RUB".
+func (p Price) Grouped() string {
+	text := strconv.FormatFloat(math.Abs(p.Amount), 'f', 2, 64)
+	integer, fraction, _ := strings.Cut(text, ".")
+	var b strings.Builder
+	if p.Amount < 0 {
+		b.WriteByte('-')
+	}
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteString("." + fraction)
+	if p.Currency != "" {
+		b.WriteString(" " + p.Currency)
+	}
+	return b.String()
+}
+
+// parseAmount extracts the first number of a price string; see ParsePrice.
+func parseAmount(s string) (float64, error) {
+	runes := []rune(s)
+	var digits strings.Builder
+scan:
+	for i, r := range runes {
+		if unicode.IsDigit(r) {
+			digits.WriteRune(r)
+			continue
+		}
+		if digits.Len() == 0 {
+			continue
+		}
+		nextIsDigit := i+1 < len(runes) && unicode.IsDigit(runes[i+1])
+		if !nextIsDigit {
+			break scan
+		}
+		switch {
+		case r == '.' || r == ',':
+			digits.WriteRune(r)
+		case unicode.IsSpace(r) || r == '\u202f' || r == '\'':
+			// thousands separator
+		default:
+			break scan
+		}
+	}
+
+	number := digits.String()
+	if number == "" {
+		return 0, fmt.Errorf("no amount in price %q", s)
+	}
+
+	// The last separator is the decimal one, any earlier ones group thousands.
+	if last := strings.LastIndexAny(number, ".,"); last >= 0 {
+		integer := strings.NewReplacer(".", "", ",", "").Replace(number[:last])
+		number = integer + "." + number[last+1:]
+	}
+
+	amount, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount in price %q: %w", s, err)
+	}
+	return amount, nil
+}
+
+// priceCurrency returns the ISO code of the currency mentioned in a price
+// string, or an empty string when none is found.
+func priceCurrency(s string) string {
+	fields := strings.FieldsFunc(strings.ToUpper(s), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsDigit(r) || r == '.' || r == ',' || r == '/'
+	})
+	for _, field := range fields {
+		if currency, ok := currencyAliases[strings.TrimSuffix(field, ".")]; ok {
+			return currency
+		}
+	}
+	return ""
+}
+
+// formatTotals renders per-currency sums, e.g. "2468.00 RUB + 10.50 USD".
+func formatTotals(totals map[string]float64) string {
+	currencies := make([]string, 0, len(totals))
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	parts := make([]string, 0, len(currencies))
+	for _, currency := range currencies {
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("%.2f %s", totals[currency], currency)))
+	}
+	return strings.Join(parts, " + ")
+}
+
+// formatGroupedTotals renders per-currency sums with grouped thousands, e.g.
+// "2 468.00 RUB + 10.50 USD". Currencies are never added together.
+func formatGroupedTotals(totals map[string]float64) string {
+	currencies := make([]string, 0, len(totals))
+	for currency := range totals {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	parts := make([]string, 0, len(currencies))
+	for _, currency := range currencies {
+		parts = append(parts, Price{Amount: totals[currency], Currency: currency}.Grouped())
+	}
+	return strings.Join(parts, " + ")
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	defaultPriceAlertsFile    = "price_alerts.json"
+	defaultPriceAlertInterval = time.Hour
+)
+
+// PriceAlert watches one product and fires when its price drops to
+// TargetPrice or below.
+type PriceAlert struct {
+	ItemID      string    `json:"item_id"`
+	Title       string    `json:"title"`
+	Link        string    `json:"link,omitempty"`
+	TargetPrice float64   `json:"target_price"`
+	CreatedAt   time.Time `json:"created_at"`
+	// LastPrice and Currency come from the latest successful check.
+	LastPrice     float64   `json:"last_price,omitempty"`
+	Currency      string    `json:"currency,omitempty"`
+	LastCheckedAt time.Time `json:"last_checked_at,omitzero"`
+	// TriggeredAt is set while the price stays at or below the target, so the
+	// alert fires once per drop rather than on every check.
+	TriggeredAt time.Time `json:"triggered_at,omitzero"`
+}
+
+// PriceAlertStore keeps price alerts by item ID and mirrors every change to
+// a JSON file. An empty path disables persistence.
+type PriceAlertStore struct {
+	path   string
+	alerts map[string]PriceAlert
+	mutex  sync.RWMutex
+}
+
+var priceAlerts = NewPriceAlertStore("")
+
+func NewPriceAlertStore(path string) *PriceAlertStore {
+	return &PriceAlertStore{path: path, alerts: make(map[string]PriceAlert)}
+}
+
+// priceAlertsPath places the price alerts file next to the cart file unless
+// PRICE_ALERTS_FILE points elsewhere.
+func priceAlertsPath(cartPath string) string {
+	if path := os.Getenv("PRICE_ALERTS_FILE"); path != "" {
+		return path
+	}
+	if cartPath == "" {
+		cartPath = defaultCartFile
+	}
+	return filepath.Join(filepath.Dir(cartPath), defaultPriceAlertsFile)
+}
+
+func (s *PriceAlertStore) Load() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read price alerts file %s: %w", s.path, err)
+	}
+
+	var alerts []PriceAlert
+	if err := json.Unmarshal(data, &alerts); err != nil {
+		return fmt.Errorf("failed to decode price alerts file %s: %w", s.path, err)
+	}
+	s.alerts = make(map[string]PriceAlert, len(alerts))
+	for _, alert := range alerts {
+		if alert.ItemID != "" {
+			s.alerts[alert.ItemID] = alert
+		}
+	}
+	return nil
+}
+
+// Put stores alert, replacing an existing alert for the same item.
+func (s *PriceAlertStore) Put(alert PriceAlert) (replaced bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, replaced = s.alerts[alert.ItemID]
+	s.alerts[alert.ItemID] = alert
+	return replaced, s.saveLocked()
+}
+
+func (s *PriceAlertStore) Delete(itemID string) (found bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found = s.alerts[itemID]; !found {
+		return false, nil
+	}
+	delete(s.alerts, itemID)
+	return true, s.saveLocked()
+}
+
+// List returns all alerts sorted by title.
+func (s *PriceAlertStore) List() []PriceAlert {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := make([]PriceAlert, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		result = append(result, alert)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Title != result[j].Title {
+			return result[i].Title < result[j].Title
+		}
+		return result[i].ItemID < result[j].ItemID
+	})
+	return result
+}
+
+// update applies fn to the alert for itemID if it still exists.
+func (s *PriceAlertStore) update(itemID string, fn func(*PriceAlert)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	alert, ok := s.alerts[itemID]
+	if !ok {
+		return nil
+	}
+	fn(&alert)
+	s.alerts[itemID] = alert
+	return s.saveLocked()
+}
+
+func (s *PriceAlertStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	alerts := make([]PriceAlert, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].ItemID < alerts[j].ItemID })
+
+	data, err := json.MarshalIndent(alerts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode price alerts: %w", err)
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// StartChecking re-checks every alert each interval until stop is closed.
+func (s *PriceAlertStore) StartChecking(interval time.Duration, stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.CheckAll(context.Background())
+			}
+		}
+	}()
+}
+
+// CheckAll searches for every alerted product by its title and compares the
+// price of the matching result with the alert's target.
+func (s *PriceAlertStore) CheckAll(ctx context.Context) {
+	for _, alert := range s.List() {
+		price, err := currentPrice(ctx, alert)
+		if err != nil {
+			slog.WarnContext(ctx, "price alert check failed", "item_id", alert.ItemID, "error", err)
+			continue
+		}
+
+		now := time.Now()
+		triggered := price.Amount <= alert.TargetPrice
+		if triggered && alert.TriggeredAt.IsZero() {
+			slog.InfoContext(ctx, "price_alert_triggered",
+				"item_id", alert.ItemID,
+				"title", alert.Title,
+				"link", alert.Link,
+				"price", price.Amount,
+				"currency", price.Currency,
+				"target_price", alert.TargetPrice)
+		}
+		err = s.update(alert.ItemID, func(stored *PriceAlert) {
+			stored.LastPrice = price.Amount
+			stored.Currency = price.Currency
+			stored.LastCheckedAt = now
+			switch {
+			case !triggered:
+				stored.TriggeredAt = time.Time{}
+			case stored.TriggeredAt.IsZero():
+				stored.TriggeredAt = now
+			}
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to save price alerts", "error", err)
+		}
+	}
+}
+
+// currentPrice finds the alerted product among the search results for its
+// title, matching by item ID or link.
+func currentPrice(ctx context.Context, alert PriceAlert) (Price, error) {
+	response, err := searchProducts(ctx, alert.Title, SearchParams{NumResults: searchPageSize, Start: 1, Safe: config.SafeSearch})
+	if err != nil {
+		return Price{}, err
+	}
+	for _, item := range response.Items {
+		if generateItemID(item) != alert.ItemID && (alert.Link == "" || canonicalLink(item.Link) != canonicalLink(alert.Link)) {
+			continue
+		}
+		price, ok := item.LowPrice()
+		if !ok {
+			return Price{}, errors.New("search result has no parseable price")
+		}
+		return price, nil
+	}
+	return Price{}, errors.New("product not found in search results for its title")
+}
+
+func (s *Server) handleSetPriceAlert(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	itemID, _ := args["item_id"].(string)
+	itemID = strings.TrimSpace(itemID)
+	title, _ := args["title"].(string)
+	title = strings.TrimSpace(title)
+	link, _ := args["link"].(string)
+	link = strings.TrimSpace(link)
+	target, ok := args["target_price"].(float64)
+
+	if itemID == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required"},
+			},
+		}, nil
+	}
+	if !ok || target <= 0 || math.IsInf(target, 0) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "target_price parameter is required and must be a positive number"},
+			},
+		}, nil
+	}
+	// Title and link may be omitted for products in the cart or in recent
+	// search results.
+	if product, _, found := s.lookupProduct(ctx, itemID); found {
+		title = cmp.Or(title, product.Title)
+		link = cmp.Or(link, product.Link)
+	}
+	if title == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("title parameter is required, product %s is not in the cart or recent search results", itemID)},
+			},
+		}, nil
+	}
+
+	replaced, err := priceAlerts.Put(PriceAlert{
+		ItemID:      itemID,
+		Title:       title,
+		Link:        link,
+		TargetPrice: target,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Failed to save price alert: %v", err)},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "price alert set", "item_id", itemID, "target_price", target, "replaced", replaced)
+
+	verb := "установлено"
+	if replaced {
+		verb = "обновлено"
+	}
+	result := fmt.Sprintf(`🔔 Уведомление о цене %s
+📦 %s
+🎯 Целевая цена: %.2f
+⏱️ Цена проверяется каждые %d мин.`,
+		verb, title, target, int(config.PriceAlertInterval.Minutes()))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func handleListPriceAlerts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	alerts := priceAlerts.List()
+	if len(alerts) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "🔔 Уведомлений о цене нет. Используйте set_price_alert, чтобы следить за ценой товара"},
+			},
+		}, nil
+	}
+
+	now := time.Now()
+	var lines []string
+	for _, alert := range alerts {
+		line := fmt.Sprintf("• %s (ID: %s)\n  🎯 Цель: %.2f", alert.Title, alert.ItemID, alert.TargetPrice)
+		if alert.LastCheckedAt.IsZero() {
+			line += ", ещё не проверялось"
+		} else {
+			line += fmt.Sprintf(", последняя цена: %.2f %s (%s)", alert.LastPrice, alert.Currency, formatRelativeTime(alert.LastCheckedAt, now))
+		}
+		if !alert.TriggeredAt.IsZero() {
+			line += "\n  ✅ Цена достигла цели " + formatRelativeTime(alert.TriggeredAt, now)
+		}
+		lines = append(lines, line)
+	}
+	result := fmt.Sprintf("🔔 Уведомления о цене (%d):\n\n%s", len(alerts), strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func handleDeletePriceAlert(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	itemID, _ := args["item_id"].(string)
+	itemID = strings.TrimSpace(itemID)
+
+	found, err := priceAlerts.Delete(itemID)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Failed to delete price alert: %v", err)},
+			},
+		}, nil
+	}
+	if !found {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("No price alert for item %s", itemID)},
+			},
+		}, nil
+	}
+	slog.InfoContext(ctx, "price alert deleted", "item_id", itemID)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: fmt.Sprintf("🔕 Уведомление о цене для товара %s удалено", itemID)},
+		},
+	}, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPriceAlertCheckAll(t *testing.T) {
+	var price atomic.Int32
+	price.Store(1500)
+	useSearchServer(t, "test-key", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"items": [
+			{"title": "Чайник Xiaomi", "link": "https://megamarket.ru/catalog/details/2"},
+			{"title": "Чайник Bosch", "link": "https://megamarket.ru/catalog/details/1",
+			 "pagemap": {"aggregateoffer": [{"pricecurrency": "RUB", "lowprice": "%d"}]}}
+		]}`, price.Load())
+	})
+	searchCache = NewSearchCache(0)
+
+	var logs bytes.Buffer
+	prevLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prevLogger) })
+
+	store := NewPriceAlertStore(filepath.Join(t.TempDir(), "price_alerts.json"))
+	item := SearchItem{Link: "https://megamarket.ru/catalog/details/1"}
+	if _, err := store.Put(PriceAlert{ItemID: generateItemID(item), Title: "Чайник Bosch", TargetPrice: 1000}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	triggered := func() int { return strings.Count(logs.String(), "price_alert_triggered") }
+	steps := []struct {
+		price         int32
+		wantTriggered int
+	}{
+		{price: 1500, wantTriggered: 0},
+		{price: 990, wantTriggered: 1},
+		// Staying below the target does not fire again.
+		{price: 950, wantTriggered: 1},
+		{price: 1200, wantTriggered: 1},
+		// A new drop fires again.
+		{price: 1000, wantTriggered: 2},
+	}
+	for _, step := range steps {
+		price.Store(step.price)
+		store.CheckAll(context.Background())
+		if got := triggered(); got != step.wantTriggered {
+			t.Fatalf("at price %d triggered %d times, want %d", step.price, got, step.wantTriggered)
+		}
+	}
+
+	reloaded := NewPriceAlertStore(store.path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	alerts := reloaded.List()
+	if len(alerts) != 1 || alerts[0].LastPrice != 1000 || alerts[0].Currency != "RUB" || alerts[0].TriggeredAt.IsZero() {
+		t.Errorf("reloaded alerts = %+v", alerts)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import "testing"
+
+func TestParsePrice(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw          string
+		wantAmount   float64
+		wantCurrency string
+		wantErr      bool
+	}{
+		{raw: "1 234,56", wantAmount: 1234.56},
+		{raw: "1 299,90 ₽", wantAmount: 1299.9, wantCurrency: "RUB"},
+		{raw: "от 1 234 RUB", wantAmount: 1234, wantCurrency: "RUB"},
+		{raw: "1234.56", wantAmount: 1234.56},
+		{raw: "от 1234 USD", wantAmount: 1234, wantCurrency: "USD"},
+		{raw: "12 500 руб.", wantAmount: 12500, wantCurrency: "RUB"},
+		{raw: "€9,99", wantAmount: 9.99, wantCurrency: "EUR"},
+		{raw: "1.234.567,89 р.", wantAmount: 1234567.89, wantCurrency: "RUB"},
+		{raw: "от 100 до 200", wantAmount: 100},
+		{raw: "Цена не указана", wantErr: true},
+		// Price strings as they appear in megamarket.ru search snippets.
+		{raw: "от 1 299 ₽", wantAmount: 1299, wantCurrency: "RUB"},
+		{raw: "2 990 ₽", wantAmount: 2990, wantCurrency: "RUB"},
+		{raw: "12 999₽", wantAmount: 12999, wantCurrency: "RUB"},
+		{raw: "7 490,00 ₽", wantAmount: 7490, wantCurrency: "RUB"},
+		{raw: "1 234 567 ₽", wantAmount: 1234567, wantCurrency: "RUB"},
+		{raw: "Цена: 3 499 ₽", wantAmount: 3499, wantCurrency: "RUB"},
+		{raw: "24 990 ₽/шт", wantAmount: 24990, wantCurrency: "RUB"},
+		{raw: "от 599 ₽ за 1 шт.", wantAmount: 599, wantCurrency: "RUB"},
+		{raw: "1 299 ₽ 1 499 ₽", wantAmount: 1299, wantCurrency: "RUB"},
+		{raw: "1\u202f299 ₽", wantAmount: 1299, wantCurrency: "RUB"},
+		{raw: "$19.99", wantAmount: 19.99, wantCurrency: "USD"},
+		{raw: "", wantErr: true},
+		{raw: "по запросу", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Parallel()
+
+			price, err := ParsePrice(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePrice(%q) error = %v, wantErr %t", tt.raw, err, tt.wantErr)
+			}
+			if price.Display != tt.raw {
+				t.Errorf("Display = %q, want %q", price.Display, tt.raw)
+			}
+			if price.Amount != tt.wantAmount || price.Currency != tt.wantCurrency {
+				t.Errorf("ParsePrice(%q) = %v %q, want %v %q", tt.raw, price.Amount, price.Currency, tt.wantAmount, tt.wantCurrency)
+			}
+		})
+	}
+}
+
+func TestSearchItemPrice(t *testing.T) {
+	t.Parallel()
+
+	var item SearchItem
+	if got := searchItemPrice(item).String(); got != "Цена не указана" {
+		t.Errorf("price without offers = %q", got)
+	}
+
+	item.PageMap.AggregateOffer = append(item.PageMap.AggregateOffer, struct {
+		PriceCurrency string `json:"pricecurrency"`
+		LowPrice      string `json:"lowprice"`
+		HighPrice     string `json:"highprice"`
+	}{PriceCurrency: "RUB", LowPrice: "1 299,90", HighPrice: "1599"})
+
+	price := searchItemPrice(item)
+	if got, want := price.String(), "от 1299.9 до 1599 RUB"; got != want {
+		t.Errorf("searchItemPrice() = %q, want %q", got, want)
+	}
+	if reparsed, err := ParsePrice(price.String()); err != nil || reparsed.Amount != 1299.9 || reparsed.Currency != "RUB" {
+		t.Errorf("display string does not parse back: %+v, %v", reparsed, err)
+	}
+}
+
+func TestSortByPrice(t *testing.T) {
+	t.Parallel()
+
+	item := func(link, low string) SearchItem {
+		var item SearchItem
+		item.Link = link
+		if low != "" {
+			item.PageMap.AggregateOffer = append(item.PageMap.AggregateOffer, struct {
+				PriceCurrency string `json:"pricecurrency"`
+				LowPrice      string `json:"lowprice"`
+				HighPrice     string `json:"highprice"`
+			}{PriceCurrency: "RUB", LowPrice: low})
+		}
+		return item
+	}
+	links := func(items []SearchItem) string {
+		var result string
+		for _, item := range items {
+			result += item.Link
+		}
+		return result
+	}
+
+	items := []SearchItem{item("a", "300"), item("b", ""), item("c", "100"), item("d", "200"), item("e", "нет")}
+	if unpriced := sortByPrice(items, false); unpriced != 2 {
+		t.Errorf("unpriced = %d, want 2", unpriced)
+	}
+	if got, want := links(items), "cdabe"; got != want {
+		t.Errorf("price_asc order = %s, want %s", got, want)
+	}
+	sortByPrice(items, true)
+	if got, want := links(items), "adcbe"; got != want {
+		t.Errorf("price_desc order = %s, want %s", got, want)
+	}
+}
+
+func TestPriceGrouped(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		price Price
+		want  string
+	}{
+		{price: Price{Amount: 0}, want: "0.00"},
+		{price: Price{Amount: 999.5, Currency: "RUB"}, want: "999.50 RUB"},
+		{price: Price{Amount: 1299.9, Currency: "RUB"}, want: "1 299.90 RUB"},
+		{price: Price{Amount: 1234567.891, Currency: "USD"}, want: "1 234 567.89 USD"},
+		{price: Price{Amount: -15000, Currency: "RUB"}, want: "-15 000.00 RUB"},
+	}
+	for _, tt := range tests {
+		if got := tt.price.Grouped(); got != tt.want {
+			t.Errorf("Grouped(%v) = %q, want %q", tt.price.Amount, got, tt.want)
+		}
+	}
+	if got := formatGroupedTotals(map[string]float64{"USD": 10.5, "RUB": 2468}); got != "2 468.00 RUB + 10.50 USD" {
+		t.Errorf("formatGroupedTotals() = %q", got)
+	}
+}
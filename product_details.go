@@ -0,0 +1,208 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	maxProductPageSize = 5 << 20
+	productPageAgent   = "Mozilla/5.0 (compatible; megamarket-mcp/1.0)"
+)
+
+// ProductDetails holds the schema.org Product fields found on a product page.
+type ProductDetails struct {
+	Name         string
+	Price        string
+	Currency     string
+	Availability string
+	Description  string
+	Brand        string
+	Image        string
+}
+
+// fetchProductDetails downloads a product page and extracts its JSON-LD
+// Product markup.
+func fetchProductDetails(ctx context.Context, link string) (*ProductDetails, error) {
+	pageURL, err := url.Parse(link)
+	if err != nil || (pageURL.Scheme != "http" && pageURL.Scheme != "https") || pageURL.Host == "" {
+		return nil, fmt.Errorf("link must be an absolute http or https URL")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create product page request: %w", err)
+	}
+	req.Header.Set("User-Agent", productPageAgent)
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch product page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("product page returned status %d", resp.StatusCode)
+	}
+	return parseProductPage(io.LimitReader(resp.Body, maxProductPageSize))
+}
+
+// parseProductPage looks for the first Product in the page's
+// <script type="application/ld+json"> blocks.
+func parseProductPage(r io.Reader) (*ProductDetails, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse product page: %w", err)
+	}
+
+	for node := range doc.Descendants() {
+		if node.Type != html.ElementNode || node.DataAtom != atom.Script || !isJSONLDScript(node) {
+			continue
+		}
+		var text strings.Builder
+		for child := range node.ChildNodes() {
+			if child.Type == html.TextNode {
+				text.WriteString(child.Data)
+			}
+		}
+
+		var data any
+		if err := json.Unmarshal([]byte(text.String()), &data); err != nil {
+			continue
+		}
+		if product := findJSONLDProduct(data); product != nil {
+			return productFromJSONLD(product), nil
+		}
+	}
+	return nil, errors.New("no schema.org Product markup found on the page")
+}
+
+func isJSONLDScript(node *html.Node) bool {
+	for _, attr := range node.Attr {
+		if attr.Key == "type" {
+			return strings.EqualFold(strings.TrimSpace(attr.Val), "application/ld+json")
+		}
+	}
+	return false
+}
+
+// findJSONLDProduct walks arrays and @graph containers to the first object
+// whose @type is or includes Product.
+func findJSONLDProduct(data any) map[string]any {
+	switch value := data.(type) {
+	case []any:
+		for _, element := range value {
+			if product := findJSONLDProduct(element); product != nil {
+				return product
+			}
+		}
+	case map[string]any:
+		if hasJSONLDType(value, "Product") {
+			return value
+		}
+		if graph, ok := value["@graph"]; ok {
+			return findJSONLDProduct(graph)
+		}
+	}
+	return nil
+}
+
+func hasJSONLDType(object map[string]any, want string) bool {
+	switch types := object["@type"].(type) {
+	case string:
+		return types == want
+	case []any:
+		for _, t := range types {
+			if t == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func productFromJSONLD(product map[string]any) *ProductDetails {
+	details := &ProductDetails{
+		Name:        jsonLDText(product["name"]),
+		Description: jsonLDText(product["description"]),
+		Brand:       jsonLDText(product["brand"]),
+		Image:       jsonLDImage(product["image"]),
+	}
+
+	offer, _ := product["offers"].(map[string]any)
+	if offers, ok := product["offers"].([]any); ok && len(offers) > 0 {
+		offer, _ = offers[0].(map[string]any)
+	}
+	if offer != nil {
+		details.Price = jsonLDText(offer["price"])
+		if details.Price == "" {
+			details.Price = jsonLDText(offer["lowPrice"])
+		}
+		details.Currency = jsonLDText(offer["priceCurrency"])
+		details.Availability = jsonLDAvailability(jsonLDText(offer["availability"]))
+	}
+	return details
+}
+
+// jsonLDText returns strings and numbers as text, and the name of nested
+// objects such as {"@type": "Brand", "name": "Bosch"}.
+func jsonLDText(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(html.UnescapeString(v))
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]any:
+		return jsonLDText(v["name"])
+	case []any:
+		if len(v) > 0 {
+			return jsonLDText(v[0])
+		}
+	}
+	return ""
+}
+
+// jsonLDImage accepts a URL, a list of URLs or an ImageObject.
+func jsonLDImage(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case []any:
+		if len(v) > 0 {
+			return jsonLDImage(v[0])
+		}
+	case map[string]any:
+		return jsonLDImage(cmp.Or(v["url"], v["contentUrl"]))
+	}
+	return ""
+}
+
+var availabilityLabels = map[string]string{
+	"InStock":             "в наличии",
+	"OutOfStock":          "нет в наличии",
+	"PreOrder":            "предзаказ",
+	"LimitedAvailability": "мало в наличии",
+	"Discontinued":        "снят с производства",
+	"SoldOut":             "распродан",
+}
+
+// jsonLDAvailability turns "https://schema.org/InStock" into a readable label.
+func jsonLDAvailability(value string) string {
+	name := value[strings.LastIndex(value, "/")+1:]
+	if label, ok := availabilityLabels[name]; ok {
+		return label
+	}
+	return name
+}
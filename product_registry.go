@@ -0,0 +1,203 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	productRegistryTTL         = time.Hour
+	defaultProductRegistrySize = 200
+	defaultRecentProductsLimit = 10
+)
+
+type registeredProduct struct {
+	ID     string
+	Item   SearchItem
+	SeenAt time.Time
+}
+
+// ProductRegistry remembers every product returned by recent searches, keyed
+// by its cart ID, so tools can refer to products that were never added to the cart.
+// It holds at most size products; when full, the least recently used one is
+// evicted.
+type ProductRegistry struct {
+	size     int
+	products map[string]*list.Element
+	// order lists *registeredProduct values, most recently used first.
+	order *list.List
+	mutex sync.Mutex
+}
+
+var productRegistry = NewProductRegistry(defaultProductRegistrySize)
+
+func NewProductRegistry(size int) *ProductRegistry {
+	if size <= 0 {
+		size = defaultProductRegistrySize
+	}
+	return &ProductRegistry{
+		size:     size,
+		products: make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Add registers items and forgets products not seen for productRegistryTTL.
+func (r *ProductRegistry) Add(items []SearchItem) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	for id, element := range r.products {
+		if now.Sub(element.Value.(*registeredProduct).SeenAt) > productRegistryTTL {
+			r.order.Remove(element)
+			delete(r.products, id)
+		}
+	}
+	for _, item := range items {
+		id := generateItemID(item)
+		if element, ok := r.products[id]; ok {
+			element.Value = &registeredProduct{ID: id, Item: item, SeenAt: now}
+			r.order.MoveToFront(element)
+			continue
+		}
+		r.products[id] = r.order.PushFront(&registeredProduct{ID: id, Item: item, SeenAt: now})
+	}
+	for r.order.Len() > r.size {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.products, oldest.Value.(*registeredProduct).ID)
+	}
+}
+
+// Get returns the product with itemID and marks it as recently used.
+func (r *ProductRegistry) Get(itemID string) (SearchItem, bool) {
+	product, ok := r.lookup(itemID)
+	return product.Item, ok
+}
+
+func (r *ProductRegistry) lookup(itemID string) (registeredProduct, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	element, ok := r.products[itemID]
+	if !ok {
+		return registeredProduct{}, false
+	}
+	product := element.Value.(*registeredProduct)
+	if time.Since(product.SeenAt) > productRegistryTTL {
+		return registeredProduct{}, false
+	}
+	r.order.MoveToFront(element)
+	return *product, true
+}
+
+// Recent returns up to limit products, most recently used first.
+func (r *ProductRegistry) Recent(limit int) []registeredProduct {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var result []registeredProduct
+	now := time.Now()
+	for element := r.order.Front(); element != nil && len(result) < limit; element = element.Next() {
+		product := element.Value.(*registeredProduct)
+		if now.Sub(product.SeenAt) <= productRegistryTTL {
+			result = append(result, *product)
+		}
+	}
+	return result
+}
+
+func handleLookupProduct(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	itemID, _ := args["item_id"].(string)
+	itemID = strings.TrimSpace(itemID)
+	if itemID == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "item_id parameter is required and must be a non-empty string"},
+			},
+		}, nil
+	}
+
+	product, ok := productRegistry.lookup(itemID)
+	if !ok {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Product %s not found among recent search results, run search_products again", itemID)},
+			},
+		}, nil
+	}
+
+	item := product.Item
+	result := fmt.Sprintf(`📦 %s
+🏪 Магазин: %s
+💰 Цена: %s
+🔗 Ссылка: %s
+📝 Описание: %s
+🕒 Найден: %s
+🆔 ID для корзины: %s`,
+		item.Title,
+		item.DisplayLink,
+		searchItemPrice(item),
+		item.Link,
+		item.Snippet,
+		product.SeenAt.Format("2006-01-02 15:04:05"),
+		product.ID,
+	)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
+
+func handleListRecentProducts(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	limit := defaultRecentProductsLimit
+	if value, ok := args["limit"].(float64); ok {
+		if value != float64(int(value)) || value < 1 {
+			return &mcp.CallToolResult{
+				IsError: true,
+				Content: []mcp.Content{
+					mcp.TextContent{Type: "text", Text: "limit must be a positive integer"},
+				},
+			}, nil
+		}
+		limit = int(value)
+	}
+
+	products := productRegistry.Recent(limit)
+	if len(products) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "📭 Недавно найденных товаров нет\n\n💡 Найдите товары через search_products"},
+			},
+		}, nil
+	}
+
+	lines := make([]string, 0, len(products))
+	for i, product := range products {
+		lines = append(lines, fmt.Sprintf("%d. %s — %s, %s (ID: %s)",
+			i+1, product.Item.Title, product.Item.DisplayLink, searchItemPrice(product.Item), product.ID))
+	}
+	result := fmt.Sprintf(`🕒 Недавно найденные товары (%d):
+
+%s`,
+		len(products), strings.Join(lines, "\n"))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result},
+		},
+	}, nil
+}
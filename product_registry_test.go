@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestProductRegistryEvictsLeastRecentlyUsed(t *testing.T) {
+	t.Parallel()
+
+	items := make([]SearchItem, 4)
+	for i := range items {
+		items[i] = SearchItem{Title: fmt.Sprintf("Товар %d", i), Link: fmt.Sprintf("https://megamarket.ru/catalog/details/%d", i)}
+	}
+	id := func(i int) string { return generateItemID(items[i]) }
+
+	registry := NewProductRegistry(3)
+	registry.Add(items[:3])
+	if _, ok := registry.Get(id(0)); !ok {
+		t.Fatalf("Get(item 0) did not find a registered product")
+	}
+	registry.Add(items[3:])
+
+	if _, ok := registry.Get(id(1)); ok {
+		t.Errorf("item 1 was least recently used and should have been evicted")
+	}
+	for _, i := range []int{0, 2, 3} {
+		if _, ok := registry.Get(id(i)); !ok {
+			t.Errorf("item %d was evicted, want it kept", i)
+		}
+	}
+
+	recent := registry.Recent(2)
+	if len(recent) != 2 || recent[0].ID != id(3) || recent[1].ID != id(2) {
+		t.Errorf("Recent(2) = %v, want items 3 and 2", recent)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func registerPrompts(s *server.MCPServer) {
+	s.AddPrompt(mcp.Prompt{
+		Name:        "find_cheapest",
+		Description: "Найти самый дешёвый товар в наличии и добавить его в корзину",
+		Arguments: []mcp.PromptArgument{
+			{
+				Name:        "product_name",
+				Description: "Что нужно найти, например «робот-пылесос Xiaomi»",
+				Required:    true,
+			},
+			{
+				Name:        "max_budget",
+				Description: "Максимальная цена в рублях",
+			},
+		},
+	}, handleFindCheapestPrompt)
+}
+
+func handleFindCheapestPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	productName := strings.TrimSpace(request.Params.Arguments["product_name"])
+	if productName == "" {
+		return nil, errors.New("product_name argument is required")
+	}
+
+	budget := ""
+	searchArgs := fmt.Sprintf(`query: "%s"`, productName)
+	if raw := strings.TrimSpace(request.Params.Arguments["max_budget"]); raw != "" {
+		maxBudget, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", "."), 64)
+		if err != nil || maxBudget <= 0 {
+			return nil, fmt.Errorf("max_budget must be a positive number, got %q", raw)
+		}
+		budget = fmt.Sprintf(" Бюджет — не дороже %.2f ₽.", maxBudget)
+		searchArgs += fmt.Sprintf(", max_price: %g", maxBudget)
+	}
+
+	task := fmt.Sprintf("Найди самый дешёвый товар «%s», который есть в наличии, и добавь его в корзину.%s", productName, budget)
+	plan := fmt.Sprintf(`План:
+1. Вызову search_products с %s.
+2. Если подходящих результатов мало, посмотрю следующую страницу через start: 11.
+3. Отброшу товары без цены и те, в описании которых сказано «нет в наличии», «под заказ» или «снят с продажи».
+4. Сравню цены оставшихся товаров (при необходимости через compare_products) и выберу самый дешёвый.
+5. Перед добавлением проверю search_cart, чтобы не добавить тот же товар повторно.
+6. Добавлю выбранный товар через add_result_to_cart и сообщу название, магазин, цену и ID.`, searchArgs)
+
+	return &mcp.GetPromptResult{
+		Description: fmt.Sprintf("Поиск самого дешёвого товара «%s»", productName),
+		Messages: []mcp.PromptMessage{
+			{
+				Role:    mcp.RoleUser,
+				Content: mcp.TextContent{Type: "text", Text: task},
+			},
+			{
+				Role:    mcp.RoleAssistant,
+				Content: mcp.TextContent{Type: "text", Text: plan},
+			},
+			{
+				Role:    mcp.RoleUser,
+				Content: mcp.TextContent{Type: "text", Text: "Выполняй план. Если ничего не подходит под условия, не добавляй ничего и объясни почему."},
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	googleSuggestURL    = "https://suggestqueries.google.com/complete/search"
+	maxQuerySuggestions = 10
+)
+
+// QuerySuggestClient completes a partial search query. Tests replace the
+// global querySuggestClient with one pointing at a fake server.
+type QuerySuggestClient interface {
+	Suggest(ctx context.Context, prefix string) ([]string, error)
+}
+
+var querySuggestClient QuerySuggestClient = NewGoogleSuggestClient(httpClient)
+
+// GoogleSuggestClient calls the Google autocomplete endpoint, which needs
+// no API key and does not count against the Custom Search quota.
+type GoogleSuggestClient struct {
+	HTTPClient *http.Client
+	BaseURL    string
+}
+
+func NewGoogleSuggestClient(client *http.Client) *GoogleSuggestClient {
+	return &GoogleSuggestClient{
+		HTTPClient: client,
+		BaseURL:    googleSuggestURL,
+	}
+}
+
+func (c *GoogleSuggestClient) Suggest(ctx context.Context, prefix string) ([]string, error) {
+	values := url.Values{}
+	values.Add("client", "firefox")
+	values.Add("q", prefix)
+	// Without these the endpoint may answer Cyrillic queries in windows-1251.
+	values.Add("ie", "utf-8")
+	values.Add("oe", "utf-8")
+	requestURL := c.BaseURL + "?" + values.Encode()
+
+	return withRetry(ctx, func() ([]string, error) {
+		return c.do(ctx, requestURL)
+	})
+}
+
+func (c *GoogleSuggestClient) do(ctx context.Context, requestURL string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create suggest request: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("failed to make suggest request: %w", &networkError{err: err})
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &SearchAPIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	// The response is ["prefix", ["completion", ...], ...].
+	var parts []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&parts); err != nil {
+		return nil, fmt.Errorf("failed to decode suggest response: %w", err)
+	}
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("failed to decode suggest response: expected 2 elements, got %d", len(parts))
+	}
+	var suggestions []string
+	if err := json.Unmarshal(parts[1], &suggestions); err != nil {
+		return nil, fmt.Errorf("failed to decode suggest response: %w", err)
+	}
+	return suggestions, nil
+}
+
+func handleSuggestQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	prefix, _ := args["prefix"].(string)
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "prefix parameter is required"},
+			},
+		}, nil
+	}
+
+	slog.InfoContext(ctx, "query suggest request", "prefix", prefix)
+	suggestions, err := querySuggestClient.Suggest(ctx, prefix)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Query suggestion failed: %v", err)},
+			},
+		}, nil
+	}
+
+	var lines []string
+	seen := make(map[string]bool)
+	for _, suggestion := range suggestions {
+		suggestion = strings.TrimSpace(suggestion)
+		if suggestion == "" || seen[strings.ToLower(suggestion)] {
+			continue
+		}
+		seen[strings.ToLower(suggestion)] = true
+		lines = append(lines, fmt.Sprintf("%d. %s", len(lines)+1, suggestion))
+		if len(lines) == maxQuerySuggestions {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🔤 Подсказок для «%s» нет\n\n💡 Попробуйте начало запроса покороче или сразу вызовите search_products", prefix)},
+			},
+		}, nil
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: fmt.Sprintf("🔤 Варианты запроса для «%s»:\n\n%s\n\n💡 Предложите пользователю выбрать вариант и передайте его в search_products",
+				prefix, strings.Join(lines, "\n"))},
+		},
+	}, nil
+}
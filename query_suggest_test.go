@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestHandleSuggestQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("client") != "firefox" || query.Get("oe") != "utf-8" {
+			t.Errorf("request query = %v, want client=firefox and oe=utf-8", query)
+		}
+		switch query.Get("q") {
+		case "чайник":
+			var completions []string
+			for i := range 12 {
+				completions = append(completions, fmt.Sprintf("%q", fmt.Sprintf("чайник %d", i+1)))
+			}
+			completions = append(completions[:2], append([]string{`"ЧАЙНИК 1"`}, completions[2:]...)...)
+			fmt.Fprintf(w, `["чайник",[%s],[],{"google:suggesttype":[]}]`, strings.Join(completions, ","))
+		case "ошибка":
+			http.Error(w, "bad request", http.StatusBadRequest)
+		default:
+			fmt.Fprintf(w, `[%q,[]]`, query.Get("q"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	prevClient := querySuggestClient
+	querySuggestClient = &GoogleSuggestClient{HTTPClient: srv.Client(), BaseURL: srv.URL}
+	t.Cleanup(func() { querySuggestClient = prevClient })
+
+	tests := []struct {
+		name      string
+		prefix    any
+		wantError bool
+		wantText  []string
+		skipText  []string
+	}{
+		{name: "missing prefix", prefix: "  ", wantError: true, wantText: []string{"prefix parameter is required"}},
+		{name: "completions", prefix: " чайник ", wantText: []string{"1. чайник 1\n2. чайник 2\n3. чайник 3", "10. чайник 10", "search_products"}, skipText: []string{"ЧАЙНИК 1", "чайник 11"}},
+		{name: "no completions", prefix: "zzzz", wantText: []string{"Подсказок для «zzzz» нет"}},
+		{name: "API error", prefix: "ошибка", wantError: true, wantText: []string{"Query suggestion failed", "400"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request mcp.CallToolRequest
+			request.Params.Arguments = map[string]any{"prefix": tt.prefix}
+			result, err := handleSuggestQuery(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handleSuggestQuery() error = %v", err)
+			}
+			text := toolResultText(result)
+			if result.IsError != tt.wantError {
+				t.Errorf("IsError = %t, want %t; text: %s", result.IsError, tt.wantError, text)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(text, want) {
+					t.Errorf("result text does not contain %q:\n%s", want, text)
+				}
+			}
+			for _, skip := range tt.skipText {
+				if strings.Contains(text, skip) {
+					t.Errorf("result text contains %q:\n%s", skip, text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+const (
+	searchMaxRetries     = 3
+	searchInitialBackoff = 500 * time.Millisecond
+	searchMaxBackoff     = 8 * time.Second
+	searchBackoffJitter  = 0.2
+)
+
+// SearchAPIError is returned when the Google API answers with a non-200 status.
+type SearchAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *SearchAPIError) Error() string {
+	return fmt.Sprintf("search API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// retryable reports whether the request may succeed if sent again. Rate
+// limiting and server-side failures are transient; everything else (bad
+// request, invalid key, quota disabled) will fail the same way next time.
+func (e *SearchAPIError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// networkError wraps transport failures so they can be told apart from
+// problems building the request or decoding the response.
+type networkError struct {
+	err error
+}
+
+func (e *networkError) Error() string { return e.err.Error() }
+func (e *networkError) Unwrap() error { return e.err }
+
+func isRetryable(err error) bool {
+	var apiErr *SearchAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.retryable()
+	}
+	var netErr *networkError
+	return errors.As(err, &netErr)
+}
+
+// backoffDelay returns the wait before retry number attempt (starting at 0):
+// the initial backoff doubled per attempt, capped, with ±20% jitter.
+func backoffDelay(attempt int) time.Duration {
+	delay := searchInitialBackoff << attempt
+	if delay <= 0 || delay > searchMaxBackoff {
+		delay = searchMaxBackoff
+	}
+	jitter := 1 + searchBackoffJitter*(2*rand.Float64()-1)
+	return time.Duration(float64(delay) * jitter)
+}
+
+// withRetry calls fn until it succeeds, fails with a non-retryable error,
+// runs out of retries or ctx is done.
+func withRetry[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt >= searchMaxRetries || !isRetryable(err) {
+			return result, err
+		}
+
+		delay := backoffDelay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return result, err
+		}
+		slog.WarnContext(ctx, "retrying search request", "attempt", attempt+1, "delay_ms", delay.Milliseconds(), "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSavedSearchesFile = "saved_searches.json"
+	maxSavedSearchNameLength = 64
+)
+
+// SavedSearch is a named search_products call that can be run again later.
+type SavedSearch struct {
+	Name       string    `json:"name"`
+	Query      string    `json:"query"`
+	NumResults int       `json:"num_results"`
+	Site       string    `json:"site,omitempty"`
+	MinPrice   *float64  `json:"min_price,omitempty"`
+	MaxPrice   *float64  `json:"max_price,omitempty"`
+	SavedAt    time.Time `json:"saved_at"`
+}
+
+// SavedSearchStore keeps saved searches in memory and mirrors every change
+// to a JSON file. An empty path disables persistence.
+type SavedSearchStore struct {
+	path     string
+	searches map[string]SavedSearch
+	mutex    sync.RWMutex
+}
+
+var savedSearches = NewSavedSearchStore("")
+
+func NewSavedSearchStore(path string) *SavedSearchStore {
+	return &SavedSearchStore{path: path, searches: make(map[string]SavedSearch)}
+}
+
+// savedSearchesPath places the saved searches file next to the cart file
+// unless SAVED_SEARCHES_FILE points elsewhere.
+func savedSearchesPath(cartPath string) string {
+	if path := os.Getenv("SAVED_SEARCHES_FILE"); path != "" {
+		return path
+	}
+	if cartPath == "" {
+		cartPath = defaultCartFile
+	}
+	return filepath.Join(filepath.Dir(cartPath), defaultSavedSearchesFile)
+}
+
+func (s *SavedSearchStore) Load() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read saved searches file %s: %w", s.path, err)
+	}
+
+	var searches []SavedSearch
+	if err := json.Unmarshal(data, &searches); err != nil {
+		return fmt.Errorf("failed to decode saved searches file %s: %w", s.path, err)
+	}
+	s.searches = make(map[string]SavedSearch, len(searches))
+	for _, search := range searches {
+		if search.Name != "" {
+			s.searches[search.Name] = search
+		}
+	}
+	return nil
+}
+
+// Put stores search under its name, replacing an existing one. replaced
+// reports whether the name was already taken.
+func (s *SavedSearchStore) Put(search SavedSearch) (replaced bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, replaced = s.searches[search.Name]
+	s.searches[search.Name] = search
+	return replaced, s.saveLocked()
+}
+
+func (s *SavedSearchStore) Delete(name string) (found bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, found = s.searches[name]; !found {
+		return false, nil
+	}
+	delete(s.searches, name)
+	return true, s.saveLocked()
+}
+
+func (s *SavedSearchStore) Get(name string) (SavedSearch, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	search, ok := s.searches[name]
+	return search, ok
+}
+
+// List returns all saved searches sorted by name.
+func (s *SavedSearchStore) List() []SavedSearch {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := make([]SavedSearch, 0, len(s.searches))
+	for _, search := range s.searches {
+		result = append(result, search)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func (s *SavedSearchStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	searches := make([]SavedSearch, 0, len(s.searches))
+	for _, search := range s.searches {
+		searches = append(searches, search)
+	}
+	sort.Slice(searches, func(i, j int) bool { return searches[i].Name < searches[j].Name })
+
+	data, err := json.MarshalIndent(searches, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode saved searches: %w", err)
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// args returns the search_products arguments that repeat this search.
+func (s SavedSearch) args() map[string]any {
+	args := map[string]any{
+		"query":       s.Query,
+		"num_results": float64(s.NumResults),
+	}
+	if s.Site != "" {
+		args["site"] = s.Site
+	}
+	if s.MinPrice != nil {
+		args["min_price"] = *s.MinPrice
+	}
+	if s.MaxPrice != nil {
+		args["max_price"] = *s.MaxPrice
+	}
+	return args
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultCacheTTL = 5 * time.Minute
+
+type cachedSearch struct {
+	Response  SearchResponse
+	ExpiresAt time.Time
+}
+
+// SearchCache keeps recent Google responses so identical queries within the
+// TTL don't spend API quota again.
+type SearchCache struct {
+	ttl     time.Duration
+	entries sync.Map
+}
+
+var searchCache = NewSearchCache(defaultCacheTTL)
+
+func NewSearchCache(ttl time.Duration) *SearchCache {
+	return &SearchCache{ttl: ttl}
+}
+
+func searchCacheKey(query string, params SearchParams) string {
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%s\x00%d\x00%d", query, params.EngineID, params.Safe, params.Language, params.Country, params.NumResults, params.Start)
+}
+
+// Get returns a copy of the cached response, so callers may modify it freely.
+func (c *SearchCache) Get(key string) (*SearchResponse, bool) {
+	value, ok := c.entries.Load(key)
+	if !ok {
+		return nil, false
+	}
+	entry := value.(*cachedSearch)
+	if time.Now().After(entry.ExpiresAt) {
+		c.entries.Delete(key)
+		return nil, false
+	}
+
+	response := entry.Response
+	response.Items = append([]SearchItem(nil), entry.Response.Items...)
+	return &response, true
+}
+
+func (c *SearchCache) Set(key string, response *SearchResponse) {
+	if c.ttl <= 0 {
+		return
+	}
+	entry := &cachedSearch{
+		Response:  *response,
+		ExpiresAt: time.Now().Add(c.ttl),
+	}
+	entry.Response.Items = append([]SearchItem(nil), response.Items...)
+	c.entries.Store(key, entry)
+}
+
+// StartEviction removes expired entries every TTL period until stop is closed.
+func (c *SearchCache) StartEviction(stop <-chan struct{}) {
+	if c.ttl <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(c.ttl)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				c.entries.Range(func(key, value any) bool {
+					if now.After(value.(*cachedSearch).ExpiresAt) {
+						c.entries.Delete(key)
+					}
+					return true
+				})
+			}
+		}
+	}()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/time/rate"
+)
+
+const googleSearchURL = "https://www.googleapis.com/customsearch/v1"
+
+// Connection pool settings of the shared HTTP client. Searches come in bursts
+// (paging, price alerts), so a few idle connections per host are kept open
+// instead of paying for a TCP and TLS handshake on every call.
+const (
+	httpMaxIdleConnsPerHost = 5
+	httpIdleConnTimeout     = 90 * time.Second
+)
+
+// newHTTPClient returns a client that keeps connections alive and speaks
+// HTTP/2 to hosts that support it, such as the Google APIs.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DisableKeepAlives:   false,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: httpMaxIdleConnsPerHost,
+		IdleConnTimeout:     httpIdleConnTimeout,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	if err := http2.ConfigureTransport(transport); err != nil {
+		slog.Warn("HTTP/2 is not available, falling back to HTTP/1.1", "error", err)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// Google SafeSearch levels, passed as the safe parameter of the API.
+const (
+	safeSearchActive = "active"
+	safeSearchOff    = "off"
+)
+
+// parseSafeSearch reads GOOGLE_SAFE_SEARCH, keeping the filter on unless
+// it is explicitly turned off.
+func parseSafeSearch(value string) string {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "":
+		return defaultSafeSearch
+	case safeSearchActive, safeSearchOff:
+		return value
+	default:
+		slog.Warn("ignoring GOOGLE_SAFE_SEARCH, expected active or off", "value", value)
+		return defaultSafeSearch
+	}
+}
+
+// SearchParams are the paging and filtering options of a search request.
+type SearchParams struct {
+	NumResults int
+	Start      int
+	// EngineID overrides the client's search engine when set.
+	EngineID string
+	// Safe is the SafeSearch level; empty leaves the API default (off).
+	Safe string
+	// Language and Country are codes checked by searchLocaleFromArgs;
+	// empty leaves the results unrestricted.
+	Language string
+	Country  string
+}
+
+// SearchClient runs product searches. Tests replace the global searchClient
+// with one pointing at a fake server.
+type SearchClient interface {
+	Search(ctx context.Context, query string, params SearchParams) (*SearchResponse, error)
+}
+
+// GoogleSearchClient calls the Google Custom Search JSON API, retrying
+// transient failures.
+type GoogleSearchClient struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	APIKey     string
+	EngineID   string
+	// Limiter paces API calls, retries included; nil means no limit.
+	Limiter *rate.Limiter
+}
+
+var searchClient SearchClient = NewGoogleSearchClient(httpClient, "", "", defaultGoogleAPIRPS)
+
+func NewGoogleSearchClient(client *http.Client, apiKey, engineID string, rps float64) *GoogleSearchClient {
+	return &GoogleSearchClient{
+		HTTPClient: client,
+		BaseURL:    googleSearchURL,
+		APIKey:     apiKey,
+		EngineID:   engineID,
+		Limiter:    rate.NewLimiter(rate.Limit(rps), 1),
+	}
+}
+
+// RateLimitError is returned when the request deadline would pass before the
+// rate limiter lets the next API call through.
+type RateLimitError struct {
+	RPS float64
+	Err error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("search is rate limited to %g requests per second (GOOGLE_API_RPS) and the request timed out waiting for its turn, try again in a moment: %v", e.RPS, e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error { return e.Err }
+
+func (c *GoogleSearchClient) Search(ctx context.Context, query string, params SearchParams) (*SearchResponse, error) {
+	cfg := Config{GoogleAPIKey: c.APIKey, SearchEngineID: cmp.Or(params.EngineID, c.EngineID)}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	values.Add("key", c.APIKey)
+	values.Add("cx", cfg.SearchEngineID)
+	values.Add("q", query)
+	values.Add("num", strconv.Itoa(params.NumResults))
+	values.Add("start", strconv.Itoa(params.Start))
+	if params.Safe != "" {
+		values.Add("safe", params.Safe)
+	}
+	if params.Language != "" {
+		values.Add("lr", googleLanguageRestrict(params.Language))
+	}
+	if params.Country != "" {
+		values.Add("gl", googleCountry(params.Country))
+	}
+	requestURL := c.BaseURL + "?" + values.Encode()
+
+	return withRetry(ctx, func() (*SearchResponse, error) {
+		return c.do(ctx, requestURL)
+	})
+}
+
+// do performs a single API call once the limiter allows it.
+func (c *GoogleSearchClient) do(ctx context.Context, requestURL string) (*SearchResponse, error) {
+	if c.Limiter != nil {
+		if err := c.Limiter.Wait(ctx); err != nil {
+			return nil, &RateLimitError{RPS: float64(c.Limiter.Limit()), Err: err}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create search request: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// url.Error repeats the request URL, which carries the API key.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("failed to make search request: %w", &networkError{err: err})
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &SearchAPIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var searchResponse SearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&searchResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode search response: %w", err)
+	}
+
+	return &searchResponse, nil
+}
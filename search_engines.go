@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// parseSearchEngineMap parses SEARCH_ENGINE_MAP, a comma-separated list of
+// category:cx_id pairs such as "electronics:abc123,books:def456". Category
+// names are case-insensitive; malformed pairs are logged and skipped.
+func parseSearchEngineMap(value string) map[string]string {
+	engines := make(map[string]string)
+	for pair := range strings.SplitSeq(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		category, engineID, ok := strings.Cut(pair, ":")
+		category = strings.ToLower(strings.TrimSpace(category))
+		engineID = strings.TrimSpace(engineID)
+		if !ok || category == "" || engineID == "" {
+			slog.Warn("ignoring malformed SEARCH_ENGINE_MAP entry, expected category:cx_id", "entry", pair)
+			continue
+		}
+		engines[category] = engineID
+	}
+	return engines
+}
+
+// searchCategories returns the configured category names in sorted order.
+func (c *Config) searchCategories() []string {
+	categories := make([]string, 0, len(c.SearchEngines))
+	for category := range c.SearchEngines {
+		categories = append(categories, category)
+	}
+	slices.Sort(categories)
+	return categories
+}
+
+// searchEngineFor returns the CX ID configured for category. An empty
+// category selects the default GOOGLE_SEARCH_ENGINE_ID, reported as "".
+func (c *Config) searchEngineFor(category string) (string, error) {
+	category = strings.ToLower(strings.TrimSpace(category))
+	if category == "" {
+		return "", nil
+	}
+	if engineID, ok := c.SearchEngines[category]; ok {
+		return engineID, nil
+	}
+	if len(c.SearchEngines) == 0 {
+		return "", fmt.Errorf("search category %q is not configured: SEARCH_ENGINE_MAP is not set", category)
+	}
+	return "", fmt.Errorf("search category %q is not configured, available categories: %s", category, strings.Join(c.searchCategories(), ", "))
+}
+
+// searchCategoryDescription lists the categories of SEARCH_ENGINE_MAP so the
+// model knows which values are accepted.
+func searchCategoryDescription(cfg *Config) string {
+	description := "Категория товаров: поиск выполняется отдельной поисковой системой, настроенной для неё в SEARCH_ENGINE_MAP. Без параметра используется GOOGLE_SEARCH_ENGINE_ID"
+	if categories := cfg.searchCategories(); len(categories) > 0 {
+		description += ". Доступные категории: " + strings.Join(categories, ", ")
+	}
+	return description
+}
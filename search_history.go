@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultSearchHistorySize = 50
+
+type SearchHistoryEntry struct {
+	Query        string
+	Results      int
+	TotalResults string
+	SearchedAt   time.Time
+}
+
+// SearchHistory is a fixed-size ring buffer of the most recent searches.
+type SearchHistory struct {
+	entries []SearchHistoryEntry
+	next    int
+	full    bool
+	mutex   sync.Mutex
+}
+
+var searchHistory = NewSearchHistory(defaultSearchHistorySize)
+
+func NewSearchHistory(size int) *SearchHistory {
+	if size <= 0 {
+		size = defaultSearchHistorySize
+	}
+	return &SearchHistory{entries: make([]SearchHistoryEntry, size)}
+}
+
+func (h *SearchHistory) Add(entry SearchHistoryEntry) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Recent returns the recorded searches, newest first.
+func (h *SearchHistory) Recent() []SearchHistoryEntry {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.entries)
+	}
+
+	result := make([]SearchHistoryEntry, 0, count)
+	for i := 1; i <= count; i++ {
+		result = append(result, h.entries[(h.next-i+len(h.entries))%len(h.entries)])
+	}
+	return result
+}
+
+// Clear forgets all searches and returns how many were removed.
+func (h *SearchHistory) Clear() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.entries)
+	}
+	h.entries = make([]SearchHistoryEntry, len(h.entries))
+	h.next = 0
+	h.full = false
+	return count
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// searchLanguages maps the ISO 639-1 codes accepted by the language
+// parameter to the lr values of the Google API, which supports only these
+// languages and uses older codes for some of them.
+var searchLanguages = map[string]string{
+	"ar": "lang_ar",
+	"bg": "lang_bg",
+	"ca": "lang_ca",
+	"cs": "lang_cs",
+	"da": "lang_da",
+	"de": "lang_de",
+	"el": "lang_el",
+	"en": "lang_en",
+	"es": "lang_es",
+	"et": "lang_et",
+	"fi": "lang_fi",
+	"fr": "lang_fr",
+	"he": "lang_iw",
+	"hr": "lang_hr",
+	"hu": "lang_hu",
+	"id": "lang_id",
+	"is": "lang_is",
+	"it": "lang_it",
+	"ja": "lang_ja",
+	"ko": "lang_ko",
+	"lt": "lang_lt",
+	"lv": "lang_lv",
+	"nl": "lang_nl",
+	"no": "lang_no",
+	"pl": "lang_pl",
+	"pt": "lang_pt",
+	"ro": "lang_ro",
+	"ru": "lang_ru",
+	"sk": "lang_sk",
+	"sl": "lang_sl",
+	"sr": "lang_sr",
+	"sv": "lang_sv",
+	"tr": "lang_tr",
+	"zh": "lang_zh-CN",
+}
+
+// searchCountries are the ISO 3166-1 alpha-2 codes accepted by the country
+// parameter.
+var searchCountries = func() map[string]bool {
+	codes := strings.Fields(`
+		ad ae af ag ai al am ao aq ar as at au aw ax az
+		ba bb bd be bf bg bh bi bj bl bm bn bo bq br bs bt bv bw by bz
+		ca cc cd cf cg ch ci ck cl cm cn co cr cu cv cw cx cy cz
+		de dj dk dm do dz ec ee eg eh er es et fi fj fk fm fo fr
+		ga gb gd ge gf gg gh gi gl gm gn gp gq gr gs gt gu gw gy
+		hk hm hn hr ht hu id ie il im in io iq ir is it je jm jo jp
+		ke kg kh ki km kn kp kr kw ky kz la lb lc li lk lr ls lt lu lv ly
+		ma mc md me mf mg mh mk ml mm mn mo mp mq mr ms mt mu mv mw mx my mz
+		na nc ne nf ng ni nl no np nr nu nz om
+		pa pe pf pg ph pk pl pm pn pr ps pt pw py qa re ro rs ru rw
+		sa sb sc sd se sg sh si sj sk sl sm sn so sr ss st sv sx sy sz
+		tc td tf tg th tj tk tl tm tn to tr tt tv tw tz
+		ua ug um us uy uz va vc ve vg vi vn vu wf ws ye yt za zm zw`)
+	countries := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		countries[code] = true
+	}
+	return countries
+}()
+
+// googleLanguageRestrict returns the lr value for a language code.
+func googleLanguageRestrict(language string) string {
+	return searchLanguages[language]
+}
+
+// googleCountry returns the gl value for a country code. Google knows the
+// United Kingdom as uk rather than its ISO code gb.
+func googleCountry(country string) string {
+	if country == "gb" {
+		return "uk"
+	}
+	return country
+}
+
+// searchLanguageCodes lists the accepted language codes, sorted.
+func searchLanguageCodes() []string {
+	return slices.Sorted(maps.Keys(searchLanguages))
+}
+
+// searchLocaleFromArgs reads the language and country parameters. Only codes
+// from the allowlists pass, so the values cannot smuggle other parameters
+// into the API request.
+func searchLocaleFromArgs(args map[string]any) (language, country string, err error) {
+	if value, present := args["language"]; present && value != nil {
+		code, ok := value.(string)
+		language = strings.ToLower(strings.TrimSpace(code))
+		if _, known := searchLanguages[language]; !ok || !known {
+			return "", "", fmt.Errorf("language parameter must be an ISO 639-1 code supported by Google search: %s", strings.Join(searchLanguageCodes(), ", "))
+		}
+	}
+	if value, present := args["country"]; present && value != nil {
+		code, ok := value.(string)
+		country = strings.ToLower(strings.TrimSpace(code))
+		if !ok || !searchCountries[country] {
+			return "", "", fmt.Errorf("country parameter must be an ISO 3166-1 alpha-2 code such as ru, got %q", code)
+		}
+	}
+	return language, country, nil
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/time/rate"
+)
+
+const twoItemsResponse = `{
+	"kind": "customsearch#search",
+	"searchInformation": {"searchTime": 0.12, "totalResults": "2"},
+	"items": [
+		{"title": "Чайник Bosch", "link": "https://megamarket.ru/catalog/details/1", "displayLink": "megamarket.ru", "snippet": "Электрический чайник"},
+		{"title": "Чайник Xiaomi", "link": "https://megamarket.ru/catalog/details/2", "displayLink": "megamarket.ru", "snippet": "Умный чайник"}
+	]
+}`
+
+// useSearchServer points the global search client at a test server running
+// handler and gives the test an empty search cache.
+func useSearchServer(t *testing.T, apiKey string, handler http.HandlerFunc) {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	prevClient, prevCache := searchClient, searchCache
+	searchClient = &GoogleSearchClient{
+		HTTPClient: srv.Client(),
+		BaseURL:    srv.URL,
+		APIKey:     apiKey,
+		EngineID:   "test-engine",
+	}
+	searchCache = NewSearchCache(time.Minute)
+	t.Cleanup(func() {
+		srv.Close()
+		searchClient, searchCache = prevClient, prevCache
+	})
+}
+
+func callSearchProducts(t *testing.T, args map[string]any) (*mcp.CallToolResult, string) {
+	t.Helper()
+
+	var request mcp.CallToolRequest
+	request.Params.Name = "search_products"
+	request.Params.Arguments = args
+
+	result, err := handleSearchProducts(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handleSearchProducts() error = %v", err)
+	}
+	return result, toolResultText(result)
+}
+
+func TestHandleSearchProducts(t *testing.T) {
+	tests := []struct {
+		name      string
+		apiKey    string
+		responses []func(http.ResponseWriter)
+		wantError bool
+		wantCalls int32
+		wantText  []string
+	}{
+		{
+			name:   "successful results",
+			apiKey: "test-key",
+			responses: []func(http.ResponseWriter){
+				func(w http.ResponseWriter) { w.Write([]byte(twoItemsResponse)) },
+			},
+			wantCalls: 1,
+			wantText:  []string{"Чайник Bosch", "Чайник Xiaomi", "Найдено: 2"},
+		},
+		{
+			name:      "API key missing",
+			apiKey:    "",
+			wantError: true,
+			wantCalls: 0,
+			wantText:  []string{"GOOGLE_API_KEY"},
+		},
+		{
+			name:   "HTTP 400 is not retried",
+			apiKey: "test-key",
+			responses: []func(http.ResponseWriter){
+				func(w http.ResponseWriter) { http.Error(w, `{"error": "bad request"}`, http.StatusBadRequest) },
+			},
+			wantError: true,
+			wantCalls: 1,
+			wantText:  []string{"status 400"},
+		},
+		{
+			name:   "HTTP 429 triggers retry",
+			apiKey: "test-key",
+			responses: []func(http.ResponseWriter){
+				func(w http.ResponseWriter) { http.Error(w, "rate limited", http.StatusTooManyRequests) },
+				func(w http.ResponseWriter) { w.Write([]byte(twoItemsResponse)) },
+			},
+			wantCalls: 2,
+			wantText:  []string{"Чайник Bosch"},
+		},
+		{
+			name:   "zero results",
+			apiKey: "test-key",
+			responses: []func(http.ResponseWriter){
+				func(w http.ResponseWriter) {
+					w.Write([]byte(`{"searchInformation": {"searchTime": 0.01, "totalResults": "0"}}`))
+				},
+			},
+			wantCalls: 1,
+			wantText:  []string{"Найдено: 0"},
+		},
+		{
+			name:   "malformed JSON",
+			apiKey: "test-key",
+			responses: []func(http.ResponseWriter){
+				func(w http.ResponseWriter) { w.Write([]byte(`{"items": [`)) },
+			},
+			wantError: true,
+			wantCalls: 1,
+			wantText:  []string{"failed to decode search response"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			useSearchServer(t, tt.apiKey, func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1))
+				if got := r.URL.Query().Get("q"); got != "чайник" {
+					t.Errorf("query q = %q, want %q", got, "чайник")
+				}
+				if got := r.URL.Query().Get("key"); got != tt.apiKey {
+					t.Errorf("query key = %q, want %q", got, tt.apiKey)
+				}
+				if n > len(tt.responses) {
+					t.Errorf("unexpected request #%d", n)
+					http.Error(w, "unexpected request", http.StatusInternalServerError)
+					return
+				}
+				tt.responses[n-1](w)
+			})
+
+			result, text := callSearchProducts(t, map[string]any{"query": "чайник"})
+			if result.IsError != tt.wantError {
+				t.Errorf("IsError = %t, want %t; text: %s", result.IsError, tt.wantError, text)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(text, want) {
+					t.Errorf("result text does not contain %q:\n%s", want, text)
+				}
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server received %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSearchProductsPaging(t *testing.T) {
+	var calls, inFlight, maxInFlight atomic.Int32
+	useSearchServer(t, "test-key", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if current <= peak || maxInFlight.CompareAndSwap(peak, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		num, _ := strconv.Atoi(r.URL.Query().Get("num"))
+		var items []string
+		for i := start; i < start+num; i++ {
+			items = append(items, fmt.Sprintf(`{"title": "Товар %d", "link": "https://megamarket.ru/catalog/details/%d"}`, i, i))
+		}
+		fmt.Fprintf(w, `{"searchInformation": {"totalResults": "100"}, "items": [%s]}`, strings.Join(items, ","))
+	})
+
+	response, err := searchProducts(context.Background(), "чайник", SearchParams{NumResults: 45, Start: 1, Safe: safeSearchActive})
+	if err != nil {
+		t.Fatalf("searchProducts() error = %v", err)
+	}
+	if got := calls.Load(); got != 5 {
+		t.Errorf("server received %d requests, want 5", got)
+	}
+	if got := maxInFlight.Load(); got > maxSearchConcurrency {
+		t.Errorf("%d requests ran concurrently, want at most %d", got, maxSearchConcurrency)
+	}
+	if len(response.Items) != 45 {
+		t.Fatalf("got %d items, want 45", len(response.Items))
+	}
+	for i, item := range response.Items {
+		if want := fmt.Sprintf("Товар %d", i+1); item.Title != want {
+			t.Fatalf("item %d title = %q, want %q", i, item.Title, want)
+		}
+	}
+}
+
+func TestSearchRateLimitDeadline(t *testing.T) {
+	var calls atomic.Int32
+	client := &GoogleSearchClient{
+		APIKey:   "test-key",
+		EngineID: "test-engine",
+		Limiter:  rate.NewLimiter(rate.Every(time.Hour), 1),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(twoItemsResponse))
+	}))
+	t.Cleanup(srv.Close)
+	client.HTTPClient, client.BaseURL = srv.Client(), srv.URL
+
+	if _, err := client.Search(t.Context(), "чайник", SearchParams{NumResults: 2, Start: 1}); err != nil {
+		t.Fatalf("first Search() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Search(ctx, "чайник", SearchParams{NumResults: 2, Start: 1})
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("second Search() error = %v, want *RateLimitError", err)
+	}
+	if !strings.Contains(err.Error(), "GOOGLE_API_RPS") {
+		t.Errorf("error %q does not mention GOOGLE_API_RPS", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("API called %d times, want 1", got)
+	}
+}
+
+func TestSearchProductsCategory(t *testing.T) {
+	var engines []string
+	useSearchServer(t, "test-key", func(w http.ResponseWriter, r *http.Request) {
+		engines = append(engines, r.URL.Query().Get("cx"))
+		fmt.Fprint(w, twoItemsResponse)
+	})
+	prevEngines := config.SearchEngines
+	config.SearchEngines = parseSearchEngineMap("electronics:cx-electronics, Books : cx-books,broken,:cx-none")
+	t.Cleanup(func() { config.SearchEngines = prevEngines })
+
+	if want := map[string]string{"electronics": "cx-electronics", "books": "cx-books"}; !reflect.DeepEqual(config.SearchEngines, want) {
+		t.Fatalf("parseSearchEngineMap() = %v, want %v", config.SearchEngines, want)
+	}
+
+	for _, category := range []string{"", "electronics", "BOOKS"} {
+		if result, text := callSearchProducts(t, map[string]any{"query": "чайник", "category": category}); result.IsError {
+			t.Fatalf("category %q: unexpected error: %s", category, text)
+		}
+	}
+	if want := []string{"test-engine", "cx-electronics", "cx-books"}; !reflect.DeepEqual(engines, want) {
+		t.Errorf("requests used engines %v, want %v", engines, want)
+	}
+
+	result, text := callSearchProducts(t, map[string]any{"query": "чайник", "category": "toys"})
+	if !result.IsError || !strings.Contains(text, "books, electronics") {
+		t.Errorf("unknown category: IsError = %t, text = %q, want an error listing the categories", result.IsError, text)
+	}
+	if len(engines) != 3 {
+		t.Errorf("unknown category made a search request")
+	}
+}
+
+func TestSearchProductsIncludeImages(t *testing.T) {
+	useSearchServer(t, "test-key", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"searchInformation": {"totalResults": "2"}, "items": [
+			{"title": "Чайник Bosch", "link": "https://megamarket.ru/catalog/details/1", "pagemap": {"cse_image": [{"src": "x-raw-image:///abc"}, {"src": "https://main-cdn.sbermegamarket.ru/1.jpg"}]}},
+			{"title": "Чайник Xiaomi", "link": "https://megamarket.ru/catalog/details/2"}
+		]}`)
+	})
+
+	_, text := callSearchProducts(t, map[string]any{"query": "чайник"})
+	if strings.Contains(text, "Изображение") {
+		t.Errorf("images shown without include_images:\n%s", text)
+	}
+	_, text = callSearchProducts(t, map[string]any{"query": "чайник", "include_images": true})
+	if want := "📝 Описание: \n🖼️ Изображение: https://main-cdn.sbermegamarket.ru/1.jpg\n🆔"; !strings.Contains(text, want) {
+		t.Errorf("result text does not contain %q:\n%s", want, text)
+	}
+	if count := strings.Count(text, "Изображение"); count != 1 {
+		t.Errorf("%d images shown, want 1 for the only result with a photo:\n%s", count, text)
+	}
+}
+
+func TestSearchProductsSafeSearch(t *testing.T) {
+	var levels []string
+	useSearchServer(t, "test-key", func(w http.ResponseWriter, r *http.Request) {
+		levels = append(levels, r.URL.Query().Get("safe"))
+		fmt.Fprint(w, twoItemsResponse)
+	})
+	prevSafeSearch := config.SafeSearch
+	t.Cleanup(func() { config.SafeSearch = prevSafeSearch })
+
+	tests := []struct {
+		name       string
+		serverSafe string
+		args       map[string]any
+		wantSafe   string
+	}{
+		{name: "server default", serverSafe: safeSearchActive, args: map[string]any{"query": "чайник"}, wantSafe: "active"},
+		{name: "adult content requested", serverSafe: safeSearchActive, args: map[string]any{"query": "чайник", "adult_content": true}, wantSafe: "off"},
+		// The same query is cached per SafeSearch level.
+		{name: "server allows adult content", serverSafe: safeSearchOff, args: map[string]any{"query": "утюг"}, wantSafe: "off"},
+		{name: "filter requested", serverSafe: safeSearchOff, args: map[string]any{"query": "утюг", "adult_content": false}, wantSafe: "active"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			levels = nil
+			config.SafeSearch = tt.serverSafe
+			result, text := callSearchProducts(t, tt.args)
+			if result.IsError {
+				t.Fatalf("unexpected error: %s", text)
+			}
+			if len(levels) != 1 || levels[0] != tt.wantSafe {
+				t.Errorf("requests used safe=%v, want %q", levels, tt.wantSafe)
+			}
+			if off := strings.Contains(text, "Безопасный поиск выключен"); off != (tt.wantSafe == "off") {
+				t.Errorf("result mentions SafeSearch off = %t, want %t:\n%s", off, tt.wantSafe == "off", text)
+			}
+		})
+	}
+
+	for value, want := range map[string]string{"": "active", " OFF ": "off", "strict": "active"} {
+		if got := parseSafeSearch(value); got != want {
+			t.Errorf("parseSafeSearch(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestSearchProductsLocale(t *testing.T) {
+	var queries []url.Values
+	useSearchServer(t, "test-key", func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		fmt.Fprint(w, twoItemsResponse)
+	})
+
+	tests := []struct {
+		name        string
+		args        map[string]any
+		wantLR      string
+		wantGL      string
+		wantErrText string
+	}{
+		{name: "no locale", args: map[string]any{"query": "пылесос"}},
+		{name: "language and country", args: map[string]any{"query": "пылесос", "language": "RU", "country": " kz "}, wantLR: "lang_ru", wantGL: "kz"},
+		{name: "google codes", args: map[string]any{"query": "пылесос", "language": "zh", "country": "gb"}, wantLR: "lang_zh-CN", wantGL: "uk"},
+		{name: "unknown language", args: map[string]any{"query": "пылесос", "language": "xx"}, wantErrText: "language parameter"},
+		{name: "parameter injection", args: map[string]any{"query": "пылесос", "language": "ru&safe=off"}, wantErrText: "language parameter"},
+		{name: "unknown country", args: map[string]any{"query": "пылесос", "country": "ru&num=10"}, wantErrText: "country parameter"},
+		{name: "country name", args: map[string]any{"query": "пылесос", "country": "russia"}, wantErrText: "country parameter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries = nil
+			result, text := callSearchProducts(t, tt.args)
+			if tt.wantErrText != "" {
+				if !result.IsError || !strings.Contains(text, tt.wantErrText) || len(queries) != 0 {
+					t.Errorf("result = %q with %d requests, want an error mentioning %q and no request", text, len(queries), tt.wantErrText)
+				}
+				return
+			}
+			if result.IsError {
+				t.Fatalf("unexpected error: %s", text)
+			}
+			if len(queries) != 1 {
+				t.Fatalf("server received %d requests, want 1", len(queries))
+			}
+			if lr, gl := queries[0].Get("lr"), queries[0].Get("gl"); lr != tt.wantLR || gl != tt.wantGL {
+				t.Errorf("request used lr=%q gl=%q, want lr=%q gl=%q", lr, gl, tt.wantLR, tt.wantGL)
+			}
+			if _, hasLR := queries[0]["lr"]; hasLR != (tt.wantLR != "") {
+				t.Errorf("request has lr = %t, want %t", hasLR, tt.wantLR != "")
+			}
+		})
+	}
+}
+
+func TestHandleSearchByImageURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("url"); got != "https://example.com/kettle.jpg" {
+			t.Errorf("url = %q, want the image URL", got)
+		}
+		fmt.Fprint(w, `{"visual_matches": [
+			{"title": "Чайник Bosch", "link": "https://www.megamarket.ru/catalog/details/1", "source": "Мегамаркет", "price": {"value": "2 499 ₽", "extracted_value": 2499, "currency": "₽"}},
+			{"title": "Без ссылки"}
+		]}`)
+	}))
+	t.Cleanup(srv.Close)
+	prevClient := visualSearchClient
+	visualSearchClient = &GoogleLensClient{HTTPClient: srv.Client(), BaseURL: srv.URL, APIKey: "test-key"}
+	t.Cleanup(func() { visualSearchClient = prevClient })
+
+	call := func(args map[string]any) (*mcp.CallToolResult, string) {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = args
+		result, err := handleSearchByImageURL(context.Background(), request)
+		if err != nil {
+			t.Fatalf("handleSearchByImageURL() error = %v", err)
+		}
+		return result, toolResultText(result)
+	}
+
+	if result, text := call(map[string]any{"image_url": "not a url"}); !result.IsError {
+		t.Errorf("invalid image_url accepted: %s", text)
+	}
+
+	result, text := call(map[string]any{"image_url": "https://example.com/kettle.jpg"})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", text)
+	}
+	for _, want := range []string{"Чайник Bosch", "Магазин: megamarket.ru", "2499", "Показано: 1", "ID для корзины: "} {
+		if !strings.Contains(text, want) {
+			t.Errorf("result text does not contain %q:\n%s", want, text)
+		}
+	}
+}
+
+// BenchmarkConsecutiveSearches measures back-to-back searches against an
+// HTTP/2 TLS server with the pooled client and with a connection per request:
+//
+//	go test -run '^$' -bench ConsecutiveSearches
+func BenchmarkConsecutiveSearches(b *testing.B) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, twoItemsResponse)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	b.Cleanup(srv.Close)
+	rootCAs := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	for _, bm := range []struct {
+		name      string
+		keepAlive bool
+	}{
+		{name: "keep-alive", keepAlive: true},
+		{name: "new-connection", keepAlive: false},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			httpClient := newHTTPClient(time.Minute)
+			transport := httpClient.Transport.(*http.Transport)
+			transport.TLSClientConfig.RootCAs = rootCAs
+			transport.DisableKeepAlives = !bm.keepAlive
+			client := &GoogleSearchClient{HTTPClient: httpClient, BaseURL: srv.URL, APIKey: "test-key", EngineID: "test-engine"}
+
+			for b.Loop() {
+				if _, err := client.Search(context.Background(), "чайник", SearchParams{NumResults: searchPageSize, Start: 1}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestNewHTTPClientUsesHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	client := newHTTPClient(time.Minute)
+	client.Transport.(*http.Transport).TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("response protocol = %s, want HTTP/2", resp.Proto)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// shutdownPlan is what main stops on SIGINT or SIGTERM, in this order.
+type shutdownPlan struct {
+	// timeout bounds how long in-flight requests may take to finish.
+	timeout time.Duration
+	// server stops accepting connections and waits for in-flight requests.
+	server  interface{ Shutdown(context.Context) error }
+	metrics *http.Server
+	// stopBackground ends the cache eviction and price alert goroutines.
+	stopBackground func()
+	persistence    CartPersistence
+	// closeStore releases the cart database connection, if there is one.
+	closeStore func() error
+	// cartLock is the lock on the cart file, released last.
+	cartLock *FileLock
+}
+
+// run goes through every phase even when one fails, so a stuck request
+// does not keep the cart from being flushed, and returns the failures.
+func (p shutdownPlan) run() error {
+	var errs []error
+	start := time.Now()
+
+	slog.Info("shutdown: draining in-flight requests", "timeout", p.timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	if err := p.server.Shutdown(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("in-flight requests still running after %s", p.timeout)
+		}
+		slog.Error("shutdown: HTTP server did not stop cleanly", "error", err)
+		errs = append(errs, err)
+	} else {
+		slog.Info("shutdown: HTTP server stopped", "elapsed", time.Since(start))
+	}
+	stopMetricsServer(ctx, p.metrics)
+
+	if p.stopBackground != nil {
+		slog.Info("shutdown: stopping background tasks")
+		p.stopBackground()
+	}
+
+	if p.persistence != nil {
+		slog.Info("shutdown: flushing cart")
+		if err := p.persistence.Save(); err != nil {
+			slog.Error("shutdown: failed to flush cart", "error", err)
+			errs = append(errs, fmt.Errorf("failed to flush cart: %w", err))
+		}
+	}
+
+	if p.closeStore != nil {
+		slog.Info("shutdown: closing cart store")
+		if err := p.closeStore(); err != nil {
+			slog.Error("shutdown: failed to close cart store", "error", err)
+			errs = append(errs, fmt.Errorf("failed to close cart store: %w", err))
+		}
+	}
+
+	if p.cartLock != nil {
+		slog.Info("shutdown: releasing cart file lock")
+		if err := p.cartLock.Unlock(); err != nil {
+			slog.Error("shutdown: failed to release cart file lock", "error", err)
+			errs = append(errs, fmt.Errorf("failed to release cart file lock: %w", err))
+		}
+	}
+
+	err := errors.Join(errs...)
+	slog.Info("shutdown complete", "elapsed", time.Since(start), "clean", err == nil)
+	return err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// countingCartPersistence counts the flushes made through it.
+type countingCartPersistence struct {
+	saves int
+	err   error
+}
+
+func (p *countingCartPersistence) Load() error { return nil }
+
+func (p *countingCartPersistence) Save() error {
+	p.saves++
+	return p.err
+}
+
+// fakeShutdownServer stands in for the HTTP server; drain is how long its
+// in-flight requests take to finish.
+type fakeShutdownServer struct {
+	drain time.Duration
+}
+
+func (s fakeShutdownServer) Shutdown(ctx context.Context) error {
+	select {
+	case <-time.After(s.drain):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestShutdownPlanRun(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		drain     time.Duration
+		saveErr   error
+		wantClean bool
+	}{
+		{name: "requests finish in time", drain: time.Millisecond, wantClean: true},
+		{name: "requests outlive the timeout", drain: time.Minute},
+		{name: "flush fails", drain: time.Millisecond, saveErr: errors.New("disk full")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			persistence := &countingCartPersistence{err: tt.saveErr}
+			var stopped, closed int
+			err := shutdownPlan{
+				timeout:        50 * time.Millisecond,
+				server:         fakeShutdownServer{drain: tt.drain},
+				stopBackground: func() { stopped++ },
+				persistence:    persistence,
+				closeStore: func() error {
+					closed++
+					return nil
+				},
+			}.run()
+
+			if clean := err == nil; clean != tt.wantClean {
+				t.Errorf("run() error = %v, want clean %v", err, tt.wantClean)
+			}
+			if persistence.saves != 1 || stopped != 1 || closed != 1 {
+				t.Errorf("cart flushed %d times, background stopped %d times, store closed %d times, want each once",
+					persistence.saves, stopped, closed)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TLSConfig is read from the TLS_* variables. The server speaks HTTPS when
+// CertFile is set; with CAFile it also checks client certificates (mutual TLS).
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// CAFile holds the PEM certificates client certificates must chain to.
+	CAFile string
+	// ClientAuth makes a client certificate mandatory when CAFile is set;
+	// otherwise clients without one are let in and only presented
+	// certificates are verified.
+	ClientAuth bool
+}
+
+func loadTLSConfig() TLSConfig {
+	cfg := TLSConfig{
+		CertFile:   strings.TrimSpace(os.Getenv("TLS_CERT_FILE")),
+		KeyFile:    strings.TrimSpace(os.Getenv("TLS_KEY_FILE")),
+		CAFile:     strings.TrimSpace(os.Getenv("TLS_CA_FILE")),
+		ClientAuth: true,
+	}
+	if value := os.Getenv("TLS_CLIENT_AUTH"); value != "" {
+		clientAuth, err := strconv.ParseBool(value)
+		if err != nil {
+			slog.Warn("ignoring TLS_CLIENT_AUTH, expected true or false", "value", value)
+		} else {
+			cfg.ClientAuth = clientAuth
+		}
+	}
+	return cfg
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// ServerConfig loads the certificates into a *tls.Config for the HTTP server.
+func (c TLSConfig) ServerConfig() (*tls.Config, error) {
+	if c.KeyFile == "" {
+		return nil, errors.New("TLS_KEY_FILE must be set together with TLS_CERT_FILE")
+	}
+	serverCert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server key pair: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.CAFile == "" {
+		return tlsConfig, nil
+	}
+
+	clientCACert, err := os.ReadFile(c.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA cert: %w", err)
+	}
+	clientCertPool := x509.NewCertPool()
+	if !clientCertPool.AppendCertsFromPEM(clientCACert) {
+		return nil, fmt.Errorf("no PEM certificates found in client CA file %s", c.CAFile)
+	}
+	tlsConfig.ClientCAs = clientCertPool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if c.ClientAuth {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a key pair signed by parent, or self-signed when parent is nil.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write stores the certificate and key as PEM files and returns their paths.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSConfigServerConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	ca := newTestCert(t, "test CA", nil, true)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "server", ca, false).write(t, dir, "server")
+	client := newTestCert(t, "client", ca, false)
+	clientCert := tls.Certificate{Certificate: [][]byte{client.der}, PrivateKey: client.key}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	tests := []struct {
+		name          string
+		cfg           TLSConfig
+		withCert      bool
+		wantConnected bool
+	}{
+		{name: "server TLS only", cfg: TLSConfig{CertFile: certFile, KeyFile: keyFile}, wantConnected: true},
+		{name: "mutual TLS with client cert", cfg: TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: caFile, ClientAuth: true}, withCert: true, wantConnected: true},
+		{name: "mutual TLS without client cert", cfg: TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: caFile, ClientAuth: true}},
+		{name: "optional client cert", cfg: TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: caFile}, wantConnected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tlsConfig, err := tt.cfg.ServerConfig()
+			if err != nil {
+				t.Fatalf("ServerConfig() error = %v", err)
+			}
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			srv.TLS = tlsConfig
+			srv.StartTLS()
+			t.Cleanup(srv.Close)
+
+			clientTLS := &tls.Config{RootCAs: roots}
+			if tt.withCert {
+				clientTLS.Certificates = []tls.Certificate{clientCert}
+			}
+			httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+			resp, err := httpClient.Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if connected := err == nil; connected != tt.wantConnected {
+				t.Errorf("request error = %v, want connected %v", err, tt.wantConnected)
+			}
+		})
+	}
+
+	if _, err := (TLSConfig{CertFile: certFile}).ServerConfig(); err == nil {
+		t.Error("ServerConfig() without TLS_KEY_FILE succeeded, want an error")
+	}
+	if _, err := (TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: keyFile}).ServerConfig(); err == nil {
+		t.Error("ServerConfig() with a CA file holding no certificates succeeded, want an error")
+	}
+}
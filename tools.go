@@ -0,0 +1,1436 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// cartParam and wishlistParam select the cart or wishlist a tool works on.
+var (
+	cartParam = stringParams{
+		Type:        "string",
+		Description: fmt.Sprintf("Имя корзины (по умолчанию %q)", defaultCartName),
+	}
+	wishlistParam = stringParams{
+		Type:        "string",
+		Description: fmt.Sprintf("Имя списка отложенных товаров (по умолчанию %q)", defaultWishlistName),
+	}
+)
+
+// toolHints are the MCP annotations of a tool. Clients use them to decide
+// whether to ask the user before a call, so every tool is registered through
+// addTool with one of the presets below.
+type toolHints struct {
+	readOnly    bool
+	destructive bool
+	idempotent  bool
+	openWorld   bool
+}
+
+var (
+	// readOnlyTool only reads the carts and server state.
+	readOnlyTool = toolHints{readOnly: true, idempotent: true}
+	// webTool is read-only but reaches out to external sites and APIs.
+	webTool = toolHints{readOnly: true, idempotent: true, openWorld: true}
+	// additiveTool adds to the carts; repeating it adds again.
+	additiveTool = toolHints{}
+	// updateTool sets a value; repeating it changes nothing.
+	updateTool = toolHints{idempotent: true}
+	// deleteTool removes or replaces data; repeating it changes nothing.
+	deleteTool = toolHints{destructive: true, idempotent: true}
+	// destructiveTool removes or replaces data and may remove more each time.
+	destructiveTool = toolHints{destructive: true}
+)
+
+// addTool registers tool with the annotations of hints.
+func addTool(s *server.MCPServer, hints toolHints, tool mcp.Tool, handler server.ToolHandlerFunc) {
+	tool.Annotations = mcp.ToolAnnotation{
+		ReadOnlyHint:    mcp.ToBoolPtr(hints.readOnly),
+		DestructiveHint: mcp.ToBoolPtr(hints.destructive),
+		IdempotentHint:  mcp.ToBoolPtr(hints.idempotent),
+		OpenWorldHint:   mcp.ToBoolPtr(hints.openWorld),
+	}
+	s.AddTool(tool, handler)
+}
+
+// RegisterAllTools adds every tool to s. Descriptions quote the limits in
+// cfg, and the cart tools work on the carts of srv.
+func RegisterAllTools(s *server.MCPServer, cfg *Config, srv *Server) {
+	registerSearchProductsTool(s, cfg)
+	registerSuggestQueryTool(s)
+	registerAddToCartTool(s, cfg, srv)
+	registerAddItemsTool(s, cfg, srv)
+	registerBatchAddToCartTool(s, cfg, srv)
+	registerAddResultToCartTool(s, cfg, srv)
+	registerViewCartTool(s, srv)
+	registerSearchCartTool(s, srv)
+	registerGetCartItemTool(s, srv)
+	registerRemoveFromCartTool(s, srv)
+	registerClearCartTool(s, srv)
+	registerCreateCartTool(s, srv)
+	registerListCartsTool(s, srv)
+	registerDeleteCartTool(s, srv)
+	registerMergeCartsTool(s, srv)
+	registerCopyCartTool(s, srv)
+	registerDedupeCartTool(s, srv)
+	registerAddToWishlistTool(s, cfg, srv)
+	registerViewWishlistTool(s)
+	registerCreateWishlistTool(s)
+	registerListWishlistsTool(s)
+	registerRemoveFromWishlistTool(s)
+	registerMoveToCartTool(s, srv)
+	registerMoveToSavedTool(s, srv)
+	registerCheckoutWishlistTool(s, srv)
+	registerViewRemovedTool(s, srv)
+	registerRestoreItemTool(s, srv)
+	registerSetQuantityTool(s, cfg, srv)
+	registerCartTotalTool(s, srv)
+	registerCartSummaryTool(s, srv)
+	registerPruneExpiredTool(s, srv)
+	registerExportCartTool(s, srv)
+	registerImportCartTool(s, srv)
+	registerSnapshotCartTool(s, srv)
+	registerListSnapshotsTool(s)
+	registerRestoreSnapshotTool(s, srv)
+	registerListBackupsTool(s)
+	registerRestoreBackupTool(s, srv)
+	registerListVersionsTool(s, srv)
+	registerRollbackToVersionTool(s, srv)
+	registerDiffCartsTool(s, srv)
+	registerSetItemNoteTool(s, srv)
+	registerTagItemTool(s, srv)
+	registerSetPriorityTool(s, srv)
+	registerSetTargetPriceTool(s, srv)
+	registerListDealsTool(s, srv)
+	registerUndoCartTool(s, cfg, srv)
+	registerSetBudgetTool(s, srv)
+	registerGetBudgetTool(s, srv)
+	registerCartHistoryTool(s, cfg)
+	registerCompareProductsTool(s, srv)
+	registerProductDetailsTool(s)
+	registerSearchHistoryTool(s)
+	registerClearSearchHistoryTool(s)
+	registerLookupProductTool(s)
+	registerSearchByImageURLTool(s, cfg)
+	registerListRecentProductsTool(s, cfg)
+	registerSaveSearchTool(s, cfg)
+	registerListSavedSearchesTool(s)
+	registerRunSavedSearchTool(s)
+	registerDeleteSavedSearchTool(s)
+	registerSetPriceAlertTool(s, srv)
+	registerListPriceAlertsTool(s)
+	registerDeletePriceAlertTool(s)
+	registerServerInfoTool(s, srv)
+}
+
+// cartItemProperties describes one item as passed to add_to_cart.
+func cartItemProperties(cfg *Config) map[string]any {
+	return map[string]any{
+		"item_id": stringParams{
+			Type:        "string",
+			Description: "ID товара из результатов search_products (16 символов из букв, цифр, - и _)",
+		},
+		"title": stringParams{
+			Type:        "string",
+			Description: "Название товара (обязательно для нового товара)",
+		},
+		"link": stringParams{
+			Type:        "string",
+			Description: "Ссылка на товар: абсолютный URL http или https",
+		},
+		"price": stringParams{
+			Type:        "string",
+			Description: "Цена товара, например \"1 299 ₽\"; нераспознанная цена сохраняется, но не входит в итог",
+		},
+		"shop": stringParams{
+			Type:        "string",
+			Description: "Магазин",
+		},
+		"description": stringParams{
+			Type:        "string",
+			Description: fmt.Sprintf("Описание товара (длиннее %d символов обрезается)", cfg.MaxDescriptionLength),
+		},
+		"quantity": integerParams{
+			Type:        "integer",
+			Description: fmt.Sprintf("Количество добавляемых единиц (по умолчанию 1, максимум %d)", cfg.MaxCartQuantity),
+			Default:     1,
+			Minimum:     1,
+			Maximum:     cfg.MaxCartQuantity,
+		},
+	}
+}
+
+// wishlistItemProperties describes one item as passed to add_to_wishlist.
+func wishlistItemProperties(cfg *Config) map[string]any {
+	return withProperty(withProperty(cartItemProperties(cfg), "wishlist", wishlistParam), "cart", stringParams{
+		Type:        "string",
+		Description: fmt.Sprintf("Корзина, в которой ищется товар по item_id (по умолчанию %q)", defaultCartName),
+	})
+}
+
+func registerSearchProductsTool(s *server.MCPServer, cfg *Config) {
+	addTool(s, webTool, mcp.Tool{
+		Name:        "search_products",
+		Description: "Поиск товаров по запросу с использованием Google Custom Search API. Текст запроса, фильтры и уровень SafeSearch отправляются в Google",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"query": queryParams{
+					Type:        "string",
+					Description: "Поисковый запрос для поиска товаров",
+				},
+				"num_results": numResultsParams{
+					Type:        "integer",
+					Description: fmt.Sprintf("Количество результатов поиска (по умолчанию %d, максимум %d). Больше %d результатов загружаются несколькими запросами", searchPageSize, cfg.MaxSearchResults, searchPageSize),
+					Default:     searchPageSize,
+				},
+				"start": integerParams{
+					Type:        "integer",
+					Description: "Номер первого результата (начиная с 1) для постраничного просмотра, например 11 для второй страницы",
+					Default:     1,
+					Minimum:     1,
+				},
+				"min_price": numberParams{
+					Type:        "number",
+					Description: "Минимальная цена товара. Фильтр применяется к полученной странице результатов, поэтому товаров может быть меньше num_results",
+				},
+				"max_price": numberParams{
+					Type:        "number",
+					Description: "Максимальная цена товара. Фильтр применяется к полученной странице результатов, поэтому товаров может быть меньше num_results",
+				},
+				"sort_by": enumParams{
+					Type:        "string",
+					Description: "Порядок результатов: relevance — как вернул поиск, price_asc — сначала дешёвые, price_desc — сначала дорогие (товары без цены в конце). Сортируется только полученная страница",
+					Enum:        searchSortOrders,
+					Default:     "relevance",
+				},
+				"site": stringParams{
+					Type:        "string",
+					Description: "Искать только на указанном сайте, например megamarket.ru",
+				},
+				"category": stringParams{
+					Type:        "string",
+					Description: searchCategoryDescription(cfg),
+				},
+				"include_images": booleanParams{
+					Type:        "boolean",
+					Description: "Добавить к каждому результату ссылку на фото товара, если Google нашёл его на странице",
+					Default:     false,
+				},
+				"adult_content": booleanParams{
+					Type:        "boolean",
+					Description: "Показывать результаты для взрослых (отключить Google SafeSearch). По умолчанию действует настройка сервера GOOGLE_SAFE_SEARCH. Запрос в любом случае передаётся в Google и обрабатывается по его политике конфиденциальности; SafeSearch лишь фильтрует выдачу и не скрывает запрос от Google",
+					Default:     cfg.SafeSearch == safeSearchOff,
+				},
+				"language": enumParams{
+					Type:        "string",
+					Description: "Искать только страницы на указанном языке (код ISO 639-1, например ru)",
+					Enum:        searchLanguageCodes(),
+				},
+				"country": stringParams{
+					Type:        "string",
+					Description: "Отдавать предпочтение результатам из указанной страны (код ISO 3166-1 alpha-2, например ru или kz)",
+				},
+			},
+			Required: []string{"query"},
+		},
+	}, handleSearchProducts)
+}
+
+func registerSuggestQueryTool(s *server.MCPServer) {
+	addTool(s, webTool, mcp.Tool{
+		Name:        "suggest_query",
+		Description: fmt.Sprintf("Подсказать до %d вариантов поискового запроса по его началу (автодополнение Google). Помогает уточнить запрос перед search_products и не расходует квоту поиска", maxQuerySuggestions),
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"prefix": stringParams{
+					Type:        "string",
+					Description: "Начало поискового запроса, например «чайник элек»",
+				},
+			},
+			Required: []string{"prefix"},
+		},
+	}, handleSuggestQuery)
+}
+
+func registerAddToCartTool(s *server.MCPServer, cfg *Config, srv *Server) {
+	addTool(s, additiveTool, mcp.Tool{
+		Name:        "add_to_cart",
+		Description: "Добавить товар из результатов поиска в корзину. Повторное добавление того же item_id увеличивает количество",
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: withProperty(cartItemProperties(cfg), "cart", cartParam),
+			Required:   []string{"item_id"},
+		},
+	}, srv.handleAddToCart)
+}
+
+func registerAddItemsTool(s *server.MCPServer, cfg *Config, srv *Server) {
+	addTool(s, additiveTool, mcp.Tool{
+		Name:        "add_items",
+		Description: fmt.Sprintf("Добавить в корзину сразу несколько товаров (до %d) одной операцией. Если хотя бы один товар некорректен, не добавляется ничего", maxBatchItems),
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"items": arrayParams{
+					Type:        "array",
+					Description: "Товары с теми же полями, что и у add_to_cart",
+					Items: objectParams{
+						Type:       "object",
+						Properties: cartItemProperties(cfg),
+						Required:   []string{"item_id"},
+					},
+					MinItems: 1,
+					MaxItems: maxBatchItems,
+				},
+			},
+			Required: []string{"items"},
+		},
+	}, srv.handleAddItems)
+}
+
+func registerBatchAddToCartTool(s *server.MCPServer, cfg *Config, srv *Server) {
+	addTool(s, additiveTool, mcp.Tool{
+		Name:        "batch_add_to_cart",
+		Description: fmt.Sprintf("Добавить в корзину сразу несколько товаров (до %d) за один вызов. Каждый товар добавляется отдельно: некорректные пропускаются, а в ответе перечислены добавленные и не добавленные товары с причинами", maxBatchItems),
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"items": arrayParams{
+					Type:        "array",
+					Description: "Товары с теми же полями, что и у add_to_cart: item_id, title, link, price, shop, description и необязательный quantity",
+					Items: objectParams{
+						Type:       "object",
+						Properties: cartItemProperties(cfg),
+						Required:   []string{"item_id"},
+					},
+					MinItems: 1,
+					MaxItems: maxBatchItems,
+				},
+			},
+			Required: []string{"items"},
+		},
+	}, srv.handleBatchAddToCart)
+}
+
+func registerAddResultToCartTool(s *server.MCPServer, cfg *Config, srv *Server) {
+	addTool(s, additiveTool, mcp.Tool{
+		Name:        "add_result_to_cart",
+		Description: "Добавить товар в корзину по его номеру в результатах последнего search_products. Данные товара копируются без изменений",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"result_index": integerParams{
+					Type:        "integer",
+					Description: "Номер товара в результатах последнего поиска (начиная с 1)",
+					Minimum:     1,
+				},
+				"quantity": integerParams{
+					Type:        "integer",
+					Description: "Количество единиц товара (по умолчанию 1)",
+					Default:     1,
+					Minimum:     1,
+					Maximum:     cfg.MaxCartQuantity,
+				},
+			},
+			Required: []string{"result_index"},
+		},
+	}, srv.handleAddResultToCart)
+}
+
+func registerViewCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "view_cart",
+		Description: "Посмотреть содержимое корзины",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"sort": enumParams{
+					Type:        "string",
+					Description: "Порядок товаров: added — по времени добавления, title — по названию, price — по цене (без цены в конце), quantity — по количеству, priority — сначала важные",
+					Enum:        cartSortOrders,
+					Default:     "added",
+				},
+				"group_by_shop": booleanParams{
+					Type:        "boolean",
+					Description: "Сгруппировать товары по магазинам с количеством и суммой по каждому магазину",
+					Default:     false,
+				},
+				"shop": stringParams{
+					Type:        "string",
+					Description: "Показать только товары магазина (поиск подстроки без учёта регистра, например citilink)",
+				},
+				"title_contains": stringParams{
+					Type:        "string",
+					Description: "Показать только товары, в названии которых есть эта подстрока (без учёта регистра)",
+				},
+				"tag": stringParams{
+					Type:        "string",
+					Description: "Показать только товары с этим тегом",
+				},
+				"page": integerParams{
+					Type:        "integer",
+					Description: "Номер страницы (по умолчанию 1)",
+					Default:     1,
+					Minimum:     1,
+				},
+				"page_size": integerParams{
+					Type:        "integer",
+					Description: fmt.Sprintf("Количество позиций на странице (по умолчанию %d, максимум %d)", defaultCartPageSize, maxCartPageSize),
+					Default:     defaultCartPageSize,
+					Minimum:     1,
+					Maximum:     maxCartPageSize,
+				},
+			},
+		},
+	}, srv.handleViewCart)
+}
+
+func registerSearchCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "search_cart",
+		Description: "Найти товары, уже лежащие в корзине, по названию, описанию, магазину или тегу. Полезно перед добавлением, чтобы не купить одно и то же дважды",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"query": queryParams{
+					Type:        "string",
+					Description: "Текст для поиска (без учёта регистра)",
+				},
+			},
+			Required: []string{"query"},
+		},
+	}, srv.handleSearchCart)
+}
+
+func registerGetCartItemTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "get_cart_item",
+		Description: "Показать все сохранённые данные одного товара из корзины: ссылку, цену, заметку, теги и время добавления",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара в корзине",
+				},
+			},
+			Required: []string{"item_id"},
+		},
+	}, srv.handleGetCartItem)
+}
+
+func registerRemoveFromCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, destructiveTool, mcp.Tool{
+		Name:        "remove_from_cart",
+		Description: "Удалить товар из корзины. По умолчанию удаляется одна единица; если количество становится нулевым, товар удаляется полностью",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара в корзине",
+				},
+				"quantity": integerParams{
+					Type:        "integer",
+					Description: "Сколько единиц удалить (по умолчанию 1). Если больше, чем есть в корзине, товар удаляется полностью",
+					Default:     1,
+					Minimum:     1,
+				},
+				"all": booleanParams{
+					Type:        "boolean",
+					Description: "Удалить товар полностью независимо от количества",
+					Default:     false,
+				},
+			},
+			Required: []string{"item_id"},
+		},
+	}, srv.handleRemoveFromCart)
+}
+
+func registerClearCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "clear_cart",
+		Description: "Полностью очистить корзину. Без confirm=true только показывает, что будет удалено",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"confirm": booleanParams{
+					Type:        "boolean",
+					Description: "Подтверждение очистки корзины, должно быть true",
+					Default:     false,
+				},
+			},
+		},
+	}, srv.handleClearCart)
+}
+
+func registerCreateCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "create_cart",
+		Description: fmt.Sprintf("Создать новую именованную корзину, например для дома и для офиса. Корзина %q существует всегда", defaultCartName),
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"name": stringParams{
+					Type:        "string",
+					Description: fmt.Sprintf("Имя корзины: до %d букв, цифр, пробелов, - и _", maxCartNameLength),
+				},
+			},
+			Required: []string{"name"},
+		},
+	}, srv.handleCreateCart)
+}
+
+func registerListCartsTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "list_carts",
+		Description: "Показать все корзины с количеством товаров в каждой. Корзины-шаблоны можно копировать через copy_cart",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+		},
+	}, srv.handleListCarts)
+}
+
+func registerDeleteCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "delete_cart",
+		Description: "Удалить именованную корзину. Непустая корзина удаляется только с confirm=true",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"name": stringParams{
+					Type:        "string",
+					Description: "Имя корзины",
+				},
+				"confirm": booleanParams{
+					Type:        "boolean",
+					Description: "Подтверждение удаления непустой корзины",
+					Default:     false,
+				},
+			},
+			Required: []string{"name"},
+		},
+	}, srv.handleDeleteCart)
+}
+
+func registerMergeCartsTool(s *server.MCPServer, srv *Server) {
+	addTool(s, destructiveTool, mcp.Tool{
+		Name:        "merge_carts",
+		Description: "Перенести все товары из одной корзины в другую. Количество одинаковых товаров складывается, цена берётся более свежая, заметки объединяются",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"source": stringParams{
+					Type:        "string",
+					Description: "Имя корзины, из которой переносятся товары",
+				},
+				"target": stringParams{
+					Type:        "string",
+					Description: "Имя корзины, в которую переносятся товары",
+				},
+				"keep_source": booleanParams{
+					Type:        "boolean",
+					Description: "Оставить товары в исходной корзине (скопировать вместо переноса)",
+					Default:     false,
+				},
+			},
+			Required: []string{"source", "target"},
+		},
+	}, srv.handleMergeCarts)
+}
+
+func registerCopyCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, additiveTool, mcp.Tool{
+		Name:        "copy_cart",
+		Description: "Создать копию корзины со всеми товарами, количествами, заметками и тегами, например из корзины-шаблона для регулярных покупок. Исходная корзина не меняется",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"source": stringParams{
+					Type:        "string",
+					Description: "Имя копируемой корзины",
+				},
+				"name": stringParams{
+					Type:        "string",
+					Description: fmt.Sprintf("Имя новой корзины: до %d букв, цифр, пробелов, - и _", maxCartNameLength),
+				},
+				"overwrite": booleanParams{
+					Type:        "boolean",
+					Description: "Заменить содержимое, если корзина с таким именем уже существует",
+					Default:     false,
+				},
+			},
+			Required: []string{"source", "name"},
+		},
+	}, srv.handleCopyCart)
+}
+
+func registerDedupeCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "dedupe_cart",
+		Description: "Объединить строки корзины, которые ведут на один и тот же товар по разным ссылкам (метки utm_*, yclid, gclid, http/https, слэш в конце). Количество складывается, изменение можно отменить через undo_cart",
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]any{"cart": cartParam},
+		},
+	}, srv.handleDedupeCart)
+}
+
+// registerAddToWishlistTool registers add_to_wishlist and save_for_later,
+// its older name for the default wishlist.
+func registerAddToWishlistTool(s *server.MCPServer, cfg *Config, srv *Server) {
+	for _, tool := range []struct{ name, description string }{
+		{"add_to_wishlist", "Добавить товар в список отложенных (например «подарки» или «после зарплаты»): по item_id товара из корзины (корзина не меняется) или по полному описанию, как у add_to_cart. Отложенные товары не учитываются в стоимости и лимитах корзины"},
+		{"save_for_later", "То же, что add_to_wishlist: отложить товар на потом, по умолчанию в список «default»"},
+	} {
+		addTool(s, additiveTool, mcp.Tool{
+			Name:        tool.name,
+			Description: tool.description,
+			InputSchema: mcp.ToolInputSchema{
+				Type:       "object",
+				Properties: wishlistItemProperties(cfg),
+				Required:   []string{"item_id"},
+			},
+		}, srv.handleAddToWishlist)
+	}
+}
+
+// registerViewWishlistTool registers view_wishlist and view_saved, its older
+// name for the default wishlist.
+func registerViewWishlistTool(s *server.MCPServer) {
+	for _, tool := range []struct{ name, description string }{
+		{"view_wishlist", "Показать товары списка отложенных"},
+		{"view_saved", "То же, что view_wishlist: показать отложенные товары, по умолчанию из списка «default»"},
+	} {
+		addTool(s, readOnlyTool, mcp.Tool{
+			Name:        tool.name,
+			Description: tool.description,
+			InputSchema: mcp.ToolInputSchema{
+				Type:       "object",
+				Properties: map[string]any{"wishlist": wishlistParam},
+			},
+		}, handleViewWishlist)
+	}
+}
+
+func registerCreateWishlistTool(s *server.MCPServer) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "create_wishlist",
+		Description: fmt.Sprintf("Создать новый именованный список отложенных товаров. Список %q существует всегда", defaultWishlistName),
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"name": stringParams{
+					Type:        "string",
+					Description: fmt.Sprintf("Имя списка: до %d букв, цифр, пробелов, - и _", maxCartNameLength),
+				},
+			},
+			Required: []string{"name"},
+		},
+	}, handleCreateWishlist)
+}
+
+func registerListWishlistsTool(s *server.MCPServer) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "list_wishlists",
+		Description: "Показать все списки отложенных товаров с количеством товаров в каждом",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+		},
+	}, handleListWishlists)
+}
+
+func registerRemoveFromWishlistTool(s *server.MCPServer) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "remove_from_wishlist",
+		Description: "Удалить товар из списка отложенных",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID отложенного товара",
+				},
+				"wishlist": wishlistParam,
+			},
+			Required: []string{"item_id"},
+		},
+	}, handleRemoveFromWishlist)
+}
+
+func registerMoveToCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, destructiveTool, mcp.Tool{
+		Name:        "move_to_cart",
+		Description: "Перенести отложенный товар в корзину вместе с количеством, заметкой и тегами",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID отложенного товара",
+				},
+				"wishlist": wishlistParam,
+				"cart":     cartParam,
+			},
+			Required: []string{"item_id"},
+		},
+	}, srv.handleMoveToCart)
+}
+
+func registerCheckoutWishlistTool(s *server.MCPServer, srv *Server) {
+	addTool(s, destructiveTool, mcp.Tool{
+		Name:        "checkout_wishlist",
+		Description: "Перенести в корзину все товары списка отложенных с их количеством и очистить список. Товары, которые не помещаются в корзину, остаются в списке. В ответе — перенесённые товары и новый итог корзины",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"wishlist": wishlistParam,
+				"wishlist_name": stringParams{
+					Type:        "string",
+					Description: "То же, что wishlist",
+				},
+				"cart": cartParam,
+			},
+		},
+	}, srv.handleCheckoutWishlist)
+}
+
+func registerMoveToSavedTool(s *server.MCPServer, srv *Server) {
+	addTool(s, destructiveTool, mcp.Tool{
+		Name:        "move_to_saved",
+		Description: "Перенести товар из корзины в отложенные вместе с количеством, заметкой и тегами",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара в корзине",
+				},
+				"cart":     cartParam,
+				"wishlist": wishlistParam,
+			},
+			Required: []string{"item_id"},
+		},
+	}, srv.handleMoveToSaved)
+}
+
+func registerViewRemovedTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "view_removed",
+		Description: fmt.Sprintf("Показать недавно удалённые из корзины товары (до %d), которые можно вернуть через restore_item", maxTrashItems),
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]any{"cart": cartParam},
+		},
+	}, srv.handleViewRemoved)
+}
+
+func registerRestoreItemTool(s *server.MCPServer, srv *Server) {
+	addTool(s, additiveTool, mcp.Tool{
+		Name:        "restore_item",
+		Description: "Вернуть недавно удалённый товар в корзину с прежним количеством, заметкой и тегами",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID удалённого товара из view_removed",
+				},
+			},
+			Required: []string{"item_id"},
+		},
+	}, srv.handleRestoreItem)
+}
+
+func registerSetQuantityTool(s *server.MCPServer, cfg *Config, srv *Server) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "set_quantity",
+		Description: "Установить точное количество товара в корзине. Количество 0 удаляет товар",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара в корзине",
+				},
+				"quantity": integerParams{
+					Type:        "integer",
+					Description: fmt.Sprintf("Новое количество товара (от 0 до %d)", cfg.MaxCartQuantity),
+					Maximum:     cfg.MaxCartQuantity,
+				},
+			},
+			Required: []string{"item_id", "quantity"},
+		},
+	}, srv.handleSetQuantity)
+}
+
+func registerCartTotalTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "cart_total",
+		Description: "Рассчитать стоимость корзины: сумма по каждой позиции (цена × количество) и общий итог. Позиции с нераспознанной ценой перечисляются отдельно, устаревшие (см. CART_ITEM_TTL) по умолчанию не учитываются",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"include_expired": booleanParams{
+					Type:        "boolean",
+					Description: "Учитывать в итоге устаревшие позиции",
+					Default:     false,
+				},
+			},
+		},
+	}, srv.handleCartTotal)
+}
+
+func registerPruneExpiredTool(s *server.MCPServer, srv *Server) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "prune_expired",
+		Description: "Удалить из корзины устаревшие товары — те, что не обновлялись дольше срока CART_ITEM_TTL и чьи цены могли измениться. Удалённые товары можно вернуть через restore_item или undo_cart",
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]any{"cart": cartParam},
+		},
+	}, srv.handlePruneExpired)
+}
+
+func registerCartSummaryTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "cart_summary",
+		Description: "Сводка корзины по магазинам: число позиций, товаров и сумма по каждому магазину (сначала самые дорогие) и общий итог. Помогает решить, стоит ли отдельная доставка из магазина",
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]any{"cart": cartParam},
+		},
+	}, srv.handleCartSummary)
+}
+
+func registerExportCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name: "export_cart",
+		Description: "Выгрузить корзину целиком как файл (встроенный ресурс в base64): JSON для обработки внешними скриптами, CSV для таблиц или Markdown-таблицу для чатов. " +
+			"JSON — объект с полями schema_version, cart, exported_at, unique_items, total_quantity, totals, unpriced_items и items; items — массив товаров корзины " +
+			"(id, title, link, price, price_amount, price_currency, price_parsed, shop, description, quantity, note, tags, priority, target_price, target_currency, added_at, updated_at), для пустой корзины — пустой массив",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"format": enumParams{
+					Type:        "string",
+					Description: "Формат выгрузки: json, csv (колонки id, title, shop, price, quantity, link) или markdown",
+					Enum:        cartExportFormats,
+					Default:     "json",
+				},
+			},
+		},
+	}, srv.handleExportCart)
+}
+
+func registerImportCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, destructiveTool, mcp.Tool{
+		Name:        "import_cart",
+		Description: "Загрузить товары в корзину из JSON в формате export_cart (или из массива товаров), обычного или в base64. Документ не больше 1 МБ. Некорректные позиции перечисляются с их номером",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"data": stringParams{
+					Type:        "string",
+					Description: "JSON-документ, как его возвращает export_cart с format=json, или он же в base64",
+				},
+				"mode": enumParams{
+					Type:        "string",
+					Description: "merge — добавить к текущей корзине, складывая количество одинаковых товаров; replace — сначала очистить корзину",
+					Enum:        cartImportModes,
+					Default:     "merge",
+				},
+				"strict": booleanParams{
+					Type:        "boolean",
+					Description: "Прервать импорт, если хотя бы одна позиция некорректна. По умолчанию некорректные позиции пропускаются",
+					Default:     false,
+				},
+				"cart": cartParam,
+			},
+			Required: []string{"data"},
+		},
+	}, srv.handleImportCart)
+}
+
+func registerSnapshotCartTool(s *server.MCPServer, srv *Server) {
+	addTool(s, additiveTool, mcp.Tool{
+		Name:        "snapshot_cart",
+		Description: fmt.Sprintf("Сохранить снимок корзины, чтобы потом вернуть её к этому состоянию через restore_snapshot. Хранится до %d снимков, самые старые удаляются", maxCartSnapshots),
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"name": stringParams{
+					Type:        "string",
+					Description: fmt.Sprintf("Уникальное имя снимка (до %d символов)", maxSnapshotNameLength),
+				},
+				"description": stringParams{
+					Type:        "string",
+					Description: fmt.Sprintf("Необязательное описание снимка (до %d символов)", maxSnapshotDescLength),
+				},
+				"cart": cartParam,
+			},
+			Required: []string{"name"},
+		},
+	}, srv.handleSnapshotCart)
+}
+
+func registerListSnapshotsTool(s *server.MCPServer) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "list_snapshots",
+		Description: "Показать сохранённые снимки корзины с временем создания и описанием",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+		},
+	}, handleListSnapshots)
+}
+
+func registerRestoreSnapshotTool(s *server.MCPServer, srv *Server) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "restore_snapshot",
+		Description: "Заменить содержимое корзины снимком и показать, какие товары добавились, удалились или изменили количество",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"name": stringParams{
+					Type:        "string",
+					Description: "Имя снимка",
+				},
+				"cart": stringParams{
+					Type:        "string",
+					Description: "Имя корзины, в которую восстановить снимок (по умолчанию та, с которой он снят)",
+				},
+			},
+			Required: []string{"name"},
+		},
+	}, srv.handleRestoreSnapshot)
+}
+
+func registerListBackupsTool(s *server.MCPServer) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "list_backups",
+		Description: "Показать резервные копии всех корзин: они создаются перед clear_cart, import_cart с mode=replace, restore_snapshot и rollback_to_version, а также по расписанию",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+		},
+	}, handleListBackups)
+}
+
+func registerRestoreBackupTool(s *server.MCPServer, srv *Server) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "restore_backup",
+		Description: "Заменить все корзины, снимки и бюджеты содержимым резервной копии. Текущее состояние перед этим тоже сохраняется в копию",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"name": stringParams{
+					Type:        "string",
+					Description: "Имя файла резервной копии из list_backups, например cart-20250101-120000.000-clear_cart.json",
+				},
+			},
+			Required: []string{"name"},
+		},
+	}, srv.handleRestoreBackup)
+}
+
+func registerListVersionsTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "list_versions",
+		Description: "Показать версии корзины: они сохраняются автоматически по мере её изменения, чтобы вернуть корзину к состоянию на определённый момент через rollback_to_version",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+			},
+		},
+	}, srv.handleListVersions)
+}
+
+func registerRollbackToVersionTool(s *server.MCPServer, srv *Server) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "rollback_to_version",
+		Description: "Вернуть корзину к сохранённой версии: по номеру из list_versions или к состоянию на время ago назад. Результат сохраняется новой версией, поэтому откат тоже можно отменить",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"version": integerParams{
+					Type:        "integer",
+					Description: "Номер версии из list_versions",
+					Minimum:     1,
+				},
+				"ago": stringParams{
+					Type:        "string",
+					Description: "Насколько давнее состояние вернуть, например 30m или 2h: берётся последняя версия не новее этого момента. Указывается вместо version",
+				},
+			},
+		},
+	}, srv.handleRollbackToVersion)
+}
+
+func registerDiffCartsTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "diff_carts",
+		Description: "Сравнить две корзины или снимки: какие товары добавлены, удалены и у каких изменились количество, цена или заметка",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"a": stringParams{
+					Type:        "string",
+					Description: "Исходное состояние: имя корзины или снимка. Префиксы cart: и snapshot: убирают неоднозначность",
+				},
+				"b": stringParams{
+					Type:        "string",
+					Description: "Новое состояние: имя корзины или снимка. Префиксы cart: и snapshot: убирают неоднозначность",
+				},
+			},
+			Required: []string{"a", "b"},
+		},
+	}, srv.handleDiffCarts)
+}
+
+func registerSetItemNoteTool(s *server.MCPServer, srv *Server) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "set_item_note",
+		Description: "Добавить заметку к товару в корзине, например «проверить таблицу размеров». Пустая заметка удаляет существующую",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара в корзине",
+				},
+				"note": stringParams{
+					Type:        "string",
+					Description: fmt.Sprintf("Текст заметки (до %d символов), пустая строка удаляет заметку", maxNoteLength),
+				},
+			},
+			Required: []string{"item_id", "note"},
+		},
+	}, srv.handleSetItemNote)
+}
+
+func registerTagItemTool(s *server.MCPServer, srv *Server) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "tag_item",
+		Description: "Добавить или снять тег у товара в корзине (например «подарок», «дача», «срочно»). В ответе перечислены все используемые теги",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара в корзине",
+				},
+				"tag": stringParams{
+					Type:        "string",
+					Description: "Тег; приводится к нижнему регистру, пробелы по краям удаляются",
+				},
+				"remove": booleanParams{
+					Type:        "boolean",
+					Description: "Снять тег вместо добавления",
+					Default:     false,
+				},
+			},
+			Required: []string{"item_id", "tag"},
+		},
+	}, srv.handleTagItem)
+}
+
+func registerSetPriorityTool(s *server.MCPServer, srv *Server) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "set_priority",
+		Description: "Установить приоритет товара в корзине: high — обязательно купить, normal — обычный, low — по возможности",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"cart": cartParam,
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара в корзине",
+				},
+				"priority": enumParams{
+					Type:        "string",
+					Description: "Приоритет товара",
+					Enum:        priorities,
+				},
+			},
+			Required: []string{"item_id", "priority"},
+		},
+	}, srv.handleSetPriority)
+}
+
+func registerSetTargetPriceTool(s *server.MCPServer, srv *Server) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "set_target_price",
+		Description: "Задать цену, по которой вы готовы купить товар. Когда текущая цена не выше целевой, view_cart отмечает товар, а list_deals его показывает. Цена 0 снимает цель",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара в корзине",
+				},
+				"price": stringParams{
+					Type:        "string",
+					Description: "Целевая цена, например \"9 990 ₽\" или \"120 USD\". Без валюты используется валюта текущей цены",
+				},
+				"cart": cartParam,
+			},
+			Required: []string{"item_id", "price"},
+		},
+	}, srv.handleSetTargetPrice)
+}
+
+func registerListDealsTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "list_deals",
+		Description: "Показать товары корзины, текущая цена которых достигла целевой (set_target_price), и товары, цену которых не удалось сравнить",
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]any{"cart": cartParam},
+		},
+	}, srv.handleListDeals)
+}
+
+func registerUndoCartTool(s *server.MCPServer, cfg *Config, srv *Server) {
+	addTool(s, destructiveTool, mcp.Tool{
+		Name:        "undo_cart",
+		Description: fmt.Sprintf("Отменить последнее изменение корзины (добавление, удаление, изменение количества или очистку). Хранится до %d последних изменений", cfg.UndoJournalSize),
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]any{"cart": cartParam},
+		},
+	}, srv.handleUndoCart)
+}
+
+func registerSetBudgetTool(s *server.MCPServer, srv *Server) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "set_budget",
+		Description: "Задать бюджет корзины. view_cart и cart_total показывают остаток или превышение, add_to_cart предупреждает о выходе за бюджет. Сумма 0 снимает бюджет",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"amount": numberParams{
+					Type:        "number",
+					Description: "Сумма бюджета, 0 — снять бюджет",
+				},
+				"currency": stringParams{
+					Type:        "string",
+					Description: "Валюта бюджета (по умолчанию RUB)",
+				},
+				"cart": cartParam,
+			},
+			Required: []string{"amount"},
+		},
+	}, srv.handleSetBudget)
+}
+
+func registerGetBudgetTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "get_budget",
+		Description: "Показать бюджет корзины, текущую стоимость и остаток",
+		InputSchema: mcp.ToolInputSchema{
+			Type:       "object",
+			Properties: map[string]any{"cart": cartParam},
+		},
+	}, srv.handleGetBudget)
+}
+
+func registerCartHistoryTool(s *server.MCPServer, cfg *Config) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "cart_history",
+		Description: fmt.Sprintf("Показать журнал изменений корзин: время, инструмент, товар, изменение количества и сессию. Хранится до %d последних изменений", cfg.CartHistorySize),
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "Показать только изменения этого товара",
+				},
+				"limit": integerParams{
+					Type:        "integer",
+					Description: fmt.Sprintf("Сколько последних записей показать (по умолчанию %d)", defaultCartHistoryLimit),
+					Minimum:     1,
+				},
+			},
+		},
+	}, handleCartHistory)
+}
+
+func registerCompareProductsTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "compare_products",
+		Description: "Сравнить два или более товара (из корзины или из недавних результатов поиска) по названию, магазину, цене и описанию",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"item_ids": arrayParams{
+					Type:        "array",
+					Description: "ID товаров для сравнения",
+					Items:       stringParams{Type: "string", Description: "ID товара"},
+					MinItems:    2,
+					MaxItems:    maxCompareItems,
+				},
+			},
+			Required: []string{"item_ids"},
+		},
+	}, srv.handleCompareProducts)
+}
+
+func registerProductDetailsTool(s *server.MCPServer) {
+	addTool(s, webTool, mcp.Tool{
+		Name:        "product_details",
+		Description: "Загрузить страницу товара по ссылке из результатов поиска и извлечь из разметки schema.org название, цену, валюту, наличие, описание, бренд и изображение",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"link": stringParams{
+					Type:        "string",
+					Description: "Ссылка на страницу товара",
+				},
+			},
+			Required: []string{"link"},
+		},
+	}, handleProductDetails)
+}
+
+func registerSearchHistoryTool(s *server.MCPServer) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "search_history",
+		Description: "Показать последние поисковые запросы с временем и количеством результатов. Помогает не повторять одинаковые запросы",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+		},
+	}, handleSearchHistory)
+}
+
+func registerSearchByImageURLTool(s *server.MCPServer, cfg *Config) {
+	addTool(s, webTool, mcp.Tool{
+		Name:        "search_by_image_url",
+		Description: "Найти товары по фотографии: ищет похожие товары по ссылке на изображение через визуальный поиск (например, Google Lens). Результаты можно добавлять в корзину так же, как результаты search_products",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"image_url": stringParams{
+					Type:        "string",
+					Description: "Ссылка на изображение товара (http или https)",
+				},
+				"num_results": numResultsParams{
+					Type:        "integer",
+					Description: fmt.Sprintf("Количество результатов (по умолчанию %d, максимум %d)", searchPageSize, cfg.MaxSearchResults),
+					Default:     searchPageSize,
+				},
+			},
+			Required: []string{"image_url"},
+		},
+	}, handleSearchByImageURL)
+}
+
+func registerLookupProductTool(s *server.MCPServer) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "lookup_product",
+		Description: "Показать полные данные товара из недавних результатов поиска по его ID, даже если товар не добавлен в корзину",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара из результатов search_products",
+				},
+			},
+			Required: []string{"item_id"},
+		},
+	}, handleLookupProduct)
+}
+
+func registerListRecentProductsTool(s *server.MCPServer, cfg *Config) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "list_recent_products",
+		Description: fmt.Sprintf("Показать товары из недавних результатов поиска, начиная с последних найденных или просмотренных. Хранится до %d товаров", cfg.ProductRegistrySize),
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"limit": integerParams{
+					Type:        "integer",
+					Description: fmt.Sprintf("Сколько товаров показать (по умолчанию %d)", defaultRecentProductsLimit),
+					Minimum:     1,
+				},
+			},
+		},
+	}, handleListRecentProducts)
+}
+
+func registerClearSearchHistoryTool(s *server.MCPServer) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "clear_search_history",
+		Description: "Очистить историю поисковых запросов",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+		},
+	}, handleClearSearchHistory)
+}
+
+func registerSaveSearchTool(s *server.MCPServer, cfg *Config) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "save_search",
+		Description: "Сохранить поисковый запрос под именем, чтобы потом повторить его через run_saved_search. Существующее имя перезаписывается",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"name": stringParams{
+					Type:        "string",
+					Description: fmt.Sprintf("Имя сохранённого поиска (до %d символов)", maxSavedSearchNameLength),
+				},
+				"query": queryParams{
+					Type:        "string",
+					Description: "Поисковый запрос",
+				},
+				"num_results": numResultsParams{
+					Type:        "integer",
+					Description: fmt.Sprintf("Количество результатов поиска (по умолчанию %d, максимум %d)", searchPageSize, cfg.MaxSearchResults),
+					Default:     searchPageSize,
+				},
+				"site": stringParams{
+					Type:        "string",
+					Description: "Искать только на указанном сайте, например megamarket.ru",
+				},
+				"min_price": numberParams{
+					Type:        "number",
+					Description: "Минимальная цена товара",
+				},
+				"max_price": numberParams{
+					Type:        "number",
+					Description: "Максимальная цена товара",
+				},
+			},
+			Required: []string{"name", "query"},
+		},
+	}, handleSaveSearch)
+}
+
+func registerListSavedSearchesTool(s *server.MCPServer) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "list_saved_searches",
+		Description: "Показать сохранённые поиски",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+		},
+	}, handleListSavedSearches)
+}
+
+func registerRunSavedSearchTool(s *server.MCPServer) {
+	addTool(s, webTool, mcp.Tool{
+		Name:        "run_saved_search",
+		Description: "Выполнить сохранённый поиск по имени",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"name": stringParams{
+					Type:        "string",
+					Description: "Имя сохранённого поиска",
+				},
+			},
+			Required: []string{"name"},
+		},
+	}, handleRunSavedSearch)
+}
+
+func registerDeleteSavedSearchTool(s *server.MCPServer) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "delete_saved_search",
+		Description: "Удалить сохранённый поиск по имени",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"name": stringParams{
+					Type:        "string",
+					Description: "Имя сохранённого поиска",
+				},
+			},
+			Required: []string{"name"},
+		},
+	}, handleDeleteSavedSearch)
+}
+
+func registerSetPriceAlertTool(s *server.MCPServer, srv *Server) {
+	addTool(s, updateTool, mcp.Tool{
+		Name:        "set_price_alert",
+		Description: "Следить за ценой товара: сервер периодически ищет товар по названию и сообщает в журнале, когда цена опустится до целевой",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара",
+				},
+				"title": stringParams{
+					Type:        "string",
+					Description: "Название товара для поиска. Можно не указывать для товаров из корзины или последних результатов поиска",
+				},
+				"link": stringParams{
+					Type:        "string",
+					Description: "Ссылка на товар. Можно не указывать для товаров из корзины или последних результатов поиска",
+				},
+				"target_price": numberParams{
+					Type:        "number",
+					Description: "Целевая цена: уведомление срабатывает, когда цена станет не выше неё",
+				},
+			},
+			Required: []string{"item_id", "target_price"},
+		},
+	}, srv.handleSetPriceAlert)
+}
+
+func registerListPriceAlertsTool(s *server.MCPServer) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "list_price_alerts",
+		Description: "Показать уведомления о цене и последние найденные цены",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+		},
+	}, handleListPriceAlerts)
+}
+
+func registerDeletePriceAlertTool(s *server.MCPServer) {
+	addTool(s, deleteTool, mcp.Tool{
+		Name:        "delete_price_alert",
+		Description: "Удалить уведомление о цене товара",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+			Properties: map[string]any{
+				"item_id": stringParams{
+					Type:        "string",
+					Description: "ID товара",
+				},
+			},
+			Required: []string{"item_id"},
+		},
+	}, handleDeletePriceAlert)
+}
+
+func registerServerInfoTool(s *server.MCPServer, srv *Server) {
+	addTool(s, readOnlyTool, mcp.Tool{
+		Name:        "server_info",
+		Description: "Информация о сервере: лимиты корзины и текущее заполнение",
+		InputSchema: mcp.ToolInputSchema{
+			Type: "object",
+		},
+	}, srv.handleServerInfo)
+}
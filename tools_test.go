@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type nopCartPersistence struct{}
+
+func (nopCartPersistence) Load() error { return nil }
+func (nopCartPersistence) Save() error { return nil }
+
+func TestRegisterAllTools(t *testing.T) {
+	cfg := *config
+	cfg.MaxCartQuantity = 7
+	s := server.NewMCPServer(serverName, serverVersion, server.WithToolCapabilities(true))
+	RegisterAllTools(s, &cfg, NewServer(NewMemoryCartStore(carts), nopCartPersistence{}))
+
+	response := s.HandleMessage(t.Context(), json.RawMessage(`{"jsonrpc": "2.0", "id": 1, "method": "tools/list"}`))
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("marshal tools/list response: %v", err)
+	}
+	var decoded struct {
+		Result mcp.ListToolsResult `json:"result"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decode tools/list response: %v", err)
+	}
+
+	tools := make(map[string]mcp.Tool)
+	for _, tool := range decoded.Result.Tools {
+		if _, dup := tools[tool.Name]; dup {
+			t.Errorf("tool %s registered twice", tool.Name)
+		}
+		if tool.InputSchema.Type != "object" {
+			t.Errorf("tool %s input schema type = %q, want object", tool.Name, tool.InputSchema.Type)
+		}
+		tools[tool.Name] = tool
+	}
+	for _, name := range []string{"search_products", "add_to_cart", "view_cart", "undo_cart", "server_info"} {
+		if _, ok := tools[name]; !ok {
+			t.Errorf("tool %s is not registered", name)
+		}
+	}
+
+	quantity, _ := json.Marshal(tools["set_quantity"].InputSchema.Properties["quantity"])
+	var param integerParams
+	if err := json.Unmarshal(quantity, &param); err != nil || param.Maximum != cfg.MaxCartQuantity {
+		t.Errorf("set_quantity quantity = %s, want maximum %d from cfg", quantity, cfg.MaxCartQuantity)
+	}
+}
+
+func TestToolAnnotations(t *testing.T) {
+	s := server.NewMCPServer(serverName, serverVersion, server.WithToolCapabilities(true))
+	RegisterAllTools(s, config, NewServer(NewMemoryCartStore(carts), nopCartPersistence{}))
+
+	c, err := client.NewInProcessClient(s)
+	if err != nil {
+		t.Fatalf("NewInProcessClient() error = %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err := c.Start(t.Context()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	var initRequest mcp.InitializeRequest
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{Name: "annotations-test", Version: "1.0.0"}
+	if _, err := c.Initialize(t.Context(), initRequest); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	list, err := c.ListTools(t.Context(), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatalf("ListTools() error = %v", err)
+	}
+
+	tools := make(map[string]mcp.ToolAnnotation)
+	for _, tool := range list.Tools {
+		a := tool.Annotations
+		if a.ReadOnlyHint == nil || a.DestructiveHint == nil || a.IdempotentHint == nil || a.OpenWorldHint == nil {
+			t.Errorf("tool %s has incomplete annotations %+v", tool.Name, a)
+			continue
+		}
+		tools[tool.Name] = a
+	}
+
+	tests := []struct {
+		name                              string
+		readOnly, destructive, idempotent bool
+	}{
+		{name: "search_products", readOnly: true, idempotent: true},
+		{name: "view_cart", readOnly: true, idempotent: true},
+		{name: "clear_cart", destructive: true, idempotent: true},
+		{name: "remove_from_cart", destructive: true},
+		{name: "add_to_cart"},
+		// Setting the quantity to 0 and moving between the cart and a
+		// wishlist remove lines, so clients should confirm them.
+		{name: "set_quantity", destructive: true, idempotent: true},
+		{name: "move_to_saved", destructive: true},
+		{name: "move_to_cart", destructive: true},
+		{name: "checkout_wishlist", destructive: true},
+	}
+	for _, tt := range tests {
+		a, ok := tools[tt.name]
+		if !ok {
+			t.Errorf("tool %s is missing from tools/list", tt.name)
+			continue
+		}
+		if *a.ReadOnlyHint != tt.readOnly || *a.DestructiveHint != tt.destructive || *a.IdempotentHint != tt.idempotent {
+			t.Errorf("%s annotations = readOnly %t, destructive %t, idempotent %t; want %t, %t, %t", tt.name,
+				*a.ReadOnlyHint, *a.DestructiveHint, *a.IdempotentHint, tt.readOnly, tt.destructive, tt.idempotent)
+		}
+	}
+	if !*tools["search_products"].OpenWorldHint || *tools["view_cart"].OpenWorldHint {
+		t.Errorf("openWorldHint should be set for search_products only, not view_cart")
+	}
+}
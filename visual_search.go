@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	defaultVisualSearchProvider = "google_lens"
+	// Google Lens has no public API of its own; SerpApi exposes it.
+	serpAPIURL = "https://serpapi.com/search.json"
+)
+
+// VisualSearchClient finds products that look like the picture at an image
+// URL. Tests replace the global visualSearchClient with one pointing at a
+// fake server.
+type VisualSearchClient interface {
+	SearchByImage(ctx context.Context, imageURL string) (*SearchResponse, error)
+}
+
+var visualSearchClient VisualSearchClient = NewGoogleLensClient(httpClient, "")
+
+// newVisualSearchClient returns the client for VISUAL_SEARCH_PROVIDER.
+func newVisualSearchClient(provider, apiKey string, client *http.Client) (VisualSearchClient, error) {
+	switch provider {
+	case "google_lens":
+		return NewGoogleLensClient(client, apiKey), nil
+	default:
+		return nil, fmt.Errorf("unknown VISUAL_SEARCH_PROVIDER %q, supported providers: google_lens", provider)
+	}
+}
+
+// GoogleLensClient queries Google Lens through the SerpApi google_lens engine.
+type GoogleLensClient struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	APIKey     string
+}
+
+func NewGoogleLensClient(client *http.Client, apiKey string) *GoogleLensClient {
+	return &GoogleLensClient{
+		HTTPClient: client,
+		BaseURL:    serpAPIURL,
+		APIKey:     apiKey,
+	}
+}
+
+// lensResponse is the part of a SerpApi google_lens response we use.
+type lensResponse struct {
+	VisualMatches []struct {
+		Title  string `json:"title"`
+		Link   string `json:"link"`
+		Source string `json:"source"`
+		Price  *struct {
+			Value          string  `json:"value"`
+			ExtractedValue float64 `json:"extracted_value"`
+			Currency       string  `json:"currency"`
+		} `json:"price"`
+	} `json:"visual_matches"`
+	SearchMetadata struct {
+		TotalTimeTaken float64 `json:"total_time_taken"`
+	} `json:"search_metadata"`
+}
+
+func (c *GoogleLensClient) SearchByImage(ctx context.Context, imageURL string) (*SearchResponse, error) {
+	if c.APIKey == "" {
+		return nil, errors.New("visual search is not configured: VISUAL_SEARCH_API_KEY not set")
+	}
+
+	values := url.Values{}
+	values.Add("engine", "google_lens")
+	values.Add("url", imageURL)
+	values.Add("api_key", c.APIKey)
+	requestURL := c.BaseURL + "?" + values.Encode()
+
+	lens, err := withRetry(ctx, func() (*lensResponse, error) {
+		return c.do(ctx, requestURL)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lens.searchResponse(), nil
+}
+
+func (c *GoogleLensClient) do(ctx context.Context, requestURL string) (*lensResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create visual search request: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		// url.Error repeats the request URL, which carries the API key.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("failed to make visual search request: %w", &networkError{err: err})
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &SearchAPIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var lens lensResponse
+	if err := json.NewDecoder(resp.Body).Decode(&lens); err != nil {
+		return nil, fmt.Errorf("failed to decode visual search response: %w", err)
+	}
+	return &lens, nil
+}
+
+// searchResponse converts visual matches to search results, so they are
+// shown, registered and added to the cart like search_products results.
+func (r *lensResponse) searchResponse() *SearchResponse {
+	response := &SearchResponse{}
+	response.SearchInformation.SearchTime = r.SearchMetadata.TotalTimeTaken
+	response.SearchInformation.TotalResults = strconv.Itoa(len(r.VisualMatches))
+	for _, match := range r.VisualMatches {
+		if match.Link == "" {
+			continue
+		}
+		item := SearchItem{
+			Title:       match.Title,
+			Link:        match.Link,
+			DisplayLink: match.Source,
+			Snippet:     match.Source,
+		}
+		if u, err := url.Parse(match.Link); err == nil && u.Host != "" {
+			item.DisplayLink = strings.TrimPrefix(u.Hostname(), "www.")
+		}
+		if match.Price != nil {
+			offers := slices.Grow(item.PageMap.AggregateOffer, 1)[:1]
+			offers[0].LowPrice = match.Price.Value
+			if match.Price.ExtractedValue > 0 {
+				offers[0].LowPrice = strconv.FormatFloat(match.Price.ExtractedValue, 'f', -1, 64)
+			}
+			offers[0].PriceCurrency = match.Price.Currency
+			item.PageMap.AggregateOffer = offers
+		}
+		response.Items = append(response.Items, item)
+	}
+	return response
+}
+
+func handleSearchByImageURL(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, _ := request.Params.Arguments.(map[string]any)
+	imageURL, _ := args["image_url"].(string)
+	imageURL = strings.TrimSpace(imageURL)
+	if !isAbsoluteHTTPURL(imageURL) {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: "image_url parameter is required and must be an absolute http or https URL"},
+			},
+		}, nil
+	}
+
+	numResults := searchPageSize
+	if num, ok := args["num_results"].(float64); ok {
+		numResults = min(max(int(num), 1), config.MaxSearchResults)
+	}
+
+	slog.InfoContext(ctx, "visual search request", "image_url", imageURL)
+	searchResponse, err := visualSearchClient.SearchByImage(ctx, imageURL)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("Visual search failed: %v", err)},
+			},
+		}, nil
+	}
+	if len(searchResponse.Items) > numResults {
+		searchResponse.Items = searchResponse.Items[:numResults]
+	}
+
+	lastSearches.Save(sessionIDFromContext(ctx), searchResponse.Items)
+	productRegistry.Add(searchResponse.Items)
+	searchHistory.Add(SearchHistoryEntry{
+		Query:        "🖼️ " + imageURL,
+		Results:      len(searchResponse.Items),
+		TotalResults: searchResponse.SearchInformation.TotalResults,
+		SearchedAt:   time.Now(),
+	})
+
+	if len(searchResponse.Items) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("🖼️ По изображению %s похожих товаров не найдено\n\n💡 Попробуйте другое фото или опишите товар словами в search_products", imageURL)},
+			},
+		}, nil
+	}
+
+	finalResult := fmt.Sprintf(`🖼️ Результаты поиска по изображению %s
+📊 Найдено: %s совпадений за %.2f секунд
+📋 Показано: %d
+
+%s
+
+💡 Используйте add_result_to_cart с номером товара или add_to_cart с ID товара для добавления в корзину`,
+		imageURL, searchResponse.SearchInformation.TotalResults, searchResponse.SearchInformation.SearchTime,
+		len(searchResponse.Items), formatSearchItems(searchResponse.Items, false))
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: finalResult},
+		},
+	}, nil
+}
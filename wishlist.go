@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// saveForLater copies item into the wishlist.
+func saveForLater(w *Wishlist, item *CartItem) *CartItem {
+	defer wishlistsChanged()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.mergeItemLocked(item).clone()
+}
+
+// removeFromWishlist deletes a whole line from the wishlist.
+func removeFromWishlist(w *Wishlist, itemID string) (*CartItem, bool) {
+	defer wishlistsChanged()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	item, exists := w.Items[itemID]
+	if !exists {
+		return nil, false
+	}
+	delete(w.Items, itemID)
+	return item, true
+}
+
+// moveToSaved moves a whole cart line to the wishlist. Carts are always
+// locked before wishlists.
+func moveToSaved(ctx context.Context, cart *Cart, w *Wishlist, itemID string) (*CartItem, error) {
+	defer wishlistsChanged()
+	cart.mutex.Lock()
+	defer cart.unlock(ctx)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	item, exists := cart.Items[itemID]
+	if !exists {
+		return nil, fmt.Errorf("item %s not found in cart", itemID)
+	}
+	cart.auditLocked("move_to_saved", itemID)
+	delete(cart.Items, itemID)
+	cartRemoveTotal.Inc()
+	return w.mergeItemLocked(item).clone(), nil
+}
+
+// moveToCart moves a wishlist line into the cart, subject to the cart limits.
+func moveToCart(ctx context.Context, cart *Cart, w *Wishlist, itemID string) (*CartItem, error) {
+	defer wishlistsChanged()
+	cart.mutex.Lock()
+	defer cart.unlock(ctx)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	item, exists := w.Items[itemID]
+	if !exists {
+		return nil, fmt.Errorf("item %s not found in saved items", itemID)
+	}
+
+	totalQuantity := 0
+	for _, cartItem := range cart.Items {
+		totalQuantity += cartItem.Quantity
+	}
+	if totalQuantity+item.Quantity > config.MaxCartTotalQuantity {
+		return nil, &CartLimitError{Limit: "total quantity", Max: config.MaxCartTotalQuantity, Current: totalQuantity}
+	}
+	existing, inCart := cart.Items[itemID]
+	if !inCart && len(cart.Items) >= config.MaxCartItems {
+		return nil, &CartLimitError{Limit: "distinct items", Max: config.MaxCartItems, Current: len(cart.Items)}
+	}
+	if inCart && existing.Quantity+item.Quantity > config.MaxCartQuantity {
+		return nil, &CartLimitError{Limit: "quantity per item", Max: config.MaxCartQuantity, Current: existing.Quantity}
+	}
+	if !inCart && item.Quantity > config.MaxCartQuantity {
+		return nil, &CartLimitError{Limit: "quantity per item", Max: config.MaxCartQuantity, Current: 0}
+	}
+
+	cart.auditLocked("move_to_cart", itemID)
+	delete(w.Items, itemID)
+	cartAddTotal.Inc()
+	return cart.mergeItemLocked(item).clone(), nil
+}
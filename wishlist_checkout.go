@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// checkedOutItem is a wishlist line moved into the cart by checkout_wishlist.
+type checkedOutItem struct {
+	Item *CartItem
+	// InCart is the quantity of the line in the cart after the move.
+	InCart int
+}
+
+// failedCheckoutItem is a wishlist line that stayed on the wishlist.
+type failedCheckoutItem struct {
+	Item *CartItem
+	Err  error
+}
+
+// checkoutWishlist moves every line of the wishlist into the cart that fits
+// its limits, in the order the lines were added, and leaves the others on
+// the wishlist. All limits are checked against the cart as the earlier
+// lines left it, and the lines are merged like moveToCart merges them.
+// Carts are always locked before wishlists.
+func checkoutWishlist(ctx context.Context, cart *Cart, w *Wishlist) (moved []checkedOutItem, failed []failedCheckoutItem) {
+	defer wishlistsChanged()
+	cart.mutex.Lock()
+	defer cart.unlock(ctx)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	items := make([]*CartItem, 0, len(w.Items))
+	for _, item := range w.Items {
+		items = append(items, item)
+	}
+	sortCartItems(items, "added")
+
+	totalQuantity := 0
+	for _, item := range cart.Items {
+		totalQuantity += item.Quantity
+	}
+	lines := len(cart.Items)
+	var fit []*CartItem
+	for _, item := range items {
+		inCart := 0
+		existing, exists := cart.Items[item.ID]
+		if exists {
+			inCart = existing.Quantity
+		}
+		var err error
+		switch {
+		case exists && inCart+item.Quantity > config.MaxCartQuantity:
+			err = &CartLimitError{Limit: "quantity per item", Max: config.MaxCartQuantity, Current: inCart}
+		case !exists && item.Quantity > config.MaxCartQuantity:
+			err = &CartLimitError{Limit: "quantity per item", Max: config.MaxCartQuantity, Current: 0}
+		case !exists && lines >= config.MaxCartItems:
+			err = &CartLimitError{Limit: "distinct items", Max: config.MaxCartItems, Current: lines}
+		case totalQuantity+item.Quantity > config.MaxCartTotalQuantity:
+			err = &CartLimitError{Limit: "total quantity", Max: config.MaxCartTotalQuantity, Current: totalQuantity}
+		}
+		if err != nil {
+			failed = append(failed, failedCheckoutItem{Item: item.clone(), Err: err})
+			continue
+		}
+		if !exists {
+			lines++
+		}
+		totalQuantity += item.Quantity
+		fit = append(fit, item)
+	}
+	if len(fit) == 0 {
+		return nil, failed
+	}
+
+	ids := make([]string, 0, len(fit))
+	for _, item := range fit {
+		ids = append(ids, item.ID)
+	}
+	cart.auditLocked("checkout_wishlist", ids...)
+	for _, item := range fit {
+		merged := cart.mergeItemLocked(item)
+		delete(w.Items, item.ID)
+		cartAddTotal.Inc()
+		moved = append(moved, checkedOutItem{Item: item.clone(), InCart: merged.Quantity})
+	}
+	return moved, failed
+}
+
+func (s *Server) handleCheckoutWishlist(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]any)
+	if !ok {
+		args = map[string]any{}
+	}
+	// wishlist_name is accepted as a synonym of the wishlist parameter of
+	// the other wishlist tools.
+	if name, present := args["wishlist_name"]; present && args["wishlist"] == nil {
+		args["wishlist"] = name
+	}
+
+	w, wishlistName, err := wishlistFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+	cartName, err := cartNameFromArgs(args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	if len(w.Snapshot()) == 0 {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: fmt.Sprintf("📌 Список «%s» пуст, переносить в корзину нечего", wishlistName)},
+			},
+		}, nil
+	}
+
+	var checkedOut []checkedOutItem
+	var notMoved []failedCheckoutItem
+	err = s.update(ctx, cartName, func(c *Cart) error {
+		checkedOut, notMoved = checkoutWishlist(ctx, c, w)
+		return nil
+	})
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: true,
+			Content: []mcp.Content{
+				mcp.TextContent{Type: "text", Text: err.Error()},
+			},
+		}, nil
+	}
+
+	moved := make([]string, 0, len(checkedOut))
+	for _, line := range checkedOut {
+		moved = append(moved, fmt.Sprintf("• %s +%d, в корзине: %d (ID: %s)", line.Item.Title, line.Item.Quantity, line.InCart, line.Item.ID))
+	}
+	// Lines that did not fit in the cart stay on the wishlist.
+	failed := make([]string, 0, len(notMoved))
+	for _, line := range notMoved {
+		failed = append(failed, fmt.Sprintf("• %s × %d — %v (ID: %s)", line.Item.Title, line.Item.Quantity, line.Err, line.Item.ID))
+	}
+	items := len(moved) + len(failed)
+	slog.InfoContext(ctx, "wishlist checked out", "wishlist", wishlistName, "cart", cartName, "moved", len(moved), "failed", len(failed))
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "🛒 Перенесено из списка «%s» в корзину%s: %d из %d", wishlistName, cartLabel(cartName), len(moved), items)
+	if len(moved) > 0 {
+		result.WriteString("\n\n" + strings.Join(moved, "\n"))
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(&result, "\n\n❌ Остались в списке: %d\n%s", len(failed), strings.Join(failed, "\n"))
+	}
+	if lines, err := s.store.List(ctx, cartName); err == nil {
+		totals, unpriced := priceTotals(lines)
+		total := "не удалось рассчитать"
+		if len(totals) > 0 {
+			total = formatGroupedTotals(totals)
+		}
+		fmt.Fprintf(&result, "\n\n💰 Итого в корзине: %s", total)
+		if unpriced > 0 {
+			fmt.Fprintf(&result, " (без цены: %d)", unpriced)
+		}
+	}
+	if len(moved) > 0 {
+		result.WriteString(s.budgetWarning(ctx, cartName))
+	}
+
+	return &mcp.CallToolResult{
+		IsError: len(moved) == 0,
+		Content: []mcp.Content{
+			mcp.TextContent{Type: "text", Text: result.String()},
+		},
+	}, nil
+}
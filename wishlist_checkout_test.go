@@ -0,0 +1,166 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestHandleCheckoutWishlist(t *testing.T) {
+	prev := wishlists
+	t.Cleanup(func() { wishlists = prev })
+	wishlists = NewWishlistStore("")
+	gifts, err := wishlists.Create("gifts")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	store := NewMemoryCartStore(newTestCartRegistry("home"))
+	if _, err := store.Add(t.Context(), "home", CartItem{ID: "kettle", Title: "Чайник", Price: "2 990 ₽"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	gifts.load([]*CartItem{
+		{ID: "kettle", Title: "Чайник", Price: "2 990 ₽", Quantity: 1},
+		{ID: "mug", Title: "Кружка", Price: "490 ₽", Quantity: 2},
+		{ID: "spoon", Title: "Ложка", Price: "100 ₽", Quantity: config.MaxCartQuantity + 1},
+	})
+
+	call := func(args map[string]any) (*mcp.CallToolResult, string) {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = args
+		result, err := NewServer(store, nil).handleCheckoutWishlist(t.Context(), request)
+		if err != nil {
+			t.Fatalf("handleCheckoutWishlist() error = %v", err)
+		}
+		return result, toolResultText(result)
+	}
+
+	result, text := call(map[string]any{"wishlist_name": "gifts", "cart": "home"})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", text)
+	}
+	for _, want := range []string{"2 из 3", "Чайник +1, в корзине: 2", "Кружка +2, в корзине: 2", "Остались в списке: 1", "Ложка", "Итого в корзине: 6 960.00 RUB"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("result does not contain %q:\n%s", want, text)
+		}
+	}
+	if ids := gifts.IDs(); len(ids) != 1 || ids[0] != "spoon" {
+		t.Errorf("wishlist after checkout = %v, want only the spoon that did not fit", ids)
+	}
+
+	gifts.load(nil)
+	if result, text := call(map[string]any{"wishlist": "gifts", "cart": "home"}); result.IsError || !strings.Contains(text, "пуст") {
+		t.Errorf("checkout of an empty wishlist = %q, want a note that it is empty", text)
+	}
+	if result, _ := call(map[string]any{"wishlist_name": "missing"}); !result.IsError {
+		t.Error("checkout of a missing wishlist succeeded")
+	}
+}
+
+// TestCheckoutWishlistLimits checks that checkout_wishlist merges lines the
+// cart already holds and keeps the lines that would break a cart limit,
+// counting the lines moved before them.
+func TestCheckoutWishlistLimits(t *testing.T) {
+	prevConfig := config
+	t.Cleanup(func() { config = prevConfig })
+	cfg := *prevConfig
+	cfg.MaxCartQuantity = 10
+	cfg.MaxCartItems = 3
+	cfg.MaxCartTotalQuantity = 15
+	config = &cfg
+
+	added := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		cart      []*CartItem
+		wishlist  []*CartItem
+		wantMoved []string
+		wantError string
+	}{
+		{
+			name:      "merge into an existing line",
+			cart:      []*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 1, Note: "белый", Tags: []string{"кухня"}}},
+			wishlist:  []*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 2, Note: "на дачу", Tags: []string{"подарок"}, Priority: "high", TargetPrice: 2500, TargetCurrency: "RUB"}},
+			wantMoved: []string{"kettle"},
+		},
+		{
+			name:      "quantity per item",
+			cart:      []*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 9}},
+			wishlist:  []*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 2}},
+			wantError: "quantity per item is limited to 10",
+		},
+		{
+			name: "distinct items counts the lines moved before",
+			cart: []*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 1}},
+			wishlist: []*CartItem{
+				{ID: "mug", Title: "Кружка", Quantity: 1, AddedAt: added},
+				{ID: "plate", Title: "Тарелка", Quantity: 1, AddedAt: added.Add(time.Minute)},
+				{ID: "spoon", Title: "Ложка", Quantity: 1, AddedAt: added.Add(2 * time.Minute)},
+			},
+			wantMoved: []string{"mug", "plate"},
+			wantError: "distinct items is limited to 3",
+		},
+		{
+			name: "total quantity counts the lines moved before",
+			cart: []*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 5}},
+			wishlist: []*CartItem{
+				{ID: "mug", Title: "Кружка", Quantity: 8, AddedAt: added},
+				{ID: "plate", Title: "Тарелка", Quantity: 3, AddedAt: added.Add(time.Minute)},
+			},
+			wantMoved: []string{"mug"},
+			wantError: "total quantity is limited to 15",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newTestCartRegistry(defaultCartName)
+			home, _ := registry.Get(defaultCartName)
+			home.load(tt.cart)
+			w := NewWishlist()
+			w.load(tt.wishlist)
+
+			moved, failed := checkoutWishlist(t.Context(), home, w)
+			var movedIDs []string
+			for _, line := range moved {
+				movedIDs = append(movedIDs, line.Item.ID)
+			}
+			if !slices.Equal(movedIDs, tt.wantMoved) {
+				t.Errorf("moved = %v, want %v", movedIDs, tt.wantMoved)
+			}
+			if tt.wantError == "" && len(failed) > 0 {
+				t.Errorf("failed = %v, want none", failed)
+			}
+			if tt.wantError != "" && (len(failed) != 1 || !strings.Contains(failed[0].Err.Error(), tt.wantError)) {
+				t.Errorf("failed = %v, want one line failing with %q", failed, tt.wantError)
+			}
+			for _, line := range failed {
+				if _, ok := w.Get(line.Item.ID); !ok {
+					t.Errorf("%s left the wishlist although it was not moved", line.Item.ID)
+				}
+			}
+			for _, id := range movedIDs {
+				if _, ok := w.Get(id); ok {
+					t.Errorf("%s is still on the wishlist after the move", id)
+				}
+			}
+		})
+	}
+
+	t.Run("merged line keeps the wishlist metadata", func(t *testing.T) {
+		registry := newTestCartRegistry(defaultCartName)
+		home, _ := registry.Get(defaultCartName)
+		home.load([]*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 1, Note: "белый", Tags: []string{"кухня"}}})
+		w := NewWishlist()
+		w.load([]*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 2, Note: "на дачу", Tags: []string{"подарок"}, Priority: "high", TargetPrice: 2500, TargetCurrency: "RUB"}})
+
+		checkoutWishlist(t.Context(), home, w)
+		kettle, _ := home.Get("kettle")
+		if kettle.Quantity != 3 || kettle.Note != "белый; на дачу" || !slices.Equal(kettle.Tags, []string{"кухня", "подарок"}) ||
+			kettle.Priority != "high" || kettle.TargetPrice != 2500 || kettle.TargetCurrency != "RUB" {
+			t.Errorf("kettle after checkout = %+v, want quantity 3 with both notes, both tags, the priority and the target price", kettle)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMoveToCartLimits checks that move_to_cart keeps a wishlist line that
+// would break a cart limit, whether or not the cart already holds it.
+func TestMoveToCartLimits(t *testing.T) {
+	prevConfig := config
+	t.Cleanup(func() { config = prevConfig })
+	cfg := *prevConfig
+	cfg.MaxCartQuantity = 10
+	cfg.MaxCartItems = 2
+	cfg.MaxCartTotalQuantity = 15
+	config = &cfg
+
+	tests := []struct {
+		name       string
+		cart       []*CartItem
+		saved      *CartItem
+		wantInCart int
+		wantError  string
+	}{
+		{
+			name:       "new line",
+			saved:      &CartItem{ID: "kettle", Title: "Чайник", Quantity: 3},
+			wantInCart: 3,
+		},
+		{
+			name:       "merge into an existing line",
+			cart:       []*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 4}},
+			saved:      &CartItem{ID: "kettle", Title: "Чайник", Quantity: 3},
+			wantInCart: 7,
+		},
+		{
+			name:      "new line above the quantity per item",
+			saved:     &CartItem{ID: "kettle", Title: "Чайник", Quantity: 11},
+			wantError: "quantity per item is limited to 10 (currently 0)",
+		},
+		{
+			name:      "existing line above the quantity per item",
+			cart:      []*CartItem{{ID: "kettle", Title: "Чайник", Quantity: 8}},
+			saved:     &CartItem{ID: "kettle", Title: "Чайник", Quantity: 3},
+			wantError: "quantity per item is limited to 10 (currently 8)",
+		},
+		{
+			name:      "distinct items",
+			cart:      []*CartItem{{ID: "mug", Title: "Кружка", Quantity: 1}, {ID: "plate", Title: "Тарелка", Quantity: 1}},
+			saved:     &CartItem{ID: "kettle", Title: "Чайник", Quantity: 1},
+			wantError: "distinct items is limited to 2",
+		},
+		{
+			name:      "total quantity",
+			cart:      []*CartItem{{ID: "mug", Title: "Кружка", Quantity: 10}},
+			saved:     &CartItem{ID: "kettle", Title: "Чайник", Quantity: 6},
+			wantError: "total quantity is limited to 15",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newTestCartRegistry(defaultCartName)
+			home, _ := registry.Get(defaultCartName)
+			home.load(tt.cart)
+			w := NewWishlist()
+			w.load([]*CartItem{tt.saved})
+
+			moved, err := moveToCart(t.Context(), home, w, tt.saved.ID)
+			_, stillSaved := w.Get(tt.saved.ID)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("moveToCart() error = %v, want %q", err, tt.wantError)
+				}
+				if !stillSaved {
+					t.Error("the line left the wishlist although it was not moved")
+				}
+				if item, ok := home.Get(tt.saved.ID); ok && item.Quantity > cfg.MaxCartQuantity {
+					t.Errorf("cart line after a refused move = %d units, above the limit", item.Quantity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("moveToCart() error = %v", err)
+			}
+			if moved.Quantity != tt.wantInCart {
+				t.Errorf("quantity in the cart = %d, want %d", moved.Quantity, tt.wantInCart)
+			}
+			if stillSaved {
+				t.Error("the line is still on the wishlist after the move")
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWishlistName  = "default"
+	defaultWishlistsFile = "wishlists.json"
+)
+
+// Wishlist holds items saved for later. It has the same shape and methods as
+// Cart but is never part of cart totals or cart size limits.
+type Wishlist struct {
+	Cart
+}
+
+func NewWishlist() *Wishlist {
+	return &Wishlist{Cart: Cart{
+		Items: make(map[string]*CartItem),
+		now:   time.Now,
+	}}
+}
+
+// WishlistStore holds the named wishlists and mirrors every change to a JSON
+// file. The default wishlist always exists. An
+// empty path disables persistence.
+type WishlistStore struct {
+	path  string
+	lists map[string]*Wishlist
+	mutex sync.RWMutex
+}
+
+var wishlists = NewWishlistStore("")
+
+func NewWishlistStore(path string) *WishlistStore {
+	return &WishlistStore{
+		path:  path,
+		lists: map[string]*Wishlist{defaultWishlistName: NewWishlist()},
+	}
+}
+
+// wishlistsPath places the wishlists file next to the cart file unless
+// WISHLISTS_FILE points elsewhere.
+func wishlistsPath(cartPath string) string {
+	if path := os.Getenv("WISHLISTS_FILE"); path != "" {
+		return path
+	}
+	if cartPath == "" {
+		cartPath = defaultCartFile
+	}
+	return filepath.Join(filepath.Dir(cartPath), defaultWishlistsFile)
+}
+
+func (s *WishlistStore) Get(name string) (*Wishlist, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	w, ok := s.lists[name]
+	return w, ok
+}
+
+func (s *WishlistStore) Create(name string) (*Wishlist, error) {
+	if err := validateListName("wishlist", name); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.lists[name]; exists {
+		return nil, fmt.Errorf("wishlist %q already exists", name)
+	}
+	w := NewWishlist()
+	s.lists[name] = w
+	return w, nil
+}
+
+// Names returns the wishlist names with the default one first and the rest sorted.
+func (s *WishlistStore) Names() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	names := make([]string, 0, len(s.lists))
+	for name := range s.lists {
+		if name != defaultWishlistName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{defaultWishlistName}, names...)
+}
+
+// Load reads the wishlists file. When it does not exist yet, the default
+// wishlist keeps the items read from the legacy "saved" field of the cart
+// file and they are written out right away, since the cart file no longer
+// stores them.
+func (s *WishlistStore) Load() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		if len(s.lists[defaultWishlistName].Snapshot()) == 0 {
+			return nil
+		}
+		return s.saveLocked()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read wishlists file %s: %w", s.path, err)
+	}
+
+	var named map[string][]*CartItem
+	if err := json.Unmarshal(data, &named); err != nil {
+		return fmt.Errorf("failed to decode wishlists file %s: %w", s.path, err)
+	}
+	defaultList := s.lists[defaultWishlistName]
+	defaultList.load(named[defaultWishlistName])
+	s.lists = map[string]*Wishlist{defaultWishlistName: defaultList}
+	for name, items := range named {
+		if name == defaultWishlistName || validateListName("wishlist", name) != nil {
+			continue
+		}
+		w := NewWishlist()
+		w.load(items)
+		s.lists[name] = w
+	}
+	return nil
+}
+
+// loadLegacy puts the items of the "saved" field of an old cart file into
+// the default wishlist.
+func (s *WishlistStore) loadLegacy(items []*CartItem) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	s.lists[defaultWishlistName].load(items)
+}
+
+func (s *WishlistStore) Save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.saveLocked()
+}
+
+func (s *WishlistStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	named := make(map[string][]*CartItem, len(s.lists))
+	for name, w := range s.lists {
+		named[name] = w.Snapshot()
+	}
+	data, err := json.MarshalIndent(named, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode wishlists: %w", err)
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// wishlistsChanged runs after every wishlist mutation and saves all wishlists.
+func wishlistsChanged() {
+	if err := wishlists.Save(); err != nil {
+		slog.Error("failed to save wishlists", "error", err)
+	}
+}
+
+// wishlistFromArgs resolves the optional wishlist argument of a tool call.
+func wishlistFromArgs(args map[string]any) (*Wishlist, string, error) {
+	name := defaultWishlistName
+	if value, present := args["wishlist"]; present && value != nil {
+		str, ok := value.(string)
+		if !ok {
+			return nil, "", errors.New("wishlist parameter must be a string")
+		}
+		if str = strings.TrimSpace(str); str != "" {
+			name = str
+		}
+	}
+
+	w, ok := wishlists.Get(name)
+	if !ok {
+		return nil, "", fmt.Errorf("wishlist %q does not exist, use list_wishlists to see wishlists or create_wishlist to add one", name)
+	}
+	return w, name, nil
+}